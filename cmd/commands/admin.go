@@ -2,28 +2,49 @@ package commands
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"proxychan/internal/models"
 	"proxychan/internal/system"
+	"time"
 )
 
-func runSetAdminPassword(db *sql.DB) {
-	exists, err := adminPasswordExists(db)
+// set-admin-pwd [name]
+// Kept from the single-password days: creates the account (role admin)
+// if it doesn't exist yet, otherwise rotates its password after checking
+// the current one.
+func runSetAdminPassword(db *sql.DB, username string) {
+	admins, err := system.ListAdmins(db)
 	if err != nil {
 		fatal(
 			models.Wrap(
 				"ADMIN_PWD_CHECK_FAIL",
 				models.ExitExternal,
-				"failed to check admin password status",
+				"failed to check admin accounts",
 				err,
 			),
 		)
 	}
 
-	var current *string
+	exists := false
+	for _, a := range admins {
+		if a.Username == username {
+			exists = true
+		}
+	}
+
 	if exists {
-		pwd := promptPassword("Current admin password")
-		current = &pwd
+		current := promptPassword("Current admin password")
+		if _, err := system.VerifyAdminCredentials(db, username, current); err != nil {
+			fatal(
+				models.Wrap(
+					"ADMIN_PWD_SET_FAIL",
+					models.ExitExternal,
+					"failed to set admin password",
+					err,
+				),
+			)
+		}
 	}
 
 	newPwd := promptPassword("New admin password")
@@ -40,7 +61,12 @@ func runSetAdminPassword(db *sql.DB) {
 		)
 	}
 
-	if err := system.SetOrRotateAdminPassword(db, current, newPwd); err != nil {
+	if exists {
+		err = system.SetAdminPassword(db, system.CLIActor(), username, newPwd)
+	} else {
+		err = system.AddAdmin(db, system.CLIActor(), username, newPwd, system.RoleAdmin)
+	}
+	if err != nil {
 		fatal(
 			models.Wrap(
 				"ADMIN_PWD_SET_FAIL",
@@ -51,20 +77,144 @@ func runSetAdminPassword(db *sql.DB) {
 		)
 	}
 
-	fmt.Println("admin password updated")
+	fmt.Printf("admin password updated for %s\n", username)
+}
+
+func parseRoleOrFatal(s string) system.AdminRole {
+	role, err := system.ParseAdminRole(s)
+	if err != nil {
+		fatal(
+			models.Wrap(
+				"ADMIN_ROLE_INVALID",
+				models.ExitUsage,
+				"invalid admin role",
+				err,
+			).
+				WithHint("use viewer, operator or admin"),
+		)
+	}
+	return role
+}
+
+// add-admin <name> <viewer|operator|admin>
+func runAddAdmin(db *sql.DB, username, roleStr string) {
+	role := parseRoleOrFatal(roleStr)
+	password := readNewPassword()
+
+	if err := system.AddAdmin(db, system.CLIActor(), username, password, role); err != nil {
+		fatal(
+			models.Wrap(
+				"ADMIN_ADD_FAIL",
+				models.ExitRuntime,
+				fmt.Sprintf("failed to add admin %q", username),
+				err,
+			),
+		)
+	}
+
+	fmt.Printf("admin added: %s (%s)\n", username, role)
 }
 
-func adminPasswordExists(db *sql.DB) (bool, error) {
-	var dummy int
-	err := db.QueryRow(
-		`SELECT 1 FROM admin_auth WHERE id = 1`,
-	).Scan(&dummy)
+// del-admin <name>
+func runDeleteAdmin(db *sql.DB, username string) {
+	if err := system.DeleteAdmin(db, system.CLIActor(), username); err != nil {
+		fatal(adminChangeError("ADMIN_DELETE_FAIL", fmt.Sprintf("failed to delete admin %q", username), err))
+	}
+
+	fmt.Println("admin deleted:", username)
+}
 
-	if err == sql.ErrNoRows {
-		return false, nil
+// set-admin-role <name> <viewer|operator|admin>
+func runSetAdminRole(db *sql.DB, username, roleStr string) {
+	role := parseRoleOrFatal(roleStr)
+
+	if err := system.SetAdminRole(db, system.CLIActor(), username, role); err != nil {
+		fatal(adminChangeError("ADMIN_ROLE_FAIL", fmt.Sprintf("failed to set role of admin %q", username), err))
 	}
+
+	fmt.Printf("admin %s is now %s\n", username, role)
+}
+
+// adminChangeError explains the two refusals a user can act on.
+func adminChangeError(code, msg string, err error) error {
+	switch {
+	case errors.Is(err, system.ErrLastAdmin):
+		return models.Wrap(code, models.ExitUsage, msg, err).
+			WithHint("it is the last account with role admin; add or promote another one first")
+	case errors.Is(err, system.ErrAdminNotFound):
+		return models.Wrap(code, models.ExitUsage, msg, err).
+			WithHint("see list-admins")
+	}
+	return models.Wrap(code, models.ExitRuntime, msg, err)
+}
+
+// passwd-admin <name>
+// Like passwd-user: no current password needed, the CLI already has
+// full access to the database.
+func runPasswdAdmin(db *sql.DB, username string) {
+	password := readNewPassword()
+
+	if err := system.SetAdminPassword(db, system.CLIActor(), username, password); err != nil {
+		fatal(
+			models.Wrap(
+				"ADMIN_PASSWD_FAIL",
+				models.ExitRuntime,
+				fmt.Sprintf("failed to change password for admin %q", username),
+				err,
+			),
+		)
+	}
+
+	fmt.Println("admin password changed:", username)
+}
+
+// list-admins
+func runListAdmins(db *sql.DB) {
+	admins, err := system.ListAdmins(db)
 	if err != nil {
-		return false, err
+		fatal(
+			models.Wrap(
+				"ADMIN_LIST_FAIL",
+				models.ExitRuntime,
+				"failed to list admins",
+				err,
+			),
+		)
+	}
+
+	if structuredOutput() {
+		rows := make([][]string, 0, len(admins))
+		for _, a := range admins {
+			rows = append(rows, []string{a.Username, string(a.Role), csvBool(a.TwoFactor), csvTime(a.CreatedAt), csvTime(a.UpdatedAt)})
+		}
+		emit(admins, []string{"username", "role", "two_factor", "created_at", "updated_at"}, rows)
+		return
+	}
+
+	if len(admins) == 0 {
+		fmt.Println("no admin accounts (web interface disabled)")
+		return
+	}
+
+	fmt.Println("ADMIN ACCOUNTS")
+	fmt.Println("----------------------------------------------")
+	for _, a := range admins {
+		twoFA := "2fa off"
+		if a.TwoFactor {
+			twoFA = "2fa on"
+		}
+		fmt.Printf("%-20s %-9s %-8s updated %s\n",
+			a.Username, a.Role, twoFA, a.UpdatedAt.Local().Format(time.RFC3339))
 	}
-	return true, nil
+}
+
+// reset-admin-2fa <name>
+// Lockout recovery: the admin logs in with the password only and can
+// enroll again from the account page.
+func runResetAdmin2FA(db *sql.DB, username string) {
+	if err := system.ResetAdminTOTP(db, system.CLIActor(), username); err != nil {
+		fatal(adminChangeError("ADMIN_2FA_RESET_FAIL", fmt.Sprintf("failed to reset 2fa of admin %q", username), err))
+	}
+
+	fmt.Println("two-factor login removed for admin:", username)
 }
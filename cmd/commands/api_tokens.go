@@ -0,0 +1,109 @@
+package commands
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"proxychan/internal/models"
+	"proxychan/internal/system"
+)
+
+// create-api-token <name> <viewer|operator|admin> [ttl]
+func runCreateAPIToken(db *sql.DB, name, roleArg, ttl string) {
+	role := parseRoleOrFatal(roleArg)
+
+	var d time.Duration
+	if ttl != "" {
+		var err error
+		d, err = system.ParseDuration(ttl)
+		if err != nil {
+			fatal(
+				models.
+					Wrap(
+						"TOKEN_TTL_INVALID",
+						models.ExitUsage,
+						fmt.Sprintf("invalid token lifetime %q", ttl),
+						err,
+					),
+			)
+		}
+	}
+
+	token, err := system.CreateAPIToken(db, system.CLIActor(), name, role, d)
+	if err != nil {
+		fatal(
+			models.
+				Wrap(
+					"TOKEN_CREATE_FAIL",
+					models.ExitRuntime,
+					fmt.Sprintf("failed to create api token %q", name),
+					err,
+				),
+		)
+	}
+
+	fmt.Printf("api token created: %s (%s)\n", name, role)
+	fmt.Println(token)
+	fmt.Println("store it now, it cannot be shown again")
+}
+
+// list-api-tokens
+func runListAPITokens(db *sql.DB) {
+	tokens, err := system.ListAPITokens(db)
+	if err != nil {
+		fatal(
+			models.
+				Wrap(
+					"TOKEN_LIST_FAIL",
+					models.ExitRuntime,
+					"failed to list api tokens",
+					err,
+				),
+		)
+	}
+
+	if structuredOutput() {
+		rows := make([][]string, 0, len(tokens))
+		for _, t := range tokens {
+			rows = append(rows, []string{t.Name, t.Prefix, string(t.Role), csvTime(t.CreatedAt), csvTime(t.ExpiresAt), csvTime(t.LastUsedAt)})
+		}
+		emit(tokens, []string{"name", "prefix", "role", "created_at", "expires_at", "last_used_at"}, rows)
+		return
+	}
+
+	if len(tokens) == 0 {
+		fmt.Println("no api tokens")
+		return
+	}
+
+	fmt.Println("API TOKENS")
+	fmt.Println("----------------------------------------------")
+	for _, t := range tokens {
+		expires, used := "never", "never"
+		if !t.ExpiresAt.IsZero() {
+			expires = t.ExpiresAt.Local().Format(time.RFC3339)
+		}
+		if !t.LastUsedAt.IsZero() {
+			used = t.LastUsedAt.Local().Format(time.RFC3339)
+		}
+		fmt.Printf("%-20s %-8s %s...  expires %s  last used %s\n", t.Name, t.Role, t.Prefix, expires, used)
+	}
+}
+
+// revoke-api-token <name>
+func runRevokeAPIToken(db *sql.DB, name string) {
+	if err := system.RevokeAPIToken(db, system.CLIActor(), name); err != nil {
+		fatal(
+			models.
+				Wrap(
+					"TOKEN_REVOKE_FAIL",
+					models.ExitRuntime,
+					fmt.Sprintf("failed to revoke api token %q", name),
+					err,
+				),
+		)
+	}
+
+	fmt.Println("api token revoked:", name)
+}
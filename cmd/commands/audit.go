@@ -0,0 +1,88 @@
+package commands
+
+import (
+	"database/sql"
+	"fmt"
+
+	"proxychan/internal/models"
+	"proxychan/internal/system"
+)
+
+// audit-log [--actor a] [--action prefix] [--target t] [--since t] [--until t] [--limit n]
+func runAuditLog(db *sql.DB, cfg models.FlagConfig) {
+	since, err := parseHistoryTime(cfg.HistorySince)
+	if err != nil {
+		fatal(
+			models.
+				Wrap("AUDIT_PARSE_FAIL", models.ExitUsage,
+					fmt.Sprintf("invalid --since %q", cfg.HistorySince),
+					err).
+				WithHint("use a date (2026-01-31), RFC3339 time or a duration like 24h"),
+		)
+	}
+	until, err := parseHistoryTime(cfg.HistoryUntil)
+	if err != nil {
+		fatal(
+			models.
+				Wrap("AUDIT_PARSE_FAIL", models.ExitUsage,
+					fmt.Sprintf("invalid --until %q", cfg.HistoryUntil),
+					err).
+				WithHint("use a date (2026-01-31), RFC3339 time or a duration like 24h"),
+		)
+	}
+
+	recs, err := system.QueryAudit(db, system.AuditFilter{
+		Actor:  cfg.AuditActor,
+		Action: cfg.AuditAction,
+		Target: cfg.AuditTarget,
+		Since:  since,
+		Until:  until,
+		Limit:  cfg.HistoryLimit,
+	})
+	if err != nil {
+		fatal(
+			models.
+				Wrap(
+					"AUDIT_QUERY_FAIL",
+					models.ExitRuntime,
+					"failed to query audit log",
+					err,
+				),
+		)
+	}
+
+	if structuredOutput() {
+		rows := make([][]string, 0, len(recs))
+		for _, r := range recs {
+			rows = append(rows, []string{csvInt(r.ID), csvTime(r.At), string(r.Actor), r.Action, r.Target, r.OldValue, r.NewValue})
+		}
+		emit(recs, []string{"id", "at", "actor", "action", "target", "old_value", "new_value"}, rows)
+		return
+	}
+
+	if len(recs) == 0 {
+		fmt.Println("no matching audit records")
+		return
+	}
+
+	for _, r := range recs {
+		fmt.Printf(
+			"%s %-16s %-18s %s",
+			r.At.Local().Format("2006-01-02 15:04:05"),
+			r.Actor,
+			r.Action,
+			r.Target,
+		)
+		if r.OldValue != "" || r.NewValue != "" {
+			fmt.Printf(" [%s -> %s]", orDash(r.OldValue), orDash(r.NewValue))
+		}
+		fmt.Println()
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,220 @@
+package commands
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"proxychan/internal/models"
+	"proxychan/internal/server"
+	"proxychan/internal/system"
+)
+
+// backup <file>
+// Safe while the service runs; the copy is a complete database.
+func runBackup(db *sql.DB, path string) {
+	if err := system.BackupDB(db, path); err != nil {
+		fatal(
+			models.
+				Wrap(
+					"BACKUP_FAIL",
+					models.ExitIO,
+					fmt.Sprintf("failed to back up the database to %s: %v", path, err),
+					err,
+				),
+		)
+	}
+	fmt.Println("backup written to", path)
+}
+
+// restore <file>
+// The current database is kept as <db>.pre-restore-<time>.
+func runRestore(db *sql.DB, path string) {
+	saved, err := system.RestoreDB(db, system.CLIActor(), path)
+	if err != nil {
+		if errors.Is(err, system.ErrInvalidBackup) {
+			fatal(
+				models.
+					Wrap(
+						"RESTORE_INVALID",
+						models.ExitConfig,
+						err.Error(),
+						err,
+					).
+					WithHint("nothing was changed"),
+			)
+		}
+		exit, hint := models.ExitRuntime, "nothing was changed"
+		if errors.Is(err, fs.ErrNotExist) {
+			exit = models.ExitIO
+		}
+		if saved != "" {
+			hint = "the database before the restore is in " + saved
+		}
+		fatal(
+			models.
+				Wrap(
+					"RESTORE_FAIL",
+					exit,
+					fmt.Sprintf("failed to restore %s: %v", path, err),
+					err,
+				).
+				WithHint(hint),
+		)
+	}
+
+	fmt.Println("restored from", path)
+	fmt.Println("previous database saved as", saved)
+	reloadAfterRestore()
+}
+
+// export-db <file|->
+func runExportDB(db *sql.DB, path string) {
+	exp, err := system.ExportDB(db)
+	if err != nil {
+		fatal(models.Wrap("EXPORT_FAIL", models.ExitRuntime, "failed to export the database", err))
+	}
+
+	var out io.Writer = os.Stdout
+	if path != "-" {
+		// the export holds password hashes, like the database itself
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			fatal(
+				models.
+					Wrap(
+						"EXPORT_FAIL",
+						models.ExitIO,
+						fmt.Sprintf("failed to create %s", path),
+						err,
+					).
+					WithHint("the file must not exist yet"),
+			)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(exp); err != nil {
+		fatal(models.Wrap("EXPORT_FAIL", models.ExitIO, "failed to write the export", err))
+	}
+	if path != "-" {
+		fmt.Println("export written to", path)
+	}
+}
+
+// import-db <file|->
+// Replaces the tables in the file; tables it doesn't have are kept.
+func runImportDB(db *sql.DB, path string) {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			fatal(
+				models.
+					Wrap(
+						"IMPORT_READ_FAIL",
+						models.ExitIO,
+						fmt.Sprintf("failed to open %s", path),
+						err,
+					),
+			)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	exp, err := system.ReadDBExport(in)
+	if err != nil {
+		fatalImportDB(path, err)
+	}
+
+	source := path
+	if path == "-" {
+		source = "stdin"
+	}
+	report, err := system.ImportDB(db, system.CLIActor(), source, exp)
+	if err != nil {
+		if report == nil {
+			fatalImportDB(path, err)
+		}
+		fatal(
+			models.
+				Wrap(
+					"IMPORT_FAIL",
+					models.ExitRuntime,
+					fmt.Sprintf("the data was imported, but updating the schema failed: %v", err),
+					err,
+				),
+		)
+	}
+
+	printImportReport(report)
+	reloadAfterRestore()
+}
+
+func fatalImportDB(path string, err error) {
+	if errors.Is(err, system.ErrInvalidExport) {
+		fatal(
+			models.
+				Wrap(
+					"IMPORT_INVALID",
+					models.ExitConfig,
+					err.Error(),
+					err,
+				).
+				WithHint("the file must come from: proxychan export-db"),
+		)
+	}
+	fatal(
+		models.
+			Wrap(
+				"IMPORT_FAIL",
+				models.ExitRuntime,
+				fmt.Sprintf("failed to import %s (nothing was changed): %v", path, err),
+				err,
+			),
+	)
+}
+
+func printImportReport(r *system.DBImportReport) {
+	if structuredOutput() {
+		rows := make([][]string, 0, len(r.Rows))
+		for _, t := range slices.Sorted(maps.Keys(r.Rows)) {
+			rows = append(rows, []string{t, csvInt(int64(r.Rows[t]))})
+		}
+		emit(r, []string{"table", "rows"}, rows)
+		return
+	}
+
+	total := 0
+	for _, t := range slices.Sorted(maps.Keys(r.Rows)) {
+		fmt.Printf("%-24s %d rows\n", t, r.Rows[t])
+		total += r.Rows[t]
+	}
+	fmt.Printf("%d rows imported into %d tables\n", total, len(r.Rows))
+	if len(r.SkippedTables) > 0 {
+		fmt.Println("skipped tables (not in this release):", strings.Join(r.SkippedTables, ", "))
+	}
+	if len(r.SkippedColumns) > 0 {
+		fmt.Println("skipped columns (not in this release):", strings.Join(r.SkippedColumns, ", "))
+	}
+}
+
+// reloadAfterRestore makes a running service pick up the new data now,
+// quotas included. The policy versions already changed, so without a
+// service (or access to it) nothing is lost.
+func reloadAfterRestore() {
+	if _, err := server.ReloadPolicies(); err == nil && !structuredOutput() {
+		fmt.Println("running service reloaded")
+	}
+}
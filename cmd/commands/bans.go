@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"proxychan/internal/models"
+	"proxychan/internal/system"
+)
+
+// list-bans
+func runListBans(db *sql.DB) {
+	bans, err := system.ListBans(db)
+	if err != nil {
+		fatal(
+			models.
+				Wrap(
+					"BAN_LIST_FAIL",
+					models.ExitRuntime,
+					"failed to list bans",
+					err,
+				),
+		)
+	}
+
+	if structuredOutput() {
+		rows := make([][]string, 0, len(bans))
+		for _, b := range bans {
+			rows = append(rows, []string{b.IP, b.Reason, strconv.Itoa(b.Hits), csvTime(b.CreatedAt), csvTime(b.ExpiresAt)})
+		}
+		emit(bans, []string{"ip", "reason", "hits", "created_at", "expires_at"}, rows)
+		return
+	}
+
+	if len(bans) == 0 {
+		fmt.Println("no active bans")
+		return
+	}
+
+	fmt.Println("SOURCE BANS")
+	fmt.Println("----------------------------------------------")
+	for _, b := range bans {
+		fmt.Printf("%-40s until %s  %s\n",
+			b.IP, b.ExpiresAt.Local().Format(time.RFC3339), b.Reason)
+	}
+}
+
+// unban-ip <ip>
+func runUnbanIP(db *sql.DB, ip string) {
+	if err := system.UnbanIP(db, system.CLIActor(), ip); err != nil {
+		fatal(
+			models.
+				Wrap(
+					"BAN_DELETE_FAIL",
+					models.ExitRuntime,
+					fmt.Sprintf("failed to unban %q", ip),
+					err,
+				),
+		)
+	}
+
+	fmt.Printf("ban lifted: %s\n", ip)
+}
@@ -10,7 +10,7 @@ import (
 
 // block-destination
 func runBlockDestination(db *sql.DB, target string) {
-	if err := system.DenyDestination(db, target); err != nil {
+	if err := system.DenyDestination(db, system.CLIActor(), target); err != nil {
 		fatal(
 			models.
 				Wrap("DEST_BLOCK_FAIL", models.ExitRuntime,
@@ -24,7 +24,7 @@ func runBlockDestination(db *sql.DB, target string) {
 
 // allow-destination
 func runAllowDestination(db *sql.DB, target string) {
-	if err := system.AllowDestination(db, target); err != nil {
+	if err := system.AllowDestination(db, system.CLIActor(), target); err != nil {
 		fatal(
 			models.
 				Wrap(
@@ -40,7 +40,7 @@ func runAllowDestination(db *sql.DB, target string) {
 
 // delete-destination
 func runDeleteDestination(db *sql.DB, target string) {
-	if err := system.DeleteDestination(db, target); err != nil {
+	if err := system.DeleteDestination(db, system.CLIActor(), target); err != nil {
 		fmt.Fprintf(os.Stderr, "failed to delete destination rule %q: %v\n", target, err)
 		os.Exit(1)
 	}
@@ -62,6 +62,15 @@ func runListBlacklist(db *sql.DB) {
 		)
 	}
 
+	if structuredOutput() {
+		rows := make([][]string, 0, len(rules))
+		for _, r := range rules {
+			rows = append(rows, []string{r.Pattern, string(r.Type), csvBool(r.Enabled)})
+		}
+		emit(rules, []string{"pattern", "type", "enabled"}, rows)
+		return
+	}
+
 	if len(rules) == 0 {
 		fmt.Println("destination blacklist is empty")
 		return
@@ -79,7 +88,7 @@ func runListBlacklist(db *sql.DB) {
 }
 
 func runClearBlacklist(db *sql.DB) {
-	if err := system.ClearDenylist(db); err != nil {
+	if err := system.ClearDenylist(db, system.CLIActor()); err != nil {
 		fatal(
 			models.
 				Wrap(
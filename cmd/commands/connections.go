@@ -1,10 +1,10 @@
 package commands
 
 import (
-	"database/sql"
 	"fmt"
-	"os"
 	"proxychan/internal/server"
+	"proxychan/internal/system"
+	"strconv"
 	"time"
 )
 
@@ -16,11 +16,30 @@ type ConnView struct {
 	StartedAt   time.Time
 }
 
-func runListConnections(db *sql.DB) {
+func runListConnections() {
 	groups, err := server.ListActiveConnectionsByIP()
 	if err != nil {
-		fmt.Println("error:", err)
-		os.Exit(1)
+		fatal(controlError("CONN_LIST_FAIL", "failed to list connections", err))
+	}
+
+	if structuredOutput() {
+		var rows [][]string
+		for _, g := range groups {
+			for _, c := range g.Conns {
+				rows = append(rows, []string{
+					strconv.FormatUint(c.ID, 10), c.Username, c.SourceIP, c.Destination, c.Route,
+					csvTime(c.StartedAt), csvTime(c.LastActivity), csvInt(c.BytesUp), csvInt(c.BytesDown),
+					csvInt(c.UpBps), csvInt(c.DownBps), strconv.FormatFloat(c.DialLatencyMs, 'f', 1, 64),
+					c.PolicyViolation,
+				})
+			}
+		}
+		// CSV has one row per tunnel; JSON keeps the per-source groups
+		emit(groups, []string{
+			"id", "username", "source_ip", "destination", "route", "started_at", "last_activity",
+			"bytes_up", "bytes_down", "up_bps", "down_bps", "dial_latency_ms", "policy_violation",
+		}, rows)
+		return
 	}
 
 	if len(groups) == 0 {
@@ -45,15 +64,40 @@ func runListConnections(db *sql.DB) {
 				user = "-"
 			}
 
+			idle := now.Sub(c.LastActivity).Truncate(time.Second)
+
 			fmt.Printf(
-				"  ID=%d USER=%s DST=%s AGE=%s\n",
+				"  ID=%d USER=%s DST=%s AGE=%s IDLE=%s\n",
 				c.ID,
 				user,
 				c.Destination,
 				age,
+				idle,
+			)
+			fmt.Printf(
+				"      UP=%s (%s/s) DOWN=%s (%s/s) DIAL=%.0fms ROUTE=%s\n",
+				system.FormatBytes(c.BytesUp),
+				system.FormatBytes(c.UpBps),
+				system.FormatBytes(c.BytesDown),
+				system.FormatBytes(c.DownBps),
+				c.DialLatencyMs,
+				c.Route,
 			)
+			if c.PolicyViolation != "" {
+				fmt.Printf("      POLICY VIOLATION: %s\n", c.PolicyViolation)
+			}
 		}
 
 		fmt.Println()
 	}
 }
+
+// kill-conn <id> | kill-user <username> | kill-source <ip>
+func runKill(kind, value string) {
+	n, err := server.KillConnections(kind, value)
+	if err != nil {
+		fatal(controlError("CONN_KILL_FAIL", fmt.Sprintf("failed to kill connections (%s %s)", kind, value), err))
+	}
+
+	fmt.Printf("killed %d connection(s)\n", n)
+}
@@ -0,0 +1,87 @@
+package commands
+
+import (
+	"fmt"
+	"proxychan/internal/models"
+	"proxychan/internal/server"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// status
+func runStatus() {
+	st, err := server.GetServiceStatus()
+	if err != nil {
+		fatal(controlError("STATUS_FAIL", "failed to get service status", err))
+	}
+
+	if structuredOutput() {
+		header := []string{"pid", "started_at", "route", "listen", "http_listen", "admin_url", "active_tunnels"}
+		row := []string{
+			strconv.Itoa(st.PID), csvTime(st.StartedAt), st.Route, st.Listen, st.HTTPListen, st.AdminURL,
+			strconv.Itoa(st.ActiveTunnels),
+		}
+		// one version_<policy> column per policy
+		for _, n := range policyNames(st) {
+			header = append(header, "version_"+n)
+			row = append(row, csvInt(st.PolicyVersions[n]))
+		}
+		emit(st, header, [][]string{row})
+		return
+	}
+	printServiceStatus(st)
+}
+
+// reload
+// Policies are picked up within a second anyway; this applies them now
+// and reports the versions loaded.
+func runReload() {
+	st, err := server.ReloadPolicies()
+	if err != nil {
+		fatal(controlError("RELOAD_FAIL", "failed to reload policies", err))
+	}
+	fmt.Println("policies reloaded")
+	printPolicyVersions(st)
+}
+
+// controlError shows why the service couldn't be reached (not running,
+// caller refused, unknown connection) as the hint; it is what the user
+// has to act on.
+func controlError(code, msg string, err error) error {
+	return models.Wrap(code, models.ExitRuntime, msg, err).WithHint(err.Error())
+}
+
+func printServiceStatus(st models.ServiceStatus) {
+	fmt.Println("SERVICE STATUS")
+	fmt.Println("----------------------------------------------")
+	fmt.Printf("PID             : %d\n", st.PID)
+	fmt.Printf("Up since        : %s (%s)\n",
+		st.StartedAt.Local().Format(time.RFC3339), time.Since(st.StartedAt).Truncate(time.Second))
+	fmt.Printf("Route           : %s\n", st.Route)
+	fmt.Printf("SOCKS5          : %s\n", st.Listen)
+	if st.HTTPListen != "" {
+		fmt.Printf("HTTP CONNECT    : %s\n", st.HTTPListen)
+	}
+	if st.AdminURL != "" {
+		fmt.Printf("Admin endpoint  : %s\n", st.AdminURL)
+	}
+	fmt.Printf("Active tunnels  : %d\n", st.ActiveTunnels)
+	printPolicyVersions(st)
+}
+
+func policyNames(st models.ServiceStatus) []string {
+	names := make([]string, 0, len(st.PolicyVersions))
+	for n := range st.PolicyVersions {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func printPolicyVersions(st models.ServiceStatus) {
+	fmt.Println("Policy versions :")
+	for _, n := range policyNames(st) {
+		fmt.Printf("  %-13s %d\n", n, st.PolicyVersions[n])
+	}
+}
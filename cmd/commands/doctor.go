@@ -3,56 +3,111 @@ package commands
 import (
 	"fmt"
 	"os"
+	"proxychan/internal/models"
 	"proxychan/internal/server"
 	"runtime"
+	"strconv"
 )
 
 func runDoctor(dbPath, logPath string) {
+	r := models.DoctorReport{
+		OS:       runtime.GOOS,
+		User:     os.Getenv("USER"),
+		UID:      os.Getuid(),
+		Database: checkPath(dbPath),
+		Logs:     checkPath(logPath),
+		Service:  checkRuntime(),
+	}
+
+	if structuredOutput() {
+		emit(r, []string{
+			"os", "user", "uid",
+			"db_path", "db_exists", "db_writable", "db_error",
+			"log_path", "log_exists", "log_writable", "log_error",
+			"service_running", "service_pid", "admin_url", "active_tunnels", "service_error",
+		}, [][]string{{
+			r.OS, r.User, strconv.Itoa(r.UID),
+			r.Database.Path, csvBool(r.Database.Exists), csvBool(r.Database.Writable), r.Database.Error,
+			r.Logs.Path, csvBool(r.Logs.Exists), csvBool(r.Logs.Writable), r.Logs.Error,
+			csvBool(r.Service.Running), strconv.Itoa(r.Service.PID), r.Service.AdminURL,
+			strconv.Itoa(r.Service.ActiveTunnels), r.Service.Error,
+		}})
+		return
+	}
+
 	fmt.Println("ProxyChan Doctor Report")
 	fmt.Println("-----------------------")
-	fmt.Printf("OS                : %s\n", runtime.GOOS)
-	fmt.Printf("Running as        : %s (uid=%d)\n", os.Getenv("USER"), os.Getuid())
+	fmt.Printf("OS                : %s\n", r.OS)
+	fmt.Printf("Running as        : %s (uid=%d)\n", r.User, r.UID)
 
 	fmt.Println("\nDatabase")
-	checkPath(dbPath)
+	printPathCheck(r.Database)
 
 	fmt.Println("\nLogs")
-	checkPath(logPath)
+	printPathCheck(r.Logs)
 
 	fmt.Println("\nRuntime")
-	checkRuntime()
+	printServiceCheck(r.Service)
 }
 
-func checkPath(path string) {
-	_, err := os.Stat(path)
+func checkPath(path string) models.PathCheck {
+	c := models.PathCheck{Path: path}
+
+	if _, err := os.Stat(path); err != nil {
+		c.Error = err.Error()
+		return c
+	}
+	c.Exists = true
+
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
 	if err != nil {
-		fmt.Printf("  Path            : %s\n", path)
-		fmt.Printf("  Exists          : no (%v)\n", err)
-		return
+		c.Error = err.Error()
+		return c
 	}
+	f.Close()
+	c.Writable = true
+	return c
+}
 
-	fmt.Printf("  Path            : %s\n", path)
+func printPathCheck(c models.PathCheck) {
+	fmt.Printf("  Path            : %s\n", c.Path)
+	if !c.Exists {
+		fmt.Printf("  Exists          : no (%s)\n", c.Error)
+		return
+	}
 	fmt.Printf("  Exists          : yes\n")
 
-	f, err := os.OpenFile(path, os.O_WRONLY, 0)
-	if err != nil {
-		fmt.Printf("  Writable        : no (%v)\n", err)
+	if !c.Writable {
+		fmt.Printf("  Writable        : no (%s)\n", c.Error)
 		return
 	}
-	f.Close()
 	fmt.Printf("  Writable        : yes\n")
 }
 
-func checkRuntime() {
-
-	count, err := server.GetActiveConnectionCount()
+func checkRuntime() models.ServiceCheck {
+	st, err := server.GetServiceStatus()
 	if err != nil {
-		fmt.Println("  Admin endpoint  : unreachable")
-		fmt.Printf("  Error           : %v\n", err)
+		return models.ServiceCheck{Error: err.Error()}
+	}
+
+	return models.ServiceCheck{
+		Running:       true,
+		PID:           st.PID,
+		AdminURL:      st.AdminURL,
+		ActiveTunnels: st.ActiveTunnels,
+	}
+}
+
+func printServiceCheck(c models.ServiceCheck) {
+	if !c.Running {
+		fmt.Println("  Service         : unreachable")
+		fmt.Printf("  Error           : %s\n", c.Error)
 		return
 	}
 
-	fmt.Println("  Admin path	: localhost:6060")
-	fmt.Println("  Admin endpoint  : reachable")
-	fmt.Printf("  Active tunnels  : %d\n", count)
+	fmt.Printf("  Service         : running (pid %d)\n", c.PID)
+	if c.AdminURL != "" {
+		fmt.Printf("  Admin address   : %s\n", c.AdminURL)
+	}
+	fmt.Printf("  Active tunnels  : %d\n", c.ActiveTunnels)
 }
@@ -12,7 +12,22 @@ func Fatal(err error) {
 }
 
 func fatal(err error) {
-	msg, code := models.FormatForUser(err)
+	format := models.FormatForUser
+	if outputFormat == OutputJSON {
+		format = models.FormatJSON
+	}
+	msg, code := format(err)
 	fmt.Fprintln(os.Stderr, msg)
 	os.Exit(code)
 }
+
+// usageExit reports wrong usage of a command. In table and csv mode the
+// usage line goes to stdout with exit 1, as it always has; with --output
+// json it is reported like any other error, with the same exit code.
+func usageExit(usage string) {
+	if outputFormat == OutputJSON {
+		fatal(models.NewCLIError("USAGE", models.ExitRuntime, usage))
+	}
+	fmt.Println(usage)
+	os.Exit(1)
+}
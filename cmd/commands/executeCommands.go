@@ -19,39 +19,95 @@ func DispatchSystemCommands(db *sql.DB, cfg models.FlagConfig) bool {
 
 	switch args[0] {
 	case "add-user":
-		runAddUser(db)
+		switch len(args) {
+		case 1:
+			runAddUser(db, "", cfg)
+		case 2:
+			runAddUser(db, args[1], cfg)
+		default:
+			usageExit("usage: proxychan add-user [name] [--password-stdin | --password-env VAR | --generate]")
+		}
+
+	case "import-users":
+		if len(args) != 2 {
+			usageExit("usage: proxychan import-users <users.csv|->  (columns: username,password,active,expires,group)")
+		}
+		runImportUsers(db, args[1], cfg)
+
+	case "policy":
+		const usage = "usage: proxychan policy export [--with-hashes] | plan <file|-> [--prune] | apply <file|-> [--prune]"
+		switch {
+		case len(args) == 2 && args[1] == "export":
+			runPolicyExport(db, cfg)
+		case len(args) == 3 && args[1] == "plan":
+			runPolicyPlan(db, args[2], cfg)
+		case len(args) == 3 && args[1] == "apply":
+			runPolicyApply(db, args[2], cfg)
+		default:
+			usageExit(usage)
+		}
 
 	case "list-users":
-		runListUsers(db)
+		if cfg.Expiring != "" {
+			runListExpiringUsers(db, cfg.Expiring)
+		} else {
+			runListUsers(db)
+		}
 
 	case "list-user":
 		if len(args) != 2 {
-			fmt.Println("usage: proxychan list-user <username>")
-			os.Exit(1)
+			usageExit("usage: proxychan list-user <username>")
 		}
 		runListUser(db, args[1])
 
 	case "del-user":
 		if len(args) != 2 {
-			fmt.Println("usage: proxychan delete-user <username>")
-			os.Exit(1)
+			usageExit("usage: proxychan del-user <username>")
 		}
 		runDeleteUser(db, args[1])
 
 	case "activate-user":
 		if len(args) != 2 {
-			fmt.Println("usage: proxychan activate-user <username>")
-			os.Exit(1)
+			usageExit("usage: proxychan activate-user <username>")
 		}
 		runActivateUser(db, args[1])
 
 	case "deactivate-user":
 		if len(args) != 2 {
-			fmt.Println("usage: proxychan deactivate-user <username>")
-			os.Exit(1)
+			usageExit("usage: proxychan deactivate-user <username>")
 		}
 		runDeactivateUser(db, args[1])
 
+	case "set-user-expiry":
+		if len(args) != 3 {
+			usageExit("usage: proxychan set-user-expiry <username> <date|duration|never>")
+		}
+		runSetUserExpiry(db, args[1], args[2])
+
+	case "passwd-user":
+		if len(args) != 2 {
+			usageExit("usage: proxychan passwd-user <username>  (new password on stdin)")
+		}
+		runPasswdUser(db, args[1])
+
+	case "set-password-max-age":
+		if len(args) != 2 {
+			usageExit("usage: proxychan set-password-max-age <duration|0>")
+		}
+		runSetPasswordMaxAge(db, args[1])
+
+	case "block-user":
+		if len(args) != 2 {
+			usageExit("usage: proxychan block-user <username>")
+		}
+		runBlockUser(db, args[1])
+
+	case "unlock-user":
+		if len(args) != 2 {
+			usageExit("usage: proxychan unlock-user <username>")
+		}
+		runUnlockUser(db, args[1])
+
 	case "activate-all":
 		runActivateAllUsers(db)
 
@@ -65,20 +121,17 @@ func DispatchSystemCommands(db *sql.DB, cfg models.FlagConfig) bool {
 		runRemoveService()
 	case "allow-ip":
 		if len(args) != 2 {
-			fmt.Println("usage: proxychan allow-ip <IP>")
-			os.Exit(1)
+			usageExit("usage: proxychan allow-ip <IP>")
 		}
 		runAllowIP(db, args[1])
 	case "block-ip":
 		if len(args) != 2 {
-			fmt.Println("usage: proxychan block-ip <IP>")
-			os.Exit(1)
+			usageExit("usage: proxychan block-ip <IP>")
 		}
 		runBlockIP(db, args[1])
 	case "del-ip":
 		if len(args) != 2 {
-			fmt.Println("usage: proxychan delete-ip <IP>")
-			os.Exit(1)
+			usageExit("usage: proxychan del-ip <IP>")
 		}
 		runDeleteIP(db, args[1])
 		return true
@@ -97,24 +150,21 @@ func DispatchSystemCommands(db *sql.DB, cfg models.FlagConfig) bool {
 
 	case "block-dest":
 		if len(args) != 2 {
-			fmt.Println("usage: proxychan block-dest<ip|cidr|domain|.domain>")
-			os.Exit(1)
+			usageExit("usage: proxychan block-dest <ip|cidr|domain|.domain>")
 		}
 		runBlockDestination(db, args[1])
 		return true
 
 	case "allow-dest":
 		if len(args) != 2 {
-			fmt.Println("usage: proxychan allow-dest<ip|cidr|domain|.domain>")
-			os.Exit(1)
+			usageExit("usage: proxychan allow-dest<ip|cidr|domain|.domain>")
 		}
 		runAllowDestination(db, args[1])
 		return true
 
 	case "del-dest":
 		if len(args) != 2 {
-			fmt.Println("usage: proxychan delete-dest <ip|cidr|domain|.domain>")
-			os.Exit(1)
+			usageExit("usage: proxychan delete-dest <ip|cidr|domain|.domain>")
 		}
 		runDeleteDestination(db, args[1])
 		return true
@@ -123,14 +173,190 @@ func DispatchSystemCommands(db *sql.DB, cfg models.FlagConfig) bool {
 		runListBlacklist(db)
 		return true
 
-	case "list-connections":
-		runListConnections(db)
+	case "set-group":
+		if len(args) != 3 {
+			usageExit("usage: proxychan set-group <username> <group|->")
+		}
+		runSetUserGroup(db, args[1], args[2])
+		return true
+
+	case "set-rate-limit":
+		switch {
+		case len(args) == 4 && args[1] == string(system.RateGlobal):
+			runSetRateLimit(db, system.RateGlobal, "", args[2], args[3])
+		case len(args) == 5:
+			runSetRateLimit(db, system.RateScope(args[1]), args[2], args[3], args[4])
+		default:
+			usageExit("usage: proxychan set-rate-limit <global|group <name>|user <name>> <up> <down>")
+		}
+		return true
+
+	case "del-rate-limit":
+		switch {
+		case len(args) == 2 && args[1] == string(system.RateGlobal):
+			runDeleteRateLimit(db, system.RateGlobal, "")
+		case len(args) == 3:
+			runDeleteRateLimit(db, system.RateScope(args[1]), args[2])
+		default:
+			usageExit("usage: proxychan del-rate-limit <global|group <name>|user <name>>")
+		}
+		return true
+
+	case "list-rate-limits":
+		runListRateLimits(db)
+		return true
+
+	case "set-quota":
+		if len(args) < 3 || len(args) > 5 {
+			usageExit("usage: proxychan set-quota <username> <size> [daily|weekly|monthly|never] [reset-day]")
+		}
+		period, resetDay := system.QuotaMonthly, ""
+		if len(args) >= 4 {
+			period = system.QuotaPeriod(args[3])
+		}
+		if len(args) == 5 {
+			resetDay = args[4]
+		}
+		runSetQuota(db, args[1], args[2], period, resetDay)
+		return true
+
+	case "del-quota":
+		if len(args) != 2 {
+			usageExit("usage: proxychan del-quota <username>")
+		}
+		runDeleteQuota(db, args[1])
+		return true
+
+	case "reset-quota":
+		if len(args) != 2 {
+			usageExit("usage: proxychan reset-quota <username>")
+		}
+		runResetQuota(db, args[1])
+		return true
+
+	case "list-quotas":
+		runListQuotas(db)
+		return true
+
+	case "list-bans":
+		runListBans(db)
+		return true
+
+	case "unban-ip":
+		if len(args) != 2 {
+			usageExit("usage: proxychan unban-ip <ip>")
+		}
+		runUnbanIP(db, args[1])
+		return true
+
+	case "history":
+		runHistory(db, cfg)
+		return true
+
+	case "audit-log":
+		runAuditLog(db, cfg)
+		return true
+
+	case "set-history-retention":
+		if len(args) != 2 {
+			usageExit("usage: proxychan set-history-retention <duration|0>")
+		}
+		runSetHistoryRetention(db, args[1])
 		return true
 
 	case "set-admin-pwd":
-		runSetAdminPassword(db)
+		name := "admin"
+		if len(args) == 2 {
+			name = args[1]
+		}
+		runSetAdminPassword(db, name)
+		return true
+
+	case "add-admin":
+		if len(args) != 3 {
+			usageExit("usage: proxychan add-admin <name> <viewer|operator|admin>  (password on stdin or prompted)")
+		}
+		runAddAdmin(db, args[1], args[2])
+		return true
+
+	case "del-admin":
+		if len(args) != 2 {
+			usageExit("usage: proxychan del-admin <name>")
+		}
+		runDeleteAdmin(db, args[1])
 		return true
 
+	case "set-admin-role":
+		if len(args) != 3 {
+			usageExit("usage: proxychan set-admin-role <name> <viewer|operator|admin>")
+		}
+		runSetAdminRole(db, args[1], args[2])
+		return true
+
+	case "passwd-admin":
+		if len(args) != 2 {
+			usageExit("usage: proxychan passwd-admin <name>  (new password on stdin or prompted)")
+		}
+		runPasswdAdmin(db, args[1])
+		return true
+
+	case "reset-admin-2fa":
+		if len(args) != 2 {
+			usageExit("usage: proxychan reset-admin-2fa <name>")
+		}
+		runResetAdmin2FA(db, args[1])
+		return true
+
+	case "list-admins":
+		runListAdmins(db)
+		return true
+
+	case "create-api-token":
+		if len(args) < 3 || len(args) > 4 {
+			usageExit("usage: proxychan create-api-token <name> <viewer|operator|admin> [lifetime]")
+		}
+		ttl := ""
+		if len(args) == 4 {
+			ttl = args[3]
+		}
+		runCreateAPIToken(db, args[1], args[2], ttl)
+		return true
+
+	case "list-api-tokens":
+		runListAPITokens(db)
+		return true
+
+	case "revoke-api-token":
+		if len(args) != 2 {
+			usageExit("usage: proxychan revoke-api-token <name>")
+		}
+		runRevokeAPIToken(db, args[1])
+		return true
+
+	case "backup":
+		if len(args) != 2 {
+			usageExit("usage: proxychan backup <file>")
+		}
+		runBackup(db, args[1])
+
+	case "restore":
+		if len(args) != 2 {
+			usageExit("usage: proxychan restore <file>")
+		}
+		runRestore(db, args[1])
+
+	case "export-db":
+		if len(args) != 2 {
+			usageExit("usage: proxychan export-db <file.json|->")
+		}
+		runExportDB(db, args[1])
+
+	case "import-db":
+		if len(args) != 2 {
+			usageExit("usage: proxychan import-db <file.json|->")
+		}
+		runImportDB(db, args[1])
+
 	case "doctor":
 		dbPath, _ := system.DBPath()
 		logDir, _ := logging.LogDir()
@@ -138,6 +364,9 @@ func DispatchSystemCommands(db *sql.DB, cfg models.FlagConfig) bool {
 		return true
 
 	default:
+		if outputFormat == OutputJSON {
+			usageExit("unknown command: " + args[0])
+		}
 		fmt.Printf("unknown command: %s\n\n", args[0])
 		printHelp()
 		os.Exit(1)
@@ -145,3 +374,55 @@ func DispatchSystemCommands(db *sql.DB, cfg models.FlagConfig) bool {
 
 	return true
 }
+
+// DispatchControlCommands runs the commands that only talk to the running
+// service. They don't open the database, so members of --control-group
+// can use them without access to it.
+func DispatchControlCommands() bool {
+	args := pflag.Args()
+	if len(args) == 0 {
+		return false
+	}
+
+	switch args[0] {
+	case "list-connections":
+		runListConnections()
+		return true
+
+	case "status":
+		runStatus()
+		return true
+
+	case "reload":
+		runReload()
+		return true
+
+	case "top":
+		runTop()
+		return true
+
+	case "kill-conn":
+		if len(args) != 2 {
+			usageExit("usage: proxychan kill-conn <id>")
+		}
+		runKill("id", args[1])
+		return true
+
+	case "kill-user":
+		if len(args) != 2 {
+			usageExit("usage: proxychan kill-user <username>")
+		}
+		runKill("user", args[1])
+		return true
+
+	case "kill-source":
+		if len(args) != 2 {
+			usageExit("usage: proxychan kill-source <ip>")
+		}
+		runKill("source", args[1])
+		return true
+
+	default:
+		return false
+	}
+}
@@ -27,11 +27,35 @@ func printHelp() {
 	)
 	fmt.Println()
 
+	fmt.Println("[Connection limits]:")
+	clihelp.Print(
+		clihelp.F("--max-conns", "int", "Maximum concurrent tunnels (0 = unlimited)"),
+		clihelp.F("--max-conns-per-user", "int", "Maximum concurrent tunnels per user (0 = unlimited)"),
+		clihelp.F("--max-conns-per-source", "int", "Maximum concurrent tunnels per source IP (0 = unlimited)"),
+	)
+	fmt.Println()
+
 	fmt.Println("[Authentication]:")
-	clihelp.Print(clihelp.F("--no-auth", "", "Enforces no authentication policy"))
+	clihelp.Print(
+		clihelp.F("--no-auth", "", "Enforces no authentication policy"),
+		clihelp.F("--lockout-threshold", "int", "Failed logins that lock an account/source (0 disables)"),
+		clihelp.F("--lockout-window", "duration", "Window in which failed logins are counted"),
+		clihelp.F("--lockout-duration", "duration", "How long a locked account/source is refused"),
+		clihelp.F("--ban-threshold", "int", "Offenses that ban a source IP (0 disables)"),
+		clihelp.F("--ban-window", "duration", "Window in which source offenses are counted"),
+		clihelp.F("--ban-duration", "duration", "How long a banned source IP is refused"),
+		clihelp.F("--policy-enforcement", "close|flag", "Close (default) or only flag open tunnels a policy change no longer allows"),
+	)
 	fmt.Println()
 
 	// ─── Tor ─────────────────────────────────────────────────
+	fmt.Println("[Metrics]:")
+	clihelp.Print(
+		clihelp.F("--metrics-listen", "address", "Also serve Prometheus /metrics here, without any authentication (keep it on loopback)"),
+		clihelp.F("--metrics-per-user", "", "Label tunnel metrics by user (higher cardinality)"),
+	)
+	fmt.Println()
+
 	fmt.Println("[Tor]:")
 	clihelp.Print(
 		clihelp.F("--tor-socks", "address", "Tor SOCKS5 address"),
@@ -48,7 +72,8 @@ func printHelp() {
 
 	fmt.Println("[User management]:")
 	clihelp.Print(
-		clihelp.F("add-user", "", "Initiates user creation"),
+		clihelp.F("add-user", "[name]", "Create a user; prompts, or --password-stdin | --password-env VAR | --generate"),
+		clihelp.F("import-users", "file.csv", "Create users from CSV (username,password,active,expires,group) in one transaction"),
 		clihelp.F("del-user", "string", "Deletes existing user"),
 		clihelp.F("list-users", "", "Prints list of existing users"),
 		clihelp.F("list-user", "string", "Prints info of specific user"),
@@ -56,6 +81,12 @@ func printHelp() {
 		clihelp.F("activate-all", "", "Activates access to specific user"),
 		clihelp.F("deactivate-user", "string", "Deactivates access to specific user"),
 		clihelp.F("deactivate-all", "", "Deactivates access to all users"),
+		clihelp.F("block-user", "string", "Block a user until unlocked by an admin"),
+		clihelp.F("unlock-user", "string", "Clear lockout and block state of a user"),
+		clihelp.F("set-user-expiry", "user when", "Expire an account at a date, after a duration (30d) or never"),
+		clihelp.F("passwd-user", "string", "Change a user's password (read from stdin)"),
+		clihelp.F("set-password-max-age", "duration", "Force password rotation after this age (0 disables)"),
+		clihelp.F("list-users --expiring", "duration", "Users whose account or password expires within the period"),
 	)
 	fmt.Println()
 
@@ -69,6 +100,13 @@ func printHelp() {
 		clihelp.F("clear-whitelist", "", "Disable all whitelist entries (localhost preserved)"),
 	)
 
+	fmt.Println()
+	fmt.Println("[Source bans]:")
+	clihelp.Print(
+		clihelp.F("list-bans", "", "Print automatically banned source IPs"),
+		clihelp.F("unban-ip", "string", "Lift a ban on a source IP"),
+	)
+
 	fmt.Println()
 	fmt.Println("[Destination Blacklist management]:")
 	clihelp.Print(
@@ -80,10 +118,55 @@ func printHelp() {
 	)
 
 	fmt.Println()
+	fmt.Println("[Bandwidth limits]:")
+	clihelp.Print(
+		clihelp.F("set-group", "user group", "Assign user to a group (- clears)"),
+		clihelp.F("set-rate-limit", "scope [name] up down", "Set bytes/sec limits for global | group <name> | user <name> (0 = unlimited)"),
+		clihelp.F("del-rate-limit", "scope [name]", "Remove a rate limit (next broader scope applies)"),
+		clihelp.F("list-rate-limits", "", "Print all rate limits"),
+	)
+
+	fmt.Println()
+	fmt.Println("[Data quotas]:")
+	clihelp.Print(
+		clihelp.F("set-quota", "user size [period] [day]", "Set data quota (period: daily | weekly | monthly | never, default monthly)"),
+		clihelp.F("del-quota", "string", "Remove a user's data quota"),
+		clihelp.F("reset-quota", "string", "Reset a user's usage for the current period"),
+		clihelp.F("list-quotas", "", "Print all quotas with current usage"),
+	)
+
+	fmt.Println()
+	fmt.Println("[Policy as code]:")
+	clihelp.Print(
+		clihelp.F("policy export", "", "Write users, whitelist, denylist and settings as YAML (--with-hashes adds password hashes)"),
+		clihelp.F("policy plan", "file.yaml", "Show what policy apply would change"),
+		clihelp.F("policy apply", "file.yaml", "Make the database match the file in one transaction (--prune removes what it lacks)"),
+	)
+	fmt.Println()
+
+	fmt.Println("[Backup]:")
+	clihelp.Print(
+		clihelp.F("backup", "file", "Write a consistent copy of the database (safe while the service runs)"),
+		clihelp.F("restore", "file", "Validate a backup and swap it in; the current database is kept as .pre-restore-<time>"),
+		clihelp.F("export-db", "file.json", "Write every table as portable JSON (- for stdout)"),
+		clihelp.F("import-db", "file.json", "Replace the tables in a JSON export, matching columns by name"),
+	)
+	fmt.Println()
+
 	fmt.Println("[Status]:")
 	clihelp.Print(
+		clihelp.F("status", "", "Show the running service's status and loaded policy versions"),
+		clihelp.F("reload", "", "Make the running service re-read all policies now"),
 		clihelp.F("list-connections", "", "Show currently active proxy connections"),
-		clihelp.F("doctor", "", "Prints Log and DB paths"))
+		clihelp.F("top", "", "Live dashboard of tunnels, per-user totals and denials (API token in PROXYCHAN_API_TOKEN)"),
+		clihelp.F("kill-conn", "id", "Terminate a live connection"),
+		clihelp.F("kill-user", "string", "Terminate all live connections of a user"),
+		clihelp.F("kill-source", "ip", "Terminate all live connections from a source IP"),
+		clihelp.F("history", "", "Past connections; filters: --user --source --dest --status --since --until --limit"),
+		clihelp.F("audit-log", "", "Administrative changes; filters: --actor --action --target --since --until --limit"),
+		clihelp.F("set-history-retention", "duration", "How long connection history is kept (default 30d, 0 = forever)"),
+		clihelp.F("doctor", "", "Prints Log and DB paths"),
+		clihelp.F("--output", "table|json|csv", "Format of list-*, status-whitelist, status, history, audit-log and doctor (default table)"))
 	fmt.Println()
 
 	fmt.Println("[auto-configuration]:")
@@ -95,17 +178,37 @@ func printHelp() {
 
 	fmt.Println("Admin Authentication:")
 	clihelp.Print(
+		clihelp.F("--admin-session-idle", "duration", "Admin web session ends after this long without requests (default 30m)"),
+		clihelp.F("--admin-session-max", "duration", "Admin web session ends this long after login (default 12h)"),
+		clihelp.F("--admin-listen", "addr", "Admin web interface and API address (default 127.0.0.1:6060)"),
+		clihelp.F("--admin-tls", "", "Serve the admin endpoint over HTTPS (self-signed certificate, kept in the data directory)"),
+		clihelp.F("--admin-tls-cert", "file", "PEM certificate for the admin endpoint (with --admin-tls-key; implies --admin-tls)"),
+		clihelp.F("--admin-tls-key", "file", "PEM private key for --admin-tls-cert"),
+		clihelp.F("--admin-allow", "list", "Only accept admin connections from these IPs/CIDRs, comma-separated (loopback always allowed)"),
+		clihelp.F("--control-group", "group", "Members may use the control socket (status, reload, list, kill) besides root (Linux)"),
+		clihelp.F("--control-socket", "path", "Control socket of this instance, for the service and the commands above (Linux, default /run/proxychan/control.sock)"),
 		clihelp.F(
 			"set-admin-pwd",
-			"",
-			"Set or rotate the administrator password for the web interface",
+			"[name]",
+			"Set or rotate an admin's web password (default name: admin; created with role admin if missing)",
 		),
+		clihelp.F("add-admin", "name role", "Create a web admin account (role: viewer | operator | admin)"),
+		clihelp.F("del-admin", "name", "Delete a web admin account (the last admin can't be removed)"),
+		clihelp.F("set-admin-role", "name role", "Change the role of a web admin account"),
+		clihelp.F("passwd-admin", "name", "Change a web admin's password (read from stdin)"),
+		clihelp.F("list-admins", "", "Print web admin accounts, their roles and 2FA status"),
+		clihelp.F("reset-admin-2fa", "name", "Remove an admin's two-factor login and recovery codes (lockout recovery)"),
+		clihelp.F("create-api-token", "name role [lifetime]", "Create a REST API token with an admin role (printed once; lifetime e.g. 90d, default never)"),
+		clihelp.F("list-api-tokens", "", "Print API tokens with expiry and last use"),
+		clihelp.F("revoke-api-token", "name", "Revoke an API token"),
 	)
 	fmt.Println()
 
 	fmt.Println("Policy Notes:")
 	fmt.Println("  • Whitelist applies to SOURCE IPs (clients)")
 	fmt.Println("  • Blacklist applies to DESTINATIONS (egress)")
+	fmt.Println("  • Rate limits resolve user → group → global; a user's tunnels share one bucket")
+	fmt.Println("  • Exhausted quotas refuse new connections and close open ones until the period resets")
 	fmt.Println()
 	// ─── Notes ───────────────────────────────────────────────
 	fmt.Println("Notes:")
@@ -0,0 +1,149 @@
+package commands
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"proxychan/internal/models"
+	"proxychan/internal/system"
+)
+
+// parseHistoryTime accepts a date (2006-01-02), an RFC3339 timestamp or
+// a duration meaning "that long ago" (24h, 7d).
+func parseHistoryTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := system.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().Add(-d), nil
+}
+
+// history [--user u] [--source ip] [--dest text] [--status s] [--since t] [--until t] [--limit n]
+func runHistory(db *sql.DB, cfg models.FlagConfig) {
+	since, err := parseHistoryTime(cfg.HistorySince)
+	if err != nil {
+		fatal(
+			models.
+				Wrap("HISTORY_PARSE_FAIL", models.ExitUsage,
+					fmt.Sprintf("invalid --since %q", cfg.HistorySince),
+					err).
+				WithHint("use a date (2026-01-31), RFC3339 time or a duration like 24h"),
+		)
+	}
+	until, err := parseHistoryTime(cfg.HistoryUntil)
+	if err != nil {
+		fatal(
+			models.
+				Wrap("HISTORY_PARSE_FAIL", models.ExitUsage,
+					fmt.Sprintf("invalid --until %q", cfg.HistoryUntil),
+					err).
+				WithHint("use a date (2026-01-31), RFC3339 time or a duration like 24h"),
+		)
+	}
+
+	recs, err := system.QueryHistory(db, system.HistoryFilter{
+		Username:    cfg.HistoryUser,
+		SourceIP:    cfg.HistorySource,
+		Destination: cfg.HistoryDest,
+		Status:      cfg.HistoryStatus,
+		Since:       since,
+		Until:       until,
+		Limit:       cfg.HistoryLimit,
+	})
+	if err != nil {
+		fatal(
+			models.
+				Wrap(
+					"HISTORY_QUERY_FAIL",
+					models.ExitRuntime,
+					"failed to query connection history",
+					err,
+				),
+		)
+	}
+
+	if structuredOutput() {
+		rows := make([][]string, 0, len(recs))
+		for _, r := range recs {
+			rows = append(rows, []string{
+				csvInt(r.ID), r.Username, r.SourceIP, r.Destination, r.Route, csvTime(r.StartedAt), csvTime(r.EndedAt),
+				csvInt(r.BytesUp), csvInt(r.BytesDown), r.Status, r.Reason,
+			})
+		}
+		emit(recs, []string{
+			"id", "username", "source_ip", "destination", "route", "started_at", "ended_at",
+			"bytes_up", "bytes_down", "status", "reason",
+		}, rows)
+		return
+	}
+
+	if len(recs) == 0 {
+		fmt.Println("no matching connections")
+		return
+	}
+
+	for _, r := range recs {
+		user := r.Username
+		if user == "" {
+			user = "-"
+		}
+
+		fmt.Printf(
+			"%s %-6s USER=%s SRC=%s DST=%s DUR=%s UP=%s DOWN=%s ROUTE=%s\n",
+			r.StartedAt.Local().Format("2006-01-02 15:04:05"),
+			r.Status,
+			user,
+			r.SourceIP,
+			r.Destination,
+			r.EndedAt.Sub(r.StartedAt).Truncate(time.Second),
+			system.FormatBytes(r.BytesUp),
+			system.FormatBytes(r.BytesDown),
+			r.Route,
+		)
+		if r.Reason != "" {
+			fmt.Printf("    reason: %s\n", r.Reason)
+		}
+	}
+}
+
+// set-history-retention <duration|0>
+func runSetHistoryRetention(db *sql.DB, keepStr string) {
+	keep, err := system.ParseDuration(keepStr)
+	if err != nil {
+		fatal(
+			models.
+				Wrap("HISTORY_RETENTION_PARSE_FAIL", models.ExitUsage,
+					fmt.Sprintf("invalid retention %q", keepStr),
+					err).
+				WithHint("use a duration like 30d, or 0 to keep history forever"),
+		)
+	}
+
+	if err := system.SetHistoryRetention(db, system.CLIActor(), keep); err != nil {
+		fatal(
+			models.
+				Wrap(
+					"HISTORY_RETENTION_SET_FAIL",
+					models.ExitRuntime,
+					"failed to set history retention",
+					err,
+				),
+		)
+	}
+
+	if keep == 0 {
+		fmt.Println("connection history kept forever")
+		return
+	}
+	fmt.Printf("connection history kept for %s\n", system.FormatDuration(keep))
+}
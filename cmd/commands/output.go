@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Listing formats for --output. Table is the human one each command
+// prints itself; json and csv go through emit.
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputCSV   = "csv"
+)
+
+var outputFormat = OutputTable
+
+func ValidOutputFormat(f string) bool {
+	return f == OutputTable || f == OutputJSON || f == OutputCSV
+}
+
+func SetOutputFormat(f string) {
+	outputFormat = f
+}
+
+// structuredOutput reports whether the command should call emit instead
+// of printing its table.
+func structuredOutput() bool {
+	return outputFormat != OutputTable
+}
+
+// emit writes v as indented JSON, or header and rows as CSV. A nil slice
+// is written as [] so "nothing found" parses the same as a result.
+func emit(v any, header []string, rows [][]string) {
+	if outputFormat == OutputCSV {
+		w := csv.NewWriter(os.Stdout)
+		_ = w.Write(header)
+		_ = w.WriteAll(rows)
+		return
+	}
+
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice && rv.IsNil() {
+		v = []any{}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+// csvTime renders times as RFC3339 UTC; zero is empty.
+func csvTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func csvInt(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+func csvBool(b bool) string {
+	return strconv.FormatBool(b)
+}
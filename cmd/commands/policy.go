@@ -0,0 +1,170 @@
+package commands
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"proxychan/internal/models"
+	"proxychan/internal/system"
+)
+
+// policy export [--with-hashes]
+// Writes users, whitelist, denylist and settings as YAML to stdout.
+func runPolicyExport(db *sql.DB, cfg models.FlagConfig) {
+	p, err := system.ExportPolicy(db, cfg.PolicyWithHashes)
+	if err != nil {
+		fatal(
+			models.
+				Wrap(
+					"POLICY_EXPORT_FAIL",
+					models.ExitRuntime,
+					"failed to export the policy",
+					err,
+				),
+		)
+	}
+
+	enc := yaml.NewEncoder(os.Stdout)
+	enc.SetIndent(2)
+	if err := enc.Encode(p); err != nil {
+		fatal(models.Wrap("POLICY_EXPORT_FAIL", models.ExitIO, "failed to write the policy", err))
+	}
+	_ = enc.Close()
+}
+
+// policy plan <file|-> [--prune]
+func runPolicyPlan(db *sql.DB, path string, cfg models.FlagConfig) {
+	p := readPolicyFile(path)
+
+	changes, err := system.PlanPolicy(db, p, cfg.PolicyPrune)
+	if err != nil {
+		fatalPolicy("POLICY_PLAN_FAIL", "failed to plan the policy", err)
+	}
+
+	if structuredOutput() {
+		emitPolicyChanges(changes)
+		return
+	}
+
+	printPolicyChanges(changes)
+	if len(changes) == 0 {
+		fmt.Println("no changes; the database matches the policy")
+	} else {
+		fmt.Printf("%d changes; run policy apply to make them\n", len(changes))
+	}
+
+	if !cfg.PolicyPrune {
+		pruned, err := system.PlanPolicy(db, p, true)
+		if err == nil && len(pruned) > len(changes) {
+			fmt.Printf("%d entries not in the file are kept (use --prune to remove them)\n", len(pruned)-len(changes))
+		}
+	}
+}
+
+// policy apply <file|-> [--prune]
+// All changes are made in one transaction; nothing is changed on error.
+func runPolicyApply(db *sql.DB, path string, cfg models.FlagConfig) {
+	p := readPolicyFile(path)
+
+	changes, err := system.ApplyPolicy(db, system.CLIActor(), p, cfg.PolicyPrune)
+	if err != nil {
+		fatalPolicy("POLICY_APPLY_FAIL", "failed to apply the policy (nothing was changed)", err)
+	}
+
+	if structuredOutput() {
+		emitPolicyChanges(changes)
+		return
+	}
+
+	printPolicyChanges(changes)
+	if len(changes) == 0 {
+		fmt.Println("no changes; the database already matches the policy")
+	} else {
+		fmt.Printf("%d changes applied\n", len(changes))
+	}
+}
+
+func readPolicyFile(path string) *system.Policy {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			fatal(
+				models.
+					Wrap(
+						"POLICY_READ_FAIL",
+						models.ExitIO,
+						fmt.Sprintf("failed to open %s", path),
+						err,
+					),
+			)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var p system.Policy
+	dec := yaml.NewDecoder(in)
+	dec.KnownFields(true)
+	if err := dec.Decode(&p); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = errors.New("the file is empty")
+		}
+		fatal(
+			models.
+				Wrap(
+					"POLICY_PARSE_FAIL",
+					models.ExitConfig,
+					fmt.Sprintf("failed to parse the policy file: %v", err),
+					err,
+				).
+				WithHint("start from the output of: proxychan policy export"),
+		)
+	}
+	return &p
+}
+
+// fatalPolicy reports an invalid policy as a config error and anything
+// else as a runtime failure.
+func fatalPolicy(code, msg string, err error) {
+	if errors.Is(err, system.ErrInvalidPolicy) {
+		fatal(
+			models.
+				Wrap(
+					"POLICY_INVALID",
+					models.ExitConfig,
+					err.Error(),
+					err,
+				),
+		)
+	}
+	fatal(models.Wrap(code, models.ExitRuntime, msg, err))
+}
+
+func printPolicyChanges(changes []system.PolicyChange) {
+	for _, c := range changes {
+		var sign, state string
+		switch c.Op {
+		case system.PolicyOpAdd:
+			sign, state = "+", c.New
+		case system.PolicyOpRemove:
+			sign, state = "-", c.Old
+		default:
+			sign, state = "~", c.Old+" -> "+c.New
+		}
+		fmt.Printf("%s %-10s %-30s %s\n", sign, c.Section, c.Target, state)
+	}
+}
+
+func emitPolicyChanges(changes []system.PolicyChange) {
+	rows := make([][]string, 0, len(changes))
+	for _, c := range changes {
+		rows = append(rows, []string{c.Section, c.Op, c.Target, c.Old, c.New})
+	}
+	emit(changes, []string{"section", "op", "target", "old", "new"}, rows)
+}
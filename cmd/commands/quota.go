@@ -0,0 +1,180 @@
+package commands
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"proxychan/internal/models"
+	"proxychan/internal/system"
+)
+
+// set-quota <username> <size> [daily|weekly|monthly|never] [reset-day]
+func runSetQuota(db *sql.DB, username, sizeStr string, period system.QuotaPeriod, resetDayStr string) {
+	size, err := system.ParseByteSize(sizeStr)
+	if err != nil {
+		fatal(
+			models.
+				Wrap("QUOTA_PARSE_FAIL", models.ExitUsage,
+					fmt.Sprintf("invalid quota size %q", sizeStr),
+					err).
+				WithHint("use a size like 500MB or 50GB"),
+		)
+	}
+
+	resetDay := 1 // 1st of the month, or Monday for weekly quotas
+	if resetDayStr != "" {
+		resetDay, err = strconv.Atoi(resetDayStr)
+		if err != nil {
+			fatal(
+				models.
+					Wrap("QUOTA_PARSE_FAIL", models.ExitUsage,
+						fmt.Sprintf("invalid reset day %q", resetDayStr),
+						err).
+					WithHint("monthly: day of month 1-28, weekly: weekday 0-6 (0 = Sunday)"),
+			)
+		}
+	}
+
+	if err := system.SetUserQuota(db, system.CLIActor(), username, size, period, resetDay); err != nil {
+		fatal(
+			models.
+				Wrap(
+					"QUOTA_SET_FAIL",
+					models.ExitRuntime,
+					fmt.Sprintf("failed to set quota for user %q", username),
+					err,
+				),
+		)
+	}
+
+	fmt.Printf("quota set: %s %s (%s)\n", username, system.FormatBytes(size), period)
+}
+
+// del-quota <username>
+func runDeleteQuota(db *sql.DB, username string) {
+	if err := system.DeleteUserQuota(db, system.CLIActor(), username); err != nil {
+		fatal(
+			models.
+				Wrap(
+					"QUOTA_DELETE_FAIL",
+					models.ExitRuntime,
+					fmt.Sprintf("failed to delete quota for user %q", username),
+					err,
+				),
+		)
+	}
+
+	fmt.Printf("quota removed: %s\n", username)
+}
+
+// reset-quota <username>
+func runResetQuota(db *sql.DB, username string) {
+	if err := system.ResetUserQuotaUsage(db, system.CLIActor(), username); err != nil {
+		fatal(
+			models.
+				Wrap(
+					"QUOTA_RESET_FAIL",
+					models.ExitRuntime,
+					fmt.Sprintf("failed to reset quota usage for user %q", username),
+					err,
+				),
+		)
+	}
+
+	fmt.Printf("quota usage reset: %s\n", username)
+}
+
+// list-quotas
+func runListQuotas(db *sql.DB) {
+	quotas, err := system.ListUserQuotas(db)
+	if err != nil {
+		fatal(
+			models.
+				Wrap(
+					"QUOTA_LIST_FAIL",
+					models.ExitRuntime,
+					"failed to list quotas",
+					err,
+				),
+		)
+	}
+
+	if structuredOutput() {
+		now := time.Now()
+		rows := make([][]string, 0, len(quotas))
+		for i, q := range quotas {
+			// usage as of now, like the table
+			quotas[i].UsedBytes = q.UsedAt(now)
+			rows = append(rows, []string{
+				q.Username, csvInt(q.QuotaBytes), string(q.Period), strconv.Itoa(q.ResetDay),
+				csvInt(quotas[i].UsedBytes), csvTime(q.NextResetAt(now)),
+			})
+		}
+		emit(quotas, []string{"username", "quota_bytes", "period", "reset_day", "used_bytes", "next_reset"}, rows)
+		return
+	}
+
+	if len(quotas) == 0 {
+		fmt.Println("no quotas defined")
+		return
+	}
+
+	fmt.Println("DATA QUOTAS")
+	fmt.Println("----------------------------------------------")
+	for _, q := range quotas {
+		fmt.Printf("%-16s %s\n", q.Username, formatQuotaUsage(q))
+	}
+}
+
+// printUserQuota prints the quota line shown by list-user.
+func printUserQuota(db *sql.DB, username string) {
+	q := loadUserQuota(db, username)
+	if q == nil {
+		fmt.Println("  Quota: none")
+		return
+	}
+
+	fmt.Printf("  Quota: %s\n", formatQuotaUsage(*q))
+}
+
+// loadUserQuota returns nil when the user has no quota. Usage is as of now.
+func loadUserQuota(db *sql.DB, username string) *system.UserQuota {
+	q, err := system.GetUserQuota(db, username)
+	if errors.Is(err, system.ErrQuotaNotFound) {
+		return nil
+	}
+	if err != nil {
+		fatal(
+			models.
+				Wrap(
+					"QUOTA_LOOKUP_FAIL",
+					models.ExitRuntime,
+					fmt.Sprintf("failed to read quota for user %q", username),
+					err,
+				),
+		)
+	}
+
+	q.UsedBytes = q.UsedAt(time.Now())
+	return q
+}
+
+func formatQuotaUsage(q system.UserQuota) string {
+	now := time.Now()
+	used := q.UsedAt(now)
+
+	pct := float64(used) / float64(q.QuotaBytes) * 100
+	line := fmt.Sprintf("%s / %s (%.1f%%) %s",
+		system.FormatBytes(used), system.FormatBytes(q.QuotaBytes), pct, q.Period)
+
+	if r := q.NextResetAt(now); !r.IsZero() {
+		line += ", resets " + r.Format("2006-01-02")
+	}
+	if used >= q.QuotaBytes {
+		line += " [EXHAUSTED]"
+	}
+	return line
+}
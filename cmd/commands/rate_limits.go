@@ -0,0 +1,143 @@
+package commands
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"proxychan/internal/models"
+	"proxychan/internal/system"
+)
+
+// set-rate-limit <global|group|user> [name] <up> <down>
+func runSetRateLimit(db *sql.DB, scope system.RateScope, name, upStr, downStr string) {
+	up, err := system.ParseByteSize(upStr)
+	if err != nil {
+		fatal(
+			models.
+				Wrap("RATE_PARSE_FAIL", models.ExitUsage,
+					fmt.Sprintf("invalid upload rate %q", upStr),
+					err).
+				WithHint("use bytes per second, e.g. 512KB or 10MB (0 = unlimited)"),
+		)
+	}
+
+	down, err := system.ParseByteSize(downStr)
+	if err != nil {
+		fatal(
+			models.
+				Wrap("RATE_PARSE_FAIL", models.ExitUsage,
+					fmt.Sprintf("invalid download rate %q", downStr),
+					err).
+				WithHint("use bytes per second, e.g. 512KB or 10MB (0 = unlimited)"),
+		)
+	}
+
+	if err := system.SetRateLimit(db, system.CLIActor(), scope, name, up, down); err != nil {
+		fatal(
+			models.
+				Wrap(
+					"RATE_SET_FAIL",
+					models.ExitRuntime,
+					"failed to set rate limit",
+					err,
+				),
+		)
+	}
+
+	fmt.Printf("rate limit set: %s up=%s down=%s\n",
+		rateTarget(scope, name), formatRate(up), formatRate(down))
+}
+
+// del-rate-limit <global|group|user> [name]
+func runDeleteRateLimit(db *sql.DB, scope system.RateScope, name string) {
+	if err := system.DeleteRateLimit(db, system.CLIActor(), scope, name); err != nil {
+		fatal(
+			models.
+				Wrap(
+					"RATE_DELETE_FAIL",
+					models.ExitRuntime,
+					"failed to delete rate limit",
+					err,
+				),
+		)
+	}
+
+	fmt.Printf("rate limit deleted: %s\n", rateTarget(scope, name))
+}
+
+// list-rate-limits
+func runListRateLimits(db *sql.DB) {
+	limits, err := system.ListRateLimits(db)
+	if err != nil {
+		fatal(
+			models.
+				Wrap(
+					"RATE_LIST_FAIL",
+					models.ExitRuntime,
+					"failed to list rate limits",
+					err,
+				),
+		)
+	}
+
+	if structuredOutput() {
+		rows := make([][]string, 0, len(limits))
+		for _, l := range limits {
+			rows = append(rows, []string{string(l.Scope), l.Name, csvInt(l.UpBps), csvInt(l.DownBps)})
+		}
+		emit(limits, []string{"scope", "name", "up_bps", "down_bps"}, rows)
+		return
+	}
+
+	if len(limits) == 0 {
+		fmt.Println("no rate limits defined (all traffic unlimited)")
+		return
+	}
+
+	fmt.Println("RATE LIMITS")
+	fmt.Println("----------------------------------------------")
+	for _, l := range limits {
+		fmt.Printf("%-24s up=%-10s down=%s\n",
+			rateTarget(l.Scope, l.Name), formatRate(l.UpBps), formatRate(l.DownBps))
+	}
+}
+
+// set-group <username> <group>
+func runSetUserGroup(db *sql.DB, username, group string) {
+	if group == "-" {
+		group = ""
+	}
+
+	if err := system.SetUserGroup(db, system.CLIActor(), username, group); err != nil {
+		msg := fmt.Sprintf("failed to set group for user %q", username)
+		if errors.Is(err, system.ErrInvalidGroup) {
+			fatal(
+				models.
+					Wrap("USER_GROUP_FAIL", models.ExitUsage, msg, err).
+					WithHint("group names are up to 255 characters without whitespace or ':'"),
+			)
+		}
+		fatal(models.Wrap("USER_GROUP_FAIL", models.ExitRuntime, msg, err))
+	}
+
+	if group == "" {
+		fmt.Printf("User %s removed from group.\n", username)
+		return
+	}
+	fmt.Printf("User %s is now in group %s.\n", username, group)
+}
+
+func rateTarget(scope system.RateScope, name string) string {
+	if scope == system.RateGlobal {
+		return "[global]"
+	}
+	return fmt.Sprintf("[%s] %s", scope, name)
+}
+
+func formatRate(bps int64) string {
+	if bps == 0 {
+		return "unlimited"
+	}
+	return system.FormatBytes(bps) + "/s"
+}
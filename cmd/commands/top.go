@@ -0,0 +1,557 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"proxychan/internal/models"
+	"proxychan/internal/server"
+	"proxychan/internal/system"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// top: a live view of the tunnels, fed by the admin API. It loads a
+// snapshot of the connections, then follows the event stream (open,
+// close, deny, auth_fail and periodic stats), like the web connections
+// page.
+
+const (
+	topSortThroughput = "throughput"
+	topSortAge        = "age"
+	topSortUser       = "user"
+
+	topMaxDenials = 50
+	topRedraw     = time.Second
+	topRetry      = 3 * time.Second
+)
+
+var topSorts = []string{topSortThroughput, topSortAge, topSortUser}
+
+type topState struct {
+	mu sync.Mutex
+
+	conns   map[uint64]*models.ActiveConn
+	denials []models.ConnEvent // newest first
+
+	sortBy   string
+	filter   string
+	editing  bool // typing a filter
+	selected uint64
+	confirm  uint64 // connection waiting for y/n before kill
+
+	status   string
+	statusAt time.Time
+}
+
+func (st *topState) setStatus(format string, args ...any) {
+	st.status = fmt.Sprintf(format, args...)
+	st.statusAt = time.Now()
+}
+
+// runTop reads the API token from PROXYCHAN_API_TOKEN, or prompts for it.
+func runTop() {
+	if !term.IsTerminal(int(os.Stdout.Fd())) || !term.IsTerminal(int(os.Stdin.Fd())) {
+		fatal(
+			models.NewCLIError(
+				"TOP_NO_TERMINAL",
+				models.ExitUsage,
+				"top needs an interactive terminal",
+			).
+				WithHint("use list-connections for a one-shot listing"),
+		)
+	}
+
+	token := os.Getenv("PROXYCHAN_API_TOKEN")
+	if token == "" {
+		token = promptPassword("API token")
+	}
+	if token == "" {
+		fatal(
+			models.NewCLIError(
+				"TOP_NO_TOKEN",
+				models.ExitUsage,
+				"top needs an API token",
+			).
+				WithHint("create one with create-api-token and pass it in PROXYCHAN_API_TOKEN"),
+		)
+	}
+
+	api, err := server.NewAdminAPI(token)
+	if err != nil {
+		fatal(controlError("TOP_CONNECT_FAIL", "failed to find the admin endpoint", err))
+	}
+
+	// fail before taking over the screen if the token or address is wrong
+	first, err := api.Connections()
+	if err != nil {
+		fatal(controlError("TOP_CONNECT_FAIL", "failed to load connections", err))
+	}
+
+	st := &topState{conns: make(map[uint64]*models.ActiveConn), sortBy: topSortThroughput}
+	st.loadSnapshot(first)
+
+	fd := int(os.Stdin.Fd())
+	old, err := term.MakeRaw(fd)
+	if err != nil {
+		fatal(models.Wrap("TOP_TERMINAL_FAIL", models.ExitIO, "failed to set up the terminal", err))
+	}
+	// alternate screen, hidden cursor
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Print("\x1b[?25h\x1b[?1049l")
+		_ = term.Restore(fd, old)
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go st.follow(ctx, api)
+
+	keys := make(chan []byte)
+	go readKeys(keys)
+
+	redraw := time.NewTicker(topRedraw)
+	defer redraw.Stop()
+
+	for {
+		st.draw(api.URL())
+
+		select {
+		case k, ok := <-keys:
+			if !ok || !st.handleKey(k, api) {
+				return
+			}
+		case <-redraw.C:
+		}
+	}
+}
+
+// follow keeps the event stream open, starting from a fresh snapshot
+// after every reconnect or resync.
+func (st *topState) follow(ctx context.Context, api *server.AdminAPI) {
+	for ctx.Err() == nil {
+		err := api.StreamEvents(ctx, models.EventFilter{}, func(event string, data []byte) {
+			st.apply(api, event, data)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+
+		st.mu.Lock()
+		st.setStatus("event stream lost: %v; retrying", err)
+		st.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(topRetry):
+		}
+		if conns, err := api.Connections(); err == nil {
+			st.mu.Lock()
+			st.loadSnapshot(conns)
+			st.mu.Unlock()
+		}
+	}
+}
+
+func (st *topState) loadSnapshot(conns []models.ActiveConn) {
+	st.conns = make(map[uint64]*models.ActiveConn, len(conns))
+	for i := range conns {
+		st.conns[conns[i].ID] = &conns[i]
+	}
+}
+
+func (st *topState) apply(api *server.AdminAPI, event string, data []byte) {
+	if event == "resync" {
+		conns, err := api.Connections()
+		st.mu.Lock()
+		if err == nil {
+			st.loadSnapshot(conns)
+		}
+		st.mu.Unlock()
+		return
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if event == "stats" {
+		var list []models.ConnStats
+		if json.Unmarshal(data, &list) != nil {
+			return
+		}
+		for _, s := range list {
+			if c, ok := st.conns[s.ID]; ok {
+				c.BytesUp, c.BytesDown = s.BytesUp, s.BytesDown
+				c.UpBps, c.DownBps = s.UpBps, s.DownBps
+				c.LastActivity = s.LastActivity
+				c.PolicyViolation = s.PolicyViolation
+			}
+		}
+		return
+	}
+
+	var ev models.ConnEvent
+	if json.Unmarshal(data, &ev) != nil {
+		return
+	}
+	switch ev.Type {
+	case models.EventOpen:
+		st.conns[ev.ID] = &models.ActiveConn{
+			ID:           ev.ID,
+			Username:     ev.Username,
+			SourceIP:     ev.SourceIP,
+			Destination:  ev.Destination,
+			Route:        ev.Route,
+			StartedAt:    ev.At,
+			LastActivity: ev.At,
+		}
+	case models.EventClose:
+		delete(st.conns, ev.ID)
+	case models.EventDeny, models.EventAuthFail:
+		st.denials = append([]models.ConnEvent{ev}, st.denials...)
+		if len(st.denials) > topMaxDenials {
+			st.denials = st.denials[:topMaxDenials]
+		}
+	}
+}
+
+// readKeys sends each chunk read from the terminal; an escape sequence
+// (arrow key) arrives as one chunk.
+func readKeys(out chan<- []byte) {
+	buf := make([]byte, 16)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			close(out)
+			return
+		}
+		out <- append([]byte(nil), buf[:n]...)
+	}
+}
+
+// handleKey applies one key press; false quits.
+func (st *topState) handleKey(k []byte, api *server.AdminAPI) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.editing {
+		switch {
+		case k[0] == '\r' || k[0] == '\n':
+			st.editing = false
+		case k[0] == 0x1b:
+			st.editing = false
+			st.filter = ""
+		case k[0] == 0x7f || k[0] == 0x08:
+			if r := []rune(st.filter); len(r) > 0 {
+				st.filter = string(r[:len(r)-1])
+			}
+		case k[0] >= 0x20:
+			st.filter += string(k)
+		}
+		return true
+	}
+
+	if st.confirm != 0 {
+		id := st.confirm
+		st.confirm = 0
+		if k[0] != 'y' && k[0] != 'Y' {
+			st.setStatus("kill cancelled")
+			return true
+		}
+		// the close event removes the row
+		if err := api.KillConnection(id); err != nil {
+			st.setStatus("kill %d failed: %v", id, err)
+		} else {
+			st.setStatus("killed connection %d", id)
+		}
+		return true
+	}
+
+	switch {
+	case k[0] == 'q' || k[0] == 0x03: // q, Ctrl-C
+		return false
+	case k[0] == 's':
+		for i, s := range topSorts {
+			if s == st.sortBy {
+				st.sortBy = topSorts[(i+1)%len(topSorts)]
+				break
+			}
+		}
+	case k[0] == '/':
+		st.editing = true
+	case k[0] == 0x1b && len(k) == 1:
+		st.filter = ""
+	case k[0] == 'j' || string(k) == "\x1b[B":
+		st.moveSelection(1)
+	case k[0] == 'k' || string(k) == "\x1b[A":
+		st.moveSelection(-1)
+	case k[0] == 'x':
+		if c, ok := st.conns[st.selected]; ok && st.visible(c) {
+			st.confirm = c.ID
+		} else {
+			st.setStatus("no connection selected")
+		}
+	}
+	return true
+}
+
+func (st *topState) visible(c *models.ActiveConn) bool {
+	if st.filter == "" {
+		return true
+	}
+	f := strings.ToLower(st.filter)
+	return strings.Contains(strings.ToLower(c.Username), f) ||
+		strings.Contains(c.SourceIP, f) ||
+		strings.Contains(strings.ToLower(c.Destination), f)
+}
+
+// view returns the visible tunnels in display order.
+func (st *topState) view() []*models.ActiveConn {
+	out := make([]*models.ActiveConn, 0, len(st.conns))
+	for _, c := range st.conns {
+		if st.visible(c) {
+			out = append(out, c)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		switch st.sortBy {
+		case topSortAge:
+			if !a.StartedAt.Equal(b.StartedAt) {
+				return a.StartedAt.Before(b.StartedAt)
+			}
+		case topSortUser:
+			if a.Username != b.Username {
+				return a.Username < b.Username
+			}
+		default:
+			if ra, rb := a.UpBps+a.DownBps, b.UpBps+b.DownBps; ra != rb {
+				return ra > rb
+			}
+		}
+		return a.ID < b.ID
+	})
+	return out
+}
+
+func (st *topState) moveSelection(delta int) {
+	v := st.view()
+	if len(v) == 0 {
+		return
+	}
+	i := 0
+	for n, c := range v {
+		if c.ID == st.selected {
+			i = n + delta
+			break
+		}
+	}
+	i = max(0, min(len(v)-1, i))
+	st.selected = v[i].ID
+}
+
+type topUserTotal struct {
+	user     string
+	tunnels  int
+	up, down int64
+	upBps    int64
+	downBps  int64
+}
+
+func perUserTotals(conns []*models.ActiveConn) []topUserTotal {
+	byUser := make(map[string]*topUserTotal)
+	for _, c := range conns {
+		u := c.Username
+		if u == "" {
+			u = "-"
+		}
+		t, ok := byUser[u]
+		if !ok {
+			t = &topUserTotal{user: u}
+			byUser[u] = t
+		}
+		t.tunnels++
+		t.up += c.BytesUp
+		t.down += c.BytesDown
+		t.upBps += c.UpBps
+		t.downBps += c.DownBps
+	}
+
+	out := make([]topUserTotal, 0, len(byUser))
+	for _, t := range byUser {
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		ri, rj := out[i].upBps+out[i].downBps, out[j].upBps+out[j].downBps
+		if ri != rj {
+			return ri > rj
+		}
+		return out[i].user < out[j].user
+	})
+	return out
+}
+
+func (st *topState) draw(addr string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width < 40 || height < 12 {
+		width, height = 80, 24
+	}
+
+	view := st.view()
+	if _, ok := st.conns[st.selected]; !ok && len(view) > 0 {
+		st.selected = view[0].ID
+	}
+	users := perUserTotals(view)
+
+	var upBps, downBps int64
+	for _, c := range view {
+		upBps += c.UpBps
+		downBps += c.DownBps
+	}
+
+	var lines []string
+	lines = append(lines,
+		fmt.Sprintf("proxychan top  %s  tunnels %d/%d  ↑ %s/s ↓ %s/s  sort: %s",
+			strings.TrimSuffix(addr, "/api/v1"), len(view), len(st.conns),
+			system.FormatBytes(upBps), system.FormatBytes(downBps), st.sortBy),
+		"",
+	)
+
+	// the tunnel list gets what the user totals and denials leave
+	userRows := min(len(users), 5)
+	denialRows := min(len(st.denials), 5)
+	tunnelRows := height - len(lines) - 1 - (userRows + 2) - (denialRows + 2) - 2
+	tunnelRows = max(tunnelRows, 3)
+
+	dstWidth := max(width-79, 12)
+	lines = append(lines, fmt.Sprintf("  %-7s %-12s %-15s %-*s %8s %9s %9s %9s",
+		"ID", "USER", "SOURCE", dstWidth, "DESTINATION", "AGE", "UP/s", "DOWN/s", "TOTAL"))
+
+	// keep the selected row on screen
+	first := 0
+	for i, c := range view {
+		if c.ID == st.selected && i >= tunnelRows {
+			first = i - tunnelRows + 1
+		}
+	}
+	for i := first; i < len(view) && i < first+tunnelRows; i++ {
+		c := view[i]
+		marker := " "
+		if c.ID == st.selected {
+			marker = ">"
+		}
+		user := c.Username
+		if user == "" {
+			user = "-"
+		}
+		line := fmt.Sprintf("%s %-7d %-12s %-15s %-*s %8s %9s %9s %9s",
+			marker, c.ID, clip(user, 12), clip(c.SourceIP, 15), dstWidth, clip(c.Destination, dstWidth),
+			topAge(time.Since(c.StartedAt)),
+			system.FormatBytes(c.UpBps), system.FormatBytes(c.DownBps),
+			system.FormatBytes(c.BytesUp+c.BytesDown))
+		if c.PolicyViolation != "" {
+			line += "  ! " + c.PolicyViolation
+		}
+		if c.ID == st.selected {
+			line = "\x1b[7m" + clip(line, width) + "\x1b[0m"
+		}
+		lines = append(lines, line)
+	}
+	if len(view) == 0 {
+		lines = append(lines, "  no active connections")
+	}
+
+	lines = append(lines, "", "PER USER")
+	for _, u := range users[:userRows] {
+		lines = append(lines, fmt.Sprintf("  %-16s %4d tunnels  ↑ %9s/s ↓ %9s/s  total %s",
+			clip(u.user, 16), u.tunnels, system.FormatBytes(u.upBps), system.FormatBytes(u.downBps),
+			system.FormatBytes(u.up+u.down)))
+	}
+
+	lines = append(lines, "", "RECENT DENIALS")
+	for _, ev := range st.denials[:denialRows] {
+		user := ev.Username
+		if user == "" {
+			user = "-"
+		}
+		line := fmt.Sprintf("  %s %-9s %-12s %-15s", ev.At.Local().Format("15:04:05"),
+			strings.ToUpper(ev.Type), clip(user, 12), ev.SourceIP)
+		if ev.Destination != "" {
+			line += " " + ev.Destination
+		}
+		lines = append(lines, line+" ("+ev.Reason+")")
+	}
+
+	// fill, then put the key help / prompt on the last line
+	for len(lines) < height-1 {
+		lines = append(lines, "")
+	}
+	lines = lines[:height-1]
+
+	var bottom string
+	switch {
+	case st.editing:
+		bottom = "filter: " + st.filter + "_   (enter: keep, esc: clear)"
+	case st.confirm != 0:
+		c := st.conns[st.confirm]
+		if c != nil {
+			bottom = fmt.Sprintf("kill connection %d (%s -> %s)? y/n", c.ID, c.SourceIP, c.Destination)
+		} else {
+			bottom = "connection already closed; press any key"
+		}
+	default:
+		bottom = "[s]ort [/]filter [j/k]select [x]kill [q]uit"
+		if st.filter != "" {
+			bottom += "   filter: " + st.filter
+		}
+		if st.status != "" && time.Since(st.statusAt) < 5*time.Second {
+			bottom += "   " + st.status
+		}
+	}
+	lines = append(lines, bottom)
+
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for i, l := range lines {
+		if !strings.HasPrefix(l, "\x1b[7m") {
+			l = clip(l, width)
+		}
+		b.WriteString(l)
+		b.WriteString("\x1b[K")
+		if i < len(lines)-1 {
+			b.WriteString("\r\n")
+		}
+	}
+	fmt.Print(b.String())
+}
+
+// clip shortens s to n runes.
+func clip(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	if n <= 1 {
+		return string(r[:n])
+	}
+	return string(r[:n-1]) + "…"
+}
+
+func topAge(d time.Duration) string {
+	d = d.Truncate(time.Second)
+	if d >= time.Hour {
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return d.String()
+}
@@ -13,22 +13,60 @@ import (
 	"golang.org/x/term"
 )
 
-func runAddUser(db *sql.DB) {
-	username := prompt("Username")
-	pass1 := promptPassword("Password")
-	pass2 := promptPassword("Confirm password")
+// add-user [name] [--password-stdin | --password-env VAR | --generate]
+// Without a name it prompts for both; with a name and no option it
+// prompts for the password (or reads it from piped stdin).
+func runAddUser(db *sql.DB, username string, cfg models.FlagConfig) {
+	var password, generated string
+	switch {
+	case username == "":
+		if cfg.PasswordStdin || cfg.PasswordEnv != "" || cfg.GeneratePassword {
+			fatal(
+				models.NewCLIError(
+					"USER_ADD_USAGE",
+					models.ExitUsage,
+					"a username is required with --password-stdin, --password-env or --generate",
+				).
+					WithHint("proxychan add-user <name> --generate"),
+			)
+		}
+		username = prompt("Username")
+		password = promptPassword("Password")
+		if promptPassword("Confirm password") != password {
+			fatal(
+				models.NewCLIError(
+					"USER_PASS_MISMATCH",
+					models.ExitUsage,
+					"passwords do not match",
+				),
+			)
+		}
+	default:
+		password, generated = passwordFromOptions(cfg)
+	}
 
-	if pass1 != pass2 {
+	if password == "" {
 		fatal(
 			models.NewCLIError(
-				"USER_PASS_MISMATCH",
+				"USER_PASS_EMPTY",
 				models.ExitUsage,
-				"passwords do not match",
+				"password cannot be empty",
 			),
 		)
 	}
 
-	if err := system.AddUser(db, username, pass1); err != nil {
+	if !system.ValidUsername(username) {
+		fatal(
+			models.NewCLIError(
+				"USER_ADD_FAIL",
+				models.ExitUsage,
+				fmt.Sprintf("invalid username %q", username),
+			).
+				WithHint("use 1-255 characters without whitespace or ':'"),
+		)
+	}
+
+	if err := system.AddUser(db, system.CLIActor(), username, password); err != nil {
 		fatal(
 			models.
 				Wrap(
@@ -40,7 +78,85 @@ func runAddUser(db *sql.DB) {
 		)
 	}
 
+	if structuredOutput() {
+		emit(
+			addedUser{Username: username, Password: generated},
+			[]string{"username", "password"},
+			[][]string{{username, generated}},
+		)
+		return
+	}
+
 	fmt.Println("user added:", username)
+	if generated != "" {
+		// shown once; only the hash is stored
+		fmt.Println("password:", generated)
+	}
+}
+
+// addedUser is add-user's JSON; Password is set only when generated.
+type addedUser struct {
+	Username string `json:"username"`
+	Password string `json:"password,omitempty"`
+}
+
+// passwordFromOptions applies --password-stdin, --password-env and
+// --generate (at most one). generated is set only for --generate. With
+// none of them it behaves like passwd-user.
+func passwordFromOptions(cfg models.FlagConfig) (password, generated string) {
+	n := 0
+	for _, set := range []bool{cfg.PasswordStdin, cfg.PasswordEnv != "", cfg.GeneratePassword} {
+		if set {
+			n++
+		}
+	}
+	if n > 1 {
+		fatal(
+			models.NewCLIError(
+				"PASSWORD_OPTION_CONFLICT",
+				models.ExitUsage,
+				"use only one of --password-stdin, --password-env and --generate",
+			),
+		)
+	}
+
+	switch {
+	case cfg.PasswordStdin:
+		password = readPasswordStdin()
+	case cfg.PasswordEnv != "":
+		password = os.Getenv(cfg.PasswordEnv)
+		if password == "" {
+			fatal(
+				models.NewCLIError(
+					"PASSWORD_ENV_EMPTY",
+					models.ExitUsage,
+					fmt.Sprintf("environment variable %s is empty or not set", cfg.PasswordEnv),
+				),
+			)
+		}
+	case cfg.GeneratePassword:
+		password = mustGeneratePassword()
+		generated = password
+	default:
+		password = readNewPassword()
+	}
+	return password, generated
+}
+
+func mustGeneratePassword() string {
+	p, err := system.GeneratePassword()
+	if err != nil {
+		fatal(
+			models.
+				Wrap(
+					"PASSWORD_GENERATE_FAIL",
+					models.ExitRuntime,
+					"failed to generate a password",
+					err,
+				),
+		)
+	}
+	return p
 }
 
 func runListUsers(db *sql.DB) {
@@ -57,6 +173,11 @@ func runListUsers(db *sql.DB) {
 		)
 	}
 
+	if structuredOutput() {
+		emitUsers(db, users)
+		return
+	}
+
 	if len(users) == 0 {
 		fmt.Println("no users defined")
 		return
@@ -79,7 +200,23 @@ func runListUsers(db *sql.DB) {
 	}
 }
 
+// userDetail is list-user's JSON: the user and their quota, if any.
+type userDetail struct {
+	*system.UserInfo
+	Quota *system.UserQuota `json:"quota,omitempty"`
+}
+
 func runListUser(db *sql.DB, username string) {
+	if structuredOutput() {
+		u := loadUserInfo(db, username)
+		if outputFormat == OutputCSV {
+			emit(nil, userCSVHeader, [][]string{userCSVRow(u)})
+			return
+		}
+		emit(userDetail{UserInfo: u, Quota: loadUserQuota(db, username)}, nil, nil)
+		return
+	}
+
 	status, err := system.ListUserByUsername(db, username)
 	if err != nil {
 		fatal(
@@ -94,10 +231,51 @@ func runListUser(db *sql.DB, username string) {
 	}
 
 	fmt.Printf("User %s is %s\n", username, status)
+	printUserQuota(db, username)
+}
+
+var userCSVHeader = []string{
+	"username", "group", "active", "blocked", "locked_until", "created_at",
+	"expires_at", "password_changed_at", "password_expires_at",
+}
+
+func userCSVRow(u *system.UserInfo) []string {
+	return []string{
+		u.Username, u.Group, csvBool(u.Active), csvBool(u.Blocked), csvTime(u.LockedUntil), csvTime(u.CreatedAt),
+		csvTime(u.ExpiresAt), csvTime(u.PasswordChangedAt), csvTime(u.PasswordExpiresAt),
+	}
+}
+
+func loadUserInfo(db *sql.DB, username string) *system.UserInfo {
+	u, err := system.GetUserInfo(db, username)
+	if err != nil {
+		fatal(
+			models.
+				Wrap(
+					"USER_STATUS_FAIL",
+					models.ExitRuntime,
+					fmt.Sprintf("failed to read status for user %q", username),
+					err,
+				),
+		)
+	}
+	return u
+}
+
+// emitUsers is the --output json|csv form of list-users.
+func emitUsers(db *sql.DB, names []string) {
+	infos := make([]*system.UserInfo, 0, len(names))
+	rows := make([][]string, 0, len(names))
+	for _, n := range names {
+		u := loadUserInfo(db, n)
+		infos = append(infos, u)
+		rows = append(rows, userCSVRow(u))
+	}
+	emit(infos, userCSVHeader, rows)
 }
 
 func runDeleteUser(db *sql.DB, username string) {
-	if err := system.DeleteUser(db, username); err != nil {
+	if err := system.DeleteUser(db, system.CLIActor(), username); err != nil {
 		fatal(
 			models.
 				Wrap(
@@ -113,7 +291,7 @@ func runDeleteUser(db *sql.DB, username string) {
 }
 
 func runActivateUser(db *sql.DB, username string) {
-	if err := system.ActivateUser(db, username); err != nil {
+	if err := system.ActivateUser(db, system.CLIActor(), username); err != nil {
 		fatal(
 			models.
 				Wrap(
@@ -129,7 +307,7 @@ func runActivateUser(db *sql.DB, username string) {
 }
 
 func runDeactivateUser(db *sql.DB, username string) {
-	if err := system.DeactivateUser(db, username); err != nil {
+	if err := system.DeactivateUser(db, system.CLIActor(), username); err != nil {
 		fatal(
 			models.
 				Wrap(
@@ -144,8 +322,40 @@ func runDeactivateUser(db *sql.DB, username string) {
 	fmt.Printf("User %s deactivated.\n", username)
 }
 
+func runBlockUser(db *sql.DB, username string) {
+	if err := system.BlockUser(db, system.CLIActor(), username); err != nil {
+		fatal(
+			models.
+				Wrap(
+					"USER_BLOCK_FAIL",
+					models.ExitRuntime,
+					fmt.Sprintf("failed to block user %q", username),
+					err,
+				),
+		)
+	}
+
+	fmt.Printf("User %s blocked.\n", username)
+}
+
+func runUnlockUser(db *sql.DB, username string) {
+	if err := system.UnlockUser(db, system.CLIActor(), username); err != nil {
+		fatal(
+			models.
+				Wrap(
+					"USER_UNLOCK_FAIL",
+					models.ExitRuntime,
+					fmt.Sprintf("failed to unlock user %q", username),
+					err,
+				),
+		)
+	}
+
+	fmt.Printf("User %s unlocked.\n", username)
+}
+
 func runActivateAllUsers(db *sql.DB) {
-	if err := system.ActivateAllUsers(db); err != nil {
+	if err := system.ActivateAllUsers(db, system.CLIActor()); err != nil {
 		fatal(
 			models.
 				Wrap(
@@ -161,7 +371,7 @@ func runActivateAllUsers(db *sql.DB) {
 }
 
 func runDeactivateAllUsers(db *sql.DB) {
-	if err := system.DeactivateAllUsers(db); err != nil {
+	if err := system.DeactivateAllUsers(db, system.CLIActor()); err != nil {
 		fatal(
 			models.
 				Wrap(
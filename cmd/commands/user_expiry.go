@@ -0,0 +1,223 @@
+package commands
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"proxychan/internal/models"
+	"proxychan/internal/system"
+
+	"golang.org/x/term"
+)
+
+// parseExpiry accepts "never", a date (2006-01-02), an RFC3339 timestamp
+// or a duration from now (30d, 12h).
+func parseExpiry(s string) (time.Time, error) {
+	if strings.EqualFold(s, "never") {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := system.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().Add(d), nil
+}
+
+// set-user-expiry <username> <date|duration|never>
+func runSetUserExpiry(db *sql.DB, username, when string) {
+	at, err := parseExpiry(when)
+	if err != nil {
+		fatal(
+			models.
+				Wrap("USER_EXPIRY_PARSE_FAIL", models.ExitUsage,
+					fmt.Sprintf("invalid expiry %q", when),
+					err).
+				WithHint("use a date (2026-12-31), a duration from now (30d) or never"),
+		)
+	}
+
+	if err := system.SetUserExpiry(db, system.CLIActor(), username, at); err != nil {
+		fatal(
+			models.
+				Wrap(
+					"USER_EXPIRY_SET_FAIL",
+					models.ExitRuntime,
+					fmt.Sprintf("failed to set expiry for user %q", username),
+					err,
+				),
+		)
+	}
+
+	if at.IsZero() {
+		fmt.Printf("User %s no longer expires.\n", username)
+		return
+	}
+	fmt.Printf("User %s expires %s.\n", username, at.Local().Format("2006-01-02 15:04"))
+}
+
+// passwd-user <username>
+// The new password is read from stdin, so it can be piped in by scripts;
+// on a terminal it is prompted for without echo.
+func runPasswdUser(db *sql.DB, username string) {
+	password := readNewPassword()
+
+	if err := system.ChangePassword(db, system.CLIActor(), username, password); err != nil {
+		fatal(
+			models.
+				Wrap(
+					"USER_PASSWD_FAIL",
+					models.ExitRuntime,
+					fmt.Sprintf("failed to change password for user %q", username),
+					err,
+				),
+		)
+	}
+
+	fmt.Printf("Password changed for user %s.\n", username)
+}
+
+// readNewPassword prompts twice on a terminal, otherwise reads one
+// password from stdin so scripts can pipe it in.
+func readNewPassword() string {
+	var password string
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		pass1 := promptPassword("New password")
+		pass2 := promptPassword("Confirm password")
+		if pass1 != pass2 {
+			fatal(
+				models.NewCLIError(
+					"USER_PASS_MISMATCH",
+					models.ExitUsage,
+					"passwords do not match",
+				),
+			)
+		}
+		password = pass1
+	} else {
+		password = readPasswordStdin()
+	}
+	return password
+}
+
+// readPasswordStdin reads one password from stdin, without the trailing
+// newline.
+func readPasswordStdin() string {
+	b, err := io.ReadAll(io.LimitReader(os.Stdin, 4096))
+	if err != nil {
+		fatal(
+			models.
+				Wrap(
+					"PASSWORD_READ_FAIL",
+					models.ExitIO,
+					"failed to read password from stdin",
+					err,
+				),
+		)
+	}
+	return strings.TrimRight(string(b), "\r\n")
+}
+
+// set-password-max-age <duration|0>
+func runSetPasswordMaxAge(db *sql.DB, ageStr string) {
+	age, err := system.ParseDuration(ageStr)
+	if err != nil {
+		fatal(
+			models.
+				Wrap("PASSWORD_AGE_PARSE_FAIL", models.ExitUsage,
+					fmt.Sprintf("invalid password age %q", ageStr),
+					err).
+				WithHint("use a duration like 90d, or 0 to disable rotation"),
+		)
+	}
+
+	if err := system.SetPasswordMaxAge(db, system.CLIActor(), age); err != nil {
+		fatal(
+			models.
+				Wrap(
+					"PASSWORD_AGE_SET_FAIL",
+					models.ExitRuntime,
+					"failed to set maximum password age",
+					err,
+				),
+		)
+	}
+
+	if age == 0 {
+		fmt.Println("password rotation disabled")
+		return
+	}
+	fmt.Printf("maximum password age: %s\n", system.FormatDuration(age))
+}
+
+// list-users --expiring <duration>
+func runListExpiringUsers(db *sql.DB, withinStr string) {
+	within, err := system.ParseDuration(withinStr)
+	if err != nil {
+		fatal(
+			models.
+				Wrap("USER_EXPIRY_PARSE_FAIL", models.ExitUsage,
+					fmt.Sprintf("invalid period %q", withinStr),
+					err).
+				WithHint("use a duration like 7d or 48h"),
+		)
+	}
+
+	now := time.Now()
+	users, err := system.ListExpiringUsers(db, within, now)
+	if err != nil {
+		fatal(
+			models.
+				Wrap(
+					"USER_LIST_FAIL",
+					models.ExitRuntime,
+					"failed to list expiring users",
+					err,
+				),
+		)
+	}
+
+	if structuredOutput() {
+		names := make([]string, 0, len(users))
+		for _, u := range users {
+			names = append(names, u.Username)
+		}
+		emitUsers(db, names)
+		return
+	}
+
+	if len(users) == 0 {
+		fmt.Printf("no users expiring within %s\n", system.FormatDuration(within))
+		return
+	}
+
+	fmt.Printf("EXPIRING WITHIN %s\n", system.FormatDuration(within))
+	fmt.Println("----------------------------------------------")
+	for _, u := range users {
+		fmt.Printf("%-16s account: %-22s password: %s\n",
+			u.Username,
+			formatExpiry(u.ExpiresAt, now),
+			formatExpiry(u.PasswordExpiresAt, now),
+		)
+	}
+}
+
+func formatExpiry(t, now time.Time) string {
+	switch {
+	case t.IsZero():
+		return "never"
+	case !now.Before(t):
+		return "EXPIRED " + t.Local().Format("2006-01-02")
+	default:
+		return t.Local().Format("2006-01-02 15:04")
+	}
+}
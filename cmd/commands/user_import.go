@@ -0,0 +1,233 @@
+package commands
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"proxychan/internal/models"
+	"proxychan/internal/system"
+)
+
+// Columns of import-users; only username is required.
+var importColumns = []string{"username", "password", "active", "expires", "group"}
+
+// importRow is one line of the import-users report.
+type importRow struct {
+	system.ImportResult
+	Password string `json:"password,omitempty"` // only when generated
+}
+
+// import-users <users.csv|-> [--generate]
+// All users are created in one transaction; rows that fail are reported
+// and skipped. Exits non-zero if any row failed.
+func runImportUsers(db *sql.DB, path string, cfg models.FlagConfig) {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			fatal(
+				models.
+					Wrap(
+						"IMPORT_READ_FAIL",
+						models.ExitIO,
+						fmt.Sprintf("failed to open %s", path),
+						err,
+					),
+			)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	users, report := parseImportCSV(in, cfg.GeneratePassword)
+
+	results, err := system.ImportUsers(db, system.CLIActor(), users)
+	if err != nil {
+		fatal(
+			models.
+				Wrap(
+					"IMPORT_FAIL",
+					models.ExitRuntime,
+					"failed to import users (nothing was created)",
+					err,
+				),
+		)
+	}
+
+	for i, res := range results {
+		r := report[users[i].Line]
+		r.ImportResult = res
+		if !res.Created {
+			r.Password = ""
+		}
+		report[users[i].Line] = r
+	}
+
+	rows := make([]importRow, 0, len(report))
+	for _, r := range report {
+		rows = append(rows, r)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Line < rows[j].Line })
+
+	failed := 0
+	for _, r := range rows {
+		if !r.Created {
+			failed++
+		}
+	}
+
+	if structuredOutput() {
+		out := make([][]string, 0, len(rows))
+		for _, r := range rows {
+			out = append(out, []string{strconv.Itoa(r.Line), r.Username, csvBool(r.Created), r.Password, r.Error})
+		}
+		emit(rows, []string{"line", "username", "created", "password", "error"}, out)
+	} else {
+		for _, r := range rows {
+			switch {
+			case !r.Created:
+				fmt.Printf("line %-5d %-20s FAILED: %s\n", r.Line, r.Username, r.Error)
+			case r.Password != "":
+				fmt.Printf("line %-5d %-20s created, password: %s\n", r.Line, r.Username, r.Password)
+			default:
+				fmt.Printf("line %-5d %-20s created\n", r.Line, r.Username)
+			}
+		}
+		fmt.Printf("%d of %d users created\n", len(rows)-failed, len(rows))
+	}
+
+	if failed > 0 {
+		fatal(
+			models.NewCLIError(
+				"IMPORT_PARTIAL",
+				models.ExitRuntime,
+				fmt.Sprintf("%d of %d rows failed", failed, len(rows)),
+			),
+		)
+	}
+}
+
+// parseImportCSV reads the users to create, keyed by line in the report.
+// Rows that can't be parsed are reported and left out of the import.
+func parseImportCSV(in io.Reader, generate bool) ([]system.UserImport, map[int]importRow) {
+	r := csv.NewReader(in)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		fatal(
+			models.
+				Wrap(
+					"IMPORT_READ_FAIL",
+					models.ExitIO,
+					"failed to read the CSV header",
+					err,
+				).
+				WithHint("the first line names the columns: " + strings.Join(importColumns, ",")),
+		)
+	}
+
+	col := make(map[string]int)
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		if !slices.Contains(importColumns, h) {
+			fatal(
+				models.NewCLIError(
+					"IMPORT_BAD_HEADER",
+					models.ExitUsage,
+					fmt.Sprintf("unknown column %q", h),
+				).
+					WithHint("columns: " + strings.Join(importColumns, ",")),
+			)
+		}
+		col[h] = i
+	}
+	if _, ok := col["username"]; !ok {
+		fatal(
+			models.NewCLIError(
+				"IMPORT_BAD_HEADER",
+				models.ExitUsage,
+				"the CSV has no username column",
+			).
+				WithHint("columns: " + strings.Join(importColumns, ",")),
+		)
+	}
+
+	var users []system.UserImport
+	report := make(map[int]importRow)
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var pe *csv.ParseError
+			if !errors.As(err, &pe) {
+				fatal(models.Wrap("IMPORT_READ_FAIL", models.ExitIO, "failed to read the CSV", err))
+			}
+			report[pe.StartLine] = importRow{ImportResult: system.ImportResult{Line: pe.StartLine, Error: pe.Err.Error()}}
+			continue
+		}
+		line, _ := r.FieldPos(0)
+
+		raw := func(name string) string {
+			if i, ok := col[name]; ok && i < len(rec) {
+				return rec[i]
+			}
+			return ""
+		}
+		field := func(name string) string { return strings.TrimSpace(raw(name)) }
+
+		// the password is taken as is; spaces may be part of it
+		u := system.UserImport{Line: line, Username: field("username"), Password: raw("password"), Group: field("group")}
+		row := importRow{ImportResult: system.ImportResult{Line: line, Username: u.Username}}
+
+		if err := parseImportRow(&u, field("active"), field("expires")); err != nil {
+			row.Error = err.Error()
+			report[line] = row
+			continue
+		}
+		if u.Password == "" {
+			if !generate {
+				row.Error = "password is empty (use --generate to create one)"
+				report[line] = row
+				continue
+			}
+			u.Password = mustGeneratePassword()
+			row.Password = u.Password
+		}
+
+		users = append(users, u)
+		report[line] = row
+	}
+	return users, report
+}
+
+func parseImportRow(u *system.UserImport, active, expires string) error {
+	switch strings.ToLower(active) {
+	case "", "0", "false", "no", "inactive":
+		u.Active = false
+	case "1", "true", "yes", "active":
+		u.Active = true
+	default:
+		return fmt.Errorf("invalid active value %q (true or false)", active)
+	}
+
+	if expires != "" {
+		at, err := parseExpiry(expires)
+		if err != nil {
+			return fmt.Errorf("invalid expires value %q (date, duration from now or never)", expires)
+		}
+		u.ExpiresAt = at
+	}
+	return nil
+}
@@ -3,13 +3,14 @@ package commands
 import (
 	"database/sql"
 	"fmt"
+	"strconv"
 
 	"proxychan/internal/models"
 	"proxychan/internal/system"
 )
 
 func runAllowIP(db *sql.DB, ip string) {
-	if err := system.AllowIP(db, ip); err != nil {
+	if err := system.AllowIP(db, system.CLIActor(), ip); err != nil {
 		fatal(
 			models.
 				Wrap(
@@ -37,7 +38,7 @@ func runAllowIP(db *sql.DB, ip string) {
 }
 
 func runBlockIP(db *sql.DB, ip string) {
-	if err := system.BlockIP(db, ip); err != nil {
+	if err := system.BlockIP(db, system.CLIActor(), ip); err != nil {
 		fatal(
 			models.
 				Wrap(
@@ -65,7 +66,7 @@ func runBlockIP(db *sql.DB, ip string) {
 }
 
 func runDeleteIP(db *sql.DB, ip string) {
-	if err := system.DeleteIP(db, ip); err != nil {
+	if err := system.DeleteIP(db, system.CLIActor(), ip); err != nil {
 		fatal(
 			models.
 				Wrap(
@@ -106,6 +107,15 @@ func runListWhitelist(db *sql.DB) {
 		)
 	}
 
+	if structuredOutput() {
+		rows := make([][]string, 0, len(entries))
+		for _, e := range entries {
+			rows = append(rows, []string{e.CIDR, csvBool(e.Enabled)})
+		}
+		emit(entries, []string{"cidr", "enabled"}, rows)
+		return
+	}
+
 	if len(entries) == 0 {
 		fmt.Println("source whitelist is empty")
 		return
@@ -136,6 +146,13 @@ func runWhitelistStatus(db *sql.DB) {
 		)
 	}
 
+	if structuredOutput() {
+		emit(s, []string{"version", "total", "enabled", "disabled"}, [][]string{{
+			csvInt(s.Version), strconv.Itoa(s.Total), strconv.Itoa(s.Enabled), strconv.Itoa(s.Disabled),
+		}})
+		return
+	}
+
 	fmt.Printf(
 		"version=%d total=%d enabled=%d disabled=%d\n",
 		s.Version,
@@ -146,7 +163,7 @@ func runWhitelistStatus(db *sql.DB) {
 }
 
 func runClearWhitelist(db *sql.DB) {
-	if err := system.ClearWhitelist(db); err != nil {
+	if err := system.ClearWhitelist(db, system.CLIActor()); err != nil {
 		fatal(
 			models.
 				Wrap(
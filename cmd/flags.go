@@ -2,11 +2,16 @@ package cmd
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"os/user"
+	"path/filepath"
 	"proxychan/cmd/commands"
 	"proxychan/internal/dialer"
 	"proxychan/internal/logging"
 	"proxychan/internal/models"
+	"proxychan/internal/server"
+	"proxychan/internal/system"
 
 	"github.com/spf13/pflag"
 )
@@ -78,6 +83,186 @@ func defineFlags() {
 		cfg.ChainConfig,
 		"path to YAML chain config (required when -dynamic-chain=true)",
 	)
+
+	pflag.IntVar(
+		&cfg.MaxConns,
+		"max-conns",
+		cfg.MaxConns,
+		"maximum concurrent tunnels (0 = unlimited)",
+	)
+
+	pflag.IntVar(
+		&cfg.MaxConnsPerUser,
+		"max-conns-per-user",
+		cfg.MaxConnsPerUser,
+		"maximum concurrent tunnels per user (0 = unlimited)",
+	)
+
+	pflag.IntVar(
+		&cfg.MaxConnsPerSource,
+		"max-conns-per-source",
+		cfg.MaxConnsPerSource,
+		"maximum concurrent tunnels per source IP (0 = unlimited)",
+	)
+
+	pflag.IntVar(
+		&cfg.LockoutThreshold,
+		"lockout-threshold",
+		cfg.LockoutThreshold,
+		"failed logins within --lockout-window that lock an account/source (0 disables)",
+	)
+
+	pflag.DurationVar(
+		&cfg.LockoutWindow,
+		"lockout-window",
+		cfg.LockoutWindow,
+		"window in which failed logins are counted",
+	)
+
+	pflag.DurationVar(
+		&cfg.LockoutDuration,
+		"lockout-duration",
+		cfg.LockoutDuration,
+		"how long a locked account/source is refused",
+	)
+
+	pflag.IntVar(
+		&cfg.BanThreshold,
+		"ban-threshold",
+		cfg.BanThreshold,
+		"offenses within --ban-window that ban a source IP (0 disables)",
+	)
+
+	pflag.DurationVar(
+		&cfg.BanWindow,
+		"ban-window",
+		cfg.BanWindow,
+		"window in which source offenses are counted",
+	)
+
+	pflag.DurationVar(
+		&cfg.BanDuration,
+		"ban-duration",
+		cfg.BanDuration,
+		"how long a banned source IP is refused",
+	)
+
+	pflag.StringVar(
+		&cfg.PolicyEnforcement,
+		"policy-enforcement",
+		cfg.PolicyEnforcement,
+		"open tunnels no longer allowed after a policy change: close | flag",
+	)
+
+	pflag.StringVar(
+		&cfg.MetricsListen,
+		"metrics-listen",
+		cfg.MetricsListen,
+		"serve Prometheus /metrics on this address as well (no login)",
+	)
+
+	pflag.BoolVar(
+		&cfg.MetricsPerUser,
+		"metrics-per-user",
+		cfg.MetricsPerUser,
+		"label tunnel metrics by user (one series per user)",
+	)
+
+	pflag.DurationVar(
+		&cfg.AdminSessionIdle,
+		"admin-session-idle",
+		cfg.AdminSessionIdle,
+		"admin web session ends after this long without requests",
+	)
+
+	pflag.DurationVar(
+		&cfg.AdminSessionMax,
+		"admin-session-max",
+		cfg.AdminSessionMax,
+		"admin web session ends this long after login, even if in use",
+	)
+
+	pflag.StringVar(
+		&cfg.AdminListen,
+		"admin-listen",
+		cfg.AdminListen,
+		"admin web interface and API address",
+	)
+
+	pflag.BoolVar(
+		&cfg.AdminTLS,
+		"admin-tls",
+		cfg.AdminTLS,
+		"serve the admin endpoint over HTTPS (self-signed certificate unless --admin-tls-cert is set)",
+	)
+
+	pflag.StringVar(
+		&cfg.AdminTLSCert,
+		"admin-tls-cert",
+		cfg.AdminTLSCert,
+		"PEM certificate for the admin endpoint (implies --admin-tls)",
+	)
+
+	pflag.StringVar(
+		&cfg.AdminTLSKey,
+		"admin-tls-key",
+		cfg.AdminTLSKey,
+		"PEM private key for --admin-tls-cert",
+	)
+
+	pflag.StringVar(
+		&cfg.AdminAllow,
+		"admin-allow",
+		cfg.AdminAllow,
+		"only accept admin connections from these IPs/CIDRs, comma-separated (loopback always allowed)",
+	)
+
+	pflag.StringVar(
+		&cfg.ControlGroup,
+		"control-group",
+		cfg.ControlGroup,
+		"members of this group may use the control socket besides root (Linux)",
+	)
+
+	pflag.StringVar(
+		&cfg.ControlSocket,
+		"control-socket",
+		cfg.ControlSocket,
+		"control socket path, for the service and the commands that talk to it (Linux, default "+system.DefaultControlSocketPath+")",
+	)
+
+	pflag.StringVar(
+		&cfg.Output,
+		"output",
+		cfg.Output,
+		"listing format: table | json | csv (json also reports errors as JSON on stderr)",
+	)
+
+	pflag.StringVar(
+		&cfg.Expiring,
+		"expiring",
+		cfg.Expiring,
+		"list-users: only users whose account or password expires within this period (e.g. 7d)",
+	)
+
+	pflag.BoolVar(&cfg.PasswordStdin, "password-stdin", cfg.PasswordStdin, "add-user: read the password from stdin")
+	pflag.StringVar(&cfg.PasswordEnv, "password-env", cfg.PasswordEnv, "add-user: read the password from this environment variable")
+	pflag.BoolVar(&cfg.GeneratePassword, "generate", cfg.GeneratePassword, "add-user/import-users: generate missing passwords and print them once")
+
+	pflag.BoolVar(&cfg.PolicyPrune, "prune", cfg.PolicyPrune, "policy plan/apply: remove users, rules and settings that are not in the file")
+	pflag.BoolVar(&cfg.PolicyWithHashes, "with-hashes", cfg.PolicyWithHashes, "policy export: include password hashes")
+
+	pflag.StringVar(&cfg.HistoryUser, "user", cfg.HistoryUser, "history: only this user")
+	pflag.StringVar(&cfg.HistorySource, "source", cfg.HistorySource, "history: only this source IP")
+	pflag.StringVar(&cfg.HistoryDest, "dest", cfg.HistoryDest, "history: destinations containing this text")
+	pflag.StringVar(&cfg.HistoryStatus, "status", cfg.HistoryStatus, "history: closed | denied | failed")
+	pflag.StringVar(&cfg.HistorySince, "since", cfg.HistorySince, "history/audit-log: after (date, RFC3339 or duration ago, e.g. 24h)")
+	pflag.StringVar(&cfg.HistoryUntil, "until", cfg.HistoryUntil, "history/audit-log: before (date, RFC3339 or duration ago)")
+	pflag.IntVar(&cfg.HistoryLimit, "limit", cfg.HistoryLimit, "history/audit-log: maximum rows (0 = all)")
+
+	pflag.StringVar(&cfg.AuditActor, "actor", cfg.AuditActor, "audit-log: only this actor (cli:<os user>, web:<admin>, api:<token>, system)")
+	pflag.StringVar(&cfg.AuditAction, "action", cfg.AuditAction, "audit-log: actions starting with this (e.g. user. or whitelist.allow)")
+	pflag.StringVar(&cfg.AuditTarget, "target", cfg.AuditTarget, "audit-log: only this target (username, CIDR, pattern or admin)")
 }
 
 func badFlagUse(cfg models.FlagConfig) (bool, string) {
@@ -91,6 +276,52 @@ func badFlagUse(cfg models.FlagConfig) (bool, string) {
 		}
 	}
 
+	if !commands.ValidOutputFormat(cfg.Output) {
+		return false, "--output must be table, json or csv"
+	}
+
+	if cfg.MaxConns < 0 || cfg.MaxConnsPerUser < 0 || cfg.MaxConnsPerSource < 0 {
+		return false, "connection limits cannot be negative"
+	}
+
+	if cfg.LockoutThreshold > 0 && (cfg.LockoutWindow <= 0 || cfg.LockoutDuration <= 0) {
+		return false, "--lockout-window and --lockout-duration must be positive when lockout is enabled"
+	}
+
+	if cfg.PolicyEnforcement != server.EnforceClose && cfg.PolicyEnforcement != server.EnforceFlag {
+		return false, "--policy-enforcement must be close or flag"
+	}
+
+	if cfg.BanThreshold > 0 && (cfg.BanWindow <= 0 || cfg.BanDuration <= 0) {
+		return false, "--ban-window and --ban-duration must be positive when bans are enabled"
+	}
+
+	if cfg.AdminSessionIdle <= 0 || cfg.AdminSessionMax <= 0 {
+		return false, "--admin-session-idle and --admin-session-max must be positive"
+	}
+
+	if _, _, err := net.SplitHostPort(cfg.AdminListen); err != nil {
+		return false, "--admin-listen must be host:port"
+	}
+
+	if (cfg.AdminTLSCert == "") != (cfg.AdminTLSKey == "") {
+		return false, "--admin-tls-cert and --admin-tls-key must be used together"
+	}
+
+	if _, err := system.ParseCIDRList(cfg.AdminAllow); err != nil {
+		return false, "--admin-allow: " + err.Error()
+	}
+
+	if cfg.ControlGroup != "" {
+		if _, err := user.LookupGroup(cfg.ControlGroup); err != nil {
+			return false, "--control-group: " + err.Error()
+		}
+	}
+
+	if cfg.ControlSocket != "" && !filepath.IsAbs(cfg.ControlSocket) {
+		return false, "--control-socket must be an absolute path"
+	}
+
 	// tor-socks misuse check
 	if cfg.Mode != "tor" {
 		const defaultTor = "127.0.0.1:9050"
@@ -111,6 +342,10 @@ func setupFlagsAndParse() {
 
 	// Check flag usage validity
 	ok, msg := badFlagUse(cfg)
+	if ok {
+		commands.SetOutputFormat(cfg.Output)
+		system.SetControlSocketPath(cfg.ControlSocket)
+	}
 	if !ok {
 		// Log the error with logrus for flag validation issues
 		logging.GetLogger().Errorf("Flag validation error: %s", msg)
@@ -77,6 +77,14 @@ func buildPlan(base dialer.Dialer, hops []dialer.ChainHop) *dialer.Plan {
 	return plan
 }
 
+// torSocksAddr returns the Tor SOCKS address to health-check ("" outside tor mode).
+func torSocksAddr() string {
+	if cfg.Mode != "tor" {
+		return ""
+	}
+	return cfg.TorSocksAddr
+}
+
 // runServer starts the server with the given configuration.
 func runServer(
 	plan *dialer.Plan,
@@ -89,6 +97,9 @@ func runServer(
 		logging.GetLogger().Warn("authentication disabled via --no-auth")
 	}
 
+	// already checked by badFlagUse
+	adminAllow, _ := system.ParseCIDRList(cfg.AdminAllow)
+
 	srv := server.New(server.Config{
 		ListenAddr:     cfg.ListenAddr,
 		HTTPListenAddr: cfg.HttpListen,
@@ -99,6 +110,35 @@ func runServer(
 
 		RequireAuth: requireAuth,
 		AuthFunc:    authFn,
+
+		MaxConns:          cfg.MaxConns,
+		MaxConnsPerUser:   cfg.MaxConnsPerUser,
+		MaxConnsPerSource: cfg.MaxConnsPerSource,
+
+		LockoutThreshold: cfg.LockoutThreshold,
+		LockoutWindow:    cfg.LockoutWindow,
+		LockoutDuration:  cfg.LockoutDuration,
+
+		BanThreshold: cfg.BanThreshold,
+		BanWindow:    cfg.BanWindow,
+		BanDuration:  cfg.BanDuration,
+
+		PolicyEnforcement: cfg.PolicyEnforcement,
+
+		MetricsListenAddr: cfg.MetricsListen,
+		MetricsPerUser:    cfg.MetricsPerUser,
+		TorSocksAddr:      torSocksAddr(),
+
+		AdminSessionIdle: cfg.AdminSessionIdle,
+		AdminSessionMax:  cfg.AdminSessionMax,
+
+		AdminListen:  cfg.AdminListen,
+		AdminTLS:     cfg.AdminTLS || cfg.AdminTLSCert != "",
+		AdminTLSCert: cfg.AdminTLSCert,
+		AdminTLSKey:  cfg.AdminTLSKey,
+		AdminAllow:   adminAllow,
+
+		ControlGroup: cfg.ControlGroup,
 	})
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
@@ -13,6 +13,11 @@ func Execute() {
 	// Setup flags and parse them
 	setupFlagsAndParse()
 
+	// Commands for the running service need no database
+	if handled := commands.DispatchControlCommands(); handled {
+		return
+	}
+
 	//Init db
 	db := mustInitDB()
 	defer db.Close()
@@ -8,3 +8,16 @@ import (
 type Dialer interface {
 	DialContext(ctx context.Context, network, address string) (net.Conn, error)
 }
+
+// Router is implemented by dialers that can describe their egress route.
+type Router interface {
+	Route() string
+}
+
+// RouteOf describes the egress route of d ("unknown" if it cannot tell).
+func RouteOf(d Dialer) string {
+	if r, ok := d.(Router); ok {
+		return r.Route()
+	}
+	return "unknown"
+}
@@ -18,3 +18,7 @@ func (d *directDialer) DialContext(ctx context.Context, network, address string)
 	nd := net.Dialer{Timeout: d.timeout}
 	return nd.DialContext(ctx, network, address)
 }
+
+func (d *directDialer) Route() string {
+	return "direct"
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"net"
+	"strings"
 	"time"
 )
 
@@ -32,6 +33,15 @@ func NewChainedPlan(hops []ChainHop, base Dialer) (*Plan, error) {
 	}, nil
 }
 
+// Route describes the egress path, e.g. "tor -> 10.0.0.5:1080".
+func (p *Plan) Route() string {
+	parts := []string{RouteOf(p.base)}
+	for _, h := range p.hops {
+		parts = append(parts, h.Addr)
+	}
+	return strings.Join(parts, " -> ")
+}
+
 func (p *Plan) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
 	// No chain => preserve existing behavior.
 	if len(p.hops) == 0 {
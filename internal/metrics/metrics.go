@@ -0,0 +1,267 @@
+// Package metrics is a minimal Prometheus text-format exporter.
+// It covers what ProxyChan needs (labelled counters and gauges,
+// histograms and scrape-time collectors) without pulling in the
+// client library.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type collector interface {
+	write(w io.Writer)
+}
+
+// Registry holds metrics in registration order.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	r.collectors = append(r.collectors, c)
+	r.mu.Unlock()
+}
+
+// Write writes every metric in the Prometheus text format.
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	cs := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	for _, c := range cs {
+		c.write(w)
+	}
+}
+
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// ---------- vectors ----------
+
+type series struct {
+	values []string
+	val    float64
+}
+
+type vec struct {
+	name, help, typ string
+	labels          []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func newVec(name, help, typ string, labels []string) *vec {
+	return &vec{name: name, help: help, typ: typ, labels: labels, series: make(map[string]*series)}
+}
+
+func (v *vec) get(values []string) *series {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		v.series[key] = s
+	}
+	return s
+}
+
+func (v *vec) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	writeHeader(w, v.name, v.help, v.typ)
+
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := v.series[k]
+		fmt.Fprintf(w, "%s%s %s\n", v.name, formatLabels(v.labels, s.values), formatValue(s.val))
+	}
+}
+
+// CounterVec is a monotonically increasing value per label set.
+type CounterVec struct{ v *vec }
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newVec(name, help, "counter", labels)}
+	r.register(c.v)
+	return c
+}
+
+func (c *CounterVec) Add(delta float64, values ...string) {
+	if delta < 0 {
+		return
+	}
+	c.v.mu.Lock()
+	c.v.get(values).val += delta
+	c.v.mu.Unlock()
+}
+
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// GaugeVec is a value per label set that can go up and down.
+type GaugeVec struct{ v *vec }
+
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newVec(name, help, "gauge", labels)}
+	r.register(g.v)
+	return g
+}
+
+func (g *GaugeVec) Set(val float64, values ...string) {
+	g.v.mu.Lock()
+	g.v.get(values).val = val
+	g.v.mu.Unlock()
+}
+
+// ---------- histogram ----------
+
+// DefaultLatencyBuckets suit handshakes and dials (seconds).
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+type Histogram struct {
+	name, help string
+	buckets    []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	h := &Histogram{
+		name:    name,
+		help:    help,
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+	r.register(h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+	for i, b := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", h.name, formatValue(b), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", h.name, formatValue(h.sum))
+	fmt.Fprintf(w, "%s_count %d\n", h.name, h.count)
+}
+
+// ---------- scrape-time collectors ----------
+
+// Sample is one series produced by a Func collector.
+type Sample struct {
+	Values []string
+	Value  float64
+}
+
+type funcCollector struct {
+	name, help, typ string
+	labels          []string
+	fn              func() []Sample
+}
+
+// NewFunc registers a metric whose samples are computed at scrape time.
+// typ is "counter" or "gauge".
+func (r *Registry) NewFunc(name, help, typ string, labels []string, fn func() []Sample) {
+	r.register(&funcCollector{name: name, help: help, typ: typ, labels: labels, fn: fn})
+}
+
+func (f *funcCollector) write(w io.Writer) {
+	samples := f.fn()
+	sort.Slice(samples, func(i, j int) bool {
+		return strings.Join(samples[i].Values, "\xff") < strings.Join(samples[j].Values, "\xff")
+	})
+
+	writeHeader(w, f.name, f.help, f.typ)
+	for _, s := range samples {
+		fmt.Fprintf(w, "%s%s %s\n", f.name, formatLabels(f.labels, s.Values), formatValue(s.Value))
+	}
+}
+
+// ---------- formatting ----------
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func writeHeader(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, helpEscaper.Replace(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(n)
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrape(r *Registry) string {
+	var b strings.Builder
+	r.Write(&b)
+	return b.String()
+}
+
+func TestLabelEscaping(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("test_total", "Help with \\ and\nnewline.", "user", "reason")
+	c.Inc(`a"b`, `c\d`)
+	c.Add(2, "line\nbreak", "plain")
+	c.Add(-1, "ignored", "negative")
+
+	want := strings.Join([]string{
+		`# HELP test_total Help with \\ and\nnewline.`,
+		`# TYPE test_total counter`,
+		`test_total{user="a\"b",reason="c\\d"} 1`,
+		`test_total{user="line\nbreak",reason="plain"} 2`,
+		``,
+	}, "\n")
+	if got := scrape(r); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestGaugeWithoutLabels(t *testing.T) {
+	r := NewRegistry()
+	g := r.NewGaugeVec("test_up", "Up.")
+	g.Set(1)
+	g.Set(0.5)
+
+	want := "# HELP test_up Up.\n# TYPE test_up gauge\ntest_up 0.5\n"
+	if got := scrape(r); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogram("test_seconds", "Latency.", []float64{0.1, 1, 2.5})
+	for _, v := range []float64{0.05, 0.1, 0.7, 3, 10} {
+		h.Observe(v)
+	}
+
+	// buckets are cumulative, and +Inf always equals _count
+	want := strings.Join([]string{
+		`# HELP test_seconds Latency.`,
+		`# TYPE test_seconds histogram`,
+		`test_seconds_bucket{le="0.1"} 2`,
+		`test_seconds_bucket{le="1"} 3`,
+		`test_seconds_bucket{le="2.5"} 3`,
+		`test_seconds_bucket{le="+Inf"} 5`,
+		`test_seconds_sum 13.85`,
+		`test_seconds_count 5`,
+		``,
+	}, "\n")
+	if got := scrape(r); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestEmptyHistogram(t *testing.T) {
+	r := NewRegistry()
+	r.NewHistogram("test_seconds", "Latency.", []float64{1})
+
+	got := scrape(r)
+	for _, line := range []string{
+		`test_seconds_bucket{le="1"} 0`,
+		`test_seconds_bucket{le="+Inf"} 0`,
+		`test_seconds_sum 0`,
+		`test_seconds_count 0`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, got)
+		}
+	}
+}
+
+func TestFuncCollectorSortsSamples(t *testing.T) {
+	r := NewRegistry()
+	r.NewFunc("test_bytes", "Bytes.", "gauge", []string{"user"}, func() []Sample {
+		return []Sample{{[]string{"bob"}, 2}, {[]string{"alice"}, 1}}
+	})
+
+	want := "# HELP test_bytes Bytes.\n# TYPE test_bytes gauge\n" +
+		"test_bytes{user=\"alice\"} 1\ntest_bytes{user=\"bob\"} 2\n"
+	if got := scrape(r); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	for _, tc := range []struct {
+		in   float64
+		want string
+	}{
+		{0, "0"},
+		{1, "1"},
+		{0.25, "0.25"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+		{math.Inf(-1), "-Inf"},
+		{math.NaN(), "NaN"},
+	} {
+		if got := formatValue(tc.in); got != tc.want {
+			t.Errorf("formatValue(%v) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestHandlerContentType(t *testing.T) {
+	r := NewRegistry()
+	r.NewGaugeVec("test_up", "Up.").Set(1)
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("content type %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "test_up 1\n") {
+		t.Errorf("body:\n%s", rec.Body.String())
+	}
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 )
@@ -109,3 +110,36 @@ func FormatForUser(err error) (text string, exitCode int) {
 	// Non-CLIError fallback
 	return err.Error(), ExitRuntime
 }
+
+// ErrorJSON is how errors are reported with --output json, in the same
+// {"error": {...}} shape as the admin API.
+type ErrorJSON struct {
+	Error ErrorDetail `json:"error"`
+}
+
+type ErrorDetail struct {
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	Hint     string `json:"hint,omitempty"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// FormatJSON is FormatForUser for machines. Errors that are not a
+// CLIError get the code "ERROR".
+func FormatJSON(err error) (text string, exitCode int) {
+	if err == nil {
+		return "", ExitOK
+	}
+
+	d := ErrorDetail{Code: "ERROR", Message: err.Error(), ExitCode: ExitRuntime}
+	var ce *CLIError
+	if errors.As(err, &ce) {
+		d.Code, d.Message, d.Hint = ce.Code, ce.Message, ce.Hint
+		if ce.ExitCode != 0 {
+			d.ExitCode = ce.ExitCode
+		}
+	}
+
+	b, _ := json.Marshal(ErrorJSON{Error: d})
+	return string(b), d.ExitCode
+}
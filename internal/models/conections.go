@@ -8,6 +8,31 @@ type ActiveConn struct {
 	SourceIP    string    `json:"source_ip"`
 	Destination string    `json:"destination"`
 	StartedAt   time.Time `json:"started_at"`
+	Route       string    `json:"route"`
+
+	// Traffic stats, filled in when the connection is snapshotted.
+	// Throughput is bytes/sec averaged since the previous sample.
+	BytesUp       int64     `json:"bytes_up"`
+	BytesDown     int64     `json:"bytes_down"`
+	LastActivity  time.Time `json:"last_activity"`
+	DialLatencyMs float64   `json:"dial_latency_ms"`
+	UpBps         int64     `json:"up_bps"`
+	DownBps       int64     `json:"down_bps"`
+
+	// Set when a policy change no longer allows this tunnel and the
+	// service is configured to flag rather than close it.
+	PolicyViolation string `json:"policy_violation,omitempty"`
+}
+
+// ConnLimitStatus reports concurrent tunnel counts against the configured caps.
+// A limit of 0 means unlimited.
+type ConnLimitStatus struct {
+	Total        int            `json:"total"`
+	MaxTotal     int            `json:"max_total"`
+	MaxPerUser   int            `json:"max_per_user"`
+	MaxPerSource int            `json:"max_per_source"`
+	PerUser      map[string]int `json:"per_user"`
+	PerSource    map[string]int `json:"per_source"`
 }
 
 type ConnGroup struct {
@@ -15,3 +40,77 @@ type ConnGroup struct {
 	Count    int          `json:"count"`
 	Conns    []ActiveConn `json:"conns"`
 }
+
+// RuleHits counts how often each policy rule decided a connection since
+// the service started. Keys are canonical: CIDRs as net.IPNet strings
+// (single IPs as /32 or /128), domains lowercased.
+type RuleHits struct {
+	Whitelist map[string]uint64 `json:"whitelist"`
+	Denylist  map[string]uint64 `json:"denylist"`
+}
+
+// Connection event types published by the service.
+const (
+	EventOpen     = "open"      // tunnel registered
+	EventClose    = "close"     // tunnel ended; Reason says why
+	EventDeny     = "deny"      // refused by policy, limits or user status
+	EventAuthFail = "auth_fail" // bad or missing credentials
+)
+
+// ConnEvent is one connection event. ID is set for open and close, the
+// byte counts for close.
+type ConnEvent struct {
+	Type        string    `json:"type"`
+	At          time.Time `json:"at"`
+	ID          uint64    `json:"id,omitempty"`
+	Username    string    `json:"username"`
+	SourceIP    string    `json:"source_ip"`
+	Destination string    `json:"destination,omitempty"`
+	Route       string    `json:"route,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	BytesUp     int64     `json:"bytes_up,omitempty"`
+	BytesDown   int64     `json:"bytes_down,omitempty"`
+}
+
+// ConnStats is the part of a live tunnel that changes after it opened,
+// sent periodically on the event stream.
+type ConnStats struct {
+	ID              uint64    `json:"id"`
+	BytesUp         int64     `json:"bytes_up"`
+	BytesDown       int64     `json:"bytes_down"`
+	UpBps           int64     `json:"up_bps"`
+	DownBps         int64     `json:"down_bps"`
+	LastActivity    time.Time `json:"last_activity"`
+	PolicyViolation string    `json:"policy_violation,omitempty"`
+}
+
+// EventFilter selects events for a subscriber. Empty fields match all.
+type EventFilter struct {
+	User   string
+	Source string
+	Types  []string
+}
+
+func (f EventFilter) Match(ev ConnEvent) bool {
+	if f.User != "" && ev.Username != f.User {
+		return false
+	}
+	if f.Source != "" && ev.SourceIP != f.Source {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if t == ev.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchConn applies the user and source parts of the filter to a live
+// connection.
+func (f EventFilter) MatchConn(c ActiveConn) bool {
+	return (f.User == "" || c.Username == f.User) && (f.Source == "" || c.SourceIP == f.Source)
+}
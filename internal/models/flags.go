@@ -3,6 +3,7 @@ package models
 import (
 	"fmt"
 	"reflect"
+	"strconv"
 	"time"
 )
 
@@ -16,6 +17,58 @@ type FlagConfig struct {
 	NoAuth         bool          `flag:"no-auth"`
 	DynamicChain   bool          `flag:"dynamic-chain"`
 	ChainConfig    string        `flag:"chain-config" omitEmpty:"true"`
+
+	MaxConns          int `flag:"max-conns" omitEmpty:"true"`
+	MaxConnsPerUser   int `flag:"max-conns-per-user" omitEmpty:"true"`
+	MaxConnsPerSource int `flag:"max-conns-per-source" omitEmpty:"true"`
+
+	LockoutThreshold int           `flag:"lockout-threshold"`
+	LockoutWindow    time.Duration `flag:"lockout-window"`
+	LockoutDuration  time.Duration `flag:"lockout-duration"`
+
+	BanThreshold int           `flag:"ban-threshold"`
+	BanWindow    time.Duration `flag:"ban-window"`
+	BanDuration  time.Duration `flag:"ban-duration"`
+
+	PolicyEnforcement string `flag:"policy-enforcement"`
+
+	MetricsListen  string `flag:"metrics-listen" omitEmpty:"true"`
+	MetricsPerUser bool   `flag:"metrics-per-user"`
+
+	AdminSessionIdle time.Duration `flag:"admin-session-idle"`
+	AdminSessionMax  time.Duration `flag:"admin-session-max"`
+
+	AdminListen  string `flag:"admin-listen"`
+	AdminTLS     bool   `flag:"admin-tls"`
+	AdminTLSCert string `flag:"admin-tls-cert" omitEmpty:"true"`
+	AdminTLSKey  string `flag:"admin-tls-key" omitEmpty:"true"`
+	AdminAllow   string `flag:"admin-allow" omitEmpty:"true"`
+
+	ControlGroup  string `flag:"control-group" omitEmpty:"true"`
+	ControlSocket string `flag:"control-socket" omitEmpty:"true"`
+
+	// Command options; untagged, so never forwarded to the service.
+	Output   string
+	Expiring string
+
+	PasswordStdin    bool
+	PasswordEnv      string
+	GeneratePassword bool
+
+	PolicyPrune      bool
+	PolicyWithHashes bool
+
+	HistoryUser   string
+	HistorySource string
+	HistoryDest   string
+	HistoryStatus string
+	HistorySince  string
+	HistoryUntil  string
+	HistoryLimit  int
+
+	AuditActor  string
+	AuditAction string
+	AuditTarget string
 }
 
 var DefaultFlagConfig = FlagConfig{
@@ -28,6 +81,28 @@ var DefaultFlagConfig = FlagConfig{
 	NoAuth:         false,
 	DynamicChain:   false,
 	ChainConfig:    "",
+
+	MaxConns:          0,
+	MaxConnsPerUser:   0,
+	MaxConnsPerSource: 0,
+
+	LockoutThreshold: 5,
+	LockoutWindow:    10 * time.Minute,
+	LockoutDuration:  15 * time.Minute,
+
+	BanThreshold: 10,
+	BanWindow:    10 * time.Minute,
+	BanDuration:  1 * time.Hour,
+
+	PolicyEnforcement: "close",
+
+	AdminSessionIdle: 30 * time.Minute,
+	AdminSessionMax:  12 * time.Hour,
+
+	AdminListen: "127.0.0.1:6060",
+
+	Output:       "table",
+	HistoryLimit: 100,
 }
 
 func (cfg FlagConfig) ToArgs() ([]string, error) {
@@ -62,6 +137,13 @@ func (cfg FlagConfig) ToArgs() ([]string, error) {
 			}
 			args = append(args, flag, val)
 
+		case reflect.Int:
+			n := fieldVal.Int()
+			if n == 0 && omitEmpty {
+				continue
+			}
+			args = append(args, flag, strconv.FormatInt(n, 10))
+
 		case reflect.Int64:
 			// time.Duration is int64 underneath
 			if fieldType.Type != reflect.TypeOf(time.Duration(0)) {
@@ -1,5 +1,48 @@
 package models
 
+import "time"
+
+// ServiceStatus is what the running service reports about itself over
+// the control channel.
+type ServiceStatus struct {
+	PID        int       `json:"pid"`
+	StartedAt  time.Time `json:"started_at"`
+	Route      string    `json:"route"`
+	Listen     string    `json:"listen"`
+	HTTPListen string    `json:"http_listen,omitempty"`
+	AdminURL   string    `json:"admin_url,omitempty"`
+
+	ActiveTunnels int `json:"active_tunnels"`
+
+	// Loaded version of each hot-reloaded policy.
+	PolicyVersions map[string]int64 `json:"policy_versions"`
+}
+
+// DoctorReport is what the doctor command checked.
+type DoctorReport struct {
+	OS       string       `json:"os"`
+	User     string       `json:"user"`
+	UID      int          `json:"uid"`
+	Database PathCheck    `json:"database"`
+	Logs     PathCheck    `json:"logs"`
+	Service  ServiceCheck `json:"service"`
+}
+
+type PathCheck struct {
+	Path     string `json:"path"`
+	Exists   bool   `json:"exists"`
+	Writable bool   `json:"writable"`
+	Error    string `json:"error,omitempty"` // why it is missing or not writable
+}
+
+type ServiceCheck struct {
+	Running       bool   `json:"running"`
+	PID           int    `json:"pid,omitempty"`
+	AdminURL      string `json:"admin_url,omitempty"`
+	ActiveTunnels int    `json:"active_tunnels"`
+	Error         string `json:"error,omitempty"` // why it is unreachable
+}
+
 type RuntimeConfig struct {
 	DisableTorOnExit bool
 }
@@ -1,12 +1,9 @@
 package server
 
 import (
-	"encoding/json"
-	"fmt"
 	"net"
 	"net/http"
 	"proxychan/internal/models"
-	"proxychan/internal/system"
 	"sort"
 	"time"
 )
@@ -15,6 +12,10 @@ func (s *Server) Warnf(format string, args ...any) {
 	s.cfg.Logger.Warnf(format, args...)
 }
 
+func (s *Server) Infof(format string, args ...any) {
+	s.cfg.Logger.Infof(format, args...)
+}
+
 func normalizeSourceIP(s string) string {
 	// SourceIP might be "ip:port" or just "ip"
 	host, _, err := net.SplitHostPort(s)
@@ -27,9 +28,10 @@ func (s *Server) SnapshotConnections() []models.ActiveConn {
 	s.connMu.RLock()
 	defer s.connMu.RUnlock()
 
+	now := time.Now()
 	out := make([]models.ActiveConn, 0, len(s.conns))
 	for _, c := range s.conns {
-		out = append(out, *c)
+		out = append(out, c.snapshot(now))
 	}
 	return out
 }
@@ -72,48 +74,9 @@ func (s *Server) GroupConnectionsByIP(
 }
 
 func ListActiveConnectionsByIP() ([]models.ConnGroup, error) {
-	client := &http.Client{Timeout: 3 * time.Second}
-
-	req, _ := http.NewRequest(
-		"GET",
-		"http://127.0.0.1:6060/connections/by-ip",
-		nil,
-	)
-	sec, err := system.InternalAdminSecret()
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("X-ProxyChan-Internal", sec)
-
-	resp, err := client.Do(req)
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to proxy admin endpoint: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("admin endpoint returned status %s", resp.Status)
-	}
-
 	var groups []models.ConnGroup
-	if err := json.NewDecoder(resp.Body).Decode(&groups); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := controlCall(http.MethodGet, controlConnections, &groups); err != nil {
+		return nil, err
 	}
-
 	return groups, nil
 }
-
-func GetActiveConnectionCount() (int, error) {
-	groups, err := ListActiveConnectionsByIP()
-	if err != nil {
-		return 0, err
-	}
-
-	total := 0
-	for _, g := range groups {
-		total += g.Count
-	}
-
-	return total, nil
-}
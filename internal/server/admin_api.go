@@ -0,0 +1,171 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"proxychan/internal/models"
+	"proxychan/internal/system"
+	"strconv"
+	"time"
+)
+
+// AdminAPI is a client for the running service's REST API (/api/v1).
+// The address and certificate pin come from the runtime file the service
+// writes at startup.
+type AdminAPI struct {
+	base  string
+	token string
+
+	// client has a timeout for plain calls; stream has none, the event
+	// stream stays open until its context ends
+	client *http.Client
+	stream *http.Client
+}
+
+func NewAdminAPI(token string) (*AdminAPI, error) {
+	rt, err := system.ReadAdminRuntime()
+	if err != nil {
+		return nil, err
+	}
+
+	tr := &http.Transport{}
+	if rt.CertSHA256 != "" {
+		tr.TLSClientConfig = pinnedTLSConfig(rt.CertSHA256)
+	}
+	return &AdminAPI{
+		base:   rt.URL + "/api/v1",
+		token:  token,
+		client: &http.Client{Transport: tr, Timeout: 5 * time.Second},
+		stream: &http.Client{Transport: tr},
+	}, nil
+}
+
+// URL is the admin endpoint the client talks to.
+func (a *AdminAPI) URL() string {
+	return a.base
+}
+
+func (a *AdminAPI) do(ctx context.Context, c *http.Client, method, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, a.base+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.token)
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to proxy admin endpoint: %w", err)
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&body)
+	if body.Error.Message == "" {
+		body.Error.Message = resp.Status
+	}
+	return nil, fmt.Errorf("admin API: %s", body.Error.Message)
+}
+
+func (a *AdminAPI) Connections() ([]models.ActiveConn, error) {
+	resp, err := a.do(context.Background(), a.client, http.MethodGet, "/connections")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var conns []models.ActiveConn
+	if err := json.NewDecoder(resp.Body).Decode(&conns); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return conns, nil
+}
+
+func (a *AdminAPI) KillConnection(id uint64) error {
+	resp, err := a.do(context.Background(), a.client, http.MethodDelete, "/connections/"+strconv.FormatUint(id, 10))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// StreamEvents reads the event stream, calling fn with each event's
+// name and JSON data, until ctx ends or the stream fails.
+func (a *AdminAPI) StreamEvents(ctx context.Context, f models.EventFilter, fn func(event string, data []byte)) error {
+	q := url.Values{}
+	if f.User != "" {
+		q.Set("user", f.User)
+	}
+	if f.Source != "" {
+		q.Set("source", f.Source)
+	}
+
+	resp, err := a.do(ctx, a.stream, http.MethodGet, "/events?"+q.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var (
+		event string
+		data  []byte
+	)
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		line := sc.Bytes()
+		switch {
+		case len(line) == 0:
+			if event != "" {
+				fn(event, data)
+			}
+			event, data = "", nil
+		case bytes.HasPrefix(line, []byte("event: ")):
+			event = string(line[len("event: "):])
+		case bytes.HasPrefix(line, []byte("data: ")):
+			data = append([]byte(nil), line[len("data: "):]...)
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	return errors.New("event stream ended")
+}
+
+// pinnedTLSConfig accepts exactly the certificate with this fingerprint.
+// Chain and name checks are skipped: the certificate is usually
+// self-signed and the pin is stronger than either.
+func pinnedTLSConfig(fingerprint string) *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("admin endpoint sent no certificate")
+			}
+			sum := sha256.Sum256(cs.PeerCertificates[0].Raw)
+			if hex.EncodeToString(sum[:]) != fingerprint {
+				return errors.New("admin endpoint certificate does not match the running service")
+			}
+			return nil
+		},
+	}
+}
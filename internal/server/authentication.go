@@ -3,6 +3,7 @@ package server
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"net"
 	"proxychan/internal/socks5"
 	"proxychan/internal/system"
@@ -12,11 +13,35 @@ import (
 func (s *Server) authenticate(client net.Conn, db *sql.DB) (string, error) {
 	_ = client.SetDeadline(time.Now().Add(15 * time.Second))
 
+	srcIP, _, _ := net.SplitHostPort(client.RemoteAddr().String())
+
+	// HandleHandshake only reports ErrAuthFailed; keep the real reason for the log.
+	var (
+		authErr  error
+		authUser string
+	)
+	start := time.Now()
 	username, err := socks5.HandleHandshake(client, socks5.HandshakeOptions{
 		RequireAuth: s.cfg.RequireAuth,
-		AuthFunc:    s.cfg.AuthFunc,
+		AuthFunc: func(u, p string) error {
+			authUser = u
+			authErr = s.checkCredentials(db, srcIP, u, p)
+			return authErr
+		},
 	})
+	s.metrics.handshake.Observe(time.Since(start).Seconds())
 	if err != nil {
+		if authErr != nil {
+			err = fmt.Errorf("%w: %v", err, authErr)
+			s.metrics.rejected.Inc(reasonAuth)
+			s.recordAuthFail(authUser, srcIP, client.LocalAddr().String(), authErr.Error())
+			if !isExpiryErr(authErr) {
+				s.recordOffense(db, srcIP, offenseAuth)
+			}
+		} else {
+			s.metrics.failed.Inc(reasonHandshake)
+			s.recordOffense(db, srcIP, offenseHandshake)
+		}
 		s.cfg.Logger.Warnf(
 			"handshake error from %s: %v",
 			client.RemoteAddr(),
@@ -42,8 +67,22 @@ func (s *Server) authenticate(client net.Conn, db *sql.DB) (string, error) {
 				username,
 			)
 			_ = socks5.WriteReply(client, 0x05)
+			s.metrics.rejected.Inc(reasonInactive)
+			s.recordRefused(username, srcIP, "", client.LocalAddr().String(), system.HistoryDenied, "user inactive")
 			return "", errors.New("user inactive")
 		}
+
+		if s.quotaExceeded(username) {
+			s.cfg.Logger.Warnf(
+				"user %s has exhausted its data quota, rejecting connection",
+				username,
+			)
+			// 0x02: connection not allowed by ruleset
+			_ = socks5.WriteReply(client, 0x02)
+			s.metrics.rejected.Inc(reasonQuota)
+			s.recordRefused(username, srcIP, "", client.LocalAddr().String(), system.HistoryDenied, reasonQuotaExceeded)
+			return "", errors.New(reasonQuotaExceeded)
+		}
 	}
 
 	return username, nil
@@ -52,11 +91,13 @@ func (s *Server) authenticate(client net.Conn, db *sql.DB) (string, error) {
 func (s *Server) readAndAuthorizeRequest(
 	client net.Conn,
 	username string,
+	db *sql.DB,
 ) (*socks5.Request, error) {
 
 	req, err := socks5.ReadRequest(client)
 	if err != nil {
 		_ = socks5.WriteReply(client, 0x07)
+		s.metrics.failed.Inc(reasonRequest)
 		s.cfg.Logger.Warnf(
 			"request error from %s: %v",
 			client.RemoteAddr(),
@@ -73,6 +114,8 @@ func (s *Server) readAndAuthorizeRequest(
 
 	if typ, pat, denied := s.destDenied(destHost); denied {
 		_ = socks5.WriteReply(client, 0x02)
+		s.metrics.rejected.Inc(reasonDenylist)
+		s.countDenylistHit(pat)
 		s.cfg.Logger.Warnf(
 			"egress denied user=%q src=%s dst=%s ruleType=%s rule=%s",
 			username,
@@ -81,6 +124,10 @@ func (s *Server) readAndAuthorizeRequest(
 			typ,
 			pat,
 		)
+		srcIP, _, _ := net.SplitHostPort(client.RemoteAddr().String())
+		s.recordOffense(db, srcIP, offenseDeniedDest)
+		s.recordRefused(username, srcIP, req.Address, client.LocalAddr().String(),
+			system.HistoryDenied, fmt.Sprintf("destination denied (%s %s)", typ, pat))
 		return nil, errors.New("destination denied")
 	}
 
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"proxychan/internal/system"
+	"time"
+)
+
+// Offense kinds counted towards an automatic source ban.
+const (
+	offenseHandshake  = "handshake failure"
+	offenseAuth       = "auth failure"
+	offenseDeniedDest = "denied destination"
+)
+
+func (s *Server) banPoller(ctx context.Context, db *sql.DB) {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	prune := time.NewTicker(1 * time.Minute)
+	defer prune.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-prune.C:
+			if n, err := system.PruneExpiredBans(db); err != nil {
+				s.cfg.Logger.Warnf("ban prune failed: %v", err)
+			} else if n > 0 {
+				s.cfg.Logger.Infof("pruned %d expired ban(s)", n)
+			}
+		case <-ticker.C:
+			v, err := system.GetBansVersion(db)
+			if err != nil {
+				s.cfg.Logger.Warnf("ban version check failed: %v", err)
+				continue
+			}
+
+			s.banMu.RLock()
+			cur := s.banVersion
+			s.banMu.RUnlock()
+
+			if v != cur {
+				if err := s.reloadBans(db, v); err != nil {
+					s.cfg.Logger.Warnf("ban reload failed: %v", err)
+					continue
+				}
+				s.reevaluateConns(db, "ban reload")
+			}
+		}
+	}
+}
+
+func (s *Server) reloadBans(db *sql.DB, v int64) error {
+	bans, err := system.LoadBans(db)
+	if err != nil {
+		return err
+	}
+
+	s.banMu.Lock()
+	s.bans = bans
+	s.banVersion = v
+	s.banMu.Unlock()
+
+	s.policyReloaded("bans", v)
+	s.cfg.Logger.Infof("bans reloaded (%d active)", len(bans))
+	return nil
+}
+
+func (s *Server) ipBanned(ip string) bool {
+	s.banMu.RLock()
+	until, ok := s.bans[ip]
+	s.banMu.RUnlock()
+
+	return ok && time.Now().Before(until)
+}
+
+// recordOffense counts a misbehaviour from a source IP and bans it
+// once --ban-threshold offenses fall inside --ban-window.
+func (s *Server) recordOffense(db *sql.DB, ip, kind string) {
+	if s.cfg.BanThreshold <= 0 || ip == "" {
+		return
+	}
+	if kind == offenseHandshake && s.handshakeExempt(ip) {
+		return
+	}
+
+	now := time.Now()
+	n := s.offenses.add(ip, now)
+	if n < s.cfg.BanThreshold {
+		return
+	}
+	s.offenses.reset(ip)
+
+	until := now.Add(s.cfg.BanDuration)
+	reason := fmt.Sprintf("%d offenses within %s (last: %s)", n, s.cfg.BanWindow, kind)
+
+	// enforce at once; the poller will confirm from SQLite
+	s.banMu.Lock()
+	s.bans[ip] = until
+	s.banMu.Unlock()
+
+	if err := system.BanIP(db, ip, reason, n, until); err != nil {
+		s.cfg.Logger.Warnf("failed to persist ban for %s: %v", ip, err)
+	}
+
+	s.cfg.Logger.Warnf("source %s banned until %s: %s", ip, until.Format(time.RFC3339), reason)
+}
+
+// handshakeExempt reports whether failed handshakes from ip are not held
+// against it: health checks and port scans from the host itself or from
+// --admin-allow networks are expected to drop the connection early.
+func (s *Server) handshakeExempt(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	if parsed.IsLoopback() {
+		return true
+	}
+	for _, n := range s.cfg.AdminAllow {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
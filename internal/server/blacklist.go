@@ -29,26 +29,35 @@ func (s *Server) denylistPoller(ctx context.Context, db *sql.DB) {
 			s.denyMu.RUnlock()
 
 			if v != cur {
-				rt, err := system.LoadDenylist(db)
-				if err != nil {
+				if err := s.reloadDenylist(db, v); err != nil {
 					s.cfg.Logger.Warnf("denylist reload failed: %v", err)
 					continue
 				}
-
-				s.denyMu.Lock()
-				s.denyIPNets = rt.IPNets
-				s.denyDomainExact = rt.DomainExact
-				s.denyDomainSuffix = rt.DomainSuffix
-				s.denyVersion = v
-				s.denyMu.Unlock()
-
-				s.cfg.Logger.Infof("denylist reloaded (ip/cidr=%d, exact=%d, suffix=%d)",
-					len(rt.IPNets), len(rt.DomainExact), len(rt.DomainSuffix))
+				s.reevaluateConns(db, "denylist reload")
 			}
 		}
 	}
 }
 
+func (s *Server) reloadDenylist(db *sql.DB, v int64) error {
+	rt, err := system.LoadDenylist(db)
+	if err != nil {
+		return err
+	}
+
+	s.denyMu.Lock()
+	s.denyIPNets = rt.IPNets
+	s.denyDomainExact = rt.DomainExact
+	s.denyDomainSuffix = rt.DomainSuffix
+	s.denyVersion = v
+	s.denyMu.Unlock()
+
+	s.policyReloaded("denylist", v)
+	s.cfg.Logger.Infof("denylist reloaded (ip/cidr=%d, exact=%d, suffix=%d)",
+		len(rt.IPNets), len(rt.DomainExact), len(rt.DomainSuffix))
+	return nil
+}
+
 func normalizeDestDomain(host string) string {
 	host = strings.ToLower(strings.TrimSpace(host))
 	host = strings.TrimSuffix(host, ".")
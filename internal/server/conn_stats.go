@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"proxychan/internal/models"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// throughputSample is the shortest interval a throughput figure is
+// averaged over, so several viewers polling at once do not reset it.
+const throughputSample = time.Second
+
+// connState is a tracked tunnel. info is fixed at registration; the
+// counters are updated from the copy loops without taking connMu.
+type connState struct {
+	info models.ActiveConn
+
+	// ctx is cancelled to kill the tunnel (dial included)
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	up          atomic.Int64
+	down        atomic.Int64
+	lastActive  atomic.Int64 // unix nanos
+	dialLatency atomic.Int64 // nanos
+
+	rateMu     sync.Mutex
+	sampleAt   time.Time
+	sampleUp   int64
+	sampleDown int64
+	upBps      int64
+	downBps    int64
+
+	reasonMu  sync.Mutex
+	reason    string
+	violation string
+}
+
+func newConnState(ctx context.Context, info models.ActiveConn) *connState {
+	c := &connState{info: info, sampleAt: info.StartedAt}
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	c.lastActive.Store(info.StartedAt.UnixNano())
+	return c
+}
+
+func (c *connState) add(counter *atomic.Int64, n int) {
+	counter.Add(int64(n))
+	c.lastActive.Store(time.Now().UnixNano())
+}
+
+func (c *connState) setDialLatency(d time.Duration) {
+	c.dialLatency.Store(int64(d))
+}
+
+// throughput returns bytes/sec since the previous sample, taking a new
+// sample once throughputSample has passed.
+func (c *connState) throughput(now time.Time, up, down int64) (int64, int64) {
+	c.rateMu.Lock()
+	defer c.rateMu.Unlock()
+
+	if dt := now.Sub(c.sampleAt); dt >= throughputSample {
+		c.upBps = int64(float64(up-c.sampleUp) / dt.Seconds())
+		c.downBps = int64(float64(down-c.sampleDown) / dt.Seconds())
+		c.sampleAt, c.sampleUp, c.sampleDown = now, up, down
+	}
+	return c.upBps, c.downBps
+}
+
+func (c *connState) snapshot(now time.Time) models.ActiveConn {
+	ac := c.info
+	ac.BytesUp = c.up.Load()
+	ac.BytesDown = c.down.Load()
+	ac.LastActivity = time.Unix(0, c.lastActive.Load())
+	ac.DialLatencyMs = float64(c.dialLatency.Load()) / float64(time.Millisecond)
+	ac.UpBps, ac.DownBps = c.throughput(now, ac.BytesUp, ac.BytesDown)
+
+	c.reasonMu.Lock()
+	ac.PolicyViolation = c.violation
+	c.reasonMu.Unlock()
+
+	return ac
+}
+
+// setCloseReason records why the tunnel ended; the first reason wins,
+// so a deliberate close is not overwritten by the errors it causes.
+func (c *connState) setCloseReason(r string) {
+	c.reasonMu.Lock()
+	if c.reason == "" {
+		c.reason = r
+	}
+	c.reasonMu.Unlock()
+}
+
+func (c *connState) closeReason() string {
+	c.reasonMu.Lock()
+	defer c.reasonMu.Unlock()
+	return c.reason
+}
+
+// kill ends the tunnel, recording why.
+func (c *connState) kill(reason string) {
+	c.setCloseReason(reason)
+	c.cancel()
+}
+
+// flagViolation marks the tunnel as no longer allowed by policy ("" clears
+// the mark). It reports whether the mark changed.
+func (c *connState) flagViolation(reason string) bool {
+	c.reasonMu.Lock()
+	defer c.reasonMu.Unlock()
+
+	if c.violation == reason {
+		return false
+	}
+	c.violation = reason
+	return true
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"proxychan/internal/models"
+	"proxychan/internal/system"
+)
+
+// The control channel carries CLI requests to the running service:
+// list connections, kill, reload and status. On Linux it is a Unix
+// socket checked with SO_PEERCRED (control_linux.go); elsewhere it is
+// served by the admin endpoint to callers holding the internal secret
+// (control_other.go). Both speak the same small HTTP protocol.
+const (
+	controlConnections = "/connections"
+	controlKill        = "/kill"
+	controlReload      = "/reload"
+	controlStatus      = "/status"
+)
+
+func (s *Server) controlHandler(db *sql.DB) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(controlConnections, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeControlJSON(w, s.GroupConnectionsByIP(s.SnapshotConnections()))
+	})
+
+	mux.HandleFunc(controlKill, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		value := r.URL.Query().Get("value")
+		var n int
+		switch r.URL.Query().Get("kind") {
+		case "id":
+			var id uint64
+			if _, err := fmt.Sscan(value, &id); err != nil {
+				http.Error(w, "invalid connection id", http.StatusBadRequest)
+				return
+			}
+			if s.KillConn(id) {
+				n = 1
+			} else {
+				http.NotFound(w, r)
+				return
+			}
+		case "user":
+			n = s.KillUser(value)
+		case "source":
+			n = s.KillSource(value)
+		default:
+			http.Error(w, "unknown kill target", http.StatusBadRequest)
+			return
+		}
+		writeControlJSON(w, map[string]int{"killed": n})
+	})
+
+	mux.HandleFunc(controlReload, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := s.Reload(db); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeControlJSON(w, s.Status())
+	})
+
+	mux.HandleFunc(controlStatus, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeControlJSON(w, s.Status())
+	})
+
+	return mux
+}
+
+func writeControlJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// Reload re-reads every policy now instead of on the next poll, and
+// re-checks open tunnels once.
+func (s *Server) Reload(db *sql.DB) error {
+	steps := []struct {
+		name    string
+		version func(*sql.DB) (int64, error)
+		load    func(*sql.DB, int64) error
+	}{
+		{"whitelist", system.GetWhitelistVersion, s.reloadWhitelist},
+		{"denylist", system.GetDenylistVersion, s.reloadDenylist},
+		{"rate limits", system.GetRateLimitsVersion, s.reloadRateLimits},
+		{"bans", system.GetBansVersion, s.reloadBans},
+	}
+	for _, st := range steps {
+		v, err := st.version(db)
+		if err != nil {
+			return fmt.Errorf("%s: %w", st.name, err)
+		}
+		if err := st.load(db, v); err != nil {
+			return fmt.Errorf("%s: %w", st.name, err)
+		}
+	}
+
+	if err := s.loadQuotas(db); err != nil {
+		return fmt.Errorf("quotas: %w", err)
+	}
+
+	s.reevaluateConns(db, "manual reload")
+	return nil
+}
+
+func (s *Server) Status() models.ServiceStatus {
+	st := models.ServiceStatus{
+		PID:        os.Getpid(),
+		StartedAt:  s.started,
+		Route:      s.route,
+		Listen:     s.cfg.ListenAddr,
+		HTTPListen: s.cfg.HTTPListenAddr,
+	}
+	if rt, err := system.ReadAdminRuntime(); err == nil && rt.PID == st.PID {
+		st.AdminURL = rt.URL
+	}
+
+	s.connMu.RLock()
+	st.ActiveTunnels = len(s.conns)
+	s.connMu.RUnlock()
+
+	st.PolicyVersions = map[string]int64{"users": s.userVersion.Load()}
+	s.mu.RLock()
+	st.PolicyVersions["whitelist"] = s.whitelistVersion
+	s.mu.RUnlock()
+	s.denyMu.RLock()
+	st.PolicyVersions["denylist"] = s.denyVersion
+	s.denyMu.RUnlock()
+	s.rateMu.Lock()
+	st.PolicyVersions["rate_limits"] = s.rateVersion
+	s.rateMu.Unlock()
+	s.banMu.RLock()
+	st.PolicyVersions["bans"] = s.banVersion
+	s.banMu.RUnlock()
+
+	return st
+}
+
+// controlCall sends one request over the control channel and decodes
+// the JSON answer into out.
+func controlCall(method, path string, out any) error {
+	resp, err := controlRequest(method, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errControlNotFound
+	case resp.StatusCode == http.StatusForbidden:
+		return errors.New("not allowed to use the control channel (run as root or a member of --control-group)")
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("service returned status %s", resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+var errControlNotFound = errors.New("not found")
+
+// ReloadPolicies makes the running service re-read all policies now.
+func ReloadPolicies() (models.ServiceStatus, error) {
+	var st models.ServiceStatus
+	err := controlCall(http.MethodPost, controlReload, &st)
+	return st, err
+}
+
+func GetServiceStatus() (models.ServiceStatus, error) {
+	var st models.ServiceStatus
+	err := controlCall(http.MethodGet, controlStatus, &st)
+	return st, err
+}
+
+// controlCtxKey carries the control channel's caller description into
+// handlers, for the log.
+type controlCtxKey struct{}
+
+func controlCaller(ctx context.Context) string {
+	if c, ok := ctx.Value(controlCtxKey{}).(string); ok {
+		return c
+	}
+	return "unknown"
+}
@@ -0,0 +1,181 @@
+//go:build linux
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"proxychan/internal/system"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// startControl serves the control channel on the Unix socket. The
+// socket is 0600, or 0660 owned by --control-group; every connection is
+// checked again against the peer credentials, so the file mode is not
+// the only guard. Nothing is served on the admin endpoint.
+func (s *Server) startControl(ctx context.Context, db *sql.DB) http.Handler {
+	gid := -1
+	if s.cfg.ControlGroup != "" {
+		g, err := user.LookupGroup(s.cfg.ControlGroup)
+		if err != nil {
+			s.cfg.Logger.Warnf("control socket disabled: %v", err)
+			return nil
+		}
+		gid, _ = strconv.Atoi(g.Gid)
+	}
+
+	ln, err := listenControlSocket(gid)
+	if err != nil {
+		s.cfg.Logger.Warnf("control socket disabled: %v", err)
+		return nil
+	}
+
+	srv := &http.Server{
+		Handler:     s.controlPeerCheck(gid, s.controlHandler(db)),
+		ConnContext: withPeerCred,
+	}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			s.cfg.Logger.Warnf("control socket error: %v", err)
+		}
+	}()
+
+	s.cfg.Logger.Infof("control socket on %s", system.ControlSocketPath())
+	return nil
+}
+
+func listenControlSocket(gid int) (net.Listener, error) {
+	path := system.ControlSocketPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	// a socket left behind by a crash blocks the bind; one that still
+	// answers belongs to another instance
+	if c, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		c.Close()
+		return nil, fmt.Errorf("%s is in use by another instance", path)
+	}
+	_ = os.Remove(path)
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// tighten the mode straight away; a caller that connects before
+	// this is still refused by controlPeerCheck
+	mode := os.FileMode(0600)
+	if gid >= 0 {
+		mode = 0660
+		if err := os.Chown(path, -1, gid); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+type peerCredKey struct{}
+
+func withPeerCred(ctx context.Context, c net.Conn) context.Context {
+	uc, ok := c.(*net.UnixConn)
+	if !ok {
+		return ctx
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return ctx
+	}
+
+	var cred *syscall.Ucred
+	_ = raw.Control(func(fd uintptr) {
+		cred, err = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil || cred == nil {
+		return ctx
+	}
+
+	ctx = context.WithValue(ctx, peerCredKey{}, cred)
+	return context.WithValue(ctx, controlCtxKey{}, fmt.Sprintf("uid=%d pid=%d", cred.Uid, cred.Pid))
+}
+
+// controlPeerCheck admits root, the service's own user and, with gid
+// set, members of that group (primary or supplementary).
+func (s *Server) controlPeerCheck(gid int, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cred, ok := r.Context().Value(peerCredKey{}).(*syscall.Ucred)
+		if !ok || !peerAllowed(cred, gid) {
+			s.cfg.Logger.Warnf("control request %s refused for %s", r.URL.Path, controlCaller(r.Context()))
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if r.Method != http.MethodGet {
+			s.cfg.Logger.Infof("control request %s from %s", r.URL.Path, controlCaller(r.Context()))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func peerAllowed(cred *syscall.Ucred, gid int) bool {
+	if cred.Uid == 0 || int(cred.Uid) == os.Geteuid() {
+		return true
+	}
+	if gid < 0 {
+		return false
+	}
+	if int(cred.Gid) == gid {
+		return true
+	}
+	u, err := user.LookupId(strconv.Itoa(int(cred.Uid)))
+	if err != nil {
+		return false
+	}
+	groups, err := u.GroupIds()
+	return err == nil && slices.Contains(groups, strconv.Itoa(gid))
+}
+
+// controlRequest sends one request over the control socket.
+func controlRequest(method, path string) (*http.Response, error) {
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", system.ControlSocketPath())
+			},
+		},
+	}
+
+	req, err := http.NewRequest(method, "http://proxychan"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ECONNREFUSED) {
+		return nil, fmt.Errorf("control socket %s not found (is the service running?)", system.ControlSocketPath())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach the service on %s: %w", system.ControlSocketPath(), err)
+	}
+	return resp, nil
+}
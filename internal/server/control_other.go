@@ -0,0 +1,54 @@
+//go:build !linux
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"proxychan/internal/system"
+	"proxychan/internal/web"
+	"time"
+)
+
+// startControl returns the control handler for the admin endpoint to
+// serve under web.ControlPrefix; without SO_PEERCRED callers are
+// authorised by the internal secret instead.
+func (s *Server) startControl(ctx context.Context, db *sql.DB) http.Handler {
+	return s.controlHandler(db)
+}
+
+// controlRequest sends one request to the running service's admin
+// endpoint with the internal secret. The address comes from the runtime
+// file the service writes at startup; an HTTPS endpoint must present the
+// certificate recorded there.
+func controlRequest(method, path string) (*http.Response, error) {
+	rt, err := system.ReadAdminRuntime()
+	if err != nil {
+		return nil, err
+	}
+	sec, err := system.InternalAdminSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	if rt.CertSHA256 != "" {
+		client.Transport = &http.Transport{
+			TLSClientConfig: pinnedTLSConfig(rt.CertSHA256),
+		}
+	}
+
+	req, err := http.NewRequest(method, rt.URL+web.ControlPrefix+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(web.InternalSecretHeader, sec)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to proxy admin endpoint %s: %w", rt.URL, err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"proxychan/internal/models"
+	"proxychan/internal/web"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// eventSubBuffer is how many events a slow subscriber may fall behind
+// before events are dropped for it. Publishing never blocks a tunnel.
+const eventSubBuffer = 512
+
+// eventBus fans connection events out to subscribers (the admin event
+// streams).
+type eventBus struct {
+	mu   sync.RWMutex
+	subs map[*eventSub]struct{}
+}
+
+type eventSub struct {
+	bus     *eventBus
+	filter  models.EventFilter
+	ch      chan models.ConnEvent
+	dropped atomic.Int64
+	once    sync.Once
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subs: make(map[*eventSub]struct{})}
+}
+
+func (b *eventBus) publish(ev models.ConnEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subs {
+		if !sub.filter.Match(ev) {
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+func (sub *eventSub) Events() <-chan models.ConnEvent { return sub.ch }
+
+// Dropped returns how many events were dropped since the last call.
+func (sub *eventSub) Dropped() int64 { return sub.dropped.Swap(0) }
+
+func (sub *eventSub) Close() {
+	sub.once.Do(func() {
+		sub.bus.mu.Lock()
+		delete(sub.bus.subs, sub)
+		sub.bus.mu.Unlock()
+	})
+}
+
+// SubscribeEvents returns a subscription to the connection events
+// matching f. The caller must Close it.
+func (s *Server) SubscribeEvents(f models.EventFilter) web.EventSubscription {
+	sub := &eventSub{bus: s.events, filter: f, ch: make(chan models.ConnEvent, eventSubBuffer)}
+
+	s.events.mu.Lock()
+	s.events.subs[sub] = struct{}{}
+	s.events.mu.Unlock()
+
+	return sub
+}
+
+func (s *Server) publishOpen(st *connState) {
+	s.events.publish(models.ConnEvent{
+		Type:        models.EventOpen,
+		At:          st.info.StartedAt,
+		ID:          st.info.ID,
+		Username:    st.info.Username,
+		SourceIP:    st.info.SourceIP,
+		Destination: st.info.Destination,
+		Route:       st.info.Route,
+	})
+}
+
+func (s *Server) publishClose(st *connState) {
+	s.events.publish(models.ConnEvent{
+		Type:        models.EventClose,
+		At:          time.Now(),
+		ID:          st.info.ID,
+		Username:    st.info.Username,
+		SourceIP:    st.info.SourceIP,
+		Destination: st.info.Destination,
+		Route:       st.info.Route,
+		Reason:      st.closeReason(),
+		BytesUp:     st.up.Load(),
+		BytesDown:   st.down.Load(),
+	})
+}
+
+// publishRefused reports a connection refused before it got a tunnel;
+// typ is models.EventDeny or models.EventAuthFail.
+func (s *Server) publishRefused(typ, username, srcIP, dst, reason string) {
+	s.events.publish(models.ConnEvent{
+		Type:        typ,
+		At:          time.Now(),
+		Username:    username,
+		SourceIP:    srcIP,
+		Destination: dst,
+		Reason:      reason,
+	})
+}
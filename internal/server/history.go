@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"proxychan/internal/logging"
+	"proxychan/internal/models"
+	"proxychan/internal/system"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	historyBuffer        = 4096
+	historyBatch         = 256
+	historyFlushInterval = 2 * time.Second
+	historyPruneInterval = time.Hour
+)
+
+// historyWriter persists finished connections off the tunnel path.
+// record never blocks: if SQLite falls behind and the buffer fills,
+// records are dropped and counted instead.
+type historyWriter struct {
+	ch      chan system.HistoryRecord
+	dropped atomic.Int64
+	done    chan struct{}
+}
+
+func newHistoryWriter() *historyWriter {
+	return &historyWriter{
+		ch:   make(chan system.HistoryRecord, historyBuffer),
+		done: make(chan struct{}),
+	}
+}
+
+func (h *historyWriter) record(r system.HistoryRecord) {
+	select {
+	case h.ch <- r:
+	default:
+		h.dropped.Add(1)
+	}
+}
+
+func (s *Server) historyLoop(ctx context.Context, db *sql.DB) {
+	h := s.history
+	defer close(h.done)
+
+	flush := time.NewTicker(historyFlushInterval)
+	defer flush.Stop()
+
+	prune := time.NewTicker(historyPruneInterval)
+	defer prune.Stop()
+
+	s.pruneHistory(db)
+
+	batch := make([]system.HistoryRecord, 0, historyBatch)
+	write := func() {
+		if n := h.dropped.Swap(0); n > 0 {
+			s.cfg.Logger.Warnf("connection history: dropped %d record(s), writer fell behind", n)
+		}
+		if len(batch) == 0 {
+			return
+		}
+		if err := system.InsertHistory(db, batch); err != nil {
+			s.cfg.Logger.Warnf("connection history write failed (%d records): %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case r := <-h.ch:
+			batch = append(batch, r)
+			if len(batch) >= historyBatch {
+				write()
+			}
+		case <-flush.C:
+			write()
+		case <-prune.C:
+			s.pruneHistory(db)
+		case <-ctx.Done():
+			// drain what the tunnels already queued
+			for {
+				select {
+				case r := <-h.ch:
+					batch = append(batch, r)
+				default:
+					write()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *Server) pruneHistory(db *sql.DB) {
+	keep, err := system.HistoryRetention(db)
+	if err != nil {
+		s.cfg.Logger.Warnf("history retention lookup failed: %v", err)
+		return
+	}
+	if keep <= 0 {
+		return
+	}
+
+	n, err := system.PruneHistory(db, time.Now().Add(-keep))
+	if err != nil {
+		s.cfg.Logger.Warnf("history prune failed: %v", err)
+		return
+	}
+	if n > 0 {
+		s.cfg.Logger.Infof("pruned %d connection history record(s) older than %s", n, system.FormatDuration(keep))
+	}
+}
+
+// recordClosed queues a finished tunnel.
+func (s *Server) recordClosed(st *connState, bind string) {
+	ac := st.snapshot(time.Now())
+	reason := st.closeReason()
+
+	logging.LogConnection(ac.Username, ac.SourceIP, bind, ac.Destination, system.HistoryClosed)
+
+	s.history.record(system.HistoryRecord{
+		Username:    ac.Username,
+		SourceIP:    ac.SourceIP,
+		Destination: ac.Destination,
+		Route:       ac.Route,
+		StartedAt:   ac.StartedAt,
+		EndedAt:     time.Now(),
+		BytesUp:     ac.BytesUp,
+		BytesDown:   ac.BytesDown,
+		Status:      system.HistoryClosed,
+		Reason:      reason,
+	})
+}
+
+// recordRefused queues a connection that never got a tunnel:
+// status is HistoryDenied or HistoryFailed.
+func (s *Server) recordRefused(username, srcIP, dst, bind, status, reason string) {
+	// failed dials already had a tunnel, whose close event reports them
+	if status == system.HistoryDenied {
+		s.publishRefused(models.EventDeny, username, srcIP, dst, reason)
+	}
+	s.queueRefused(username, srcIP, dst, bind, status, reason)
+}
+
+// recordAuthFail queues a refused login. It is published as an
+// auth_fail event rather than a deny.
+func (s *Server) recordAuthFail(username, srcIP, bind, reason string) {
+	s.publishRefused(models.EventAuthFail, username, srcIP, "", reason)
+	s.queueRefused(username, srcIP, "", bind, system.HistoryDenied, reason)
+}
+
+func (s *Server) queueRefused(username, srcIP, dst, bind, status, reason string) {
+	now := time.Now()
+
+	logging.LogConnection(username, srcIP, bind, dst, status)
+
+	s.history.record(system.HistoryRecord{
+		Username:    username,
+		SourceIP:    srcIP,
+		Destination: dst,
+		Route:       s.route,
+		StartedAt:   now,
+		EndedAt:     now,
+		Status:      status,
+		Reason:      reason,
+	})
+}
@@ -10,7 +10,6 @@ import (
 	"io"
 	"net"
 	"net/textproto"
-	"proxychan/internal/models"
 	"proxychan/internal/system"
 	"strings"
 	"time"
@@ -32,6 +31,8 @@ func (s *Server) handleHTTPConn(ctx context.Context, client net.Conn, db *sql.DB
 	target, hdr, err := readHTTPConnect(br)
 	if err != nil {
 		writeHTTPError(client, 405, "Method Not Allowed")
+		s.metrics.failed.Inc(reasonRequest)
+		s.recordOffense(db, srcIPStr, offenseHandshake)
 		return
 	}
 
@@ -45,21 +46,47 @@ func (s *Server) handleHTTPConn(ctx context.Context, client net.Conn, db *sql.DB
 	host, _, _ := net.SplitHostPort(target)
 	if typ, pat, denied := s.destDenied(host); denied {
 		writeHTTPError(client, 403, "Forbidden")
+		s.metrics.rejected.Inc(reasonDenylist)
+		s.countDenylistHit(pat)
 		s.cfg.Logger.Warnf(
 			"http egress denied user=%q src=%s dst=%s ruleType=%s rule=%s",
 			username, srcIP, target, typ, pat,
 		)
+		s.recordOffense(db, srcIPStr, offenseDeniedDest)
+		s.recordRefused(username, srcIPStr, target, client.LocalAddr().String(),
+			system.HistoryDenied, fmt.Sprintf("destination denied (%s %s)", typ, pat))
 		return
 	}
 
-	// 5. track connection
-	id := s.registerConn(username, srcIPStr, target)
-	defer s.unregisterConn(id)
+	// 5. track connection (enforces concurrency caps)
+	st, err := s.registerConn(ctx, username, srcIPStr, target)
+	if err != nil {
+		if errors.Is(err, errGlobalConnLimit) {
+			writeHTTPError(client, 503, "Service Unavailable")
+		} else {
+			writeHTTPError(client, 429, "Too Many Requests")
+		}
+		s.metrics.rejected.Inc(reasonLimit)
+		s.cfg.Logger.Warnf(
+			"http connection rejected user=%q src=%s dst=%s: %v",
+			username, srcIP, target, err,
+		)
+		s.recordRefused(username, srcIPStr, target, client.LocalAddr().String(), system.HistoryDenied, err.Error())
+		return
+	}
+	defer s.unregisterConn(st.info.ID)
 
 	// 6. dial outbound
-	out, err := s.cfg.Dialer.DialContext(ctx, "tcp", target)
+	dialStart := time.Now()
+	out, err := s.cfg.Dialer.DialContext(st.ctx, "tcp", target)
+	st.setDialLatency(time.Since(dialStart))
+	s.metrics.dial.Observe(time.Since(dialStart).Seconds())
 	if err != nil {
 		writeHTTPError(client, 502, "Bad Gateway")
+		s.metrics.failed.Inc(reasonDial)
+		s.cfg.Logger.Warnf("http dial fail %s -> %s: %v", srcIP, target, err)
+		st.setCloseReason("dial failed: " + err.Error())
+		s.recordRefused(username, srcIPStr, target, client.LocalAddr().String(), system.HistoryFailed, "dial failed: "+err.Error())
 		return
 	}
 	defer out.Close()
@@ -71,7 +98,8 @@ func (s *Server) handleHTTPConn(ctx context.Context, client net.Conn, db *sql.DB
 	))
 
 	// 8. tunnel (important: use raw conn, not reader)
-	s.tunnel(client, out)
+	s.tunnel(st.ctx, client, out, st, username, srcIP)
+	s.recordClosed(st, client.LocalAddr().String())
 }
 
 func readHTTPConnect(br *bufio.Reader) (target string, hdr textproto.MIMEHeader, err error) {
@@ -99,15 +127,29 @@ func (s *Server) httpAuthFromHeaders(hdr textproto.MIMEHeader, conn net.Conn, db
 		return "", nil
 	}
 
+	srcIP, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+
 	pa := hdr.Get("Proxy-Authorization")
 	u, p, ok := parseBasicProxyAuth(pa)
 	if !ok {
 		writeHTTPError(conn, 407, "Proxy Authentication Required")
 		_, _ = conn.Write([]byte("Proxy-Authenticate: Basic realm=\"ProxyChan\"\r\n\r\n"))
+		s.metrics.rejected.Inc(reasonAuth)
+		s.recordAuthFail("", srcIP, conn.LocalAddr().String(), "missing proxy auth")
 		return "", errors.New("missing proxy auth")
 	}
 
-	if err := s.cfg.AuthFunc(u, p); err != nil {
+	if err := s.checkCredentials(db, srcIP, u, p); err != nil {
+		if !isExpiryErr(err) {
+			s.recordOffense(db, srcIP, offenseAuth)
+		}
+		s.metrics.rejected.Inc(reasonAuth)
+		s.recordAuthFail(u, srcIP, conn.LocalAddr().String(), err.Error())
+		if isLockoutErr(err) {
+			writeHTTPError(conn, 403, "Forbidden")
+			s.cfg.Logger.Warnf("http login refused user=%q src=%s: %v", u, srcIP, err)
+			return "", err
+		}
 		_, _ = fmt.Fprintf(
 			conn,
 			"HTTP/1.1 407 Proxy Authentication Required\r\n"+
@@ -124,9 +166,19 @@ func (s *Server) httpAuthFromHeaders(hdr textproto.MIMEHeader, conn net.Conn, db
 	}
 	if !active {
 		writeHTTPError(conn, 403, "Forbidden")
+		s.metrics.rejected.Inc(reasonInactive)
+		s.recordRefused(u, srcIP, "", conn.LocalAddr().String(), system.HistoryDenied, "user inactive")
 		return "", errors.New("user inactive")
 	}
 
+	if s.quotaExceeded(u) {
+		writeHTTPError(conn, 403, "Quota Exceeded")
+		s.metrics.rejected.Inc(reasonQuota)
+		s.recordRefused(u, srcIP, "", conn.LocalAddr().String(), system.HistoryDenied, reasonQuotaExceeded)
+		s.cfg.Logger.Warnf("http user %s has exhausted its data quota, rejecting connection", u)
+		return "", errors.New(reasonQuotaExceeded)
+	}
+
 	return u, nil
 }
 
@@ -157,27 +209,3 @@ func writeHTTPError(w io.Writer, code int, msg string) {
 		msg,
 	)
 }
-
-func (s *Server) unregisterConn(id uint64) {
-	s.connMu.Lock()
-	delete(s.conns, id)
-	s.connMu.Unlock()
-}
-
-func (s *Server) registerConn(username, srcIP, dst string) uint64 {
-	id := s.nextConnID.Add(1)
-
-	ac := &models.ActiveConn{
-		ID:          id,
-		Username:    username,
-		SourceIP:    srcIP,
-		Destination: dst,
-		StartedAt:   time.Now(),
-	}
-
-	s.connMu.Lock()
-	s.conns[id] = ac
-	s.connMu.Unlock()
-
-	return id
-}
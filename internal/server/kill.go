@@ -0,0 +1,74 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const reasonKilledByAdmin = "killed by admin"
+
+// killMatching kills every tracked tunnel match selects and returns how many.
+func (s *Server) killMatching(match func(*connState) bool, reason string) int {
+	s.connMu.RLock()
+	var victims []*connState
+	for _, st := range s.conns {
+		if match(st) {
+			victims = append(victims, st)
+		}
+	}
+	s.connMu.RUnlock()
+
+	for _, st := range victims {
+		st.kill(reason)
+	}
+	return len(victims)
+}
+
+// KillConn terminates a single tunnel. It reports false if id is unknown.
+func (s *Server) KillConn(id uint64) bool {
+	n := s.killMatching(func(st *connState) bool { return st.info.ID == id }, reasonKilledByAdmin)
+	if n > 0 {
+		s.cfg.Logger.Warnf("connection %d killed by admin", id)
+	}
+	return n > 0
+}
+
+// KillUser terminates all tunnels of a user.
+func (s *Server) KillUser(username string) int {
+	n := s.killMatching(func(st *connState) bool { return st.info.Username == username }, reasonKilledByAdmin)
+	if n > 0 {
+		s.cfg.Logger.Warnf("%d connection(s) of user %s killed by admin", n, username)
+	}
+	return n
+}
+
+// KillSource terminates all tunnels from a source IP.
+func (s *Server) KillSource(ip string) int {
+	n := s.killMatching(func(st *connState) bool { return st.info.SourceIP == ip }, reasonKilledByAdmin)
+	if n > 0 {
+		s.cfg.Logger.Warnf("%d connection(s) from %s killed by admin", n, ip)
+	}
+	return n
+}
+
+// KillConnections asks the running service to kill tunnels. kind is
+// "id", "user" or "source".
+func KillConnections(kind, value string) (int, error) {
+	switch kind {
+	case "id", "user", "source":
+	default:
+		return 0, fmt.Errorf("unknown kill target %q", kind)
+	}
+
+	q := url.Values{"kind": {kind}, "value": {value}}
+	var out struct {
+		Killed int `json:"killed"`
+	}
+	err := controlCall(http.MethodPost, controlKill+"?"+q.Encode(), &out)
+	if errors.Is(err, errControlNotFound) {
+		return 0, fmt.Errorf("no such connection: %s", value)
+	}
+	return out.Killed, err
+}
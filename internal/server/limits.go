@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"proxychan/internal/models"
+	"time"
+)
+
+var (
+	errGlobalConnLimit = errors.New("global connection limit reached")
+	errUserConnLimit   = errors.New("per-user connection limit reached")
+	errSourceConnLimit = errors.New("per-source connection limit reached")
+)
+
+// registerConn records a tunnel in s.conns, refusing it if any
+// concurrency cap would be exceeded. Check and insert happen under
+// the same lock so bursts cannot overshoot the limits.
+func (s *Server) registerConn(ctx context.Context, username, srcIP, dst string) (*connState, error) {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+
+	if max := s.cfg.MaxConns; max > 0 && len(s.conns) >= max {
+		return nil, errGlobalConnLimit
+	}
+	if max := s.cfg.MaxConnsPerUser; max > 0 && username != "" && s.userConns[username] >= max {
+		return nil, errUserConnLimit
+	}
+	if max := s.cfg.MaxConnsPerSource; max > 0 && s.srcConns[srcIP] >= max {
+		return nil, errSourceConnLimit
+	}
+
+	id := s.nextConnID.Add(1)
+
+	st := newConnState(ctx, models.ActiveConn{
+		ID:          id,
+		Username:    username,
+		SourceIP:    srcIP,
+		Destination: dst,
+		StartedAt:   time.Now(),
+		Route:       s.route,
+	})
+	s.conns[id] = st
+	if username != "" {
+		s.userConns[username]++
+	}
+	s.srcConns[srcIP]++
+
+	s.publishOpen(st)
+	return st, nil
+}
+
+func (s *Server) unregisterConn(id uint64) {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+
+	st, ok := s.conns[id]
+	if !ok {
+		return
+	}
+	st.cancel()
+	s.addClosedBytes(st)
+	s.publishClose(st)
+	ac := st.info
+	delete(s.conns, id)
+
+	if ac.Username != "" {
+		if s.userConns[ac.Username]--; s.userConns[ac.Username] <= 0 {
+			delete(s.userConns, ac.Username)
+		}
+	}
+	if s.srcConns[ac.SourceIP]--; s.srcConns[ac.SourceIP] <= 0 {
+		delete(s.srcConns, ac.SourceIP)
+	}
+}
+
+// admitConn counts an accepted socket until release is called,
+// refusing it if the global or per-source cap is already reached. It
+// counts from Accept on, handshake included: a client that never finishes
+// the handshake holds a file descriptor just like a tunnel does.
+func (s *Server) admitConn(c net.Conn) (release func(), err error) {
+	srcIP, _, _ := net.SplitHostPort(c.RemoteAddr().String())
+
+	if n := s.inflight.Add(1); s.cfg.MaxConns > 0 && n > int64(s.cfg.MaxConns) {
+		s.inflight.Add(-1)
+		return nil, errGlobalConnLimit
+	}
+
+	s.inflightMu.Lock()
+	if max := s.cfg.MaxConnsPerSource; max > 0 && s.inflightSrc[srcIP] >= max {
+		s.inflightMu.Unlock()
+		s.inflight.Add(-1)
+		return nil, errSourceConnLimit
+	}
+	s.inflightSrc[srcIP]++
+	s.inflightMu.Unlock()
+
+	return func() {
+		s.inflight.Add(-1)
+		s.inflightMu.Lock()
+		if s.inflightSrc[srcIP]--; s.inflightSrc[srcIP] <= 0 {
+			delete(s.inflightSrc, srcIP)
+		}
+		s.inflightMu.Unlock()
+	}, nil
+}
+
+// ConnLimits reports current tunnel counts against the configured caps.
+func (s *Server) ConnLimits() models.ConnLimitStatus {
+	s.connMu.RLock()
+	defer s.connMu.RUnlock()
+
+	st := models.ConnLimitStatus{
+		Total:        len(s.conns),
+		MaxTotal:     s.cfg.MaxConns,
+		MaxPerUser:   s.cfg.MaxConnsPerUser,
+		MaxPerSource: s.cfg.MaxConnsPerSource,
+		PerUser:      make(map[string]int, len(s.userConns)),
+		PerSource:    make(map[string]int, len(s.srcConns)),
+	}
+	for u, n := range s.userConns {
+		st.PerUser[u] = n
+	}
+	for ip, n := range s.srcConns {
+		st.PerSource[ip] = n
+	}
+	return st
+}
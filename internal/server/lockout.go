@@ -0,0 +1,163 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"proxychan/internal/system"
+	"sync"
+	"time"
+)
+
+var errSourceLocked = errors.New("too many failed logins from source")
+
+// failureWindow counts events per key inside a sliding time window.
+type failureWindow struct {
+	mu     sync.Mutex
+	window time.Duration
+	hits   map[string][]time.Time
+}
+
+func newFailureWindow(window time.Duration) *failureWindow {
+	return &failureWindow{
+		window: window,
+		hits:   make(map[string][]time.Time),
+	}
+}
+
+// add records one event and returns how many fall inside the window.
+func (f *failureWindow) add(key string, now time.Time) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	cutoff := now.Add(-f.window)
+	kept := f.hits[key][:0]
+	for _, t := range f.hits[key] {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	kept = append(kept, now)
+	f.hits[key] = kept
+
+	// drop stale keys so the map does not grow without bound
+	if len(f.hits) > 4096 {
+		for k, ts := range f.hits {
+			if len(ts) == 0 || !ts[len(ts)-1].After(cutoff) {
+				delete(f.hits, k)
+			}
+		}
+	}
+
+	return len(kept)
+}
+
+func (f *failureWindow) reset(key string) {
+	f.mu.Lock()
+	delete(f.hits, key)
+	f.mu.Unlock()
+}
+
+func (s *Server) lockoutEnabled() bool {
+	return s.cfg.LockoutThreshold > 0
+}
+
+func (s *Server) sourceLocked(srcIP string) bool {
+	s.lockMu.Lock()
+	defer s.lockMu.Unlock()
+
+	until, ok := s.lockedSources[srcIP]
+	if !ok {
+		return false
+	}
+	if time.Now().After(until) {
+		delete(s.lockedSources, srcIP)
+		return false
+	}
+	return true
+}
+
+// checkCredentials wraps AuthFunc with account and source lockout.
+// Locked accounts are refused before bcrypt runs, so a brute-force
+// attempt against them costs the attacker nothing useful.
+func (s *Server) checkCredentials(db *sql.DB, srcIP, username, password string) error {
+	if s.lockoutEnabled() && s.sourceLocked(srcIP) {
+		return errSourceLocked
+	}
+
+	// unknown users still go through AuthFunc, so a guess costs the
+	// same bcrypt run and counts towards the source lockout
+	if err := system.CheckUserLock(db, username); err != nil && !errors.Is(err, system.ErrUserNotFound) {
+		return err
+	}
+
+	if err := s.cfg.AuthFunc(username, password); err != nil {
+		s.recordAuthFailure(db, username, srcIP)
+		return err
+	}
+
+	// checked only once the password is known to be right, so expiry
+	// does not tell a guesser anything about the account
+	if err := system.CheckUserExpiry(db, username, time.Now()); err != nil {
+		return err
+	}
+
+	if s.lockoutEnabled() {
+		s.userFailures.reset(username)
+	}
+	return nil
+}
+
+func (s *Server) recordAuthFailure(db *sql.DB, username, srcIP string) {
+	if !s.lockoutEnabled() {
+		return
+	}
+
+	now := time.Now()
+	until := now.Add(s.cfg.LockoutDuration)
+
+	if n := s.userFailures.add(username, now); n >= s.cfg.LockoutThreshold {
+		err := system.LockUser(db, system.ActorSystem, username, until)
+		switch {
+		case errors.Is(err, system.ErrUserNotFound):
+			// a guessed username; the source lockout below covers it
+		case err != nil:
+			s.cfg.Logger.Warnf("failed to lock user %s: %v", username, err)
+		default:
+			s.cfg.Logger.Warnf(
+				"user %s locked until %s after %d failed logins (last from %s)",
+				username, until.Format(time.RFC3339), n, srcIP,
+			)
+		}
+		s.userFailures.reset(username)
+	}
+
+	if n := s.sourceFailures.add(srcIP, now); n >= s.cfg.LockoutThreshold {
+		s.lockMu.Lock()
+		s.lockedSources[srcIP] = until
+		s.lockMu.Unlock()
+
+		s.cfg.Logger.Warnf(
+			"source %s locked out until %s after %d failed logins",
+			srcIP, until.Format(time.RFC3339), n,
+		)
+		s.sourceFailures.reset(srcIP)
+	}
+}
+
+// isLockoutErr reports whether err means the login was refused by policy
+// rather than because of wrong credentials.
+func isLockoutErr(err error) bool {
+	return errors.Is(err, system.ErrUserBlocked) ||
+		errors.Is(err, system.ErrUserLocked) ||
+		errors.Is(err, system.ErrUserExpired) ||
+		errors.Is(err, system.ErrPasswordExpired) ||
+		errors.Is(err, errSourceLocked)
+}
+
+// isExpiryErr reports whether err means the credentials were right but
+// the account or its password has expired. The client is not guessing,
+// so such refusals don't count towards a source ban.
+func isExpiryErr(err error) bool {
+	return errors.Is(err, system.ErrUserExpired) ||
+		errors.Is(err, system.ErrPasswordExpired)
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFailureWindowSlides(t *testing.T) {
+	f := newFailureWindow(time.Minute)
+	start := time.Now()
+
+	for _, tc := range []struct {
+		key   string
+		after time.Duration
+		want  int
+	}{
+		{"alice", 0, 1},
+		{"alice", 20 * time.Second, 2},
+		{"alice", 40 * time.Second, 3},
+		{"bob", 40 * time.Second, 1},   // keys are counted apart
+		{"alice", 61 * time.Second, 3}, // the first hit left the window
+		{"alice", 100 * time.Second, 2},
+		{"alice", 10 * time.Minute, 1}, // everything before expired
+	} {
+		if got := f.add(tc.key, start.Add(tc.after)); got != tc.want {
+			t.Errorf("%s at +%v: %d hits in the window, want %d", tc.key, tc.after, got, tc.want)
+		}
+	}
+
+	f.reset("alice")
+	if got := f.add("alice", start.Add(10*time.Minute)); got != 1 {
+		t.Errorf("after reset: %d hits, want 1", got)
+	}
+}
+
+func TestFailureWindowDropsStaleKeys(t *testing.T) {
+	f := newFailureWindow(time.Minute)
+	start := time.Now()
+
+	for i := 0; i <= 4096; i++ {
+		f.add(fmt.Sprintf("guess-%d", i), start)
+	}
+	f.add("late", start.Add(2*time.Minute))
+
+	f.mu.Lock()
+	n := len(f.hits)
+	f.mu.Unlock()
+	if n != 1 {
+		t.Errorf("%d keys kept, want only the live one", n)
+	}
+}
+
+func TestSourceLockExpires(t *testing.T) {
+	s := New(Config{LockoutThreshold: 3, LockoutWindow: time.Minute})
+	s.lockedSources["192.0.2.1"] = time.Now().Add(time.Hour)
+	s.lockedSources["192.0.2.2"] = time.Now().Add(-time.Second)
+
+	if !s.sourceLocked("192.0.2.1") {
+		t.Error("source with a lock in the future is not locked")
+	}
+	if s.sourceLocked("192.0.2.2") {
+		t.Error("expired source lock still applies")
+	}
+	if _, ok := s.lockedSources["192.0.2.2"]; ok {
+		t.Error("expired source lock was not dropped")
+	}
+	if s.sourceLocked("192.0.2.3") {
+		t.Error("unknown source is locked")
+	}
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"proxychan/internal/metrics"
+	"time"
+)
+
+// Reasons used to label rejected and failed connections.
+const (
+	reasonWhitelist = "whitelist"
+	reasonBan       = "ban"
+	reasonAuth      = "auth"
+	reasonHandshake = "handshake"
+	reasonInactive  = "inactive"
+	reasonQuota     = "quota"
+	reasonRequest   = "request"
+	reasonDenylist  = "denylist"
+	reasonLimit     = "limit"
+	reasonDial      = "dial"
+)
+
+const torHealthInterval = 15 * time.Second
+
+// Timeouts of the --metrics-listen server. A scrape is one short request,
+// so slow or idle clients are dropped early.
+const (
+	metricsReadHeaderTimeout = 10 * time.Second
+	metricsIdleTimeout       = time.Minute
+)
+
+type serverMetrics struct {
+	reg *metrics.Registry
+
+	accepted  *metrics.CounterVec
+	rejected  *metrics.CounterVec
+	failed    *metrics.CounterVec
+	handshake *metrics.Histogram
+	dial      *metrics.Histogram
+	reloads   *metrics.CounterVec
+	versions  *metrics.GaugeVec
+	torUp     *metrics.GaugeVec
+}
+
+// bytesKey identifies a closed-tunnel byte total; user is "" unless
+// per-user metrics are enabled.
+type bytesKey struct {
+	user, direction string
+}
+
+func (s *Server) initMetrics() {
+	reg := metrics.NewRegistry()
+
+	m := &serverMetrics{
+		reg: reg,
+		accepted: reg.NewCounterVec("proxychan_connections_accepted_total",
+			"Client connections accepted by a listener.", "listener"),
+		rejected: reg.NewCounterVec("proxychan_connections_rejected_total",
+			"Connections refused by policy.", "reason"),
+		failed: reg.NewCounterVec("proxychan_connections_failed_total",
+			"Connections that failed (bad handshake or request, dial error).", "reason"),
+		handshake: reg.NewHistogram("proxychan_handshake_duration_seconds",
+			"Time to complete the SOCKS5 greeting and authentication.", metrics.DefaultLatencyBuckets),
+		dial: reg.NewHistogram("proxychan_dial_duration_seconds",
+			"Time to dial the destination through the egress route.", metrics.DefaultLatencyBuckets),
+		reloads: reg.NewCounterVec("proxychan_policy_reloads_total",
+			"Policy reloads picked up from SQLite.", "policy"),
+		versions: reg.NewGaugeVec("proxychan_policy_version",
+			"Currently loaded policy version.", "policy"),
+	}
+
+	labels := []string{"egress"}
+	if s.cfg.MetricsPerUser {
+		labels = []string{"user", "egress"}
+	}
+
+	reg.NewFunc("proxychan_active_tunnels", "Open tunnels.", "gauge", labels, s.activeTunnelSamples)
+	reg.NewFunc("proxychan_transferred_bytes_total", "Bytes relayed through tunnels.", "counter",
+		append(labels, "direction"), s.transferredSamples)
+
+	if s.cfg.TorSocksAddr != "" {
+		m.torUp = reg.NewGaugeVec("proxychan_tor_up",
+			"Whether the Tor SOCKS port accepts connections.", "addr")
+	}
+
+	s.metrics = m
+}
+
+func (s *Server) MetricsHandler() http.Handler {
+	return s.metrics.reg.Handler()
+}
+
+func (s *Server) metricUser(username string) string {
+	if !s.cfg.MetricsPerUser {
+		return ""
+	}
+	return username
+}
+
+func (s *Server) metricLabels(user string, extra ...string) []string {
+	if s.cfg.MetricsPerUser {
+		return append([]string{user, s.route}, extra...)
+	}
+	return append([]string{s.route}, extra...)
+}
+
+func (s *Server) activeTunnelSamples() []metrics.Sample {
+	s.connMu.RLock()
+	defer s.connMu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, st := range s.conns {
+		counts[s.metricUser(st.info.Username)]++
+	}
+
+	out := make([]metrics.Sample, 0, len(counts))
+	for u, n := range counts {
+		out = append(out, metrics.Sample{Values: s.metricLabels(u), Value: float64(n)})
+	}
+	return out
+}
+
+// transferredSamples adds live tunnel counters to the totals of closed
+// ones. Both are read under connMu, which unregisterConn holds while it
+// moves a tunnel's bytes into the totals, so the sum never goes back.
+func (s *Server) transferredSamples() []metrics.Sample {
+	s.connMu.RLock()
+	defer s.connMu.RUnlock()
+
+	totals := make(map[bytesKey]int64, len(s.closedBytes))
+	for k, n := range s.closedBytes {
+		totals[k] = n
+	}
+	for _, st := range s.conns {
+		u := s.metricUser(st.info.Username)
+		totals[bytesKey{u, "up"}] += st.up.Load()
+		totals[bytesKey{u, "down"}] += st.down.Load()
+	}
+
+	out := make([]metrics.Sample, 0, len(totals))
+	for k, n := range totals {
+		out = append(out, metrics.Sample{Values: s.metricLabels(k.user, k.direction), Value: float64(n)})
+	}
+	return out
+}
+
+// addClosedBytes must be called with connMu held for writing.
+func (s *Server) addClosedBytes(st *connState) {
+	u := s.metricUser(st.info.Username)
+	s.closedBytes[bytesKey{u, "up"}] += st.up.Load()
+	s.closedBytes[bytesKey{u, "down"}] += st.down.Load()
+}
+
+func (s *Server) policyReloaded(policy string, version int64) {
+	s.metrics.reloads.Inc(policy)
+	s.metrics.versions.Set(float64(version), policy)
+}
+
+func (s *Server) torHealthLoop(ctx context.Context) {
+	check := func() {
+		up := 0.0
+		c, err := net.DialTimeout("tcp", s.cfg.TorSocksAddr, 3*time.Second)
+		if err == nil {
+			_ = c.Close()
+			up = 1
+		}
+		s.metrics.torUp.Set(up, s.cfg.TorSocksAddr)
+	}
+
+	check()
+
+	ticker := time.NewTicker(torHealthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			check()
+		}
+	}
+}
+
+// runMetricsListener serves /metrics on its own address, without the
+// admin login, so a Prometheus server can scrape it.
+func (s *Server) runMetricsListener(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s.MetricsHandler())
+
+	srv := &http.Server{
+		Addr:              s.cfg.MetricsListenAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: metricsReadHeaderTimeout,
+		IdleTimeout:       metricsIdleTimeout,
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+
+	s.cfg.Logger.Infof("metrics listening on %s", s.cfg.MetricsListenAddr)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		s.cfg.Logger.Warnf("metrics endpoint error: %v", err)
+	}
+}
@@ -23,6 +23,7 @@ func (s *Server) initPolicies(ctx context.Context, db *sql.DB) error {
 	s.whitelistVersion = v
 	s.mu.Unlock()
 
+	s.metrics.versions.Set(float64(v), "whitelist")
 	go s.whitelistPoller(ctx, db)
 
 	// denylist
@@ -43,7 +44,60 @@ func (s *Server) initPolicies(ctx context.Context, db *sql.DB) error {
 	s.denyVersion = dv
 	s.denyMu.Unlock()
 
+	s.metrics.versions.Set(float64(dv), "denylist")
 	go s.denylistPoller(ctx, db)
 
+	// rate limits
+	rl, err := system.LoadRateLimits(db)
+	if err != nil {
+		return err
+	}
+
+	rv, err := system.GetRateLimitsVersion(db)
+	if err != nil {
+		return err
+	}
+
+	s.applyRateLimits(rl, rv)
+	s.metrics.versions.Set(float64(rv), "rate_limits")
+
+	go s.rateLimitPoller(ctx, db)
+
+	// source bans
+	bans, err := system.LoadBans(db)
+	if err != nil {
+		return err
+	}
+
+	bv, err := system.GetBansVersion(db)
+	if err != nil {
+		return err
+	}
+
+	s.banMu.Lock()
+	s.bans = bans
+	s.banVersion = bv
+	s.banMu.Unlock()
+
+	s.metrics.versions.Set(float64(bv), "bans")
+	go s.banPoller(ctx, db)
+
+	// user status (open tunnels are re-checked when it changes)
+	uv, err := system.GetUsersVersion(db)
+	if err != nil {
+		return err
+	}
+	s.userVersion.Store(uv)
+	s.metrics.versions.Set(float64(uv), "users")
+
+	go s.userPoller(ctx, db)
+
+	// quotas
+	if err := s.loadQuotas(db); err != nil {
+		return err
+	}
+
+	go s.quotaFlusher(ctx, db)
+
 	return nil
 }
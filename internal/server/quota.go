@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"proxychan/internal/system"
+	"sync/atomic"
+	"time"
+)
+
+// quotaFlushInterval is how often accumulated byte counts are written
+// to SQLite. Anything not yet flushed is lost on a crash, never on a
+// clean shutdown.
+const quotaFlushInterval = 10 * time.Second
+
+const reasonQuotaExceeded = "quota exceeded"
+
+// usageCounter returns the shared pending byte counter for a user.
+// Unauthenticated tunnels are not accounted.
+func (s *Server) usageCounter(username string) *atomic.Int64 {
+	if username == "" {
+		return nil
+	}
+
+	s.quotaMu.RLock()
+	c, ok := s.usage[username]
+	s.quotaMu.RUnlock()
+	if ok {
+		return c
+	}
+
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+
+	if c, ok := s.usage[username]; ok {
+		return c
+	}
+	c = new(atomic.Int64)
+	s.usage[username] = c
+	return c
+}
+
+// quotaExceeded reports whether the user has used up the current period.
+func (s *Server) quotaExceeded(username string) bool {
+	if username == "" {
+		return false
+	}
+
+	s.quotaMu.RLock()
+	q, ok := s.quotas[username]
+	pending := s.usage[username]
+	s.quotaMu.RUnlock()
+
+	if !ok {
+		return false
+	}
+
+	used := q.UsedAt(time.Now())
+	if pending != nil {
+		used += pending.Load()
+	}
+	return used >= q.QuotaBytes
+}
+
+// loadQuotas replaces the in-memory quotas with the database's. It waits
+// for a running flush, whose bytes would otherwise be counted twice or
+// not at all.
+func (s *Server) loadQuotas(db *sql.DB) error {
+	s.quotaFlushMu.Lock()
+	defer s.quotaFlushMu.Unlock()
+	return s.reloadQuotas(db)
+}
+
+func (s *Server) reloadQuotas(db *sql.DB) error {
+	q, err := system.LoadQuotas(db)
+	if err != nil {
+		return err
+	}
+
+	s.quotaMu.Lock()
+	s.quotas = q
+	s.quotaMu.Unlock()
+	return nil
+}
+
+// flushUsage persists pending byte counts in one batch, rolls over
+// elapsed periods and reloads quotas so CLI changes take effect.
+// Pending bytes move into the in-memory usage under the same lock that
+// clears them, so quotaExceeded always sees them in one place or the
+// other.
+func (s *Server) flushUsage(db *sql.DB) {
+	s.quotaFlushMu.Lock()
+	defer s.quotaFlushMu.Unlock()
+
+	now := time.Now()
+	batch := make(map[string]int64)
+
+	s.quotaMu.Lock()
+	for user, c := range s.usage {
+		n := c.Swap(0)
+		if n <= 0 {
+			continue
+		}
+		batch[user] = n
+		if q, ok := s.quotas[user]; ok {
+			s.quotas[user] = q.WithUsage(n, now)
+		}
+	}
+	s.quotaMu.Unlock()
+
+	n, err := system.FlushQuotaUsage(db, batch, now)
+	if err != nil {
+		s.cfg.Logger.Warnf("quota usage flush failed: %v", err)
+
+		// keep the bytes for the next attempt; the in-memory usage
+		// is corrected by the next successful reload
+		s.quotaMu.Lock()
+		for user, n := range batch {
+			if q, ok := s.quotas[user]; ok {
+				q.UsedBytes -= n
+				s.quotas[user] = q
+			}
+		}
+		s.quotaMu.Unlock()
+		for user, n := range batch {
+			s.usageCounter(user).Add(n)
+		}
+		return
+	}
+	if n > 0 {
+		s.cfg.Logger.Infof("quota period reset for %d user(s)", n)
+	}
+
+	if err := s.reloadQuotas(db); err != nil {
+		s.cfg.Logger.Warnf("quota reload failed: %v", err)
+		return
+	}
+	s.killOverQuota()
+}
+
+// killOverQuota closes every tunnel of a user whose quota is used up.
+// Tunnels check their own quota only while moving data, so an idle one,
+// or one whose quota was lowered from the CLI, would otherwise stay open.
+func (s *Server) killOverQuota() {
+	s.quotaMu.RLock()
+	users := make([]string, 0, len(s.quotas))
+	for user := range s.quotas {
+		users = append(users, user)
+	}
+	s.quotaMu.RUnlock()
+
+	for _, user := range users {
+		if !s.quotaExceeded(user) {
+			continue
+		}
+		n := s.killMatching(func(st *connState) bool { return st.info.Username == user }, reasonQuotaExceeded)
+		if n > 0 {
+			s.cfg.Logger.Warnf("%d connection(s) of user %s closed: quota exceeded", n, user)
+		}
+	}
+}
+
+func (s *Server) quotaFlusher(ctx context.Context, db *sql.DB) {
+	ticker := time.NewTicker(quotaFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.flushUsage(db)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"proxychan/internal/system"
+	"sync"
+	"time"
+)
+
+// tokenBucket is a byte rate limiter shared by every tunnel of one user.
+// A rate of 0 disables limiting. Callers may overdraw the bucket and
+// then sleep off the debt, so a single large read never stalls forever.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate int64) *tokenBucket {
+	b := &tokenBucket{}
+	b.setRate(rate)
+	return b
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if b.rate > 0 {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+}
+
+// setRate changes the rate in place so open tunnels follow policy changes.
+func (b *tokenBucket) setRate(rate int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.refill(now)
+
+	wasUnlimited := b.rate <= 0
+	b.rate = float64(rate)
+	b.burst = b.rate // one second worth of traffic
+
+	if wasUnlimited || b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// wait takes n bytes from the bucket, sleeping if it runs dry.
+func (b *tokenBucket) wait(ctx context.Context, n int) error {
+	b.mu.Lock()
+	if b.rate <= 0 {
+		b.mu.Unlock()
+		return nil
+	}
+
+	b.refill(time.Now())
+	b.tokens -= float64(n)
+
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+type userLimiter struct {
+	user string       // "" for unauthenticated tunnels
+	up   *tokenBucket // client -> destination
+	down *tokenBucket // destination -> client
+	refs int
+}
+
+// limiterKey identifies whose bucket a tunnel draws from.
+// Unauthenticated tunnels (--no-auth) are grouped per source IP.
+func limiterKey(username string, srcIP net.IP) (key, user string) {
+	if username != "" {
+		return "user:" + username, username
+	}
+	return "src:" + srcIP.String(), ""
+}
+
+func (s *Server) acquireLimiter(username string, srcIP net.IP) (*userLimiter, func()) {
+	key, user := limiterKey(username, srcIP)
+
+	s.rateMu.Lock()
+	defer s.rateMu.Unlock()
+
+	l, ok := s.limiters[key]
+	if !ok {
+		up, down := s.rateLimits.Resolve(user)
+		l = &userLimiter{
+			user: user,
+			up:   newTokenBucket(up),
+			down: newTokenBucket(down),
+		}
+		s.limiters[key] = l
+	}
+	l.refs++
+
+	release := func() {
+		s.rateMu.Lock()
+		defer s.rateMu.Unlock()
+
+		l.refs--
+		if l.refs == 0 {
+			delete(s.limiters, key)
+		}
+	}
+
+	return l, release
+}
+
+// applyRateLimits pushes freshly loaded limits into live buckets.
+func (s *Server) applyRateLimits(rt *system.RateLimitRuntime, v int64) {
+	s.rateMu.Lock()
+	defer s.rateMu.Unlock()
+
+	s.rateLimits = rt
+	s.rateVersion = v
+
+	for _, l := range s.limiters {
+		up, down := rt.Resolve(l.user)
+		l.up.setRate(up)
+		l.down.setRate(down)
+	}
+}
+
+func (s *Server) rateLimitPoller(ctx context.Context, db *sql.DB) {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			v, err := system.GetRateLimitsVersion(db)
+			if err != nil {
+				s.cfg.Logger.Warnf("rate limit version check failed: %v", err)
+				continue
+			}
+
+			s.rateMu.Lock()
+			cur := s.rateVersion
+			s.rateMu.Unlock()
+
+			if v != cur {
+				if err := s.reloadRateLimits(db, v); err != nil {
+					s.cfg.Logger.Warnf("rate limit reload failed: %v", err)
+				}
+			}
+		}
+	}
+}
+
+func (s *Server) reloadRateLimits(db *sql.DB, v int64) error {
+	rt, err := system.LoadRateLimits(db)
+	if err != nil {
+		return err
+	}
+
+	s.applyRateLimits(rt, v)
+	s.policyReloaded("rate_limits", v)
+
+	s.cfg.Logger.Infof("rate limits reloaded (users=%d, groups=%d, global=%t)",
+		len(rt.Users), len(rt.Groups), rt.Global != nil)
+	return nil
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketRefill(t *testing.T) {
+	now := time.Now()
+
+	for _, tc := range []struct {
+		name    string
+		rate    int64
+		tokens  float64
+		elapsed time.Duration
+		want    float64
+	}{
+		{"partial", 1000, 0, 250 * time.Millisecond, 250},
+		{"adds to what is left", 1000, 300, 500 * time.Millisecond, 800},
+		{"capped at one second of burst", 1000, 0, 10 * time.Second, 1000},
+		{"pays off a debt", 1000, -500, 750 * time.Millisecond, 250},
+		{"still in debt", 1000, -2000, time.Second, -1000},
+		{"unlimited does not change", 0, 42, time.Hour, 42},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := newTokenBucket(tc.rate)
+			b.tokens = tc.tokens
+			b.last = now.Add(-tc.elapsed)
+
+			b.refill(now)
+			if math.Abs(b.tokens-tc.want) > 1e-6 {
+				t.Errorf("tokens = %v, want %v", b.tokens, tc.want)
+			}
+			if !b.last.Equal(now) {
+				t.Errorf("last = %v, want %v", b.last, now)
+			}
+		})
+	}
+}
+
+func TestTokenBucketSetRate(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		from, to   int64
+		tokens     float64
+		wantTokens float64
+	}{
+		{"new bucket starts full", 0, 2048, 0, 2048},
+		{"lowering caps the burst", 4096, 1024, 4096, 1024},
+		{"raising keeps the tokens", 1024, 4096, 512, 512},
+		{"raising keeps a debt", 1024, 4096, -512, -512},
+		{"unlimited to limited starts full", 0, 100, -5000, 100},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := newTokenBucket(tc.from)
+			b.tokens = tc.tokens
+			// refill adds at most a few bytes before setRate reads the clock
+			b.last = time.Now()
+
+			b.setRate(tc.to)
+			if b.rate != float64(tc.to) || b.burst != float64(tc.to) {
+				t.Errorf("rate %v burst %v, want both %d", b.rate, b.burst, tc.to)
+			}
+			if math.Abs(b.tokens-tc.wantTokens) > 10 {
+				t.Errorf("tokens = %v, want about %v", b.tokens, tc.wantTokens)
+			}
+		})
+	}
+}
+
+func TestTokenBucketWait(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("unlimited never waits", func(t *testing.T) {
+		b := newTokenBucket(0)
+		start := time.Now()
+		for i := 0; i < 100; i++ {
+			if err := b.wait(ctx, 1<<20); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if d := time.Since(start); d > 50*time.Millisecond {
+			t.Errorf("took %v", d)
+		}
+	})
+
+	t.Run("burst is free then overdraw sleeps", func(t *testing.T) {
+		b := newTokenBucket(10000)
+		start := time.Now()
+		if err := b.wait(ctx, 10000); err != nil {
+			t.Fatal(err)
+		}
+		if d := time.Since(start); d > 50*time.Millisecond {
+			t.Errorf("burst took %v", d)
+		}
+
+		// 1000 bytes over at 10000 B/s is 100ms of debt
+		start = time.Now()
+		if err := b.wait(ctx, 1000); err != nil {
+			t.Fatal(err)
+		}
+		if d := time.Since(start); d < 80*time.Millisecond || d > time.Second {
+			t.Errorf("overdraw slept %v, want about 100ms", d)
+		}
+	})
+
+	t.Run("cancel stops the sleep", func(t *testing.T) {
+		b := newTokenBucket(1)
+		ctx, cancel := context.WithCancel(ctx)
+		time.AfterFunc(20*time.Millisecond, cancel)
+
+		start := time.Now()
+		if err := b.wait(ctx, 1000); err != context.Canceled {
+			t.Errorf("err = %v, want context.Canceled", err)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("cancelled wait took %v", d)
+		}
+	})
+}
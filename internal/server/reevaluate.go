@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"proxychan/internal/system"
+	"time"
+)
+
+// What to do with open tunnels that a policy change no longer allows.
+const (
+	EnforceClose = "close" // kill the tunnel
+	EnforceFlag  = "flag"  // keep it, but mark it on the connections views
+)
+
+func (s *Server) userPoller(ctx context.Context, db *sql.DB) {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			v, err := system.GetUsersVersion(db)
+			if err != nil {
+				s.cfg.Logger.Warnf("user version check failed: %v", err)
+				continue
+			}
+
+			if v != s.userVersion.Load() {
+				s.userVersion.Store(v)
+				s.policyReloaded("users", v)
+				s.reevaluateConns(db, "user status change")
+			}
+		}
+	}
+}
+
+// reevaluateConns re-checks every open tunnel against the current
+// whitelist, bans, denylist and user status.
+func (s *Server) reevaluateConns(db *sql.DB, trigger string) {
+	s.connMu.RLock()
+	conns := make([]*connState, 0, len(s.conns))
+	for _, st := range s.conns {
+		conns = append(conns, st)
+	}
+	s.connMu.RUnlock()
+
+	if len(conns) == 0 {
+		return
+	}
+
+	userVerdicts := make(map[string]string)
+	affected := 0
+
+	for _, st := range conns {
+		reason := s.connViolation(db, st, userVerdicts)
+		if reason == "" {
+			// allowed again, e.g. the rule that flagged it was removed
+			st.flagViolation("")
+			continue
+		}
+		affected++
+
+		if s.cfg.PolicyEnforcement == EnforceFlag {
+			if st.flagViolation(reason) {
+				s.cfg.Logger.Warnf(
+					"tunnel %d user=%q src=%s dst=%s violates policy after %s: %s",
+					st.info.ID, st.info.Username, st.info.SourceIP, st.info.Destination, trigger, reason,
+				)
+			}
+			continue
+		}
+
+		s.cfg.Logger.Warnf(
+			"closing tunnel %d user=%q src=%s dst=%s after %s: %s",
+			st.info.ID, st.info.Username, st.info.SourceIP, st.info.Destination, trigger, reason,
+		)
+		st.kill("policy change: " + reason)
+	}
+
+	if affected > 0 {
+		s.cfg.Logger.Infof("%s: %d open tunnel(s) no longer allowed", trigger, affected)
+	}
+}
+
+// connViolation returns why a tunnel is no longer allowed ("" if it is).
+// userVerdicts caches user lookups for one pass.
+func (s *Server) connViolation(db *sql.DB, st *connState, userVerdicts map[string]string) string {
+	ac := st.info
+
+	if ip := net.ParseIP(ac.SourceIP); ip != nil {
+		if s.ipBanned(ip.String()) {
+			return "source banned"
+		}
+		if !s.ipAllowed(ip) {
+			return "source no longer whitelisted"
+		}
+	}
+
+	if host, _, err := net.SplitHostPort(ac.Destination); err == nil {
+		if typ, pat, denied := s.destDenied(host); denied {
+			return fmt.Sprintf("destination denied (%s %s)", typ, pat)
+		}
+	}
+
+	if ac.Username == "" {
+		return ""
+	}
+	verdict, ok := userVerdicts[ac.Username]
+	if !ok {
+		verdict = s.userRevoked(db, ac.Username)
+		userVerdicts[ac.Username] = verdict
+	}
+	return verdict
+}
+
+// userRevoked returns why a user may no longer hold tunnels ("" if it may).
+// Temporary lockouts are left alone: they stop guessing, not sessions.
+func (s *Server) userRevoked(db *sql.DB, username string) string {
+	active, err := system.IsActive(db, username)
+	if errors.Is(err, system.ErrUserNotFound) {
+		return "user deleted"
+	}
+	if err != nil {
+		s.cfg.Logger.Warnf("re-check of user %s failed: %v", username, err)
+		return ""
+	}
+	if !active {
+		return "user deactivated"
+	}
+
+	if err := system.CheckUserLock(db, username); errors.Is(err, system.ErrUserBlocked) {
+		return "user blocked"
+	}
+
+	if err := system.CheckUserExpiry(db, username, time.Now()); err != nil {
+		if errors.Is(err, system.ErrUserExpired) || errors.Is(err, system.ErrPasswordExpired) {
+			return err.Error()
+		}
+		s.cfg.Logger.Warnf("re-check of user %s failed: %v", username, err)
+	}
+	return ""
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"maps"
+
+	"proxychan/internal/models"
+)
+
+// Hits are only counted where a rule decides a new connection, not when
+// open tunnels are re-checked after a reload.
+
+func (s *Server) countWhitelistHit(rule string) {
+	s.hitMu.Lock()
+	s.whitelistHits[rule]++
+	s.hitMu.Unlock()
+}
+
+func (s *Server) countDenylistHit(rule string) {
+	s.hitMu.Lock()
+	s.denylistHits[rule]++
+	s.hitMu.Unlock()
+}
+
+func (s *Server) RuleHits() models.RuleHits {
+	s.hitMu.Lock()
+	defer s.hitMu.Unlock()
+
+	return models.RuleHits{
+		Whitelist: maps.Clone(s.whitelistHits),
+		Denylist:  maps.Clone(s.denylistHits),
+	}
+}
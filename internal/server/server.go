@@ -11,7 +11,7 @@ import (
 
 	"proxychan/internal/dialer"
 	"proxychan/internal/logging"
-	"proxychan/internal/models"
+	"proxychan/internal/system"
 	"proxychan/internal/web"
 
 	"github.com/sirupsen/logrus"
@@ -27,11 +27,60 @@ type Config struct {
 
 	RequireAuth bool
 	AuthFunc    func(username, password string) error
+
+	// Concurrent tunnel caps (0 = unlimited)
+	MaxConns          int
+	MaxConnsPerUser   int
+	MaxConnsPerSource int
+
+	// Brute-force protection: N failed logins within the window lock
+	// the account (and the source IP) for the duration. 0 disables.
+	LockoutThreshold int
+	LockoutWindow    time.Duration
+	LockoutDuration  time.Duration
+
+	// Automatic source bans: N offenses (failed handshakes, failed logins,
+	// denied destinations) within the window ban the IP. 0 disables.
+	BanThreshold int
+	BanWindow    time.Duration
+	BanDuration  time.Duration
+
+	// What to do with open tunnels a policy change no longer allows:
+	// EnforceClose (default) or EnforceFlag.
+	PolicyEnforcement string
+
+	// Metrics: served on the admin endpoint, and on MetricsListenAddr
+	// too if set. Per-user labels are opt-in to bound cardinality.
+	// TorSocksAddr enables the Tor health gauge.
+	MetricsListenAddr string
+	MetricsPerUser    bool
+	TorSocksAddr      string
+
+	// Admin web sessions end after AdminSessionIdle without requests
+	// or AdminSessionMax after login, whichever comes first.
+	AdminSessionIdle time.Duration
+	AdminSessionMax  time.Duration
+
+	// Admin endpoint address, HTTPS (with the given certificate or a
+	// persisted self-signed one) and the source IPs it accepts; an
+	// empty AdminAllow accepts all.
+	AdminListen  string
+	AdminTLS     bool
+	AdminTLSCert string
+	AdminTLSKey  string
+	AdminAllow   []net.IPNet
+
+	// Members of ControlGroup may use the control socket besides root
+	// (Linux only).
+	ControlGroup string
 }
 
 type Server struct {
 	cfg Config
 
+	// egress route reported for every tunnel
+	route string
+
 	// ip whitelist
 	mu               sync.RWMutex
 	whitelist        []net.IPNet
@@ -46,18 +95,94 @@ type Server struct {
 
 	//active connections
 	connMu     sync.RWMutex
-	conns      map[uint64]*models.ActiveConn
+	conns      map[uint64]*connState
 	nextConnID atomic.Uint64
+	userConns  map[string]int
+	srcConns   map[string]int
+
+	// accepted sockets, handshakes included (see admitConn)
+	inflight    atomic.Int64
+	inflightMu  sync.Mutex
+	inflightSrc map[string]int
+
+	//bandwidth limits
+	rateMu      sync.Mutex
+	rateLimits  *system.RateLimitRuntime
+	rateVersion int64
+	limiters    map[string]*userLimiter
+
+	//data volume quotas
+	quotaMu      sync.RWMutex
+	quotaFlushMu sync.Mutex // one flush or reload at a time
+	quotas       map[string]system.UserQuota
+	usage        map[string]*atomic.Int64
+
+	//login lockout
+	lockMu         sync.Mutex
+	lockedSources  map[string]time.Time
+	userFailures   *failureWindow
+	sourceFailures *failureWindow
+
+	//source bans
+	banMu      sync.RWMutex
+	bans       map[string]time.Time
+	banVersion int64
+	offenses   *failureWindow
+
+	//connection history
+	history *historyWriter
+
+	//live connection events for the admin streams
+	events *eventBus
+
+	// user status version, written by userPoller
+	userVersion atomic.Int64
+
+	started time.Time
+
+	//metrics
+	metrics     *serverMetrics
+	closedBytes map[bytesKey]int64
+
+	//policy rule hit counts since start
+	hitMu         sync.Mutex
+	whitelistHits map[string]uint64
+	denylistHits  map[string]uint64
 }
 
 func New(cfg Config) *Server {
 	if cfg.Logger == nil {
 		cfg.Logger = logging.GetLogger()
 	}
-	return &Server{
-		cfg:   cfg,
-		conns: make(map[uint64]*models.ActiveConn),
+	s := &Server{
+		cfg:       cfg,
+		route:     dialer.RouteOf(cfg.Dialer),
+		conns:     make(map[uint64]*connState),
+		userConns: make(map[string]int),
+		srcConns:  make(map[string]int),
+
+		inflightSrc: make(map[string]int),
+		limiters:    make(map[string]*userLimiter),
+		quotas:      make(map[string]system.UserQuota),
+		usage:       make(map[string]*atomic.Int64),
+
+		lockedSources:  make(map[string]time.Time),
+		userFailures:   newFailureWindow(cfg.LockoutWindow),
+		sourceFailures: newFailureWindow(cfg.LockoutWindow),
+
+		bans:     make(map[string]time.Time),
+		offenses: newFailureWindow(cfg.BanWindow),
+
+		history: newHistoryWriter(),
+		events:  newEventBus(),
+
+		closedBytes: make(map[bytesKey]int64),
+
+		whitelistHits: make(map[string]uint64),
+		denylistHits:  make(map[string]uint64),
 	}
+	s.initMetrics()
+	return s
 }
 
 func (s *Server) logStartupInfo() {
@@ -84,7 +209,22 @@ func (s *Server) acceptLoop(ctx context.Context, ln net.Listener, db *sql.DB) er
 			s.cfg.Logger.Errorf("accept error: %v", err)
 			continue
 		}
-		go s.handleConn(ctx, c, db)
+
+		// Shed load before spending a goroutine on the handshake.
+		s.metrics.accepted.Inc("socks5")
+
+		release, err := s.admitConn(c)
+		if err != nil {
+			s.metrics.rejected.Inc(reasonLimit)
+			s.cfg.Logger.Warnf("connection from %s dropped: %v", c.RemoteAddr(), err)
+			_ = c.Close()
+			continue
+		}
+
+		go func() {
+			defer release()
+			s.handleConn(ctx, c, db)
+		}()
 	}
 }
 
@@ -120,11 +260,27 @@ func (s *Server) startHTTPProxy(ctx context.Context, db *sql.DB) {
 		if err != nil {
 			return
 		}
-		go s.handleHTTPConn(ctx, c, db)
+
+		s.metrics.accepted.Inc("http")
+
+		release, err := s.admitConn(c)
+		if err != nil {
+			s.metrics.rejected.Inc(reasonLimit)
+			s.cfg.Logger.Warnf("http connection from %s dropped: %v", c.RemoteAddr(), err)
+			_ = c.Close()
+			continue
+		}
+
+		go func() {
+			defer release()
+			s.handleHTTPConn(ctx, c, db)
+		}()
 	}
 }
 
 func (s *Server) Run(ctx context.Context, db *sql.DB) error {
+	s.started = time.Now()
+
 	if err := s.initPolicies(ctx, db); err != nil {
 		return err
 	}
@@ -140,9 +296,37 @@ func (s *Server) Run(ctx context.Context, db *sql.DB) error {
 		go s.startHTTPProxy(ctx, db)
 	}
 
-	go web.RunAdminEndpoint(ctx, s, db)
+	control := s.startControl(ctx, db)
+
+	go web.RunAdminEndpoint(ctx, s, db, web.AdminOptions{
+		SessionIdle: s.cfg.AdminSessionIdle,
+		SessionMax:  s.cfg.AdminSessionMax,
+		Listen:      s.cfg.AdminListen,
+		TLS:         s.cfg.AdminTLS,
+		TLSCert:     s.cfg.AdminTLSCert,
+		TLSKey:      s.cfg.AdminTLSKey,
+		Allow:       s.cfg.AdminAllow,
+		Control:     control,
+	})
+
+	go s.historyLoop(ctx, db)
+
+	if s.cfg.MetricsListenAddr != "" {
+		go s.runMetricsListener(ctx)
+	}
+	if s.cfg.TorSocksAddr != "" {
+		go s.torHealthLoop(ctx)
+	}
+
+	err = s.acceptLoop(ctx, ln, db)
+
+	// persist byte counts gathered since the last periodic flush
+	s.flushUsage(db)
+
+	// wait for queued history records to be written
+	<-s.history.done
 
-	return s.acceptLoop(ctx, ln, db)
+	return err
 }
 
 func (s *Server) handleConn(ctx context.Context, client net.Conn, db *sql.DB) {
@@ -158,7 +342,7 @@ func (s *Server) handleConn(ctx context.Context, client net.Conn, db *sql.DB) {
 		return
 	}
 
-	req, err := s.readAndAuthorizeRequest(client, username)
+	req, err := s.readAndAuthorizeRequest(client, username, db)
 	if err != nil {
 		return
 	}
@@ -2,10 +2,13 @@ package server
 
 import (
 	"context"
+	"errors"
+	"io"
 	"net"
-	"proxychan/internal/models"
 	"proxychan/internal/socks5"
+	"proxychan/internal/system"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,38 +19,46 @@ func (s *Server) handleTunnel(
 	srcIP net.IP,
 	req *socks5.Request,
 ) {
-	id := s.nextConnID.Add(1)
-
-	ac := &models.ActiveConn{
-		ID:          id,
-		Username:    username,
-		SourceIP:    srcIP.String(),
-		Destination: req.Address,
-		StartedAt:   time.Now(),
+	st, err := s.registerConn(ctx, username, srcIP.String(), req.Address)
+	if err != nil {
+		if errors.Is(err, errGlobalConnLimit) {
+			// 0x01: general SOCKS server failure
+			_ = socks5.WriteReply(client, 0x01)
+		} else {
+			// 0x02: connection not allowed by ruleset
+			_ = socks5.WriteReply(client, 0x02)
+		}
+		s.metrics.rejected.Inc(reasonLimit)
+		s.cfg.Logger.Warnf(
+			"connection rejected user=%q src=%s dst=%s: %v",
+			username,
+			client.RemoteAddr(),
+			req.Address,
+			err,
+		)
+		s.recordRefused(username, srcIP.String(), req.Address, client.LocalAddr().String(), system.HistoryDenied, err.Error())
+		return
 	}
+	defer s.unregisterConn(st.info.ID)
 
-	s.connMu.Lock()
-	s.conns[id] = ac
-	s.connMu.Unlock()
-
-	defer func() {
-		s.connMu.Lock()
-		delete(s.conns, id)
-		s.connMu.Unlock()
-	}()
-
-	dialCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	dialCtx, cancel := context.WithTimeout(st.ctx, 30*time.Second)
 	defer cancel()
 
+	dialStart := time.Now()
 	out, err := s.cfg.Dialer.DialContext(dialCtx, "tcp", req.Address)
+	st.setDialLatency(time.Since(dialStart))
+	s.metrics.dial.Observe(time.Since(dialStart).Seconds())
 	if err != nil {
 		_ = socks5.WriteReply(client, 0x05)
+		s.metrics.failed.Inc(reasonDial)
 		s.cfg.Logger.Warnf(
 			"dial fail %s -> %s: %v",
 			client.RemoteAddr(),
 			req.Address,
 			err,
 		)
+		st.setCloseReason("dial failed: " + err.Error())
+		s.recordRefused(username, srcIP.String(), req.Address, client.LocalAddr().String(), system.HistoryFailed, "dial failed: "+err.Error())
 		return
 	}
 	defer out.Close()
@@ -57,16 +68,41 @@ func (s *Server) handleTunnel(
 	_ = client.SetDeadline(time.Time{})
 	_ = out.SetDeadline(time.Time{})
 
-	s.tunnel(client, out)
+	s.tunnel(st.ctx, client, out, st, username, srcIP)
+	s.recordClosed(st, client.LocalAddr().String())
 }
 
-func (s *Server) tunnel(a, b net.Conn) {
+// tunnel copies between the client (a) and the outbound conn (b).
+// Traffic is throttled by the user's shared upload/download buckets
+// and counted against the user's data quota and the tunnel's own stats.
+func (s *Server) tunnel(ctx context.Context, a, b net.Conn, st *connState, username string, srcIP net.IP) {
 	// Optional idle timeout: refreshed by traffic in either direction.
 	var (
-		idle = s.cfg.IdleTimeout
-		mu   sync.Mutex
+		idle      = s.cfg.IdleTimeout
+		mu        sync.Mutex
+		quotaOnce sync.Once
 	)
 
+	lim, release := s.acquireLimiter(username, srcIP)
+	defer release()
+
+	usage := s.usageCounter(username)
+
+	// closing both ends unblocks the copy loop in the other direction
+	closeOverQuota := func() {
+		quotaOnce.Do(func() {
+			st.setCloseReason(reasonQuotaExceeded)
+			s.cfg.Logger.Warnf(
+				"user %s exhausted its data quota, closing tunnel %s -> %s",
+				username,
+				a.RemoteAddr(),
+				b.RemoteAddr(),
+			)
+			_ = a.Close()
+			_ = b.Close()
+		})
+	}
+
 	refreshDeadline := func() {
 		if idle <= 0 {
 			return
@@ -78,21 +114,47 @@ func (s *Server) tunnel(a, b net.Conn) {
 
 	refreshDeadline()
 
-	copyWithRefresh := func(dst, src net.Conn) {
+	// killing the tunnel (or shutting down) closes both ends
+	stop := context.AfterFunc(ctx, func() {
+		st.setCloseReason("shutdown")
+		_ = a.Close()
+		_ = b.Close()
+	})
+	defer stop()
+
+	copyWithRefresh := func(dst, src net.Conn, bucket *tokenBucket, counter *atomic.Int64, srcSide, dstSide string) {
 		buf := make([]byte, 32*1024)
 		for {
 			n, rerr := src.Read(buf)
 			if n > 0 {
+				if err := bucket.wait(ctx, n); err != nil {
+					st.setCloseReason("shutdown")
+					halfCloseWrite(dst)
+					return
+				}
+
 				mu.Lock()
 				refreshDeadline()
 				mu.Unlock()
 
 				_, werr := dst.Write(buf[:n])
 				if werr != nil {
+					st.setCloseReason(tunnelEndReason(ctx, dstSide, werr))
 					return
 				}
+
+				st.add(counter, n)
+
+				if usage != nil {
+					usage.Add(int64(n))
+					if s.quotaExceeded(username) {
+						closeOverQuota()
+						return
+					}
+				}
 			}
 			if rerr != nil {
+				st.setCloseReason(tunnelEndReason(ctx, srcSide, rerr))
 				halfCloseWrite(dst)
 				return
 			}
@@ -100,13 +162,28 @@ func (s *Server) tunnel(a, b net.Conn) {
 	}
 
 	done := make(chan struct{}, 2)
-	go func() { copyWithRefresh(b, a); done <- struct{}{} }()
-	go func() { copyWithRefresh(a, b); done <- struct{}{} }()
+	go func() { copyWithRefresh(b, a, lim.up, &st.up, "client", "remote"); done <- struct{}{} }()
+	go func() { copyWithRefresh(a, b, lim.down, &st.down, "remote", "client"); done <- struct{}{} }()
 
 	<-done
 	<-done
 }
 
+// tunnelEndReason describes why one side of a tunnel stopped.
+func tunnelEndReason(ctx context.Context, side string, err error) string {
+	var ne net.Error
+	switch {
+	case ctx.Err() != nil:
+		return "shutdown"
+	case errors.Is(err, io.EOF):
+		return side + " closed"
+	case errors.As(err, &ne) && ne.Timeout():
+		return "idle timeout"
+	default:
+		return side + " error: " + err.Error()
+	}
+}
+
 func halfCloseWrite(c net.Conn) {
 	if tc, ok := c.(*net.TCPConn); ok {
 		_ = tc.CloseWrite()
@@ -29,33 +29,48 @@ func (s *Server) whitelistPoller(ctx context.Context, db *sql.DB) {
 			s.mu.RUnlock()
 
 			if v != cur {
-				wl, err := system.LoadWhitelist(db)
-				if err != nil {
+				if err := s.reloadWhitelist(db, v); err != nil {
 					s.cfg.Logger.Warnf("whitelist reload failed: %v", err)
 					continue
 				}
-
-				s.mu.Lock()
-				s.whitelist = wl
-				s.whitelistVersion = v
-				s.mu.Unlock()
-
-				s.cfg.Logger.Infof("whitelist reloaded (%d entries)", len(wl))
+				s.reevaluateConns(db, "whitelist reload")
 			}
 		}
 	}
 }
 
+func (s *Server) reloadWhitelist(db *sql.DB, v int64) error {
+	wl, err := system.LoadWhitelist(db)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.whitelist = wl
+	s.whitelistVersion = v
+	s.mu.Unlock()
+
+	s.policyReloaded("whitelist", v)
+	s.cfg.Logger.Infof("whitelist reloaded (%d entries)", len(wl))
+	return nil
+}
+
 func (s *Server) ipAllowed(ip net.IP) bool {
+	_, ok := s.whitelistMatch(ip)
+	return ok
+}
+
+// whitelistMatch returns the first whitelist entry containing ip.
+func (s *Server) whitelistMatch(ip net.IP) (string, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	for _, n := range s.whitelist {
 		if n.Contains(ip) {
-			return true
+			return n.String(), true
 		}
 	}
-	return false
+	return "", false
 }
 
 func (s *Server) checkSource(client net.Conn) (net.IP, error) {
@@ -71,10 +86,24 @@ func (s *Server) checkSource(client net.Conn) (net.IP, error) {
 	)
 
 	ip := net.ParseIP(host)
-	if ip == nil || !s.ipAllowed(ip) {
+	if ip != nil && s.ipBanned(ip.String()) {
+		s.metrics.rejected.Inc(reasonBan)
+		s.recordRefused("", host, "", client.LocalAddr().String(), system.HistoryDenied, "source banned")
+		s.cfg.Logger.Warnf("connection from %s blocked by ban", host)
+		return nil, errors.New("source banned")
+	}
+
+	var rule string
+	if ip != nil {
+		rule, _ = s.whitelistMatch(ip)
+	}
+	if rule == "" {
+		s.metrics.rejected.Inc(reasonWhitelist)
+		s.recordRefused("", host, "", client.LocalAddr().String(), system.HistoryDenied, "source not allowed")
 		s.cfg.Logger.Warnf("connection from %s blocked by whitelist", host)
 		return nil, errors.New("source not allowed")
 	}
+	s.countWhitelistHit(rule)
 
 	return ip, nil
 }
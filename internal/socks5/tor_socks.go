@@ -20,6 +20,10 @@ func NewTorSOCKS5(torSocksAddr string, connectTimeout time.Duration) *torSocks5D
 	return &torSocks5Dialer{torAddr: torSocksAddr, timeout: connectTimeout}
 }
 
+func (t *torSocks5Dialer) Route() string {
+	return "tor"
+}
+
 func (t *torSocks5Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
 	if network != "tcp" && network != "tcp4" && network != "tcp6" {
 		logging.GetLogger().Errorf("tor dialer supports tcp only, got %q", network)
@@ -5,85 +5,255 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"os"
 	"strings"
 	"sync"
 	"time"
 )
 
-// SetOrRotateAdminPassword
-// - current == nil  → initial setup
-// - current != nil  → verify + rotate
-func SetOrRotateAdminPassword(db *sql.DB, current *string, next string) error {
+// AdminRole is what an admin account may do in the web interface.
+// Each role includes everything the roles below it may do.
+type AdminRole string
+
+const (
+	RoleViewer   AdminRole = "viewer"   // connections only
+	RoleOperator AdminRole = "operator" // + kill connections, toggle users
+	RoleAdmin    AdminRole = "admin"    // everything
+)
+
+func (r AdminRole) rank() int {
+	switch r {
+	case RoleViewer:
+		return 1
+	case RoleOperator:
+		return 2
+	case RoleAdmin:
+		return 3
+	}
+	return 0
+}
+
+// Allows reports whether r includes the permissions of min.
+func (r AdminRole) Allows(min AdminRole) bool {
+	return r.rank() > 0 && r.rank() >= min.rank()
+}
+
+func ParseAdminRole(s string) (AdminRole, error) {
+	r := AdminRole(strings.ToLower(strings.TrimSpace(s)))
+	if r.rank() == 0 {
+		return "", fmt.Errorf("%w: %q (viewer | operator | admin)", ErrInvalidRole, s)
+	}
+	return r, nil
+}
+
+type AdminAccount struct {
+	Username  string    `json:"username"`
+	Role      AdminRole `json:"role"`
+	TwoFactor bool      `json:"two_factor"` // TOTP enrolled and confirmed
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AddAdmin creates a named admin account.
+func AddAdmin(db *sql.DB, actor Actor, username, password string, role AdminRole) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		username = strings.TrimSpace(username)
+		if username == "" {
+			return errors.New("admin username cannot be empty")
+		}
+		if role.rank() == 0 {
+			return ErrInvalidRole
+		}
+
+		hash, err := hashPassword(password)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		_, err = tx.Exec(
+			`INSERT INTO admin_accounts (username, password_hash, role, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?)`,
+			username, hash, string(role), now, now,
+		)
+		if err != nil && strings.Contains(err.Error(), "UNIQUE") {
+			return ErrAdminExists
+		}
+		if err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditAdminAdd, username, "", string(role))
+	})
+}
+
+// lastAdminGuard refuses changes that would leave no account with the
+// admin role, since nobody could manage accounts from the web anymore.
+func lastAdminGuard(tx *sql.Tx, username string) error {
+	var role string
+	err := tx.QueryRow(
+		`SELECT role FROM admin_accounts WHERE username = ?`,
+		username,
+	).Scan(&role)
+	if err == sql.ErrNoRows {
+		return ErrAdminNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if AdminRole(role) != RoleAdmin {
+		return nil
+	}
+
+	var n int
+	if err := tx.QueryRow(
+		`SELECT COUNT(*) FROM admin_accounts WHERE role = ?`,
+		string(RoleAdmin),
+	).Scan(&n); err != nil {
+		return err
+	}
+	if n <= 1 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+func DeleteAdmin(db *sql.DB, actor Actor, username string) error {
+	old, err := GetAdmin(db, username)
+	if err != nil {
+		return err
+	}
+
 	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	var storedHash string
-	err = tx.QueryRow(
-		`SELECT password_hash FROM admin_auth WHERE id = 1`,
-	).Scan(&storedHash)
+	if err := lastAdminGuard(tx, username); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM admin_accounts WHERE username = ?`, username); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM admin_recovery_codes WHERE username = ?`, username); err != nil {
+		return err
+	}
+	if err := recordAudit(tx, actor, AuditAdminDelete, username, string(old.Role), ""); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
 
+func SetAdminRole(db *sql.DB, actor Actor, username string, role AdminRole) error {
+	if role.rank() == 0 {
+		return ErrInvalidRole
+	}
+	old, err := GetAdmin(db, username)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			// No admin password exists
-			if current != nil {
-				return errors.New("admin password not set")
-			}
-			// initial insert
-			hash, err := hashPassword(next)
-			if err != nil {
-				return err
-			}
-			_, err = tx.Exec(
-				`INSERT INTO admin_auth (id, password_hash, updated_at)
-				 VALUES (1, ?, ?)`,
-				hash,
-				time.Now(),
-			)
-			if err != nil {
-				return err
-			}
-			return tx.Commit()
-		}
 		return err
 	}
 
-	// Admin password exists → rotation path
-	if current == nil {
-		return errors.New("admin password already set")
+	tx, err := db.Begin()
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
 
-	if !verifyPassword(storedHash, *current) {
-		return errors.New("invalid admin password")
+	if role != RoleAdmin {
+		if err := lastAdminGuard(tx, username); err != nil {
+			return err
+		}
 	}
 
-	newHash, err := hashPassword(next)
+	res, err := tx.Exec(
+		`UPDATE admin_accounts SET role = ?, updated_at = ? WHERE username = ?`,
+		string(role), time.Now().UTC(), username,
+	)
 	if err != nil {
 		return err
 	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAdminNotFound
+	}
+	if err := recordAudit(tx, actor, AuditAdminRole, username, string(old.Role), string(role)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetAdminPassword replaces an admin account's password.
+func SetAdminPassword(db *sql.DB, actor Actor, username, password string) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		hash, err := hashPassword(password)
+		if err != nil {
+			return err
+		}
 
-	_, err = tx.Exec(
-		`UPDATE admin_auth
-		 SET password_hash = ?, updated_at = ?
-		 WHERE id = 1`,
-		newHash,
-		time.Now(),
+		res, err := tx.Exec(
+			`UPDATE admin_accounts SET password_hash = ?, updated_at = ? WHERE username = ?`,
+			hash, time.Now().UTC(), username,
+		)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrAdminNotFound
+		}
+		return recordAudit(tx, actor, AuditAdminPassword, username, "", auditSecret)
+	})
+}
+
+func ListAdmins(db *sql.DB) ([]AdminAccount, error) {
+	rows, err := db.Query(
+		`SELECT username, role, totp_enabled, created_at, updated_at
+		FROM admin_accounts ORDER BY username`,
 	)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	return tx.Commit()
+	var out []AdminAccount
+	for rows.Next() {
+		var (
+			a    AdminAccount
+			role string
+		)
+		if err := rows.Scan(&a.Username, &role, &a.TwoFactor, &a.CreatedAt, &a.UpdatedAt); err != nil {
+			return nil, err
+		}
+		a.Role = AdminRole(role)
+		out = append(out, a)
+	}
+	return out, rows.Err()
 }
 
-func AdminPasswordConfigured(db *sql.DB) (bool, error) {
-	var v int
+func GetAdmin(db *sql.DB, username string) (*AdminAccount, error) {
+	var (
+		a    AdminAccount
+		role string
+	)
 	err := db.QueryRow(
-		`SELECT 1 FROM admin_auth WHERE id = 1`,
-	).Scan(&v)
+		`SELECT username, role, totp_enabled, created_at, updated_at
+		FROM admin_accounts WHERE username = ?`,
+		username,
+	).Scan(&a.Username, &role, &a.TwoFactor, &a.CreatedAt, &a.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrAdminNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.Role = AdminRole(role)
+	return &a, nil
+}
+
+// AdminAccountsConfigured reports whether any admin account exists;
+// the web interface stays disabled until one does.
+func AdminAccountsConfigured(db *sql.DB) (bool, error) {
+	var v int
+	err := db.QueryRow(`SELECT 1 FROM admin_accounts LIMIT 1`).Scan(&v)
 
 	if err == sql.ErrNoRows {
 		return false, nil
@@ -94,19 +264,50 @@ func AdminPasswordConfigured(db *sql.DB) (bool, error) {
 	return true, nil
 }
 
-func VerifyAdminCredentials(db *sql.DB, password string) error {
-	var hash string
+// VerifyAdminCredentials checks a login password and returns the
+// account. Unknown users and wrong passwords give the same error. When
+// the account has TwoFactor set, the caller must also check a code with
+// VerifyAdminSecondFactor.
+func VerifyAdminCredentials(db *sql.DB, username, password string) (*AdminAccount, error) {
+	var (
+		a    AdminAccount
+		hash string
+		role string
+	)
 	err := db.QueryRow(
-		`SELECT password_hash FROM admin_auth WHERE id = 1`,
-	).Scan(&hash)
+		`SELECT username, password_hash, role, totp_enabled, created_at, updated_at
+		FROM admin_accounts WHERE username = ?`,
+		username,
+	).Scan(&a.Username, &hash, &role, &a.TwoFactor, &a.CreatedAt, &a.UpdatedAt)
+	if err == sql.ErrNoRows {
+		// burn comparable time so unknown names aren't obvious
+		verifyPassword(dummyAdminHash(), password)
+		return nil, errors.New("invalid admin credentials")
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if !verifyPassword(hash, password) {
-		return errors.New("invalid admin credentials")
+		return nil, errors.New("invalid admin credentials")
 	}
-	return nil
+	a.Role = AdminRole(role)
+	return &a, nil
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// dummyAdminHash is a bcrypt hash of random bytes, only used for timing.
+func dummyAdminHash() string {
+	dummyHashOnce.Do(func() {
+		b := make([]byte, 16)
+		_, _ = rand.Read(b)
+		dummyHash, _ = hashPassword(hex.EncodeToString(b))
+	})
+	return dummyHash
 }
 
 var (
@@ -115,6 +316,27 @@ var (
 	internalSecretErr  error
 )
 
+// DefaultControlSocketPath is where the service listens for CLI
+// control requests on Linux unless --control-socket says otherwise.
+const DefaultControlSocketPath = "/run/proxychan/control.sock"
+
+var controlSocketPath = DefaultControlSocketPath
+
+// SetControlSocketPath selects the control socket of this instance, for
+// the service and for the CLI alike. An empty path keeps the default.
+func SetControlSocketPath(p string) {
+	if p != "" {
+		controlSocketPath = p
+	}
+}
+
+// ControlSocketPath is the control socket selected for this instance.
+func ControlSocketPath() string {
+	return controlSocketPath
+}
+
+// InternalAdminSecret authorises CLI control requests on the admin
+// endpoint on platforms without the control socket.
 func InternalAdminSecret() (string, error) {
 	internalSecretOnce.Do(func() {
 		internalSecret, internalSecretErr = loadOrCreateSecret("/var/lib/proxychan/admin_internal.secret")
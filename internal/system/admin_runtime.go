@@ -0,0 +1,114 @@
+package system
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AdminRuntime is what a running service publishes about its admin
+// endpoint, so CLI commands can find it without being told the
+// address. CertSHA256 pins the TLS certificate (hex SHA-256 of the leaf)
+// and is empty for plain HTTP.
+type AdminRuntime struct {
+	PID        int    `json:"pid"`
+	URL        string `json:"url"`
+	CertSHA256 string `json:"cert_sha256,omitempty"`
+}
+
+var ErrAdminNotRunning = errors.New("admin endpoint not found (is the service running?)")
+
+// dataDir is the directory holding the database and the other files
+// the service keeps between runs.
+func dataDir() (string, error) {
+	p, err := DBPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Dir(p), nil
+}
+
+func adminRuntimePath() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "admin_endpoint.json"), nil
+}
+
+// WriteAdminRuntime replaces the runtime file. The last instance to
+// start wins when several run at once.
+func WriteAdminRuntime(rt AdminRuntime) error {
+	path, err := adminRuntimePath()
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(rt)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func ReadAdminRuntime() (*AdminRuntime, error) {
+	path, err := adminRuntimePath()
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrAdminNotRunning
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rt AdminRuntime
+	if err := json.Unmarshal(b, &rt); err != nil {
+		return nil, fmt.Errorf("invalid admin runtime file %s: %w", path, err)
+	}
+	return &rt, nil
+}
+
+// RemoveAdminRuntime deletes the runtime file if it still belongs to pid.
+func RemoveAdminRuntime(pid int) error {
+	rt, err := ReadAdminRuntime()
+	if err != nil || rt.PID != pid {
+		return nil
+	}
+	path, err := adminRuntimePath()
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// ParseCIDRList parses a comma-separated list of IPs and CIDRs.
+func ParseCIDRList(s string) ([]net.IPNet, error) {
+	var out []net.IPNet
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		cidr, err := normalizeCIDR(part)
+		if err != nil {
+			return nil, err
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidCIDR, part)
+		}
+		out = append(out, *n)
+	}
+	return out, nil
+}
@@ -0,0 +1,117 @@
+package system
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Self-signed admin certificates last a year and are replaced when less
+// than a month is left, or when they don't cover the listen address.
+const (
+	adminCertLifetime = 365 * 24 * time.Hour
+	adminCertRenew    = 30 * 24 * time.Hour
+)
+
+// EnsureAdminCert returns the self-signed admin TLS certificate and key
+// files, creating them in the data directory on first use. host is the
+// listen host; loopback names and the machine's hostname are always
+// included.
+func EnsureAdminCert(host string) (certFile, keyFile string, err error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", "", err
+	}
+	certFile = filepath.Join(dir, "admin_tls.crt")
+	keyFile = filepath.Join(dir, "admin_tls.key")
+
+	names := []string{"localhost", "127.0.0.1", "::1"}
+	if h, err := os.Hostname(); err == nil && h != "" {
+		names = append(names, h)
+	}
+	if ip := net.ParseIP(host); host != "" && (ip == nil || !ip.IsUnspecified()) && !slices.Contains(names, host) {
+		names = append(names, host)
+	}
+
+	if adminCertUsable(certFile, keyFile, names) {
+		return certFile, keyFile, nil
+	}
+	if err := writeSelfSignedCert(certFile, keyFile, names); err != nil {
+		return "", "", err
+	}
+	return certFile, keyFile, nil
+}
+
+func adminCertUsable(certFile, keyFile string, names []string) bool {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return false
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return false
+	}
+	if time.Until(leaf.NotAfter) < adminCertRenew {
+		return false
+	}
+	for _, n := range names {
+		if leaf.VerifyHostname(n) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func writeSelfSignedCert(certFile, keyFile string, names []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "proxychan admin", Organization: []string{"ProxyChan"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(adminCertLifetime),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, n := range names {
+		if ip := net.ParseIP(n); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, n)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	// key first, so a cert file never exists without its key
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
@@ -0,0 +1,310 @@
+package system
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters (RFC 6238 defaults, which every authenticator app
+// understands): HMAC-SHA1, 6 digits, 30 second steps.
+const (
+	totpDigits = 6
+	totpPeriod = 30
+	// totpSkew accepts codes one step before and after now, for clock
+	// drift between the server and the phone.
+	totpSkew = 1
+
+	recoveryCodeCount = 10
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// totpCode computes the HOTP value (RFC 4226) for one time step.
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	off := sum[len(sum)-1] & 0x0f
+	v := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, v%1000000)
+}
+
+// matchTOTP returns the time step code is valid for, or 0. Steps at or
+// before lastStep are refused so a code can't be replayed.
+func matchTOTP(secret, code string, lastStep int64, now time.Time) int64 {
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		return 0
+	}
+
+	cur := now.Unix() / totpPeriod
+	for step := cur - totpSkew; step <= cur+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step
+		}
+	}
+	return 0
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// newRecoveryCode returns a code like "k7qd-2mxa".
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	s := strings.ToLower(totpEncoding.EncodeToString(b))
+	return s[:4] + "-" + s[4:], nil
+}
+
+// BeginAdminTOTP starts (or restarts) enrollment for an admin: a new
+// secret is stored unconfirmed and returned with its otpauth:// URI.
+// Login doesn't ask for codes until ConfirmAdminTOTP succeeds.
+func BeginAdminTOTP(db *sql.DB, username, issuer string) (secret, uri string, err error) {
+	var enabled bool
+	err = db.QueryRow(
+		`SELECT totp_enabled FROM admin_accounts WHERE username = ?`,
+		username,
+	).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return "", "", ErrAdminNotFound
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if enabled {
+		return "", "", ErrTOTPEnabled
+	}
+
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		return "", "", err
+	}
+	secret = totpEncoding.EncodeToString(key)
+
+	_, err = db.Exec(
+		`UPDATE admin_accounts SET totp_secret = ?, totp_last_step = 0
+		WHERE username = ? AND totp_enabled = 0`,
+		secret, username,
+	)
+	if err != nil {
+		return "", "", err
+	}
+
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(totpPeriod))
+	uri = "otpauth://totp/" + url.PathEscape(issuer+":"+username) + "?" + q.Encode()
+
+	return secret, uri, nil
+}
+
+// ConfirmAdminTOTP finishes enrollment with a first code from the
+// authenticator app. It returns fresh single-use recovery codes, which
+// are stored hashed and can't be shown again.
+func ConfirmAdminTOTP(db *sql.DB, actor Actor, username, code string) ([]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var (
+		secret  sql.NullString
+		enabled bool
+	)
+	err = tx.QueryRow(
+		`SELECT totp_secret, totp_enabled FROM admin_accounts WHERE username = ?`,
+		username,
+	).Scan(&secret, &enabled)
+	if err == sql.ErrNoRows {
+		return nil, ErrAdminNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrTOTPEnabled
+	}
+	if !secret.Valid {
+		return nil, ErrTOTPNotPending
+	}
+
+	step := matchTOTP(secret.String, strings.TrimSpace(code), 0, time.Now())
+	if step == 0 {
+		return nil, ErrInvalidTOTP
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE admin_accounts SET totp_enabled = 1, totp_last_step = ?, updated_at = ?
+		WHERE username = ?`,
+		step, time.Now().UTC(), username,
+	); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM admin_recovery_codes WHERE username = ?`, username); err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	for len(codes) < recoveryCodeCount {
+		c, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO admin_recovery_codes (username, code_hash) VALUES (?, ?)`,
+			username, hashRecoveryCode(c),
+		); err != nil {
+			return nil, err
+		}
+		codes = append(codes, c)
+	}
+
+	if err := recordAudit(tx, actor, AuditAdmin2FA, username, "off", "on"); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// VerifyAdminSecondFactor checks a TOTP code or, failing that, a
+// recovery code, which is used up. recovery reports which one matched.
+func VerifyAdminSecondFactor(db *sql.DB, username, code string) (recovery bool, err error) {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return false, ErrInvalidTOTP
+	}
+
+	var (
+		secret   sql.NullString
+		enabled  bool
+		lastStep int64
+	)
+	err = db.QueryRow(
+		`SELECT totp_secret, totp_enabled, totp_last_step FROM admin_accounts WHERE username = ?`,
+		username,
+	).Scan(&secret, &enabled, &lastStep)
+	if err == sql.ErrNoRows {
+		return false, ErrAdminNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+	if !enabled || !secret.Valid {
+		return false, ErrInvalidTOTP
+	}
+
+	if step := matchTOTP(secret.String, code, lastStep, time.Now()); step > 0 {
+		// the condition makes two concurrent logins with one code race
+		// for the step; only one of them updates the row
+		res, err := db.Exec(
+			`UPDATE admin_accounts SET totp_last_step = ?
+			WHERE username = ? AND totp_last_step < ?`,
+			step, username, step,
+		)
+		if err != nil {
+			return false, err
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			return false, nil
+		}
+		return false, ErrInvalidTOTP
+	}
+
+	res, err := db.Exec(
+		`DELETE FROM admin_recovery_codes WHERE username = ? AND code_hash = ?`,
+		username, hashRecoveryCode(code),
+	)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		return true, nil
+	}
+	return false, ErrInvalidTOTP
+}
+
+// RecoveryCodesLeft counts an admin's unused recovery codes.
+func RecoveryCodesLeft(db *sql.DB, username string) (int, error) {
+	var n int
+	err := db.QueryRow(
+		`SELECT COUNT(*) FROM admin_recovery_codes WHERE username = ?`,
+		username,
+	).Scan(&n)
+	return n, err
+}
+
+// ResetAdminTOTP removes an admin's 2FA secret and recovery codes; the
+// next login needs only the password.
+func ResetAdminTOTP(db *sql.DB, actor Actor, username string) error {
+	old, err := GetAdmin(db, username)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		`UPDATE admin_accounts
+		SET totp_secret = NULL, totp_enabled = 0, totp_last_step = 0, updated_at = ?
+		WHERE username = ?`,
+		time.Now().UTC(), username,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAdminNotFound
+	}
+
+	if _, err := tx.Exec(`DELETE FROM admin_recovery_codes WHERE username = ?`, username); err != nil {
+		return err
+	}
+	oldState := "off"
+	if old.TwoFactor {
+		oldState = "on"
+	}
+	if err := recordAudit(tx, actor, AuditAdmin2FA, username, oldState, "off"); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
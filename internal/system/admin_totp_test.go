@@ -0,0 +1,60 @@
+package system
+
+import (
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B, SHA-1 column. The RFC lists 8-digit values; a
+// 6-digit code is their last six digits.
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},          // 94287082
+	{1111111109, "081804"},  // 07081804
+	{1111111111, "050471"},  // 14050471
+	{1234567890, "005924"},  // 89005924
+	{2000000000, "279037"},  // 69279037
+	{20000000000, "353130"}, // 65353130
+}
+
+const rfc6238Key = "12345678901234567890"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		if got := totpCode([]byte(rfc6238Key), v.unix/totpPeriod); got != v.code {
+			t.Errorf("time %d: got %s, want %s", v.unix, got, v.code)
+		}
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte(rfc6238Key))
+
+	for _, v := range rfc6238Vectors {
+		step := v.unix / totpPeriod
+
+		for _, skew := range []int64{-totpSkew, 0, totpSkew} {
+			now := time.Unix(v.unix+skew*totpPeriod, 0)
+			if got := matchTOTP(secret, v.code, 0, now); got != step {
+				t.Errorf("time %d, skew %d: got step %d, want %d", v.unix, skew, got, step)
+			}
+		}
+
+		now := time.Unix(v.unix, 0)
+		if got := matchTOTP(secret, v.code, step, now); got != 0 {
+			t.Errorf("time %d: replayed code matched step %d", v.unix, got)
+		}
+		if got := matchTOTP(secret, v.code, 0, now.Add(2*totpPeriod*time.Second)); got != 0 {
+			t.Errorf("time %d: code matched step %d two steps later", v.unix, got)
+		}
+	}
+
+	if got := matchTOTP(secret, "000000", 0, time.Unix(59, 0)); got != 0 {
+		t.Errorf("wrong code matched step %d", got)
+	}
+	if got := matchTOTP("not base32!", "287082", 0, time.Unix(59, 0)); got != 0 {
+		t.Errorf("invalid secret matched step %d", got)
+	}
+}
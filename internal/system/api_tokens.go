@@ -0,0 +1,216 @@
+package system
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// apiTokenPrefix marks ProxyChan API tokens so they are easy to spot
+// in configs and secret scanners.
+const apiTokenPrefix = "pct_"
+
+// apiTokenTouchInterval is how stale last_used_at may get before a
+// request writes it again; a busy client would otherwise write on every
+// call.
+const apiTokenTouchInterval = time.Minute
+
+// APIToken describes a REST API token. The token itself is only shown
+// once at creation; SQLite keeps its SHA-256 so a leaked DB can't be
+// replayed against the API. Role limits what the token may do, the same
+// way it does for admin accounts.
+type APIToken struct {
+	Name       string    `json:"name"`
+	Prefix     string    `json:"prefix"`
+	Role       AdminRole `json:"role"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at,omitzero"`   // zero = never
+	LastUsedAt time.Time `json:"last_used_at,omitzero"` // zero = never used
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func normalizeTokenName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("token name cannot be empty")
+	}
+	return name, nil
+}
+
+// CreateAPIToken issues a new token under a unique name and returns it.
+// ttl <= 0 creates a token that never expires.
+func CreateAPIToken(db *sql.DB, actor Actor, name string, role AdminRole, ttl time.Duration) (string, error) {
+	name, err := normalizeTokenName(name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := ParseAdminRole(string(role)); err != nil {
+		return "", err
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := apiTokenPrefix + hex.EncodeToString(b)
+
+	now := time.Now().UTC()
+	var (
+		expires   any
+		expiresAt time.Time
+	)
+	if ttl > 0 {
+		expiresAt = now.Add(ttl)
+		expires = expiresAt
+	}
+
+	err = inTx(db, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			INSERT INTO api_tokens (name, token_hash, prefix, role, created_at, expires_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, name, hashAPIToken(token), token[:len(apiTokenPrefix)+8], role, now, expires)
+		if err != nil {
+			if strings.Contains(err.Error(), "UNIQUE") {
+				return ErrTokenExists
+			}
+			return err
+		}
+		return recordAudit(tx, actor, AuditTokenCreate, name, "", tokenAuditValue(role, expiresAt))
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// tokenAuditValue describes a token for the audit log.
+func tokenAuditValue(role AdminRole, expires time.Time) string {
+	return fmt.Sprintf("%s, expires %s", role, auditTime(expires))
+}
+
+// RevokeAPIToken deletes a token by name.
+func RevokeAPIToken(db *sql.DB, actor Actor, name string) error {
+	name = strings.TrimSpace(name)
+	return inTx(db, func(tx *sql.Tx) error {
+		var (
+			role    AdminRole
+			expires sql.NullTime
+		)
+		err := tx.QueryRow(
+			`SELECT role, expires_at FROM api_tokens WHERE name = ?`,
+			name,
+		).Scan(&role, &expires)
+		if err == sql.ErrNoRows {
+			return ErrTokenNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(`DELETE FROM api_tokens WHERE name = ?`, name); err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditTokenRevoke, name, tokenAuditValue(role, expires.Time), "")
+	})
+}
+
+func ListAPITokens(db *sql.DB) ([]APIToken, error) {
+	rows, err := db.Query(`
+		SELECT name, prefix, role, created_at, expires_at, last_used_at
+		FROM api_tokens ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []APIToken
+	for rows.Next() {
+		var (
+			t        APIToken
+			expires  sql.NullTime
+			lastUsed sql.NullTime
+		)
+		if err := rows.Scan(&t.Name, &t.Prefix, &t.Role, &t.CreatedAt, &expires, &lastUsed); err != nil {
+			return nil, err
+		}
+		if expires.Valid {
+			t.ExpiresAt = expires.Time
+		}
+		if lastUsed.Valid {
+			t.LastUsedAt = lastUsed.Time
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// VerifyAPIToken resolves a presented token to its record and notes the
+// use, at most once per apiTokenTouchInterval. Unknown and expired
+// tokens both return ErrTokenInvalid.
+func VerifyAPIToken(db *sql.DB, token string) (*APIToken, error) {
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return nil, ErrTokenInvalid
+	}
+
+	var (
+		t        APIToken
+		expires  sql.NullTime
+		lastUsed sql.NullTime
+	)
+	err := db.QueryRow(
+		`SELECT name, prefix, role, created_at, expires_at, last_used_at
+		FROM api_tokens WHERE token_hash = ?`,
+		hashAPIToken(token),
+	).Scan(&t.Name, &t.Prefix, &t.Role, &t.CreatedAt, &expires, &lastUsed)
+	if err == sql.ErrNoRows {
+		return nil, ErrTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if expires.Valid {
+		if !now.Before(expires.Time) {
+			return nil, ErrTokenInvalid
+		}
+		t.ExpiresAt = expires.Time
+	}
+	if lastUsed.Valid {
+		t.LastUsedAt = lastUsed.Time
+	}
+
+	if now.Sub(t.LastUsedAt) >= apiTokenTouchInterval {
+		if _, err := db.Exec(`UPDATE api_tokens SET last_used_at = ? WHERE name = ?`, now, t.Name); err != nil {
+			return nil, err
+		}
+		t.LastUsedAt = now
+	}
+	return &t, nil
+}
+
+// APITokenActive reports whether the token t was resolved from is still
+// there and unexpired, for requests that outlive a single check.
+func APITokenActive(db *sql.DB, t *APIToken) (bool, error) {
+	var expires sql.NullTime
+	err := db.QueryRow(
+		`SELECT expires_at FROM api_tokens WHERE name = ? AND prefix = ?`,
+		t.Name, t.Prefix,
+	).Scan(&expires)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !expires.Valid || time.Now().UTC().Before(expires.Time), nil
+}
@@ -0,0 +1,206 @@
+package system
+
+import (
+	"database/sql"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+)
+
+// Actor identifies who made an administrative change:
+// "cli:<os user>", "web:<admin account>", "api:<token name>" or "system"
+// for changes the service makes on its own (brute-force lockouts).
+type Actor string
+
+const ActorSystem Actor = "system"
+
+// CLIActor is the OS user running the CLI. Under sudo that is the user
+// who ran sudo, not root.
+func CLIActor() Actor {
+	if u := os.Getenv("SUDO_USER"); u != "" {
+		return Actor("cli:" + u)
+	}
+	if u, err := user.Current(); err == nil {
+		return Actor("cli:" + u.Username)
+	}
+	return "cli:unknown"
+}
+
+func WebActor(admin string) Actor {
+	return Actor("web:" + admin)
+}
+
+func APIActor(tokenName string) Actor {
+	return Actor("api:" + tokenName)
+}
+
+// Audit actions, one per kind of change.
+const (
+	AuditUserAdd        = "user.add"
+	AuditUserDelete     = "user.delete"
+	AuditUserActivate   = "user.activate"
+	AuditUserDeactivate = "user.deactivate"
+	AuditUserBlock      = "user.block"
+	AuditUserUnlock     = "user.unlock"
+	AuditUserLock       = "user.lock"
+	AuditUserGroup      = "user.group"
+	AuditUserExpiry     = "user.expiry"
+	AuditUserPassword   = "user.password"
+
+	AuditWhitelistAllow  = "whitelist.allow"
+	AuditWhitelistBlock  = "whitelist.block"
+	AuditWhitelistDelete = "whitelist.delete"
+	AuditWhitelistClear  = "whitelist.clear"
+
+	AuditDenylistBlock  = "denylist.block"
+	AuditDenylistAllow  = "denylist.allow"
+	AuditDenylistDelete = "denylist.delete"
+	AuditDenylistClear  = "denylist.clear"
+
+	AuditAdminAdd      = "admin.add"
+	AuditAdminDelete   = "admin.delete"
+	AuditAdminRole     = "admin.role"
+	AuditAdminPassword = "admin.password"
+	AuditAdmin2FA      = "admin.2fa"
+
+	AuditTokenCreate = "token.create"
+	AuditTokenRevoke = "token.revoke"
+
+	AuditSettingChange = "setting.change"
+
+	AuditQuotaSet    = "quota.set"
+	AuditQuotaDelete = "quota.delete"
+	AuditQuotaReset  = "quota.reset"
+
+	AuditRateLimitSet    = "ratelimit.set"
+	AuditRateLimitDelete = "ratelimit.delete"
+
+	AuditBanLift = "ban.lift"
+
+	AuditDBRestore = "db.restore"
+	AuditDBImport  = "db.import"
+)
+
+// Passwords are never written to the audit log, only that they changed.
+const auditSecret = "(changed)"
+
+type AuditRecord struct {
+	ID       int64     `json:"id"`
+	At       time.Time `json:"at"`
+	Actor    Actor     `json:"actor"`
+	Action   string    `json:"action"`
+	Target   string    `json:"target"`
+	OldValue string    `json:"old_value"`
+	NewValue string    `json:"new_value"`
+}
+
+// auditTime formats an optional time for old/new values.
+func auditTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// recordAudit appends one record. Pass the transaction that makes the
+// change, so the change and its record are committed together.
+func recordAudit(q querier, actor Actor, action, target, oldValue, newValue string) error {
+	if actor == "" {
+		actor = "unknown"
+	}
+	_, err := q.Exec(
+		`INSERT INTO audit_log (at, actor, action, target, old_value, new_value)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		time.Now().UTC(), string(actor), action, target, oldValue, newValue,
+	)
+	return err
+}
+
+// inTx runs fn in a transaction and commits it if fn succeeds.
+func inTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AuditFilter narrows QueryAudit. Zero fields do not filter. Action
+// matches as a prefix, so "user." finds every user change.
+type AuditFilter struct {
+	Since  time.Time
+	Until  time.Time
+	Actor  string
+	Action string
+	Target string
+	Limit  int
+}
+
+// QueryAudit returns matching records, newest first.
+func QueryAudit(db *sql.DB, f AuditFilter) ([]AuditRecord, error) {
+	var (
+		where []string
+		args  []any
+	)
+	if !f.Since.IsZero() {
+		where = append(where, "at >= ?")
+		args = append(args, f.Since.UTC())
+	}
+	if !f.Until.IsZero() {
+		where = append(where, "at < ?")
+		args = append(args, f.Until.UTC())
+	}
+	if f.Actor != "" {
+		where = append(where, "actor = ?")
+		args = append(args, f.Actor)
+	}
+	if f.Action != "" {
+		where = append(where, "action LIKE ? ESCAPE '\\'")
+		args = append(args, escapeLike(f.Action)+"%")
+	}
+	if f.Target != "" {
+		where = append(where, "target = ?")
+		args = append(args, f.Target)
+	}
+
+	q := `SELECT id, at, actor, action, target, old_value, new_value FROM audit_log`
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	q += " ORDER BY id DESC"
+	if f.Limit > 0 {
+		q += " LIMIT ?"
+		args = append(args, f.Limit)
+	}
+
+	rows, err := db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []AuditRecord
+	for rows.Next() {
+		var (
+			r     AuditRecord
+			actor string
+		)
+		if err := rows.Scan(&r.ID, &r.At, &actor, &r.Action, &r.Target, &r.OldValue, &r.NewValue); err != nil {
+			return nil, err
+		}
+		r.Actor = Actor(actor)
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
@@ -0,0 +1,255 @@
+package system
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// backupTables are the tables (and columns) every ProxyChan database
+// has had since the first release; a backup without them is refused.
+var backupTables = map[string][]string{
+	"users":       {"id", "username", "password_hash"},
+	"user_status": {"user_id", "blocked", "active"},
+	"whitelist":   {"cidr", "enabled"},
+	"denylist":    {"pattern", "type", "enabled"},
+}
+
+// restoreBusyTimeout is how long RestoreDB waits for the running service
+// to release its write lock.
+const restoreBusyTimeout = 10 * time.Second
+
+// BackupDB writes a consistent copy of the database to path with
+// VACUUM INTO, which is safe while the service is writing. The copy holds
+// password hashes, so the file is created 0600 before anything is written
+// to it; VACUUM INTO accepts an existing empty file. An existing path is
+// never overwritten.
+func BackupDB(db *sql.DB, path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s already exists", path)
+	}
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	if _, err := db.Exec(`VACUUM INTO ?`, path); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+// ValidateBackup checks that path is an intact SQLite database with the
+// tables ProxyChan needs. Older schemas pass; RestoreDB migrates them.
+func ValidateBackup(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%w: %s is not a regular file", ErrInvalidBackup, path)
+	}
+
+	src, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	var result string
+	if err := src.QueryRow(`PRAGMA integrity_check`).Scan(&result); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("%w: integrity check: %s", ErrInvalidBackup, result)
+	}
+
+	for table, want := range backupTables {
+		cols, err := tableColumns(src, table)
+		if err != nil {
+			return err
+		}
+		if len(cols) == 0 {
+			return fmt.Errorf("%w: table %s is missing", ErrInvalidBackup, table)
+		}
+		for _, c := range want {
+			if _, ok := cols[c]; !ok {
+				return fmt.Errorf("%w: column %s.%s is missing", ErrInvalidBackup, table, c)
+			}
+		}
+	}
+	return nil
+}
+
+// RestoreDB replaces the contents of db with the backup at path. The
+// backup is validated and migrated on a temporary copy first, and the
+// current database is saved next to it; that copy's path is returned.
+// The swap uses SQLite's online backup API on the open connection, so a
+// running service sees the restored data instead of an unlinked file,
+// and every policy version ends up past the one it has loaded. The
+// restore is recorded in the restored audit log together with that bump.
+func RestoreDB(db *sql.DB, actor Actor, path string) (string, error) {
+	if !onlineBackup {
+		return "", ErrRestoreUnsupported
+	}
+	if err := ValidateBackup(path); err != nil {
+		return "", err
+	}
+
+	dbPath, err := dbFile(db)
+	if err != nil {
+		return "", err
+	}
+
+	tmp := dbPath + ".restore"
+	_ = os.Remove(tmp)
+	defer os.Remove(tmp)
+	if err := prepareRestore(path, tmp); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+
+	saved := fmt.Sprintf("%s.pre-restore-%s", dbPath, time.Now().Format("20060102-150405.000"))
+	if err := BackupDB(db, saved); err != nil {
+		return "", fmt.Errorf("save current database: %w", err)
+	}
+
+	before, err := policyVersions(db)
+	if err != nil {
+		return saved, err
+	}
+
+	src, err := sql.Open("sqlite3", tmp)
+	if err != nil {
+		return saved, err
+	}
+	defer src.Close()
+
+	if err := copyDB(db, src); err != nil {
+		return saved, err
+	}
+	return saved, inTx(db, func(tx *sql.Tx) error {
+		if err := bumpPastVersions(tx, before); err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditDBRestore, path, "saved as "+saved, "")
+	})
+}
+
+// dbFile is the path of the file db has open.
+func dbFile(q querier) (string, error) {
+	var path string
+	err := q.QueryRow(`SELECT file FROM pragma_database_list WHERE name = 'main'`).Scan(&path)
+	if err == nil && path == "" {
+		err = errors.New("database has no file")
+	}
+	return path, err
+}
+
+// prepareRestore copies the backup to tmp and brings its schema up to
+// date, leaving the backup itself untouched.
+func prepareRestore(path, tmp string) error {
+	src, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if _, err := src.Exec(`VACUUM INTO ?`, tmp); err != nil {
+		return err
+	}
+
+	t, err := sql.Open("sqlite3", tmp)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+	if err := initSchema(t); err != nil {
+		return err
+	}
+	return migrateSchema(t)
+}
+
+// policyVersions returns the version of every *_meta table.
+func policyVersions(q querier) (map[string]int64, error) {
+	rows, err := q.Query(
+		`SELECT name FROM sqlite_master WHERE type = 'table' AND name LIKE '%\_meta' ESCAPE '\'`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var tables []string
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]int64, len(tables))
+	for _, t := range tables {
+		var v int64
+		err := q.QueryRow(`SELECT version FROM "` + t + `" WHERE id = 1`).Scan(&v)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		out[t] = v
+	}
+	return out, nil
+}
+
+// bumpPastVersions moves every policy version past both its old value
+// and the one that was restored or imported. The service reloads a policy
+// when the version differs from what it has, so going back to an older
+// number it has already seen would go unnoticed.
+func bumpPastVersions(q querier, before map[string]int64) error {
+	for _, t := range sortedKeys(before) {
+		_, err := q.Exec(
+			`UPDATE "`+t+`" SET version = MAX(version, ?) + 1 WHERE id = 1`,
+			before[t],
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tableColumns maps a table's columns to their declared types. A table
+// that doesn't exist has none.
+func tableColumns(q querier, table string) (map[string]string, error) {
+	rows, err := q.Query(fmt.Sprintf(`PRAGMA table_info("%s")`, table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols := make(map[string]string)
+	for rows.Next() {
+		var (
+			cid     int
+			name    string
+			typ     string
+			notNull int
+			dflt    sql.NullString
+			pk      int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return nil, err
+		}
+		cols[name] = strings.ToUpper(typ)
+	}
+	return cols, rows.Err()
+}
@@ -0,0 +1,57 @@
+//go:build cgo
+
+package system
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// onlineBackup reports whether this build has SQLite's online backup
+// API, which RestoreDB needs.
+const onlineBackup = true
+
+// copyDB overwrites dst with src page by page, waiting for other
+// processes' locks on dst for up to restoreBusyTimeout.
+func copyDB(dst, src *sql.DB) error {
+	ctx := context.Background()
+	dstConn, err := dst.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dstConn.Close()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return dstConn.Raw(func(d any) error {
+		return srcConn.Raw(func(s any) error {
+			b, err := d.(*sqlite3.SQLiteConn).Backup("main", s.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			deadline := time.Now().Add(restoreBusyTimeout)
+			for {
+				done, err := b.Step(-1)
+				if err != nil {
+					b.Close()
+					return err
+				}
+				if done {
+					return b.Close()
+				}
+				if time.Now().After(deadline) {
+					b.Close()
+					return errors.New("database is busy, try again")
+				}
+				time.Sleep(100 * time.Millisecond)
+			}
+		})
+	})
+}
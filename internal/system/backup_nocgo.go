@@ -0,0 +1,13 @@
+//go:build !cgo
+
+package system
+
+import "database/sql"
+
+// onlineBackup reports whether this build has SQLite's online backup
+// API, which RestoreDB needs. Builds without cgo don't.
+const onlineBackup = false
+
+func copyDB(dst, src *sql.DB) error {
+	return ErrRestoreUnsupported
+}
@@ -0,0 +1,96 @@
+package system
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func userExists(t *testing.T, db querier, name string) bool {
+	t.Helper()
+	var n int
+	must(t, db.QueryRow(`SELECT COUNT(*) FROM users WHERE username = ?`, name).Scan(&n))
+	return n > 0
+}
+
+func assertMode(t *testing.T, path string, want os.FileMode) {
+	t.Helper()
+	fi, err := os.Stat(path)
+	must(t, err)
+	if got := fi.Mode().Perm(); got != want {
+		t.Errorf("%s: mode %v, want %v", filepath.Base(path), got, want)
+	}
+}
+
+func TestBackupRestoreImportRoundTrip(t *testing.T) {
+	db := openTestDB(t)
+	seedPolicy(t, db)
+
+	backup := filepath.Join(t.TempDir(), "backup.db")
+	must(t, BackupDB(db, backup))
+	assertMode(t, backup, 0600)
+	if err := BackupDB(db, backup); err == nil {
+		t.Fatal("backup over an existing file succeeded")
+	}
+
+	// changes after the backup, which the restore undoes
+	must(t, AddUser(db, testActor, "carol", "secret-three"))
+	must(t, AllowIP(db, testActor, "198.51.100.0/24"))
+	before := loadPolicyVersions(t, db)
+
+	saved, err := RestoreDB(db, testActor, backup)
+	must(t, err)
+	if userExists(t, db, "carol") || !userExists(t, db, "alice") {
+		t.Error("restore did not bring back the backed-up users")
+	}
+
+	// the pre-restore copy holds what was there before
+	assertMode(t, saved, 0600)
+	prev := openTestDBAt(t, saved)
+	if !userExists(t, prev, "carol") {
+		t.Error("pre-restore copy lacks carol")
+	}
+
+	// the restored versions are older than the ones the service has
+	// seen, so every version must move past them
+	after := loadPolicyVersions(t, db)
+	for i := range after {
+		if after[i] <= before[i] {
+			t.Errorf("version %d went from %d to %d after restore", i, before[i], after[i])
+		}
+	}
+
+	if n := countRows(t, db, `SELECT COUNT(*) FROM audit_log WHERE action = ? AND target = ?`, AuditDBRestore, backup); n != 1 {
+		t.Errorf("%d restore audit records, want 1", n)
+	}
+
+	exp, err := ExportDB(db)
+	must(t, err)
+	var buf bytes.Buffer
+	must(t, json.NewEncoder(&buf).Encode(exp))
+	read, err := ReadDBExport(&buf)
+	must(t, err)
+
+	must(t, AddUser(db, testActor, "dave", "secret-four"))
+	before = loadPolicyVersions(t, db)
+
+	report, err := ImportDB(db, testActor, "export.json", read)
+	must(t, err)
+	if len(report.SkippedTables) != 0 || len(report.SkippedColumns) != 0 {
+		t.Errorf("same-schema import skipped %v %v", report.SkippedTables, report.SkippedColumns)
+	}
+	if userExists(t, db, "dave") || !userExists(t, db, "alice") {
+		t.Error("import did not replace the users")
+	}
+	after = loadPolicyVersions(t, db)
+	for i := range after {
+		if after[i] <= before[i] {
+			t.Errorf("version %d went from %d to %d after import", i, before[i], after[i])
+		}
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM audit_log WHERE action = ? AND target = 'export.json'`, AuditDBImport); n != 1 {
+		t.Errorf("%d import audit records, want 1", n)
+	}
+}
@@ -35,7 +35,12 @@ func InitDB() (*sql.DB, error) {
 	if err := os.MkdirAll(filepath.Dir(dbPath), 0750); err != nil {
 		return nil, err
 	}
+	return OpenDB(dbPath)
+}
 
+// OpenDB opens the database at path and brings its schema up to date.
+// InitDB uses it for the service's own database.
+func OpenDB(dbPath string) (*sql.DB, error) {
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
 		return nil, err
@@ -51,6 +56,11 @@ func InitDB() (*sql.DB, error) {
 		return nil, err
 	}
 
+	if err := migrateSchema(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	return db, nil
 }
 
@@ -103,13 +113,224 @@ func initSchema(db *sql.DB) error {
 	INSERT OR IGNORE INTO denylist_meta (id, version)
 	VALUES (1, 1);
 
-	CREATE TABLE IF NOT EXISTS admin_auth (
-	    id INTEGER PRIMARY KEY CHECK (id = 1),
+	CREATE TABLE IF NOT EXISTS admin_accounts (
+	    id INTEGER PRIMARY KEY AUTOINCREMENT,
+	    username TEXT NOT NULL UNIQUE,
 	    password_hash TEXT NOT NULL,
-	    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	    role TEXT NOT NULL,                   -- viewer | operator | admin
+	    created_at DATETIME NOT NULL,
+	    updated_at DATETIME NOT NULL,
+	    totp_secret TEXT,                     -- base32; NULL = no 2FA
+	    totp_enabled INTEGER NOT NULL DEFAULT 0,  -- 0 while enrollment is unconfirmed
+	    totp_last_step INTEGER NOT NULL DEFAULT 0 -- last accepted time step, against replay
+	);
+
+	CREATE TABLE IF NOT EXISTS admin_recovery_codes (
+	    username TEXT NOT NULL,
+	    code_hash TEXT NOT NULL,              -- sha256 of the code, hex
+	    PRIMARY KEY (username, code_hash)
+	);
+
+	CREATE TABLE IF NOT EXISTS rate_limits (
+	    scope TEXT NOT NULL,                  -- global | group | user
+	    name TEXT NOT NULL DEFAULT '',        -- empty for global
+	    up_bps INTEGER NOT NULL DEFAULT 0,    -- 0 = unlimited
+	    down_bps INTEGER NOT NULL DEFAULT 0,  -- 0 = unlimited
+	    PRIMARY KEY (scope, name)
+	);
+
+	CREATE TABLE IF NOT EXISTS rate_limits_meta (
+	    id INTEGER PRIMARY KEY CHECK (id = 1),
+	    version INTEGER NOT NULL
+	);
+
+	INSERT OR IGNORE INTO rate_limits_meta (id, version)
+	VALUES (1, 1);
+
+	CREATE TABLE IF NOT EXISTS user_quotas (
+	    user_id INTEGER PRIMARY KEY,
+	    quota_bytes INTEGER NOT NULL,
+	    period TEXT NOT NULL DEFAULT 'monthly',  -- daily | weekly | monthly | never
+	    reset_day INTEGER NOT NULL DEFAULT 1,    -- day of month (monthly) or weekday 0-6 (weekly)
+	    used_bytes INTEGER NOT NULL DEFAULT 0,
+	    period_start DATETIME NOT NULL,
+	    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS ip_bans (
+	    ip TEXT PRIMARY KEY,
+	    reason TEXT NOT NULL,
+	    hits INTEGER NOT NULL DEFAULT 0,
+	    created_at DATETIME NOT NULL,
+	    expires_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS ip_bans_meta (
+	    id INTEGER PRIMARY KEY CHECK (id = 1),
+	    version INTEGER NOT NULL
+	);
+
+	INSERT OR IGNORE INTO ip_bans_meta (id, version)
+	VALUES (1, 1);
+
+	CREATE TABLE IF NOT EXISTS users_meta (
+	    id INTEGER PRIMARY KEY CHECK (id = 1),
+	    version INTEGER NOT NULL
+	);
+
+	INSERT OR IGNORE INTO users_meta (id, version)
+	VALUES (1, 1);
+
+	CREATE TABLE IF NOT EXISTS settings (
+	    key TEXT PRIMARY KEY,
+	    value TEXT NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS conn_history (
+	    id INTEGER PRIMARY KEY AUTOINCREMENT,
+	    username TEXT NOT NULL DEFAULT '',
+	    source_ip TEXT NOT NULL,
+	    destination TEXT NOT NULL,
+	    route TEXT NOT NULL DEFAULT '',
+	    started_at DATETIME NOT NULL,
+	    ended_at DATETIME NOT NULL,
+	    bytes_up INTEGER NOT NULL DEFAULT 0,
+	    bytes_down INTEGER NOT NULL DEFAULT 0,
+	    status TEXT NOT NULL,
+	    reason TEXT NOT NULL DEFAULT ''
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_conn_history_started ON conn_history(started_at);
+	CREATE INDEX IF NOT EXISTS idx_conn_history_user ON conn_history(username);
+
+	CREATE TABLE IF NOT EXISTS audit_log (
+	    id INTEGER PRIMARY KEY AUTOINCREMENT,
+	    at DATETIME NOT NULL,
+	    actor TEXT NOT NULL,               -- cli:<os user> | web:<admin> | api:<token> | system
+	    action TEXT NOT NULL,              -- e.g. user.activate, whitelist.allow
+	    target TEXT NOT NULL DEFAULT '',
+	    old_value TEXT NOT NULL DEFAULT '',
+	    new_value TEXT NOT NULL DEFAULT ''
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_audit_log_at ON audit_log(at);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target);
+
+	CREATE TABLE IF NOT EXISTS api_tokens (
+	    name TEXT PRIMARY KEY,
+	    token_hash TEXT NOT NULL UNIQUE,   -- sha256 of the token, hex
+	    prefix TEXT NOT NULL,              -- first characters, for display only
+	    role TEXT NOT NULL DEFAULT 'admin',
+	    created_at DATETIME NOT NULL,
+	    expires_at DATETIME,               -- NULL = never
+	    last_used_at DATETIME
 	);
 	`
 
 	_, err := db.Exec(schema)
 	return err
 }
+
+// migrateSchema upgrades tables created by older releases.
+// CREATE TABLE IF NOT EXISTS never touches existing tables, so new
+// columns on old tables have to be added here.
+func migrateSchema(db *sql.DB) error {
+	columns := []struct{ table, column, decl string }{
+		{"users", "group_name", "TEXT NOT NULL DEFAULT ''"},
+		{"users", "expires_at", "DATETIME"},
+		{"users", "password_changed_at", "DATETIME"},
+		{"admin_accounts", "totp_secret", "TEXT"},
+		{"admin_accounts", "totp_enabled", "INTEGER NOT NULL DEFAULT 0"},
+		{"admin_accounts", "totp_last_step", "INTEGER NOT NULL DEFAULT 0"},
+		// tokens from before roles could do everything, and still can
+		{"api_tokens", "role", "TEXT NOT NULL DEFAULT 'admin'"},
+	}
+	for _, c := range columns {
+		if err := addColumnIfMissing(db, c.table, c.column, c.decl); err != nil {
+			return err
+		}
+	}
+
+	// accounts created before password rotation existed count from creation
+	_, err := db.Exec(
+		`UPDATE users SET password_changed_at = created_at
+		WHERE password_changed_at IS NULL`,
+	)
+	if err != nil {
+		return err
+	}
+
+	// delete-user used to leave the user's status row behind
+	_, err = db.Exec(`DELETE FROM user_status WHERE user_id NOT IN (SELECT id FROM users)`)
+	if err != nil {
+		return err
+	}
+
+	return migrateAdminAuth(db)
+}
+
+// migrateAdminAuth turns the old single shared admin password into an
+// account named "admin" with the admin role, then drops admin_auth.
+func migrateAdminAuth(db *sql.DB) error {
+	var name string
+	err := db.QueryRow(
+		`SELECT name FROM sqlite_master WHERE type = 'table' AND name = 'admin_auth'`,
+	).Scan(&name)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT OR IGNORE INTO admin_accounts (username, password_hash, role, created_at, updated_at)
+		SELECT 'admin', password_hash, 'admin', COALESCE(updated_at, CURRENT_TIMESTAMP), COALESCE(updated_at, CURRENT_TIMESTAMP)
+		FROM admin_auth WHERE id = 1
+	`)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DROP TABLE admin_auth`); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func addColumnIfMissing(db *sql.DB, table, column, decl string) error {
+	rows, err := db.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid     int
+			name    string
+			typ     string
+			notNull int
+			dflt    sql.NullString
+			pk      int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, decl))
+	return err
+}
@@ -0,0 +1,318 @@
+package system
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Identifies ExportDB files. The format version only changes if the
+// envelope does; table contents follow whatever schema wrote them.
+const (
+	DBExportFormat  = "proxychan-db"
+	DBExportVersion = 1
+)
+
+// DBExport is a portable copy of every table, row by row, keyed by
+// column name. Unlike a backup it can be read by a release with a
+// different schema: ImportDB matches columns by name.
+type DBExport struct {
+	Format     string                      `json:"format"`
+	Version    int                         `json:"version"`
+	ExportedAt time.Time                   `json:"exported_at"`
+	Tables     map[string][]map[string]any `json:"tables"`
+}
+
+// DBImportReport is what ImportDB did. Tables and columns this schema
+// doesn't have are skipped and listed.
+type DBImportReport struct {
+	Rows           map[string]int `json:"rows"`
+	SkippedTables  []string       `json:"skipped_tables,omitempty"`
+	SkippedColumns []string       `json:"skipped_columns,omitempty"` // table.column
+}
+
+// ExportDB reads every table. Times are written as RFC3339.
+func ExportDB(db *sql.DB) (*DBExport, error) {
+	tables, err := userTables(db)
+	if err != nil {
+		return nil, err
+	}
+
+	exp := &DBExport{
+		Format:     DBExportFormat,
+		Version:    DBExportVersion,
+		ExportedAt: time.Now().UTC(),
+		Tables:     make(map[string][]map[string]any, len(tables)),
+	}
+	for _, t := range tables {
+		rows, err := exportTable(db, t)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", t, err)
+		}
+		exp.Tables[t] = rows
+	}
+	return exp, nil
+}
+
+func exportTable(db *sql.DB, table string) ([]map[string]any, error) {
+	rows, err := db.Query(`SELECT * FROM "` + table + `"`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	out := []map[string]any{}
+	for rows.Next() {
+		vals := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]any, len(cols))
+		for i, c := range cols {
+			switch v := vals[i].(type) {
+			case []byte:
+				row[c] = string(v)
+			case time.Time:
+				row[c] = v.UTC()
+			default:
+				row[c] = v
+			}
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+// ReadDBExport decodes an ExportDB file, keeping numbers exact.
+func ReadDBExport(r io.Reader) (*DBExport, error) {
+	var exp DBExport
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := dec.Decode(&exp); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExport, err)
+	}
+	return &exp, nil
+}
+
+// ImportDB replaces the rows of every table in exp with the exported
+// ones, in one transaction. Tables not in exp are left alone. Columns
+// are matched by name: ones this schema lacks are dropped, and ones the
+// export lacks get their defaults. The admin_auth table of releases
+// before admin accounts becomes the "admin" account, as migrateAdminAuth
+// does. The usual migrations then run, and every policy version is moved
+// past the one the service has loaded. The import is recorded in the
+// audit log in the same transaction, after any audit_log rows from exp.
+func ImportDB(db *sql.DB, actor Actor, source string, exp *DBExport) (*DBImportReport, error) {
+	if exp.Format != DBExportFormat {
+		return nil, fmt.Errorf("%w: format is %q", ErrInvalidExport, exp.Format)
+	}
+	if exp.Version > DBExportVersion {
+		return nil, fmt.Errorf("%w: format version %d is newer than this release reads (%d)", ErrInvalidExport, exp.Version, DBExportVersion)
+	}
+
+	before, err := policyVersions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	report := &DBImportReport{Rows: make(map[string]int)}
+	for _, table := range sortedKeys(exp.Tables) {
+		// names come from the file; only ones this schema has are used
+		if strings.ContainsRune(table, '"') || strings.HasPrefix(table, "sqlite_") {
+			report.SkippedTables = append(report.SkippedTables, table)
+			continue
+		}
+		cols, err := tableColumns(tx, table)
+		if err != nil {
+			return nil, err
+		}
+		if len(cols) == 0 && table == "admin_auth" {
+			if _, ok := exp.Tables["admin_accounts"]; !ok {
+				n, err := importAdminAuth(tx, exp.Tables[table])
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", table, err)
+				}
+				report.Rows["admin_accounts"] = n
+				continue
+			}
+		}
+		if len(cols) == 0 {
+			report.SkippedTables = append(report.SkippedTables, table)
+			continue
+		}
+
+		n, skipped, err := importTable(tx, table, cols, exp.Tables[table])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", table, err)
+		}
+		report.Rows[table] = n
+		report.SkippedColumns = append(report.SkippedColumns, skipped...)
+	}
+
+	total := 0
+	for _, n := range report.Rows {
+		total += n
+	}
+	summary := fmt.Sprintf("%d rows in %d tables, exported %s", total, len(report.Rows), auditTime(exp.ExportedAt))
+	if err := recordAudit(tx, actor, AuditDBImport, source, "", summary); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if err := migrateSchema(db); err != nil {
+		return report, err
+	}
+	return report, bumpPastVersions(db, before)
+}
+
+func importTable(tx *sql.Tx, table string, cols map[string]string, rows []map[string]any) (int, []string, error) {
+	if _, err := tx.Exec(`DELETE FROM "` + table + `"`); err != nil {
+		return 0, nil, err
+	}
+
+	skipped := make(map[string]bool)
+	for _, row := range rows {
+		var names, marks []string
+		var args []any
+		for _, c := range sortedKeys(row) {
+			typ, ok := cols[c]
+			if !ok {
+				skipped[table+"."+c] = true
+				continue
+			}
+			v, err := importValue(typ, row[c])
+			if err != nil {
+				return 0, nil, fmt.Errorf("column %s: %w", c, err)
+			}
+			names = append(names, `"`+c+`"`)
+			marks = append(marks, "?")
+			args = append(args, v)
+		}
+		if len(names) == 0 {
+			continue
+		}
+
+		_, err := tx.Exec(
+			`INSERT INTO "`+table+`" (`+strings.Join(names, ", ")+`) VALUES (`+strings.Join(marks, ", ")+`)`,
+			args...,
+		)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	out := make([]string, 0, len(skipped))
+	for c := range skipped {
+		out = append(out, c)
+	}
+	sort.Strings(out)
+	return len(rows), out, nil
+}
+
+// importAdminAuth replaces the admin accounts with one named "admin"
+// holding the shared password of an admin_auth export. Without a
+// password there is nothing to map and the accounts are left alone.
+func importAdminAuth(tx *sql.Tx, rows []map[string]any) (int, error) {
+	var row map[string]any
+	for _, r := range rows {
+		if fmt.Sprint(r["id"]) == "1" {
+			row = r
+		}
+	}
+	if row == nil {
+		return 0, nil
+	}
+
+	hash, _ := row["password_hash"].(string)
+	if hash == "" {
+		return 0, fmt.Errorf("%w: admin_auth has no password_hash", ErrInvalidExport)
+	}
+	updated := time.Now().UTC()
+	if s, ok := row["updated_at"].(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			updated = t
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM admin_accounts`); err != nil {
+		return 0, err
+	}
+	_, err := tx.Exec(`
+		INSERT INTO admin_accounts (username, password_hash, role, created_at, updated_at)
+		VALUES ('admin', ?, 'admin', ?, ?)
+	`, hash, updated, updated)
+	if err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// importValue turns a decoded JSON value back into what the driver
+// stores. Times go in as time.Time so they are written the same way the
+// rest of ProxyChan writes them, which keeps comparisons in SQL working.
+func importValue(typ string, v any) (any, error) {
+	switch x := v.(type) {
+	case json.Number:
+		if n, err := x.Int64(); err == nil {
+			return n, nil
+		}
+		return x.Float64()
+	case string:
+		if typ == "DATETIME" {
+			if t, err := time.Parse(time.RFC3339Nano, x); err == nil {
+				return t, nil
+			}
+		}
+		return x, nil
+	case nil, bool:
+		return x, nil
+	default:
+		return nil, fmt.Errorf("unsupported value %v", v)
+	}
+}
+
+// userTables lists the database's own tables, without SQLite's.
+func userTables(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(
+		`SELECT name FROM sqlite_master
+		WHERE type = 'table' AND name NOT LIKE 'sqlite\_%' ESCAPE '\'
+		ORDER BY name`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []string
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
@@ -17,9 +17,9 @@ const (
 )
 
 type DenyRule struct {
-	Pattern string
-	Type    DenyType
-	Enabled bool
+	Pattern string   `json:"pattern"`
+	Type    DenyType `json:"type"`
+	Enabled bool     `json:"enabled"`
 }
 
 // ---------- versioning (mirror whitelist) ----------
@@ -30,8 +30,8 @@ func GetDenylistVersion(db *sql.DB) (int64, error) {
 	return v, err
 }
 
-func BumpDenylistVersion(db *sql.DB) error {
-	_, err := db.Exec(`UPDATE denylist_meta SET version = version + 1 WHERE id = 1`)
+func BumpDenylistVersion(q querier) error {
+	_, err := q.Exec(`UPDATE denylist_meta SET version = version + 1 WHERE id = 1`)
 	return err
 }
 
@@ -41,12 +41,12 @@ func BumpDenylistVersion(db *sql.DB) error {
 func normalizeDomain(d string) (string, error) {
 	d = strings.TrimSpace(d)
 	if d == "" {
-		return "", fmt.Errorf("empty domain")
+		return "", fmt.Errorf("%w: empty domain", ErrInvalidPattern)
 	}
 	d = strings.ToLower(d)
 	d = strings.TrimSuffix(d, ".")
 	if d == "" {
-		return "", fmt.Errorf("invalid domain")
+		return "", fmt.Errorf("%w: invalid domain", ErrInvalidPattern)
 	}
 	return d, nil
 }
@@ -54,7 +54,7 @@ func normalizeDomain(d string) (string, error) {
 func classifyAndNormalizePattern(input string) (pattern string, typ DenyType, err error) {
 	in := strings.TrimSpace(input)
 	if in == "" {
-		return "", "", fmt.Errorf("empty pattern")
+		return "", "", fmt.Errorf("%w: empty pattern", ErrInvalidPattern)
 	}
 
 	// IP?
@@ -90,58 +90,105 @@ func classifyAndNormalizePattern(input string) (pattern string, typ DenyType, er
 
 // ---------- CRUD ----------
 
-// DenyDestination enables (or inserts) a deny rule.
-func DenyDestination(db *sql.DB, input string) error {
-	pattern, typ, err := classifyAndNormalizePattern(input)
-	if err != nil {
-		return err
+// denyRuleState is a rule's state for the audit log: "enabled",
+// "disabled" or "" when there is no such rule.
+func denyRuleState(q querier, pattern string) (string, error) {
+	var enabled int
+	err := q.QueryRow(`SELECT enabled FROM denylist WHERE pattern = ?`, pattern).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return "", nil
 	}
-
-	_, err = db.Exec(`
-		INSERT INTO denylist (pattern, type, enabled)
-		VALUES (?, ?, 1)
-		ON CONFLICT(pattern) DO UPDATE SET enabled = 1, type = excluded.type
-	`, pattern, string(typ))
 	if err != nil {
-		return err
+		return "", err
 	}
+	if enabled == 1 {
+		return "enabled", nil
+	}
+	return "disabled", nil
+}
+
+// DenyDestination enables (or inserts) a deny rule.
+func DenyDestination(db *sql.DB, actor Actor, input string) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		pattern, typ, err := classifyAndNormalizePattern(input)
+		if err != nil {
+			return err
+		}
+		old, err := denyRuleState(tx, pattern)
+		if err != nil {
+			return err
+		}
 
-	return BumpDenylistVersion(db)
+		_, err = tx.Exec(`
+			INSERT INTO denylist (pattern, type, enabled)
+			VALUES (?, ?, 1)
+			ON CONFLICT(pattern) DO UPDATE SET enabled = 1, type = excluded.type
+		`, pattern, string(typ))
+		if err != nil {
+			return err
+		}
+
+		if err := BumpDenylistVersion(tx); err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditDenylistBlock, pattern, old, "enabled")
+	})
 }
 
 // AllowDestination disables a deny rule (soft remove).
-func AllowDestination(db *sql.DB, input string) error {
-	pattern, _, err := classifyAndNormalizePattern(input)
-	if err != nil {
-		return err
-	}
+func AllowDestination(db *sql.DB, actor Actor, input string) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		pattern, _, err := classifyAndNormalizePattern(input)
+		if err != nil {
+			return err
+		}
+		old, err := denyRuleState(tx, pattern)
+		if err != nil {
+			return err
+		}
 
-	_, err = db.Exec(`UPDATE denylist SET enabled = 0 WHERE pattern = ?`, pattern)
-	if err != nil {
-		return err
-	}
+		res, err := tx.Exec(`UPDATE denylist SET enabled = 0 WHERE pattern = ?`, pattern)
+		if err != nil {
+			return err
+		}
 
-	return BumpDenylistVersion(db)
+		if err := BumpDenylistVersion(tx); err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+		return recordAudit(tx, actor, AuditDenylistAllow, pattern, old, "disabled")
+	})
 }
 
 // DeleteDestination hard-deletes a rule.
-func DeleteDestination(db *sql.DB, input string) error {
-	pattern, _, err := classifyAndNormalizePattern(input)
-	if err != nil {
-		return err
-	}
+func DeleteDestination(db *sql.DB, actor Actor, input string) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		pattern, _, err := classifyAndNormalizePattern(input)
+		if err != nil {
+			return err
+		}
+		old, err := denyRuleState(tx, pattern)
+		if err != nil {
+			return err
+		}
 
-	res, err := db.Exec(`DELETE FROM denylist WHERE pattern = ?`, pattern)
-	if err != nil {
-		return err
-	}
+		res, err := tx.Exec(`DELETE FROM denylist WHERE pattern = ?`, pattern)
+		if err != nil {
+			return err
+		}
 
-	n, _ := res.RowsAffected()
-	if n == 0 {
-		return fmt.Errorf("deny rule not found: %s", pattern)
-	}
+		n, _ := res.RowsAffected()
+		if n == 0 {
+			return fmt.Errorf("deny %w: %s", ErrRuleNotFound, pattern)
+		}
 
-	return BumpDenylistVersion(db)
+		if err := BumpDenylistVersion(tx); err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditDenylistDelete, pattern, old, "")
+	})
 }
 
 func ListDenylist(db *sql.DB) ([]DenyRule, error) {
@@ -237,10 +284,18 @@ func LoadDenylist(db *sql.DB) (*DenylistRuntime, error) {
 	return rt, rows.Err()
 }
 
-func ClearDenylist(db *sql.DB) error {
-	_, err := db.Exec(`
-		UPDATE denylist
-		SET enabled = 0
-	`)
-	return err
+func ClearDenylist(db *sql.DB, actor Actor) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		res, err := tx.Exec(`
+			UPDATE denylist
+			SET enabled = 0
+			WHERE enabled = 1
+		`)
+		if err != nil {
+			return err
+		}
+
+		n, _ := res.RowsAffected()
+		return recordAudit(tx, actor, AuditDenylistClear, "*", "", fmt.Sprintf("disabled (%d changed)", n))
+	})
 }
@@ -3,7 +3,30 @@ package system
 import "errors"
 
 var (
-	ErrUserExists    = errors.New("user already exists")
-	ErrUserNotFound  = errors.New("user not found")
-	ErrBadCredential = errors.New("invalid credentials")
+	ErrUserExists      = errors.New("user already exists")
+	ErrUserNotFound    = errors.New("user not found")
+	ErrBadCredential   = errors.New("invalid credentials")
+	ErrUserBlocked     = errors.New("user blocked")
+	ErrUserLocked      = errors.New("user temporarily locked")
+	ErrUserExpired     = errors.New("user account expired")
+	ErrInvalidGroup    = errors.New("invalid group name")
+	ErrPasswordExpired = errors.New("password expired, rotation required")
+	ErrInvalidCIDR     = errors.New("invalid IP/CIDR")
+	ErrInvalidPattern  = errors.New("invalid pattern")
+	ErrRuleNotFound    = errors.New("rule not found")
+	ErrAdminExists     = errors.New("admin account already exists")
+	ErrAdminNotFound   = errors.New("admin account not found")
+	ErrLastAdmin       = errors.New("cannot remove or demote the last admin account")
+	ErrInvalidRole     = errors.New("invalid admin role")
+	ErrTOTPEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotPending  = errors.New("no two-factor enrollment in progress")
+	ErrInvalidTOTP     = errors.New("invalid two-factor code")
+	ErrTokenExists     = errors.New("api token already exists")
+	ErrTokenNotFound   = errors.New("api token not found")
+	ErrTokenInvalid    = errors.New("invalid or expired api token")
+	ErrInvalidPolicy   = errors.New("invalid policy")
+	ErrInvalidBackup   = errors.New("not a valid proxychan database")
+	ErrInvalidExport   = errors.New("not a proxychan export")
+
+	ErrRestoreUnsupported = errors.New("restore needs a build with cgo (SQLite online backup)")
 )
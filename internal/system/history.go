@@ -0,0 +1,148 @@
+package system
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Outcomes recorded in conn_history.status.
+const (
+	HistoryClosed = "closed" // tunnel ran and ended
+	HistoryDenied = "denied" // refused by policy
+	HistoryFailed = "failed" // outbound dial failed
+)
+
+// HistoryRecord is one finished (or refused) connection.
+type HistoryRecord struct {
+	ID          int64     `json:"id"`
+	Username    string    `json:"username"`
+	SourceIP    string    `json:"source_ip"`
+	Destination string    `json:"destination"`
+	Route       string    `json:"route"`
+	StartedAt   time.Time `json:"started_at"`
+	EndedAt     time.Time `json:"ended_at"`
+	BytesUp     int64     `json:"bytes_up"`
+	BytesDown   int64     `json:"bytes_down"`
+	Status      string    `json:"status"`
+	Reason      string    `json:"reason,omitempty"`
+}
+
+// HistoryFilter narrows QueryHistory. Zero fields do not filter.
+type HistoryFilter struct {
+	Username    string
+	SourceIP    string
+	Destination string // substring match
+	Status      string
+	Since       time.Time
+	Until       time.Time
+	Limit       int
+}
+
+// InsertHistory writes a batch of records in one transaction.
+func InsertHistory(db *sql.DB, recs []HistoryRecord) error {
+	if len(recs) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO conn_history
+			(username, source_ip, destination, route, started_at, ended_at,
+			 bytes_up, bytes_down, status, reason)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, r := range recs {
+		_, err := stmt.Exec(
+			r.Username, r.SourceIP, r.Destination, r.Route,
+			r.StartedAt.UTC(), r.EndedAt.UTC(),
+			r.BytesUp, r.BytesDown, r.Status, r.Reason,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// QueryHistory returns matching records, newest first.
+func QueryHistory(db *sql.DB, f HistoryFilter) ([]HistoryRecord, error) {
+	var (
+		where []string
+		args  []any
+	)
+	if f.Username != "" {
+		where = append(where, "username = ?")
+		args = append(args, f.Username)
+	}
+	if f.SourceIP != "" {
+		where = append(where, "source_ip = ?")
+		args = append(args, f.SourceIP)
+	}
+	if f.Destination != "" {
+		where = append(where, "destination LIKE ?")
+		args = append(args, "%"+f.Destination+"%")
+	}
+	if f.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, f.Status)
+	}
+	if !f.Since.IsZero() {
+		where = append(where, "started_at >= ?")
+		args = append(args, f.Since.UTC())
+	}
+	if !f.Until.IsZero() {
+		where = append(where, "started_at < ?")
+		args = append(args, f.Until.UTC())
+	}
+
+	q := `SELECT id, username, source_ip, destination, route, started_at, ended_at,
+		bytes_up, bytes_down, status, reason FROM conn_history`
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	q += " ORDER BY started_at DESC, id DESC"
+	if f.Limit > 0 {
+		q += " LIMIT ?"
+		args = append(args, f.Limit)
+	}
+
+	rows, err := db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []HistoryRecord
+	for rows.Next() {
+		var r HistoryRecord
+		if err := rows.Scan(
+			&r.ID, &r.Username, &r.SourceIP, &r.Destination, &r.Route,
+			&r.StartedAt, &r.EndedAt, &r.BytesUp, &r.BytesDown, &r.Status, &r.Reason,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// PruneHistory deletes records that started before the cutoff.
+func PruneHistory(db *sql.DB, before time.Time) (int64, error) {
+	res, err := db.Exec(`DELETE FROM conn_history WHERE started_at < ?`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,141 @@
+package system
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"time"
+)
+
+// IPBan is a temporary ban of a client source IP.
+// Times are stored in UTC so SQL comparisons on the text columns hold.
+type IPBan struct {
+	IP        string    `json:"ip"`
+	Reason    string    `json:"reason"`
+	Hits      int       `json:"hits"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ---------- versioning (mirror whitelist) ----------
+
+func GetBansVersion(db *sql.DB) (int64, error) {
+	var v int64
+	err := db.QueryRow(`SELECT version FROM ip_bans_meta WHERE id = 1`).Scan(&v)
+	return v, err
+}
+
+func BumpBansVersion(q querier) error {
+	_, err := q.Exec(`UPDATE ip_bans_meta SET version = version + 1 WHERE id = 1`)
+	return err
+}
+
+func normalizeBanIP(input string) (string, error) {
+	ip := net.ParseIP(input)
+	if ip == nil {
+		return "", fmt.Errorf("invalid IP: %s", input)
+	}
+	return ip.String(), nil
+}
+
+// ---------- CRUD ----------
+
+// BanIP bans (or re-bans) a source IP until the given time.
+func BanIP(db *sql.DB, input, reason string, hits int, until time.Time) error {
+	ip, err := normalizeBanIP(input)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO ip_bans (ip, reason, hits, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(ip) DO UPDATE SET
+			reason = excluded.reason,
+			hits = excluded.hits,
+			created_at = excluded.created_at,
+			expires_at = excluded.expires_at
+	`, ip, reason, hits, time.Now().UTC(), until.UTC())
+	if err != nil {
+		return err
+	}
+
+	return BumpBansVersion(db)
+}
+
+// UnbanIP lifts a ban immediately.
+func UnbanIP(db *sql.DB, actor Actor, input string) error {
+	ip, err := normalizeBanIP(input)
+	if err != nil {
+		return err
+	}
+
+	return inTx(db, func(tx *sql.Tx) error {
+		var (
+			reason string
+			until  time.Time
+		)
+		err := tx.QueryRow(`SELECT reason, expires_at FROM ip_bans WHERE ip = ?`, ip).Scan(&reason, &until)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("ban not found: %s", ip)
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(`DELETE FROM ip_bans WHERE ip = ?`, ip); err != nil {
+			return err
+		}
+		if err := BumpBansVersion(tx); err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditBanLift, ip, reason+", until "+auditTime(until), "")
+	})
+}
+
+// ListBans returns bans that have not expired yet, newest first.
+func ListBans(db *sql.DB) ([]IPBan, error) {
+	rows, err := db.Query(`
+		SELECT ip, reason, hits, created_at, expires_at
+		FROM ip_bans
+		WHERE expires_at > ?
+		ORDER BY created_at DESC
+	`, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []IPBan
+	for rows.Next() {
+		var b IPBan
+		if err := rows.Scan(&b.IP, &b.Reason, &b.Hits, &b.CreatedAt, &b.ExpiresAt); err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+// Runtime: active bans keyed by IP with their expiry.
+func LoadBans(db *sql.DB) (map[string]time.Time, error) {
+	bans, err := ListBans(db)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]time.Time, len(bans))
+	for _, b := range bans {
+		out[b.IP] = b.ExpiresAt
+	}
+	return out, nil
+}
+
+// PruneExpiredBans deletes bans that have run out.
+func PruneExpiredBans(db *sql.DB) (int64, error) {
+	res, err := db.Exec(`DELETE FROM ip_bans WHERE expires_at <= ?`, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -1,7 +1,10 @@
 package system
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"errors"
+	"strings"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -37,3 +40,24 @@ func verifyPassword(storedHash, plain string) bool {
 
 	return err == nil
 }
+
+// GeneratePassword returns a random 24-character password (144 bits).
+func GeneratePassword() (string, error) {
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ValidUsername rejects names that can't be sent as proxy credentials:
+// empty, too long, or containing whitespace or ':'.
+func ValidUsername(name string) bool {
+	return name != "" && len(name) <= 255 && !strings.ContainsAny(name, " \t\r\n:")
+}
+
+// ValidGroupName follows the username rules, except that "" (no group)
+// is allowed. Group names are typed as single arguments on the CLI.
+func ValidGroupName(name string) bool {
+	return name == "" || ValidUsername(name)
+}
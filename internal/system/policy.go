@@ -0,0 +1,811 @@
+package system
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Policy is the declarative form of what SQLite holds for access control:
+// users, the client whitelist, the destination denylist and settings.
+// ExportPolicy produces one; PlanPolicy and ApplyPolicy bring the
+// database in line with one.
+type Policy struct {
+	Users     []PolicyUser      `yaml:"users"`
+	Whitelist []PolicyWhitelist `yaml:"whitelist"`
+	Denylist  []PolicyDeny      `yaml:"denylist"`
+	Settings  PolicySettings    `yaml:"settings"`
+}
+
+// PolicyUser is a user in a policy file. A field that is left out keeps
+// an existing user's value; a new user starts inactive, unblocked,
+// without a group and without expiry, as with add-user. Without a
+// password hash an existing user keeps its password; a new user can't be
+// created.
+type PolicyUser struct {
+	Username     string        `yaml:"username"`
+	Active       *bool         `yaml:"active,omitempty"`
+	Blocked      *bool         `yaml:"blocked,omitempty"`
+	Group        *string       `yaml:"group,omitempty"`
+	Expires      *PolicyExpiry `yaml:"expires,omitempty"`
+	PasswordHash string        `yaml:"password_hash,omitempty"`
+}
+
+// PolicyExpiry is an account expiry in a policy file: an RFC3339 time,
+// or "never" for the zero time. It has no IsZero, so "never" is written
+// out rather than omitted.
+type PolicyExpiry time.Time
+
+func (e PolicyExpiry) MarshalText() ([]byte, error) {
+	t := time.Time(e)
+	if t.IsZero() {
+		return []byte("never"), nil
+	}
+	return []byte(t.UTC().Format(time.RFC3339Nano)), nil
+}
+
+func (e *PolicyExpiry) UnmarshalText(b []byte) error {
+	s := strings.TrimSpace(string(b))
+	if strings.EqualFold(s, "never") {
+		*e = PolicyExpiry{}
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return fmt.Errorf("expires: want an RFC3339 time or never, got %q", s)
+	}
+	*e = PolicyExpiry(t.UTC())
+	return nil
+}
+
+// policyUser is a user as stored, with every field known.
+type policyUser struct {
+	Username     string
+	Active       bool
+	Blocked      bool
+	Group        string
+	Expires      time.Time // zero = never
+	PasswordHash string
+}
+
+// resolve fills the fields u leaves out from old.
+func (u PolicyUser) resolve(old policyUser) policyUser {
+	out := old
+	out.Username = u.Username
+	out.PasswordHash = u.PasswordHash
+	if u.Active != nil {
+		out.Active = *u.Active
+	}
+	if u.Blocked != nil {
+		out.Blocked = *u.Blocked
+	}
+	if u.Group != nil {
+		out.Group = strings.TrimSpace(*u.Group)
+	}
+	if u.Expires != nil {
+		out.Expires = time.Time(*u.Expires).UTC()
+	}
+	return out
+}
+
+// policyFileUser is the exported form of u, with every field set.
+func policyFileUser(u policyUser) PolicyUser {
+	return PolicyUser{
+		Username:     u.Username,
+		Active:       &u.Active,
+		Blocked:      &u.Blocked,
+		Group:        &u.Group,
+		Expires:      (*PolicyExpiry)(&u.Expires),
+		PasswordHash: u.PasswordHash,
+	}
+}
+
+// PolicyWhitelist and PolicyDeny are rules; a missing enabled means true.
+type PolicyWhitelist struct {
+	CIDR    string `yaml:"cidr"`
+	Enabled *bool  `yaml:"enabled,omitempty"`
+}
+
+type PolicyDeny struct {
+	Pattern string `yaml:"pattern"`
+	Enabled *bool  `yaml:"enabled,omitempty"`
+}
+
+// PolicySettings are durations; an empty one is left as it is, or reset
+// to its default when pruning.
+type PolicySettings struct {
+	PasswordMaxAge   string `yaml:"password_max_age,omitempty"`
+	HistoryRetention string `yaml:"history_retention,omitempty"`
+}
+
+// Sections of a policy, as used in PolicyChange.Section.
+const (
+	policyUsers     = "users"
+	policyWhitelist = "whitelist"
+	policyDenylist  = "denylist"
+	policySettings  = "settings"
+)
+
+// Operations of a PolicyChange.
+const (
+	PolicyOpAdd    = "add"
+	PolicyOpChange = "change"
+	PolicyOpRemove = "remove"
+)
+
+// PolicyChange is one step of a plan. Old and New describe the entry
+// before and after in the words list-user and list-whitelist use.
+type PolicyChange struct {
+	Section string `json:"section"`
+	Op      string `json:"op"`
+	Target  string `json:"target"`
+	Old     string `json:"old,omitempty"`
+	New     string `json:"new,omitempty"`
+
+	exec       func(q querier) error
+	audits     []policyAudit
+	rateLimits bool // a group or a per-user rate limit is affected
+}
+
+type policyAudit struct {
+	action, old, new string
+}
+
+// querier is what *sql.DB and *sql.Tx have in common, so a plan can be
+// computed on its own and again inside the transaction that applies it.
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// ExportPolicy reads the current policy. Password hashes are left out
+// unless withHashes is set.
+func ExportPolicy(db *sql.DB, withHashes bool) (*Policy, error) {
+	var p Policy
+
+	users, err := policyLoadUsers(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		if !withHashes {
+			u.PasswordHash = ""
+		}
+		p.Users = append(p.Users, policyFileUser(u))
+	}
+
+	wl, err := policyLoadWhitelist(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, cidr := range sortedKeys(wl) {
+		p.Whitelist = append(p.Whitelist, PolicyWhitelist{CIDR: cidr, Enabled: policyEnabled(wl[cidr])})
+	}
+
+	dl, err := policyLoadDenylist(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, pattern := range sortedKeys(dl) {
+		p.Denylist = append(p.Denylist, PolicyDeny{Pattern: pattern, Enabled: policyEnabled(dl[pattern])})
+	}
+
+	if p.Settings.PasswordMaxAge, err = GetSetting(db, SettingPasswordMaxAge); err != nil {
+		return nil, err
+	}
+	if p.Settings.HistoryRetention, err = GetSetting(db, SettingHistoryRetention); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// policyEnabled leaves enabled rules implicit in exported files.
+func policyEnabled(enabled bool) *bool {
+	if enabled {
+		return nil
+	}
+	return &enabled
+}
+
+// PlanPolicy returns the changes ApplyPolicy would make. Entries missing
+// from p are only removed when prune is set. An invalid p is an error
+// and nothing is planned.
+func PlanPolicy(db *sql.DB, p *Policy, prune bool) ([]PolicyChange, error) {
+	return planPolicy(db, p, prune)
+}
+
+// ApplyPolicy makes the database match p in one transaction. Each policy
+// version is bumped at most once, and only if its section changed, so
+// applying the same file again is a no-op. Audit records, one per
+// change, are written in the same transaction.
+func ApplyPolicy(db *sql.DB, actor Actor, p *Policy, prune bool) ([]PolicyChange, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	changes, err := planPolicy(tx, p, prune)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	bump := make(map[string]bool)
+	for _, c := range changes {
+		if err := c.exec(tx); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", c.Section, c.Target, err)
+		}
+		switch c.Section {
+		case policyUsers:
+			bump["users_meta"] = true
+			if c.rateLimits {
+				bump["rate_limits_meta"] = true
+			}
+		case policyWhitelist:
+			bump["whitelist_meta"] = true
+		case policyDenylist:
+			bump["denylist_meta"] = true
+		case policySettings:
+			if c.Target == SettingPasswordMaxAge {
+				bump["users_meta"] = true
+			}
+		}
+	}
+	for _, table := range sortedKeys(bump) {
+		if _, err := tx.Exec(`UPDATE ` + table + ` SET version = version + 1 WHERE id = 1`); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, c := range changes {
+		for _, a := range c.audits {
+			if err := recordAudit(tx, actor, a.action, c.Target, a.old, a.new); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func planPolicy(q querier, p *Policy, prune bool) ([]PolicyChange, error) {
+	var changes []PolicyChange
+
+	users, err := planPolicyUsers(q, p.Users, prune)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, users...)
+
+	wl, err := planPolicyWhitelist(q, p.Whitelist, prune)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, wl...)
+
+	dl, err := planPolicyDenylist(q, p.Denylist, prune)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, dl...)
+
+	settings, err := planPolicySettings(q, p.Settings, prune)
+	if err != nil {
+		return nil, err
+	}
+	return append(changes, settings...), nil
+}
+
+// ---------- users ----------
+
+func policyLoadUsers(q querier) ([]policyUser, error) {
+	rows, err := q.Query(`
+		SELECT users.username, users.password_hash, users.group_name, users.expires_at,
+			user_status.active, user_status.blocked
+		FROM users JOIN user_status ON users.id = user_status.user_id
+		ORDER BY users.username
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []policyUser
+	for rows.Next() {
+		var (
+			u               policyUser
+			expires         sql.NullTime
+			active, blocked int
+		)
+		if err := rows.Scan(&u.Username, &u.PasswordHash, &u.Group, &expires, &active, &blocked); err != nil {
+			return nil, err
+		}
+		if expires.Valid {
+			u.Expires = expires.Time.UTC()
+		}
+		u.Active = active == 1
+		u.Blocked = blocked == 1
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+// policyUserState describes a user like importAuditValue does, plus the
+// blocked flag.
+func policyUserState(u policyUser) string {
+	v := "inactive"
+	if u.Active {
+		v = "active"
+	}
+	if u.Blocked {
+		v += ", blocked"
+	}
+	if !u.Expires.IsZero() {
+		v += ", expires " + auditTime(u.Expires)
+	}
+	if u.Group != "" {
+		v += ", group " + u.Group
+	}
+	return v
+}
+
+func planPolicyUsers(q querier, want []PolicyUser, prune bool) ([]PolicyChange, error) {
+	current, err := policyLoadUsers(q)
+	if err != nil {
+		return nil, err
+	}
+	have := make(map[string]policyUser, len(current))
+	for _, u := range current {
+		have[u.Username] = u
+	}
+
+	var changes []PolicyChange
+	seen := make(map[string]bool, len(want))
+	for _, pu := range want {
+		if !ValidUsername(pu.Username) {
+			return nil, fmt.Errorf("%w: users: invalid username %q", ErrInvalidPolicy, pu.Username)
+		}
+		if seen[pu.Username] {
+			return nil, fmt.Errorf("%w: users: %s is listed twice", ErrInvalidPolicy, pu.Username)
+		}
+		seen[pu.Username] = true
+		if pu.Group != nil && !ValidGroupName(strings.TrimSpace(*pu.Group)) {
+			return nil, fmt.Errorf("%w: users: %s: invalid group %q", ErrInvalidPolicy, pu.Username, *pu.Group)
+		}
+		if pu.PasswordHash != "" {
+			if _, err := bcrypt.Cost([]byte(pu.PasswordHash)); err != nil || len(pu.PasswordHash) != 60 {
+				return nil, fmt.Errorf("%w: users: %s: password_hash is not a bcrypt hash", ErrInvalidPolicy, pu.Username)
+			}
+		}
+
+		old, ok := have[pu.Username]
+		u := pu.resolve(old)
+		if !ok {
+			if u.PasswordHash == "" {
+				return nil, fmt.Errorf("%w: users: %s does not exist and has no password_hash", ErrInvalidPolicy, u.Username)
+			}
+			changes = append(changes, policyAddUser(u))
+			continue
+		}
+		if c, ok := policyChangeUser(old, u); ok {
+			changes = append(changes, c)
+		}
+	}
+
+	if prune {
+		for _, u := range current {
+			if !seen[u.Username] {
+				changes = append(changes, policyRemoveUser(u))
+			}
+		}
+	}
+	return changes, nil
+}
+
+func policyAddUser(u policyUser) PolicyChange {
+	return PolicyChange{
+		Section:    policyUsers,
+		Op:         PolicyOpAdd,
+		Target:     u.Username,
+		New:        policyUserState(u),
+		audits:     []policyAudit{{AuditUserAdd, "", policyUserState(u)}},
+		rateLimits: u.Group != "",
+		exec: func(q querier) error {
+			var expires any
+			if !u.Expires.IsZero() {
+				expires = u.Expires
+			}
+			res, err := q.Exec(
+				`INSERT INTO users (username, password_hash, password_changed_at, expires_at, group_name)
+				VALUES (?, ?, ?, ?, ?)`,
+				u.Username, u.PasswordHash, time.Now().UTC(), expires, u.Group,
+			)
+			if err != nil {
+				return err
+			}
+			userID, err := res.LastInsertId()
+			if err != nil {
+				return err
+			}
+			_, err = q.Exec(
+				`INSERT INTO user_status (user_id, active, blocked) VALUES (?, ?, ?)`,
+				userID, boolInt(u.Active), boolInt(u.Blocked),
+			)
+			return err
+		},
+	}
+}
+
+// policyChangeUser returns the change from old to u, if there is one.
+// Every field that changed gets the audit record its own command writes.
+func policyChangeUser(old, u policyUser) (PolicyChange, bool) {
+	oldState, newState := policyUserState(old), policyUserState(u)
+	c := PolicyChange{
+		Section: policyUsers,
+		Op:      PolicyOpChange,
+		Target:  u.Username,
+		Old:     oldState,
+		New:     newState,
+	}
+
+	if old.Active != u.Active {
+		action := AuditUserDeactivate
+		if u.Active {
+			action = AuditUserActivate
+		}
+		c.audits = append(c.audits, policyAudit{action, oldState, newState})
+	}
+	if old.Blocked != u.Blocked {
+		action := AuditUserUnlock
+		if u.Blocked {
+			action = AuditUserBlock
+		}
+		c.audits = append(c.audits, policyAudit{action, oldState, newState})
+	}
+	if old.Group != u.Group {
+		c.audits = append(c.audits, policyAudit{AuditUserGroup, old.Group, u.Group})
+		c.rateLimits = true
+	}
+	if !old.Expires.Equal(u.Expires) {
+		c.audits = append(c.audits, policyAudit{AuditUserExpiry, auditTime(old.Expires), auditTime(u.Expires)})
+	}
+	newHash := u.PasswordHash != "" && u.PasswordHash != old.PasswordHash
+	if newHash {
+		c.audits = append(c.audits, policyAudit{AuditUserPassword, "", auditSecret})
+		c.New += ", new password"
+	}
+	if len(c.audits) == 0 {
+		return c, false
+	}
+
+	c.exec = func(q querier) error {
+		var expires any
+		if !u.Expires.IsZero() {
+			expires = u.Expires
+		}
+		_, err := q.Exec(
+			`UPDATE users SET group_name = ?, expires_at = ? WHERE username = ?`,
+			u.Group, expires, u.Username,
+		)
+		if err != nil {
+			return err
+		}
+		if newHash {
+			_, err = q.Exec(
+				`UPDATE users SET password_hash = ?, password_changed_at = ? WHERE username = ?`,
+				u.PasswordHash, time.Now().UTC(), u.Username,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		// unblocking also clears a temporary lock, as unlock-user does
+		_, err = q.Exec(
+			`UPDATE user_status
+			SET active = ?, blocked = ?,
+				locked_until = CASE WHEN ? THEN NULL ELSE locked_until END
+			WHERE user_id = (SELECT id FROM users WHERE username = ?)`,
+			boolInt(u.Active), boolInt(u.Blocked), old.Blocked && !u.Blocked, u.Username,
+		)
+		return err
+	}
+	return c, true
+}
+
+// policyRemoveUser deletes a user and what hangs off it, like DeleteUser.
+func policyRemoveUser(u policyUser) PolicyChange {
+	return PolicyChange{
+		Section:    policyUsers,
+		Op:         PolicyOpRemove,
+		Target:     u.Username,
+		Old:        policyUserState(u),
+		audits:     []policyAudit{{AuditUserDelete, policyUserState(u), ""}},
+		rateLimits: true,
+		exec: func(q querier) error {
+			for _, stmt := range []string{
+				`DELETE FROM user_quotas WHERE user_id = (SELECT id FROM users WHERE username = ?)`,
+				`DELETE FROM user_status WHERE user_id = (SELECT id FROM users WHERE username = ?)`,
+				`DELETE FROM users WHERE username = ?`,
+				`DELETE FROM rate_limits WHERE scope = 'user' AND name = ?`,
+			} {
+				if _, err := q.Exec(stmt, u.Username); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// ---------- whitelist and denylist ----------
+
+// policyRuleState matches whitelistState and denyRuleState.
+func policyRuleState(enabled bool) string {
+	if enabled {
+		return "enabled"
+	}
+	return "disabled"
+}
+
+func policyLoadWhitelist(q querier) (map[string]bool, error) {
+	rows, err := q.Query(`SELECT cidr, enabled FROM whitelist`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string]bool)
+	for rows.Next() {
+		var cidr string
+		var enabled int
+		if err := rows.Scan(&cidr, &enabled); err != nil {
+			return nil, err
+		}
+		out[cidr] = enabled == 1
+	}
+	return out, rows.Err()
+}
+
+func planPolicyWhitelist(q querier, want []PolicyWhitelist, prune bool) ([]PolicyChange, error) {
+	have, err := policyLoadWhitelist(q)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make(map[string]bool, len(want))
+	for _, r := range want {
+		cidr, err := normalizeCIDR(strings.TrimSpace(r.CIDR))
+		if err != nil {
+			return nil, fmt.Errorf("%w: whitelist: %w", ErrInvalidPolicy, err)
+		}
+		if _, dup := rules[cidr]; dup {
+			return nil, fmt.Errorf("%w: whitelist: %s is listed twice", ErrInvalidPolicy, cidr)
+		}
+		rules[cidr] = r.Enabled == nil || *r.Enabled
+	}
+
+	return planPolicyRules(policyWhitelist, have, rules, prune,
+		func(cidr string, enabled bool) string {
+			if enabled {
+				return AuditWhitelistAllow
+			}
+			return AuditWhitelistBlock
+		},
+		AuditWhitelistDelete,
+		func(q querier, cidr string, enabled bool) error {
+			_, err := q.Exec(`
+				INSERT INTO whitelist (cidr, enabled) VALUES (?, ?)
+				ON CONFLICT(cidr) DO UPDATE SET enabled = excluded.enabled
+			`, cidr, boolInt(enabled))
+			return err
+		},
+		func(q querier, cidr string) error {
+			_, err := q.Exec(`DELETE FROM whitelist WHERE cidr = ?`, cidr)
+			return err
+		},
+	), nil
+}
+
+func policyLoadDenylist(q querier) (map[string]bool, error) {
+	rows, err := q.Query(`SELECT pattern, enabled FROM denylist`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string]bool)
+	for rows.Next() {
+		var pattern string
+		var enabled int
+		if err := rows.Scan(&pattern, &enabled); err != nil {
+			return nil, err
+		}
+		out[pattern] = enabled == 1
+	}
+	return out, rows.Err()
+}
+
+func planPolicyDenylist(q querier, want []PolicyDeny, prune bool) ([]PolicyChange, error) {
+	have, err := policyLoadDenylist(q)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make(map[string]bool, len(want))
+	types := make(map[string]DenyType, len(want))
+	for _, r := range want {
+		pattern, typ, err := classifyAndNormalizePattern(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: denylist: %w", ErrInvalidPolicy, err)
+		}
+		if _, dup := rules[pattern]; dup {
+			return nil, fmt.Errorf("%w: denylist: %s is listed twice", ErrInvalidPolicy, pattern)
+		}
+		rules[pattern] = r.Enabled == nil || *r.Enabled
+		types[pattern] = typ
+	}
+
+	return planPolicyRules(policyDenylist, have, rules, prune,
+		func(pattern string, enabled bool) string {
+			if enabled {
+				return AuditDenylistBlock
+			}
+			return AuditDenylistAllow
+		},
+		AuditDenylistDelete,
+		func(q querier, pattern string, enabled bool) error {
+			_, err := q.Exec(`
+				INSERT INTO denylist (pattern, type, enabled) VALUES (?, ?, ?)
+				ON CONFLICT(pattern) DO UPDATE SET enabled = excluded.enabled, type = excluded.type
+			`, pattern, string(types[pattern]), boolInt(enabled))
+			return err
+		},
+		func(q querier, pattern string) error {
+			_, err := q.Exec(`DELETE FROM denylist WHERE pattern = ?`, pattern)
+			return err
+		},
+	), nil
+}
+
+// planPolicyRules diffs a rule list (key -> enabled) shared by the
+// whitelist and the denylist.
+func planPolicyRules(
+	section string,
+	have, want map[string]bool,
+	prune bool,
+	setAction func(key string, enabled bool) string,
+	deleteAction string,
+	set func(q querier, key string, enabled bool) error,
+	del func(q querier, key string) error,
+) []PolicyChange {
+	var changes []PolicyChange
+	for _, key := range sortedKeys(want) {
+		enabled := want[key]
+		c := PolicyChange{Section: section, Target: key, New: policyRuleState(enabled)}
+		cur, ok := have[key]
+		switch {
+		case !ok:
+			c.Op = PolicyOpAdd
+		case cur != enabled:
+			c.Op = PolicyOpChange
+			c.Old = policyRuleState(cur)
+		default:
+			continue
+		}
+		c.audits = []policyAudit{{setAction(key, enabled), c.Old, c.New}}
+		c.exec = func(q querier) error { return set(q, key, enabled) }
+		changes = append(changes, c)
+	}
+
+	if prune {
+		for _, key := range sortedKeys(have) {
+			if _, ok := want[key]; ok {
+				continue
+			}
+			old := policyRuleState(have[key])
+			changes = append(changes, PolicyChange{
+				Section: section,
+				Op:      PolicyOpRemove,
+				Target:  key,
+				Old:     old,
+				audits:  []policyAudit{{deleteAction, old, ""}},
+				exec:    func(q querier) error { return del(q, key) },
+			})
+		}
+	}
+	return changes
+}
+
+// ---------- settings ----------
+
+func planPolicySettings(q querier, want PolicySettings, prune bool) ([]PolicyChange, error) {
+	var changes []PolicyChange
+	for _, s := range []struct {
+		key, value string
+		zeroUnset  bool // 0 is stored as no setting
+	}{
+		{SettingPasswordMaxAge, want.PasswordMaxAge, true},
+		{SettingHistoryRetention, want.HistoryRetention, false},
+	} {
+		var cur string
+		err := q.QueryRow(`SELECT value FROM settings WHERE key = ?`, s.key).Scan(&cur)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+
+		value := strings.TrimSpace(s.value)
+		if value == "" && !prune {
+			continue
+		}
+		if value != "" {
+			d, err := ParseDuration(value)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("%w: settings: invalid %s %q", ErrInvalidPolicy, s.key, s.value)
+			}
+			value = d.String()
+			if d == 0 && s.zeroUnset {
+				value = ""
+			}
+		}
+		if value == cur {
+			continue
+		}
+
+		key := s.key
+		c := PolicyChange{
+			Section: policySettings,
+			Target:  key,
+			Old:     cur,
+			New:     value,
+			audits:  []policyAudit{{AuditSettingChange, cur, value}},
+		}
+		switch {
+		case cur == "":
+			c.Op = PolicyOpAdd
+		case value == "":
+			c.Op = PolicyOpRemove
+		default:
+			c.Op = PolicyOpChange
+		}
+		c.exec = func(q querier) error {
+			if value == "" {
+				_, err := q.Exec(`DELETE FROM settings WHERE key = ?`, key)
+				return err
+			}
+			_, err := q.Exec(`
+				INSERT INTO settings (key, value) VALUES (?, ?)
+				ON CONFLICT(key) DO UPDATE SET value = excluded.value
+			`, key, value)
+			return err
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
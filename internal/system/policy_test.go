@@ -0,0 +1,238 @@
+package system
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const testActor = Actor("cli:test")
+
+// openTestDBAt opens the database file at path, closed when the test ends.
+func openTestDBAt(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// openTestDB creates a database with the current schema.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db := openTestDBAt(t, filepath.Join(t.TempDir(), "proxychan.db"))
+	if err := initSchema(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateSchema(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// seedPolicy fills every section of the policy with something other
+// than the defaults.
+func seedPolicy(t *testing.T, db *sql.DB) {
+	t.Helper()
+	must(t, AddUser(db, testActor, "alice", "secret-one"))
+	must(t, ActivateUser(db, testActor, "alice"))
+	must(t, SetUserGroup(db, testActor, "alice", "staff"))
+	must(t, SetUserExpiry(db, testActor, "alice", time.Now().Add(30*24*time.Hour)))
+	must(t, AddUser(db, testActor, "bob", "secret-two"))
+	must(t, BlockUser(db, testActor, "bob"))
+
+	must(t, AllowIP(db, testActor, "10.0.0.0/8"))
+	must(t, BlockIP(db, testActor, "192.0.2.7"))
+	must(t, DenyDestination(db, testActor, ".ads.example"))
+	must(t, AllowDestination(db, testActor, "203.0.113.0/24"))
+
+	must(t, SetPasswordMaxAge(db, testActor, 90*24*time.Hour))
+	must(t, SetHistoryRetention(db, testActor, 240*time.Hour))
+}
+
+type testVersions [4]int64
+
+func loadPolicyVersions(t *testing.T, db *sql.DB) testVersions {
+	t.Helper()
+	var v testVersions
+	var err error
+	for i, get := range []func(*sql.DB) (int64, error){
+		GetUsersVersion, GetWhitelistVersion, GetDenylistVersion, GetRateLimitsVersion,
+	} {
+		if v[i], err = get(db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return v
+}
+
+func countRows(t *testing.T, db *sql.DB, query string, args ...any) int {
+	t.Helper()
+	var n int
+	must(t, db.QueryRow(query, args...).Scan(&n))
+	return n
+}
+
+// exportViaYAML exports the policy and reads it back the way policy
+// apply reads a file.
+func exportViaYAML(t *testing.T, db *sql.DB, withHashes bool) *Policy {
+	t.Helper()
+	p, err := ExportPolicy(db, withHashes)
+	must(t, err)
+	b, err := yaml.Marshal(p)
+	must(t, err)
+	var out Policy
+	must(t, yaml.Unmarshal(b, &out))
+	return &out
+}
+
+func TestPolicyExportApplyIsNoop(t *testing.T) {
+	db := openTestDB(t)
+	seedPolicy(t, db)
+
+	for _, tc := range []struct {
+		name              string
+		withHashes, prune bool
+	}{
+		{"plain", false, false},
+		{"with hashes", true, false},
+		{"prune", false, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := exportViaYAML(t, db, tc.withHashes)
+			versions := loadPolicyVersions(t, db)
+			audits := countRows(t, db, `SELECT COUNT(*) FROM audit_log`)
+
+			changes, err := ApplyPolicy(db, testActor, p, tc.prune)
+			must(t, err)
+			if len(changes) != 0 {
+				t.Fatalf("applying the export made %d changes: %+v", len(changes), changes)
+			}
+			if got := loadPolicyVersions(t, db); got != versions {
+				t.Errorf("versions moved from %v to %v", versions, got)
+			}
+			if got := countRows(t, db, `SELECT COUNT(*) FROM audit_log`); got != audits {
+				t.Errorf("%d audit records written", got-audits)
+			}
+		})
+	}
+}
+
+func TestPolicyApplyPrune(t *testing.T) {
+	db := openTestDB(t)
+	seedPolicy(t, db)
+	p := exportViaYAML(t, db, false)
+
+	// entries the file doesn't know about
+	must(t, AddUser(db, testActor, "carol", "secret-three"))
+	must(t, AllowIP(db, testActor, "198.51.100.0/24"))
+	must(t, DenyDestination(db, testActor, "tracker.example"))
+	p.Settings.HistoryRetention = ""
+
+	changes, err := ApplyPolicy(db, testActor, p, false)
+	must(t, err)
+	if len(changes) != 0 {
+		t.Fatalf("without prune: %d changes: %+v", len(changes), changes)
+	}
+
+	versions := loadPolicyVersions(t, db)
+	lastAudit := countRows(t, db, `SELECT COALESCE(MAX(id), 0) FROM audit_log`)
+	changes, err = ApplyPolicy(db, testActor, p, true)
+	must(t, err)
+
+	want := map[string]bool{
+		policyUsers + " carol":                         true,
+		policyWhitelist + " 198.51.100.0/24":           true,
+		policyDenylist + " tracker.example":            true,
+		policySettings + " " + SettingHistoryRetention: true,
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("with prune: got %d changes, want %d: %+v", len(changes), len(want), changes)
+	}
+	for _, c := range changes {
+		if c.Op != PolicyOpRemove || !want[c.Section+" "+c.Target] {
+			t.Errorf("unexpected change %+v", c)
+		}
+	}
+
+	if n := countRows(t, db, `SELECT COUNT(*) FROM users WHERE username = 'carol'`); n != 0 {
+		t.Error("carol was not removed")
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM whitelist WHERE cidr = '198.51.100.0/24'`); n != 0 {
+		t.Error("whitelist entry was not removed")
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM denylist WHERE pattern = 'tracker.example'`); n != 0 {
+		t.Error("denylist entry was not removed")
+	}
+	if v, err := GetSetting(db, SettingHistoryRetention); err != nil || v != "" {
+		t.Errorf("history_retention is %q (%v), want unset", v, err)
+	}
+
+	// users, whitelist and denylist once each; a removed user may have
+	// had a per-user rate limit
+	got := loadPolicyVersions(t, db)
+	for i, name := range []string{"users", "whitelist", "denylist", "rate_limits"} {
+		if got[i] != versions[i]+1 {
+			t.Errorf("%s version moved from %d to %d, want one bump", name, versions[i], got[i])
+		}
+	}
+
+	for _, action := range []string{AuditUserDelete, AuditWhitelistDelete, AuditDenylistDelete, AuditSettingChange} {
+		n := countRows(t, db, `SELECT COUNT(*) FROM audit_log WHERE id > ? AND action = ? AND actor = ?`,
+			lastAudit, action, string(testActor))
+		if n != 1 {
+			t.Errorf("%d %s audit records, want 1", n, action)
+		}
+	}
+
+	changes, err = ApplyPolicy(db, testActor, p, true)
+	must(t, err)
+	if len(changes) != 0 {
+		t.Errorf("second apply: %d changes: %+v", len(changes), changes)
+	}
+}
+
+func TestPolicyOmittedUserFieldsAreKept(t *testing.T) {
+	db := openTestDB(t)
+	must(t, AddUser(db, testActor, "bob", "secret-two"))
+	must(t, ActivateUser(db, testActor, "bob"))
+	must(t, SetUserGroup(db, testActor, "bob", "staff"))
+	must(t, SetUserExpiry(db, testActor, "bob", time.Now().Add(30*24*time.Hour)))
+	must(t, BlockUser(db, testActor, "bob"))
+	must(t, LockUser(db, testActor, "bob", time.Now().Add(time.Hour)))
+
+	var p Policy
+	must(t, yaml.Unmarshal([]byte("users:\n  - username: bob\n"), &p))
+
+	for _, prune := range []bool{false, true} {
+		changes, err := PlanPolicy(db, &p, prune)
+		must(t, err)
+		for _, c := range changes {
+			if c.Section == policyUsers {
+				t.Errorf("prune=%v: listing bob by name only plans %+v", prune, c)
+			}
+		}
+	}
+
+	changes, err := ApplyPolicy(db, testActor, &p, false)
+	must(t, err)
+	if len(changes) != 0 {
+		t.Fatalf("apply made %d changes: %+v", len(changes), changes)
+	}
+	n := countRows(t, db, `SELECT COUNT(*) FROM user_status WHERE blocked = 1 AND locked_until IS NOT NULL`)
+	if n != 1 {
+		t.Error("bob lost the block or the lock")
+	}
+}
@@ -0,0 +1,364 @@
+package system
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type QuotaPeriod string
+
+const (
+	QuotaDaily   QuotaPeriod = "daily"
+	QuotaWeekly  QuotaPeriod = "weekly"
+	QuotaMonthly QuotaPeriod = "monthly"
+	QuotaNever   QuotaPeriod = "never"
+)
+
+var ErrQuotaNotFound = errors.New("quota not found")
+
+// UserQuota is a data volume allowance (upload + download) per period.
+type UserQuota struct {
+	Username    string      `json:"username"`
+	QuotaBytes  int64       `json:"quota_bytes"`
+	Period      QuotaPeriod `json:"period"`
+	ResetDay    int         `json:"reset_day"`
+	UsedBytes   int64       `json:"used_bytes"`
+	PeriodStart time.Time   `json:"period_start"`
+}
+
+// ResetAt returns when the current period ends (zero for QuotaNever).
+func (q UserQuota) ResetAt() time.Time {
+	return nextQuotaReset(q.Period, q.PeriodStart)
+}
+
+// UsedAt returns usage as of now, treating an elapsed period as reset
+// even if the service has not rolled it over in the database yet.
+func (q UserQuota) UsedAt(now time.Time) int64 {
+	if r := q.ResetAt(); !r.IsZero() && !now.Before(r) {
+		return 0
+	}
+	return q.UsedBytes
+}
+
+// NextResetAt returns when usage next resets as seen from now, which
+// differs from ResetAt if the period elapsed while the service was down.
+func (q UserQuota) NextResetAt(now time.Time) time.Time {
+	r := q.ResetAt()
+	if r.IsZero() || now.Before(r) {
+		return r
+	}
+	return nextQuotaReset(q.Period, quotaPeriodStart(q.Period, q.ResetDay, now))
+}
+
+// ---------- schedule ----------
+
+func validateQuotaSchedule(period QuotaPeriod, resetDay int) error {
+	switch period {
+	case QuotaDaily, QuotaNever:
+		return nil
+	case QuotaWeekly:
+		if resetDay < 0 || resetDay > 6 {
+			return fmt.Errorf("weekly reset day must be 0-6 (0 = Sunday)")
+		}
+		return nil
+	case QuotaMonthly:
+		// capped at 28 so every month has the reset day
+		if resetDay < 1 || resetDay > 28 {
+			return fmt.Errorf("monthly reset day must be 1-28")
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid quota period: %q (use daily|weekly|monthly|never)", period)
+	}
+}
+
+// quotaPeriodStart returns the start of the period containing t.
+func quotaPeriodStart(period QuotaPeriod, resetDay int, t time.Time) time.Time {
+	y, m, d := t.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+
+	switch period {
+	case QuotaDaily:
+		return midnight
+	case QuotaWeekly:
+		back := (int(t.Weekday()) - resetDay + 7) % 7
+		return midnight.AddDate(0, 0, -back)
+	case QuotaMonthly:
+		start := time.Date(y, m, resetDay, 0, 0, 0, 0, t.Location())
+		if d < resetDay {
+			start = start.AddDate(0, -1, 0)
+		}
+		return start
+	default:
+		return t
+	}
+}
+
+func nextQuotaReset(period QuotaPeriod, start time.Time) time.Time {
+	switch period {
+	case QuotaDaily:
+		return start.AddDate(0, 0, 1)
+	case QuotaWeekly:
+		return start.AddDate(0, 0, 7)
+	case QuotaMonthly:
+		return start.AddDate(0, 1, 0)
+	default:
+		return time.Time{}
+	}
+}
+
+// ---------- CRUD ----------
+
+// quotaAuditValue describes a quota schedule for the audit log.
+func quotaAuditValue(quota int64, period QuotaPeriod, resetDay int) string {
+	v := FormatBytes(quota) + " " + string(period)
+	switch period {
+	case QuotaWeekly, QuotaMonthly:
+		v += fmt.Sprintf(" (reset day %d)", resetDay)
+	}
+	return v
+}
+
+// quotaState reads a user's quota inside tx, returning ErrQuotaNotFound
+// if there is none.
+func quotaState(tx *sql.Tx, username string) (quota, used int64, period QuotaPeriod, resetDay int, err error) {
+	err = tx.QueryRow(`
+		SELECT q.quota_bytes, q.used_bytes, q.period, q.reset_day
+		FROM user_quotas q JOIN users u ON u.id = q.user_id
+		WHERE u.username = ?
+	`, username).Scan(&quota, &used, &period, &resetDay)
+	if err == sql.ErrNoRows {
+		err = ErrQuotaNotFound
+	}
+	return
+}
+
+// SetUserQuota sets (or replaces) a user's quota. Usage is kept when the
+// schedule does not change, so raising a quota mid-month is harmless.
+func SetUserQuota(db *sql.DB, actor Actor, username string, quota int64, period QuotaPeriod, resetDay int) error {
+	period = QuotaPeriod(strings.ToLower(string(period)))
+	if err := validateQuotaSchedule(period, resetDay); err != nil {
+		return err
+	}
+	if quota <= 0 {
+		return fmt.Errorf("quota must be greater than zero")
+	}
+
+	return inTx(db, func(tx *sql.Tx) error {
+		var userID int64
+		err := tx.QueryRow(`SELECT id FROM users WHERE username = ?`, username).Scan(&userID)
+		if err == sql.ErrNoRows {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var old string
+		oldQuota, _, oldPeriod, oldDay, err := quotaState(tx, username)
+		switch {
+		case err == nil:
+			old = quotaAuditValue(oldQuota, oldPeriod, oldDay)
+		case !errors.Is(err, ErrQuotaNotFound):
+			return err
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO user_quotas (user_id, quota_bytes, period, reset_day, used_bytes, period_start)
+			VALUES (?, ?, ?, ?, 0, ?)
+			ON CONFLICT(user_id) DO UPDATE SET
+				quota_bytes = excluded.quota_bytes,
+				used_bytes = CASE
+					WHEN user_quotas.period = excluded.period AND user_quotas.reset_day = excluded.reset_day
+					THEN user_quotas.used_bytes ELSE 0 END,
+				period_start = CASE
+					WHEN user_quotas.period = excluded.period AND user_quotas.reset_day = excluded.reset_day
+					THEN user_quotas.period_start ELSE excluded.period_start END,
+				period = excluded.period,
+				reset_day = excluded.reset_day
+		`, userID, quota, string(period), resetDay, quotaPeriodStart(period, resetDay, time.Now()))
+		if err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditQuotaSet, username, old, quotaAuditValue(quota, period, resetDay))
+	})
+}
+
+func DeleteUserQuota(db *sql.DB, actor Actor, username string) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		quota, _, period, resetDay, err := quotaState(tx, username)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			`DELETE FROM user_quotas
+			WHERE user_id = (SELECT id FROM users WHERE username = ?)`,
+			username,
+		)
+		if err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditQuotaDelete, username, quotaAuditValue(quota, period, resetDay), "")
+	})
+}
+
+// ResetUserQuotaUsage zeroes usage for the current period.
+func ResetUserQuotaUsage(db *sql.DB, actor Actor, username string) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		_, used, _, _, err := quotaState(tx, username)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			`UPDATE user_quotas SET used_bytes = 0
+			WHERE user_id = (SELECT id FROM users WHERE username = ?)`,
+			username,
+		)
+		if err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditQuotaReset, username, FormatBytes(used)+" used", FormatBytes(0)+" used")
+	})
+}
+
+func GetUserQuota(db *sql.DB, username string) (*UserQuota, error) {
+	var (
+		q      UserQuota
+		period string
+	)
+	err := db.QueryRow(`
+		SELECT users.username, quota_bytes, period, reset_day, used_bytes, period_start
+		FROM user_quotas
+		JOIN users ON users.id = user_quotas.user_id
+		WHERE users.username = ?
+	`, username).Scan(&q.Username, &q.QuotaBytes, &period, &q.ResetDay, &q.UsedBytes, &q.PeriodStart)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrQuotaNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	q.Period = QuotaPeriod(period)
+	return &q, nil
+}
+
+func ListUserQuotas(db *sql.DB) ([]UserQuota, error) {
+	return listUserQuotas(db)
+}
+
+func listUserQuotas(q querier) ([]UserQuota, error) {
+	rows, err := q.Query(`
+		SELECT users.username, quota_bytes, period, reset_day, used_bytes, period_start
+		FROM user_quotas
+		JOIN users ON users.id = user_quotas.user_id
+		ORDER BY users.username
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []UserQuota
+	for rows.Next() {
+		var (
+			q      UserQuota
+			period string
+		)
+		if err := rows.Scan(&q.Username, &q.QuotaBytes, &period, &q.ResetDay, &q.UsedBytes, &q.PeriodStart); err != nil {
+			return nil, err
+		}
+		q.Period = QuotaPeriod(period)
+		out = append(out, q)
+	}
+	return out, rows.Err()
+}
+
+// ---------- runtime ----------
+
+// LoadQuotas returns all quotas keyed by username.
+func LoadQuotas(db *sql.DB) (map[string]UserQuota, error) {
+	list, err := ListUserQuotas(db)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]UserQuota, len(list))
+	for _, q := range list {
+		out[q.Username] = q
+	}
+	return out, nil
+}
+
+// WithUsage returns q with n more bytes used as of now. An elapsed
+// period is rolled over first, the way FlushQuotaUsage does it, so the
+// in-memory copy matches the database after the next flush.
+func (q UserQuota) WithUsage(n int64, now time.Time) UserQuota {
+	if r := q.ResetAt(); !r.IsZero() && !now.Before(r) {
+		q.UsedBytes = 0
+		q.PeriodStart = quotaPeriodStart(q.Period, q.ResetDay, now)
+	}
+	q.UsedBytes += n
+	return q
+}
+
+// FlushQuotaUsage persists a batch of byte counts in one transaction.
+// Quotas whose period has ended are reset first, in the same
+// transaction, so bytes counted after the reset are never wiped by it.
+// Users without a quota are ignored. It returns how many periods were
+// reset.
+func FlushQuotaUsage(db *sql.DB, usage map[string]int64, now time.Time) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	quotas, err := listUserQuotas(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	rolled := 0
+	for _, q := range quotas {
+		r := q.ResetAt()
+		if r.IsZero() || now.Before(r) {
+			continue
+		}
+
+		_, err := tx.Exec(`
+			UPDATE user_quotas SET used_bytes = 0, period_start = ?
+			WHERE user_id = (SELECT id FROM users WHERE username = ?)
+		`, quotaPeriodStart(q.Period, q.ResetDay, now), q.Username)
+		if err != nil {
+			return 0, err
+		}
+		rolled++
+	}
+
+	stmt, err := tx.Prepare(`
+		UPDATE user_quotas SET used_bytes = used_bytes + ?
+		WHERE user_id = (SELECT id FROM users WHERE username = ?)
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	for user, n := range usage {
+		if n <= 0 {
+			continue
+		}
+		if _, err := stmt.Exec(n, user); err != nil {
+			return 0, err
+		}
+	}
+
+	return rolled, tx.Commit()
+}
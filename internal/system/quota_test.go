@@ -0,0 +1,114 @@
+package system
+
+import (
+	"testing"
+	"time"
+)
+
+func day(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// quotaRollovers are usage added at now to a quota whose period began
+// at start; wantStart and wantUsed are the state afterwards.
+var quotaRollovers = []struct {
+	name      string
+	period    QuotaPeriod
+	resetDay  int
+	start     time.Time
+	now       time.Time
+	wantStart time.Time
+	wantUsed  int64
+}{
+	{"monthly within period", QuotaMonthly, 15, day(2026, 1, 15), day(2026, 2, 14).Add(23 * time.Hour), day(2026, 1, 15), 1100},
+	{"monthly at the reset day", QuotaMonthly, 15, day(2026, 1, 15), day(2026, 2, 15), day(2026, 2, 15), 100},
+	{"monthly before the reset day of the next month", QuotaMonthly, 15, day(2026, 1, 15), day(2026, 3, 3), day(2026, 2, 15), 100},
+	{"monthly across the year", QuotaMonthly, 1, day(2025, 12, 1), day(2026, 1, 1).Add(time.Minute), day(2026, 1, 1), 100},
+	{"monthly elapsed while down", QuotaMonthly, 28, day(2026, 1, 28), day(2026, 6, 2), day(2026, 5, 28), 100},
+	{"weekly elapsed while down", QuotaWeekly, 1, day(2026, 1, 5), day(2026, 2, 19), day(2026, 2, 16), 100},
+	{"daily next day", QuotaDaily, 0, day(2026, 1, 5), day(2026, 1, 6).Add(time.Hour), day(2026, 1, 6), 100},
+	{"never", QuotaNever, 0, day(2020, 1, 1), day(2026, 1, 1), day(2020, 1, 1), 1100},
+}
+
+func TestQuotaWithUsage(t *testing.T) {
+	for _, tc := range quotaRollovers {
+		t.Run(tc.name, func(t *testing.T) {
+			q := UserQuota{
+				QuotaBytes:  5000,
+				Period:      tc.period,
+				ResetDay:    tc.resetDay,
+				UsedBytes:   1000,
+				PeriodStart: tc.start,
+			}
+			got := q.WithUsage(100, tc.now)
+			if got.UsedBytes != tc.wantUsed || !got.PeriodStart.Equal(tc.wantStart) {
+				t.Errorf("got %d bytes from %v, want %d from %v",
+					got.UsedBytes, got.PeriodStart, tc.wantUsed, tc.wantStart)
+			}
+			if tc.wantUsed == 100 && !got.ResetAt().After(tc.now) {
+				t.Errorf("rolled over to a period ending at %v, before %v", got.ResetAt(), tc.now)
+			}
+		})
+	}
+}
+
+func TestFlushQuotaUsageMatchesWithUsage(t *testing.T) {
+	for _, tc := range quotaRollovers {
+		t.Run(tc.name, func(t *testing.T) {
+			db := openTestDB(t)
+			must(t, AddUser(db, testActor, "alice", "secret-one"))
+			must(t, AddUser(db, testActor, "bob", "secret-two"))
+			must(t, SetUserQuota(db, testActor, "alice", 5000, tc.period, tc.resetDay))
+			_, err := db.Exec(`UPDATE user_quotas SET used_bytes = 1000, period_start = ?`, tc.start)
+			must(t, err)
+
+			before, err := GetUserQuota(db, "alice")
+			must(t, err)
+
+			// bob has no quota and is ignored
+			rolled, err := FlushQuotaUsage(db, map[string]int64{"alice": 100, "bob": 100}, tc.now)
+			must(t, err)
+
+			wantRolled := 0
+			if tc.wantUsed == 100 {
+				wantRolled = 1
+			}
+			if rolled != wantRolled {
+				t.Errorf("%d periods reset, want %d", rolled, wantRolled)
+			}
+
+			got, err := GetUserQuota(db, "alice")
+			must(t, err)
+			if got.UsedBytes != tc.wantUsed || !got.PeriodStart.Equal(tc.wantStart) {
+				t.Errorf("got %d bytes from %v, want %d from %v",
+					got.UsedBytes, got.PeriodStart, tc.wantUsed, tc.wantStart)
+			}
+
+			mem := before.WithUsage(100, tc.now)
+			if mem.UsedBytes != got.UsedBytes || !mem.PeriodStart.Equal(got.PeriodStart) {
+				t.Errorf("in memory %d from %v, database %d from %v",
+					mem.UsedBytes, mem.PeriodStart, got.UsedBytes, got.PeriodStart)
+			}
+		})
+	}
+}
+
+func TestQuotaUsedAtElapsedPeriod(t *testing.T) {
+	q := UserQuota{
+		QuotaBytes:  1000,
+		Period:      QuotaMonthly,
+		ResetDay:    10,
+		UsedBytes:   1000,
+		PeriodStart: day(2026, 1, 10),
+	}
+	now := day(2026, 3, 20)
+	if n := q.UsedAt(now); n != 0 {
+		t.Errorf("UsedAt after the period = %d, want 0", n)
+	}
+	if r := q.NextResetAt(now); !r.Equal(day(2026, 4, 10)) {
+		t.Errorf("NextResetAt = %v, want 2026-04-10", r)
+	}
+	if r := q.ResetAt(); !r.Equal(day(2026, 2, 10)) {
+		t.Errorf("ResetAt = %v, want 2026-02-10", r)
+	}
+}
@@ -0,0 +1,260 @@
+package system
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+type RateScope string
+
+const (
+	RateGlobal RateScope = "global"
+	RateGroup  RateScope = "group"
+	RateUser   RateScope = "user"
+)
+
+// RateLimit is a bandwidth cap in bytes per second. 0 means unlimited.
+type RateLimit struct {
+	Scope   RateScope `json:"scope"`
+	Name    string    `json:"name"`
+	UpBps   int64     `json:"up_bps"`   // 0 = unlimited
+	DownBps int64     `json:"down_bps"` // 0 = unlimited
+}
+
+// ---------- versioning (mirror whitelist) ----------
+
+func GetRateLimitsVersion(db *sql.DB) (int64, error) {
+	var v int64
+	err := db.QueryRow(`SELECT version FROM rate_limits_meta WHERE id = 1`).Scan(&v)
+	return v, err
+}
+
+func BumpRateLimitsVersion(q querier) error {
+	_, err := q.Exec(`UPDATE rate_limits_meta SET version = version + 1 WHERE id = 1`)
+	return err
+}
+
+// ---------- normalization ----------
+
+func normalizeRateTarget(scope RateScope, name string) (RateScope, string, error) {
+	name = strings.TrimSpace(name)
+
+	switch scope {
+	case RateGlobal:
+		return scope, "", nil
+	case RateGroup, RateUser:
+		if name == "" {
+			return "", "", fmt.Errorf("%s rate limit requires a name", scope)
+		}
+		return scope, name, nil
+	default:
+		return "", "", fmt.Errorf("invalid rate limit scope: %q (use global|group|user)", scope)
+	}
+}
+
+// ---------- CRUD ----------
+
+// rateAuditTarget names a rate limit in the audit log: global, or
+// scope:name.
+func rateAuditTarget(scope RateScope, name string) string {
+	if scope == RateGlobal {
+		return string(scope)
+	}
+	return string(scope) + ":" + name
+}
+
+func rateAuditValue(up, down int64) string {
+	bps := func(n int64) string {
+		if n == 0 {
+			return "unlimited"
+		}
+		return FormatBytes(n) + "/s"
+	}
+	return "up " + bps(up) + ", down " + bps(down)
+}
+
+// rateLimitState returns the audit value of an existing limit, or "".
+func rateLimitState(tx *sql.Tx, scope RateScope, name string) (string, error) {
+	var up, down int64
+	err := tx.QueryRow(
+		`SELECT up_bps, down_bps FROM rate_limits WHERE scope = ? AND name = ?`,
+		string(scope), name,
+	).Scan(&up, &down)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return rateAuditValue(up, down), nil
+}
+
+// SetRateLimit inserts or replaces a rate limit.
+func SetRateLimit(db *sql.DB, actor Actor, scope RateScope, name string, up, down int64) error {
+	scope, name, err := normalizeRateTarget(scope, name)
+	if err != nil {
+		return err
+	}
+	if up < 0 || down < 0 {
+		return fmt.Errorf("rate limits cannot be negative")
+	}
+
+	return inTx(db, func(tx *sql.Tx) error {
+		if scope == RateUser {
+			var id int64
+			err := tx.QueryRow(`SELECT id FROM users WHERE username = ?`, name).Scan(&id)
+			if err == sql.ErrNoRows {
+				return ErrUserNotFound
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		old, err := rateLimitState(tx, scope, name)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO rate_limits (scope, name, up_bps, down_bps)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT(scope, name) DO UPDATE SET
+				up_bps = excluded.up_bps,
+				down_bps = excluded.down_bps
+		`, string(scope), name, up, down)
+		if err != nil {
+			return err
+		}
+
+		if err := BumpRateLimitsVersion(tx); err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditRateLimitSet, rateAuditTarget(scope, name), old, rateAuditValue(up, down))
+	})
+}
+
+// DeleteRateLimit removes a rate limit so the next broader scope applies.
+func DeleteRateLimit(db *sql.DB, actor Actor, scope RateScope, name string) error {
+	scope, name, err := normalizeRateTarget(scope, name)
+	if err != nil {
+		return err
+	}
+
+	return inTx(db, func(tx *sql.Tx) error {
+		old, err := rateLimitState(tx, scope, name)
+		if err != nil {
+			return err
+		}
+		if old == "" {
+			return fmt.Errorf("rate limit not found: %s %s", scope, name)
+		}
+
+		_, err = tx.Exec(
+			`DELETE FROM rate_limits WHERE scope = ? AND name = ?`,
+			string(scope), name,
+		)
+		if err != nil {
+			return err
+		}
+
+		if err := BumpRateLimitsVersion(tx); err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditRateLimitDelete, rateAuditTarget(scope, name), old, "")
+	})
+}
+
+func ListRateLimits(db *sql.DB) ([]RateLimit, error) {
+	rows, err := db.Query(`
+		SELECT scope, name, up_bps, down_bps
+		FROM rate_limits
+		ORDER BY CASE scope WHEN 'global' THEN 0 WHEN 'group' THEN 1 ELSE 2 END, name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []RateLimit
+	for rows.Next() {
+		var r RateLimit
+		var scope string
+		if err := rows.Scan(&scope, &r.Name, &r.UpBps, &r.DownBps); err != nil {
+			return nil, err
+		}
+		r.Scope = RateScope(scope)
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// Runtime: all limits plus the user -> group mapping needed to resolve them.
+type RateLimitRuntime struct {
+	Global     *RateLimit
+	Groups     map[string]RateLimit
+	Users      map[string]RateLimit
+	UserGroups map[string]string
+}
+
+func LoadRateLimits(db *sql.DB) (*RateLimitRuntime, error) {
+	limits, err := ListRateLimits(db)
+	if err != nil {
+		return nil, err
+	}
+
+	rt := &RateLimitRuntime{
+		Groups:     make(map[string]RateLimit),
+		Users:      make(map[string]RateLimit),
+		UserGroups: make(map[string]string),
+	}
+
+	for _, l := range limits {
+		switch l.Scope {
+		case RateGlobal:
+			g := l
+			rt.Global = &g
+		case RateGroup:
+			rt.Groups[l.Name] = l
+		case RateUser:
+			rt.Users[l.Name] = l
+		}
+	}
+
+	rows, err := db.Query(`SELECT username, group_name FROM users WHERE group_name <> ''`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u, g string
+		if err := rows.Scan(&u, &g); err != nil {
+			return nil, err
+		}
+		rt.UserGroups[u] = g
+	}
+
+	return rt, rows.Err()
+}
+
+// Resolve returns the effective limits for a user.
+// The most specific rule wins: user, then group, then global.
+func (rt *RateLimitRuntime) Resolve(username string) (up, down int64) {
+	if rt == nil {
+		return 0, 0
+	}
+	if l, ok := rt.Users[username]; ok && username != "" {
+		return l.UpBps, l.DownBps
+	}
+	if g, ok := rt.UserGroups[username]; ok {
+		if l, ok := rt.Groups[g]; ok {
+			return l.UpBps, l.DownBps
+		}
+	}
+	if rt.Global != nil {
+		return rt.Global.UpBps, rt.Global.DownBps
+	}
+	return 0, 0
+}
@@ -0,0 +1,53 @@
+package system
+
+import "testing"
+
+func TestRateLimitResolve(t *testing.T) {
+	db := openTestDB(t)
+	must(t, AddUser(db, testActor, "alice", "secret-one"))
+	must(t, AddUser(db, testActor, "bob", "secret-two"))
+	must(t, AddUser(db, testActor, "carol", "secret-three"))
+	must(t, SetUserGroup(db, testActor, "bob", "staff"))
+	must(t, SetUserGroup(db, testActor, "carol", "staff"))
+
+	must(t, SetRateLimit(db, testActor, RateGlobal, "", 1000, 2000))
+	must(t, SetRateLimit(db, testActor, RateGroup, "staff", 3000, 4000))
+	must(t, SetRateLimit(db, testActor, RateUser, "carol", 0, 0))
+
+	if err := SetRateLimit(db, testActor, RateGlobal, "", -1, 0); err == nil {
+		t.Error("negative rate accepted")
+	}
+	if err := SetRateLimit(db, testActor, RateUser, "nobody", 1, 1); err != ErrUserNotFound {
+		t.Errorf("unknown user: %v, want ErrUserNotFound", err)
+	}
+
+	rt, err := LoadRateLimits(db)
+	must(t, err)
+
+	for _, tc := range []struct {
+		user     string
+		up, down int64
+	}{
+		{"alice", 1000, 2000}, // global
+		{"bob", 3000, 4000},   // group
+		{"carol", 0, 0},       // user rule lifts the group's
+		{"", 1000, 2000},      // unauthenticated
+	} {
+		up, down := rt.Resolve(tc.user)
+		if up != tc.up || down != tc.down {
+			t.Errorf("Resolve(%q) = %d/%d, want %d/%d", tc.user, up, down, tc.up, tc.down)
+		}
+	}
+
+	must(t, DeleteRateLimit(db, testActor, RateGroup, "staff"))
+	rt, err = LoadRateLimits(db)
+	must(t, err)
+	if up, down := rt.Resolve("bob"); up != 1000 || down != 2000 {
+		t.Errorf("after deleting the group limit bob gets %d/%d, want the global 1000/2000", up, down)
+	}
+
+	var none *RateLimitRuntime
+	if up, down := none.Resolve("alice"); up != 0 || down != 0 {
+		t.Errorf("nil runtime resolves to %d/%d", up, down)
+	}
+}
@@ -0,0 +1,94 @@
+package system
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Keys in the settings table. Settings are read by both the running
+// service and the CLI, which is why they live in SQLite and not in flags.
+const (
+	SettingPasswordMaxAge   = "password_max_age"
+	SettingHistoryRetention = "history_retention"
+)
+
+// DefaultHistoryRetention applies until an admin sets one.
+const DefaultHistoryRetention = 30 * 24 * time.Hour
+
+// GetSetting returns the stored value for key ("" if unset).
+func GetSetting(q querier, key string) (string, error) {
+	var v string
+	err := q.QueryRow(`SELECT value FROM settings WHERE key = ?`, key).Scan(&v)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return v, err
+}
+
+// changeSetting stores value under key, or removes key for "", and
+// records the change. An unchanged value is left alone.
+func changeSetting(tx *sql.Tx, actor Actor, key, value string) error {
+	old, err := GetSetting(tx, key)
+	if err != nil || old == value {
+		return err
+	}
+
+	if value == "" {
+		_, err = tx.Exec(`DELETE FROM settings WHERE key = ?`, key)
+	} else {
+		_, err = tx.Exec(`
+			INSERT INTO settings (key, value) VALUES (?, ?)
+			ON CONFLICT(key) DO UPDATE SET value = excluded.value
+		`, key, value)
+	}
+	if err != nil {
+		return err
+	}
+	return recordAudit(tx, actor, AuditSettingChange, key, old, value)
+}
+
+// PasswordMaxAge returns the maximum password age (0 = passwords never expire).
+func PasswordMaxAge(q querier) (time.Duration, error) {
+	v, err := GetSetting(q, SettingPasswordMaxAge)
+	if err != nil || v == "" {
+		return 0, err
+	}
+	return time.ParseDuration(v)
+}
+
+// SetPasswordMaxAge sets the maximum password age; 0 disables rotation.
+func SetPasswordMaxAge(db *sql.DB, actor Actor, d time.Duration) error {
+	value := ""
+	if d > 0 {
+		value = d.String()
+	}
+	return inTx(db, func(tx *sql.Tx) error {
+		if err := changeSetting(tx, actor, SettingPasswordMaxAge, value); err != nil {
+			return err
+		}
+		return BumpUsersVersion(tx)
+	})
+}
+
+// HistoryRetention returns how long connection history is kept
+// (0 = forever).
+func HistoryRetention(db *sql.DB) (time.Duration, error) {
+	v, err := GetSetting(db, SettingHistoryRetention)
+	if err != nil {
+		return 0, err
+	}
+	if v == "" {
+		return DefaultHistoryRetention, nil
+	}
+	return time.ParseDuration(v)
+}
+
+// SetHistoryRetention sets how long connection history is kept; 0 keeps it forever.
+func SetHistoryRetention(db *sql.DB, actor Actor, d time.Duration) error {
+	if d < 0 {
+		d = 0
+	}
+	return inTx(db, func(tx *sql.Tx) error {
+		return changeSetting(tx, actor, SettingHistoryRetention, d.String())
+	})
+}
@@ -0,0 +1,96 @@
+package system
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var byteUnits = []struct {
+	suffix string
+	mult   int64
+}{
+	{"TB", 1 << 40},
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"T", 1 << 40},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+	{"B", 1},
+}
+
+// ParseByteSize parses sizes like "512", "64KB", "10M" or "50GB".
+// Units are binary (1KB = 1024 bytes) and case-insensitive.
+func ParseByteSize(s string) (int64, error) {
+	in := strings.ToUpper(strings.TrimSpace(s))
+	if in == "" {
+		return 0, fmt.Errorf("empty size")
+	}
+
+	mult := int64(1)
+	for _, u := range byteUnits {
+		if strings.HasSuffix(in, u.suffix) {
+			mult = u.mult
+			in = strings.TrimSpace(strings.TrimSuffix(in, u.suffix))
+			break
+		}
+	}
+
+	// ParseFloat accepts "inf", "nan" and huge exponents; converting
+	// those to int64 is undefined, so anything past MaxInt64 is refused.
+	n, err := strconv.ParseFloat(in, 64)
+	if err != nil || n < 0 || math.IsNaN(n) || n*float64(mult) >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+
+	return int64(n * float64(mult)), nil
+}
+
+// ParseDuration is time.ParseDuration plus whole-day ("7d") and
+// whole-week ("2w") units, which account policies are usually given in.
+func ParseDuration(s string) (time.Duration, error) {
+	in := strings.TrimSpace(s)
+
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(in, suffix); ok {
+			v, err := strconv.Atoi(n)
+			if err != nil || v < 0 || int64(v) > math.MaxInt64/int64(unit) {
+				return 0, fmt.Errorf("invalid duration: %s", s)
+			}
+			return time.Duration(v) * unit, nil
+		}
+	}
+
+	d, err := time.ParseDuration(in)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration: %s", s)
+	}
+	return d, nil
+}
+
+// FormatDuration renders whole days as "90d" and anything else as Go does.
+func FormatDuration(d time.Duration) string {
+	if d > 0 && d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return d.String()
+}
+
+// FormatBytes renders a byte count using binary units.
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
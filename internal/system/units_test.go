@@ -0,0 +1,103 @@
+package system
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseByteSize(t *testing.T) {
+	for _, tc := range []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"0", 0, false},
+		{"0B", 0, false},
+		{"512", 512, false},
+		{"64KB", 64 << 10, false},
+		{"10MB", 10 << 20, false},
+		{"10mb", 10 << 20, false},
+		{"10M", 10 << 20, false},
+		{" 1.5 GB ", 3 << 29, false},
+		{"2TB", 2 << 40, false},
+		{"", 0, true},
+		{"-1", 0, true},
+		{"-10MB", 0, true},
+		{"1Gbit/s", 0, true},
+		{"10XB", 0, true},
+		{"MB", 0, true},
+		{"inf", 0, true},
+		{"NaN", 0, true},
+		{"9000000TB", 0, true},
+	} {
+		got, err := ParseByteSize(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseByteSize(%q) = %d, want an error", tc.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("ParseByteSize(%q) = %d, %v; want %d", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+func TestFormatBytesRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		in   int64
+		want string
+	}{
+		{0, "0B"},
+		{1023, "1023B"},
+		{1024, "1.0KB"},
+		{1536, "1.5KB"},
+		{10 << 20, "10.0MB"},
+		{1 << 30, "1.0GB"},
+		{5 << 40, "5.0TB"},
+	} {
+		s := FormatBytes(tc.in)
+		if s != tc.want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", tc.in, s, tc.want)
+		}
+		back, err := ParseByteSize(s)
+		if err != nil || back != tc.in {
+			t.Errorf("ParseByteSize(%q) = %d, %v; want %d", s, back, err, tc.in)
+		}
+	}
+}
+
+func TestParseDurationRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		in      string
+		want    time.Duration
+		format  string
+		wantErr bool
+	}{
+		{"0s", 0, "0s", false},
+		{"90m", 90 * time.Minute, "1h30m0s", false},
+		{"7d", 7 * 24 * time.Hour, "7d", false},
+		{"2w", 14 * 24 * time.Hour, "14d", false},
+		{"-1h", 0, "", true},
+		{"-3d", 0, "", true},
+		{"1.5d", 0, "", true},
+		{"soon", 0, "", true},
+	} {
+		got, err := ParseDuration(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseDuration(%q) = %v, want an error", tc.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("ParseDuration(%q) = %v, %v; want %v", tc.in, got, err, tc.want)
+			continue
+		}
+		if s := FormatDuration(got); s != tc.format {
+			t.Errorf("FormatDuration(%v) = %q, want %q", got, s, tc.format)
+		} else if back, err := ParseDuration(s); err != nil || back != got {
+			t.Errorf("ParseDuration(%q) = %v, %v; want %v", s, back, err, got)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package system
+
+import (
+	"database/sql"
+	"time"
+)
+
+// UserExpiry describes when an account and its password stop working.
+// Zero times mean "never".
+type UserExpiry struct {
+	Username          string    `json:"username"`
+	ExpiresAt         time.Time `json:"expires_at,omitzero"`
+	PasswordChangedAt time.Time `json:"password_changed_at,omitzero"`
+	PasswordExpiresAt time.Time `json:"password_expires_at,omitzero"`
+}
+
+// AccountExpired reports whether the account itself has expired at now.
+func (e UserExpiry) AccountExpired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+// PasswordExpired reports whether the password is older than the max age.
+func (e UserExpiry) PasswordExpired(now time.Time) bool {
+	return !e.PasswordExpiresAt.IsZero() && !now.Before(e.PasswordExpiresAt)
+}
+
+func scanUserExpiry(sc interface{ Scan(...any) error }, maxAge time.Duration) (UserExpiry, error) {
+	var (
+		e         UserExpiry
+		expiresAt sql.NullTime
+		changedAt sql.NullTime
+	)
+	if err := sc.Scan(&e.Username, &expiresAt, &changedAt); err != nil {
+		return e, err
+	}
+
+	if expiresAt.Valid {
+		e.ExpiresAt = expiresAt.Time
+	}
+	if changedAt.Valid {
+		e.PasswordChangedAt = changedAt.Time
+		if maxAge > 0 {
+			e.PasswordExpiresAt = changedAt.Time.Add(maxAge)
+		}
+	}
+	return e, nil
+}
+
+func GetUserExpiry(q querier, username string) (*UserExpiry, error) {
+	maxAge, err := PasswordMaxAge(q)
+	if err != nil {
+		return nil, err
+	}
+
+	row := q.QueryRow(
+		`SELECT username, expires_at, password_changed_at FROM users WHERE username = ?`,
+		username,
+	)
+	e, err := scanUserExpiry(row, maxAge)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// ListExpiringUsers returns users whose account or password expires
+// before now+within, including those that already expired.
+func ListExpiringUsers(db *sql.DB, within time.Duration, now time.Time) ([]UserExpiry, error) {
+	maxAge, err := PasswordMaxAge(db)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(
+		`SELECT username, expires_at, password_changed_at FROM users ORDER BY username`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	horizon := now.Add(within)
+
+	var out []UserExpiry
+	for rows.Next() {
+		e, err := scanUserExpiry(rows, maxAge)
+		if err != nil {
+			return nil, err
+		}
+		if e.AccountExpired(horizon) || e.PasswordExpired(horizon) {
+			out = append(out, e)
+		}
+	}
+	return out, rows.Err()
+}
+
+// CheckUserExpiry returns ErrUserExpired or ErrPasswordExpired if the
+// account may no longer log in. Unknown users return nil.
+func CheckUserExpiry(db *sql.DB, username string, now time.Time) error {
+	e, err := GetUserExpiry(db, username)
+	if err == ErrUserNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if e.AccountExpired(now) {
+		return ErrUserExpired
+	}
+	if e.PasswordExpired(now) {
+		return ErrPasswordExpired
+	}
+	return nil
+}
+
+// SetUserExpiry sets when an account expires; a zero time removes expiry.
+func SetUserExpiry(db *sql.DB, actor Actor, username string, at time.Time) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		old, err := GetUserExpiry(tx, username)
+		if err != nil {
+			return err
+		}
+
+		var v any
+		if !at.IsZero() {
+			v = at.UTC()
+		}
+
+		res, err := tx.Exec(
+			`UPDATE users SET expires_at = ? WHERE username = ?`,
+			v,
+			username,
+		)
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrUserNotFound
+		}
+		if err := BumpUsersVersion(tx); err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditUserExpiry, username, auditTime(old.ExpiresAt), auditTime(at))
+	})
+}
+
+// ChangePassword replaces a user's password and restarts its max-age clock.
+func ChangePassword(db *sql.DB, actor Actor, username, password string) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		hash, err := hashPassword(password)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.Exec(
+			`UPDATE users SET password_hash = ?, password_changed_at = ? WHERE username = ?`,
+			hash,
+			time.Now().UTC(),
+			username,
+		)
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrUserNotFound
+		}
+		return recordAudit(tx, actor, AuditUserPassword, username, "", auditSecret)
+	})
+}
@@ -0,0 +1,162 @@
+package system
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// UserImport is one user to create with ImportUsers.
+type UserImport struct {
+	Line      int // source line, carried into the result
+	Username  string
+	Password  string
+	Active    bool
+	ExpiresAt time.Time // zero = never
+	Group     string
+}
+
+// ImportResult is the outcome of one UserImport.
+type ImportResult struct {
+	Line     int    `json:"line"`
+	Username string `json:"username"`
+	Created  bool   `json:"created"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ImportUsers creates users in one transaction. Every row runs in its own
+// savepoint, so a row that fails (duplicate, invalid name) is rolled back
+// and reported while the others are committed together. Passwords are
+// hashed before the transaction starts to keep the write lock short.
+func ImportUsers(db *sql.DB, actor Actor, rows []UserImport) ([]ImportResult, error) {
+	results := make([]ImportResult, len(rows))
+	hashes := make([]string, len(rows))
+	for i, r := range rows {
+		results[i] = ImportResult{Line: r.Line, Username: r.Username}
+		if !ValidUsername(r.Username) {
+			results[i].Error = "invalid username"
+			continue
+		}
+		if !ValidGroupName(strings.TrimSpace(r.Group)) {
+			results[i].Error = "invalid group"
+			continue
+		}
+		h, err := hashPassword(r.Password)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		hashes[i] = h
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	var created, grouped int
+	for i, r := range rows {
+		if results[i].Error != "" {
+			continue
+		}
+
+		if _, err := tx.Exec(`SAVEPOINT import_row`); err != nil {
+			return nil, err
+		}
+		if err := importUser(tx, r, hashes[i], now); err != nil {
+			if _, rbErr := tx.Exec(`ROLLBACK TO import_row`); rbErr != nil {
+				return nil, rbErr
+			}
+			results[i].Error = err.Error()
+		} else {
+			results[i].Created = true
+			created++
+			if r.Group != "" {
+				grouped++
+			}
+		}
+		if _, err := tx.Exec(`RELEASE import_row`); err != nil {
+			return nil, err
+		}
+	}
+
+	if created == 0 {
+		return results, nil
+	}
+
+	if err := BumpUsersVersion(tx); err != nil {
+		return nil, err
+	}
+	if grouped > 0 {
+		if err := BumpRateLimitsVersion(tx); err != nil {
+			return nil, err
+		}
+	}
+	for i, r := range rows {
+		if !results[i].Created {
+			continue
+		}
+		if err := recordAudit(tx, actor, AuditUserAdd, r.Username, "", importAuditValue(r)); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func importUser(tx *sql.Tx, r UserImport, hash string, now time.Time) error {
+	var exists int
+	err := tx.QueryRow(`SELECT 1 FROM users WHERE username = ?`, r.Username).Scan(&exists)
+	if err == nil {
+		return ErrUserExists
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	var expires any
+	if !r.ExpiresAt.IsZero() {
+		expires = r.ExpiresAt.UTC()
+	}
+
+	res, err := tx.Exec(
+		`INSERT INTO users (username, password_hash, password_changed_at, expires_at, group_name)
+		VALUES (?, ?, ?, ?, ?)`,
+		r.Username, hash, now, expires, strings.TrimSpace(r.Group),
+	)
+	if err != nil {
+		return err
+	}
+	userID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	active := 0
+	if r.Active {
+		active = 1
+	}
+	_, err = tx.Exec(`INSERT INTO user_status (user_id, active) VALUES (?, ?)`, userID, active)
+	return err
+}
+
+// importAuditValue describes a created user like ListUserByUsername does.
+func importAuditValue(r UserImport) string {
+	v := "inactive"
+	if r.Active {
+		v = "active"
+	}
+	if !r.ExpiresAt.IsZero() {
+		v += ", expires " + r.ExpiresAt.Local().Format("2006-01-02 15:04")
+	}
+	if g := strings.TrimSpace(r.Group); g != "" {
+		v += fmt.Sprintf(", group %s", g)
+	}
+	return v
+}
@@ -2,10 +2,26 @@ package system
 
 import (
 	"database/sql"
+	"fmt"
+	"strings"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+// GetUsersVersion returns the user status version. It is bumped whenever
+// a change may revoke access, so the service can re-check open tunnels.
+func GetUsersVersion(db *sql.DB) (int64, error) {
+	var v int64
+	err := db.QueryRow(`SELECT version FROM users_meta WHERE id = 1`).Scan(&v)
+	return v, err
+}
+
+func BumpUsersVersion(q querier) error {
+	_, err := q.Exec(`UPDATE users_meta SET version = version + 1 WHERE id = 1`)
+	return err
+}
+
 // ListUsers returns all users in the database
 func ListUsers(db *sql.DB) ([]string, error) {
 	rows, err := db.Query(`SELECT username FROM users ORDER BY username`)
@@ -25,16 +41,20 @@ func ListUsers(db *sql.DB) ([]string, error) {
 	return users, rows.Err()
 }
 
-// ListUserByUsername returns the status (active/inactive) of a specific user
-func ListUserByUsername(db *sql.DB, username string) (string, error) {
+// ListUserByUsername returns the status (active/inactive, blocked, locked) of a specific user
+func ListUserByUsername(q querier, username string) (string, error) {
 	// Check if the user exists and get their active status
-	var active int
-	err := db.QueryRow(
-		`SELECT active FROM user_status
+	var (
+		active      int
+		blocked     int
+		lockedUntil sql.NullTime
+	)
+	err := q.QueryRow(
+		`SELECT active, blocked, locked_until FROM user_status
 		JOIN users ON users.id = user_status.user_id
 		WHERE users.username = ?`,
 		username,
-	).Scan(&active)
+	).Scan(&active, &blocked, &lockedUntil)
 
 	if err == sql.ErrNoRows {
 		return "", ErrUserNotFound
@@ -48,38 +68,118 @@ func ListUserByUsername(db *sql.DB, username string) (string, error) {
 	if active == 0 {
 		status = "inactive"
 	}
-	return status, nil
-}
-
-func DeleteUser(db *sql.DB, username string) error {
-	res, err := db.Exec(
-		`DELETE FROM users WHERE username = ?`,
-		username,
-	)
-	if err != nil {
-		return err
+	if blocked == 1 {
+		status += ", blocked"
+	}
+	if lockedUntil.Valid && time.Now().Before(lockedUntil.Time) {
+		status += ", locked until " + lockedUntil.Time.Local().Format("2006-01-02 15:04:05")
 	}
 
-	n, err := res.RowsAffected()
+	e, err := GetUserExpiry(q, username)
 	if err != nil {
-		return err
+		return "", err
 	}
-	if n == 0 {
-		return ErrUserNotFound
+	now := time.Now()
+	switch {
+	case e.AccountExpired(now):
+		status += ", expired"
+	case !e.ExpiresAt.IsZero():
+		status += ", expires " + e.ExpiresAt.Local().Format("2006-01-02 15:04")
 	}
+	if e.PasswordExpired(now) {
+		status += ", password expired"
+	}
+	return status, nil
+}
 
-	return nil
+func DeleteUser(db *sql.DB, actor Actor, username string) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		old, err := ListUserByUsername(tx, username)
+		if err != nil {
+			return err
+		}
+
+		// foreign keys are not enforced by SQLite by default,
+		// so dependent rows are removed explicitly.
+		for _, table := range []string{"user_quotas", "user_status"} {
+			_, err = tx.Exec(
+				`DELETE FROM `+table+`
+				WHERE user_id = (SELECT id FROM users WHERE username = ?)`,
+				username,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		res, err := tx.Exec(
+			`DELETE FROM users WHERE username = ?`,
+			username,
+		)
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrUserNotFound
+		}
+
+		if err := BumpUsersVersion(tx); err != nil {
+			return err
+		}
+
+		res, err = tx.Exec(
+			`DELETE FROM rate_limits WHERE scope = 'user' AND name = ?`,
+			username,
+		)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			if err := BumpRateLimitsVersion(tx); err != nil {
+				return err
+			}
+		}
+
+		return recordAudit(tx, actor, AuditUserDelete, username, old, "")
+	})
 }
 
-func AddUser(db *sql.DB, username, password string) error {
-	tx, err := db.Begin()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
+// AddUser creates an inactive user.
+func AddUser(db *sql.DB, actor Actor, username, password string) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		return addUser(tx, actor, username, password)
+	})
+}
 
+// CreateUser adds a user with its group and active flag in one
+// transaction, so a failing step leaves no half-created user behind.
+func CreateUser(db *sql.DB, actor Actor, username, password, group string, active bool) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		if err := addUser(tx, actor, username, password); err != nil {
+			return err
+		}
+		if group != "" {
+			if err := setUserGroup(tx, actor, username, group); err != nil {
+				return err
+			}
+		}
+		if active {
+			return recordUserChange(tx, actor, AuditUserActivate, username, func(tx *sql.Tx) error {
+				return activateUser(tx, username)
+			})
+		}
+		return nil
+	})
+}
+
+func addUser(tx *sql.Tx, actor Actor, username, password string) error {
 	var exists int
-	err = tx.QueryRow(
+	err := tx.QueryRow(
 		`SELECT 1 FROM users WHERE username = ?`,
 		username,
 	).Scan(&exists)
@@ -97,9 +197,10 @@ func AddUser(db *sql.DB, username, password string) error {
 	}
 
 	res, err := tx.Exec(
-		`INSERT INTO users (username, password_hash) VALUES (?, ?)`,
+		`INSERT INTO users (username, password_hash, password_changed_at) VALUES (?, ?, ?)`,
 		username,
 		hash,
+		time.Now().UTC(),
 	)
 	if err != nil {
 		return err
@@ -118,7 +219,7 @@ func AddUser(db *sql.DB, username, password string) error {
 		return err
 	}
 
-	return tx.Commit()
+	return recordAudit(tx, actor, AuditUserAdd, username, "", "inactive")
 }
 
 func Authenticate(db *sql.DB, username, password string) error {
@@ -164,8 +265,40 @@ func IsActive(db *sql.DB, username string) (bool, error) {
 	return active == 1, nil
 }
 
-func ActivateUser(db *sql.DB, username string) error {
-	_, err := db.Exec(
+// auditUserChange runs change in a transaction and records it there
+// with the user's status line (see ListUserByUsername) from before and
+// after.
+func auditUserChange(db *sql.DB, actor Actor, action, username string, change func(tx *sql.Tx) error) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		return recordUserChange(tx, actor, action, username, change)
+	})
+}
+
+// recordUserChange is auditUserChange inside a transaction the caller
+// already holds.
+func recordUserChange(tx *sql.Tx, actor Actor, action, username string, change func(tx *sql.Tx) error) error {
+	old, err := ListUserByUsername(tx, username)
+	if err != nil {
+		return err
+	}
+	if err := change(tx); err != nil {
+		return err
+	}
+	cur, err := ListUserByUsername(tx, username)
+	if err != nil {
+		return err
+	}
+	return recordAudit(tx, actor, action, username, old, cur)
+}
+
+func ActivateUser(db *sql.DB, actor Actor, username string) error {
+	return auditUserChange(db, actor, AuditUserActivate, username, func(tx *sql.Tx) error {
+		return activateUser(tx, username)
+	})
+}
+
+func activateUser(tx *sql.Tx, username string) error {
+	_, err := tx.Exec(
 		`UPDATE user_status 
 		SET active = 1 
 		WHERE user_id = (SELECT id FROM users WHERE username = ?)`,
@@ -174,40 +307,265 @@ func ActivateUser(db *sql.DB, username string) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	return BumpUsersVersion(tx)
 }
 
-func DeactivateUser(db *sql.DB, username string) error {
-	_, err := db.Exec(
-		`UPDATE user_status 
-		SET active = 0 
-		WHERE user_id = (SELECT id FROM users WHERE username = ?)`,
+func DeactivateUser(db *sql.DB, actor Actor, username string) error {
+	return auditUserChange(db, actor, AuditUserDeactivate, username, func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			`UPDATE user_status 
+			SET active = 0 
+			WHERE user_id = (SELECT id FROM users WHERE username = ?)`,
+			username,
+		)
+		if err != nil {
+			return err
+		}
+		return BumpUsersVersion(tx)
+	})
+}
+
+// ActivateAllUsers activates all users in the database.
+func ActivateAllUsers(db *sql.DB, actor Actor) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		res, err := tx.Exec(
+			`UPDATE user_status SET active = 1 WHERE active = 0`,
+		)
+		if err != nil {
+			return err
+		}
+		if err := BumpUsersVersion(tx); err != nil {
+			return err
+		}
+		n, _ := res.RowsAffected()
+		return recordAudit(tx, actor, AuditUserActivate, "*", "", fmt.Sprintf("active (%d changed)", n))
+	})
+}
+
+// DeactivateAllUsers deactivates all users in the database.
+func DeactivateAllUsers(db *sql.DB, actor Actor) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		res, err := tx.Exec(
+			`UPDATE user_status SET active = 0 WHERE active = 1`,
+		)
+		if err != nil {
+			return err
+		}
+		if err := BumpUsersVersion(tx); err != nil {
+			return err
+		}
+		n, _ := res.RowsAffected()
+		return recordAudit(tx, actor, AuditUserDeactivate, "*", "", fmt.Sprintf("inactive (%d changed)", n))
+	})
+}
+
+// SetUserGroup assigns a user to a group ("" clears it).
+// Groups only matter for rate limit resolution, so the rate limit
+// version is bumped to make the running service pick up the change.
+func SetUserGroup(db *sql.DB, actor Actor, username, group string) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		return setUserGroup(tx, actor, username, group)
+	})
+}
+
+func setUserGroup(tx *sql.Tx, actor Actor, username, group string) error {
+	group = strings.TrimSpace(group)
+	if !ValidGroupName(group) {
+		return ErrInvalidGroup
+	}
+
+	old, err := UserGroup(tx, username)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(
+		`UPDATE users SET group_name = ? WHERE username = ?`,
+		group,
 		username,
 	)
 	if err != nil {
 		return err
 	}
-	return nil
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+
+	if err := BumpRateLimitsVersion(tx); err != nil {
+		return err
+	}
+	return recordAudit(tx, actor, AuditUserGroup, username, old, group)
 }
 
-// ActivateAllUsers activates all users in the database.
-func ActivateAllUsers(db *sql.DB) error {
-	_, err := db.Exec(
-		`UPDATE user_status SET active = 1`,
+// UserGroup returns the group a user belongs to ("" if none).
+func UserGroup(q querier, username string) (string, error) {
+	var g string
+	err := q.QueryRow(
+		`SELECT group_name FROM users WHERE username = ?`,
+		username,
+	).Scan(&g)
+
+	if err == sql.ErrNoRows {
+		return "", ErrUserNotFound
+	}
+	return g, err
+}
+
+// CheckUserLock returns ErrUserBlocked or ErrUserLocked if the user may
+// not log in right now, and ErrUserNotFound for an unknown user. It is
+// cheap and meant to run before bcrypt.
+func CheckUserLock(db *sql.DB, username string) error {
+	var (
+		blocked     int
+		lockedUntil sql.NullTime
 	)
+	err := db.QueryRow(
+		`SELECT blocked, locked_until FROM user_status
+		JOIN users ON users.id = user_status.user_id
+		WHERE users.username = ?`,
+		username,
+	).Scan(&blocked, &lockedUntil)
+
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
 	if err != nil {
 		return err
 	}
+
+	if blocked == 1 {
+		return ErrUserBlocked
+	}
+	if lockedUntil.Valid && time.Now().Before(lockedUntil.Time) {
+		return ErrUserLocked
+	}
 	return nil
 }
 
-// DeactivateAllUsers deactivates all users in the database.
-func DeactivateAllUsers(db *sql.DB) error {
-	_, err := db.Exec(
-		`UPDATE user_status SET active = 0`,
+// LockUser refuses logins for a user until the given time.
+func LockUser(db *sql.DB, actor Actor, username string, until time.Time) error {
+	return auditUserChange(db, actor, AuditUserLock, username, func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			`UPDATE user_status
+			SET locked_until = ?
+			WHERE user_id = (SELECT id FROM users WHERE username = ?)`,
+			until,
+			username,
+		)
+		return err
+	})
+}
+
+// UnlockUser clears both the temporary lock and the blocked flag.
+func UnlockUser(db *sql.DB, actor Actor, username string) error {
+	return auditUserChange(db, actor, AuditUserUnlock, username, func(tx *sql.Tx) error {
+		return unlockUser(tx, username)
+	})
+}
+
+func unlockUser(q querier, username string) error {
+	res, err := q.Exec(
+		`UPDATE user_status
+		SET locked_until = NULL, blocked = 0
+		WHERE user_id = (SELECT id FROM users WHERE username = ?)`,
+		username,
 	)
 	if err != nil {
 		return err
 	}
-	return nil
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+	return BumpUsersVersion(q)
+}
+
+// BlockUser refuses logins for a user until it is unlocked by an admin.
+func BlockUser(db *sql.DB, actor Actor, username string) error {
+	return auditUserChange(db, actor, AuditUserBlock, username, func(tx *sql.Tx) error {
+		return blockUser(tx, username)
+	})
+}
+
+func blockUser(q querier, username string) error {
+	res, err := q.Exec(
+		`UPDATE user_status
+		SET blocked = 1
+		WHERE user_id = (SELECT id FROM users WHERE username = ?)`,
+		username,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+	return BumpUsersVersion(q)
+}
+
+// UserInfo is the structured form of a user's state, for callers that
+// need more than the one-line status of ListUserByUsername.
+// Zero times are left out of its JSON form.
+type UserInfo struct {
+	Username    string    `json:"username"`
+	Group       string    `json:"group"`
+	Active      bool      `json:"active"`
+	Blocked     bool      `json:"blocked"`
+	LockedUntil time.Time `json:"locked_until,omitzero"` // zero = not locked
+	CreatedAt   time.Time `json:"created_at,omitzero"`
+	UserExpiry
+}
+
+func GetUserInfo(db *sql.DB, username string) (*UserInfo, error) {
+	var (
+		u           UserInfo
+		active      int
+		blocked     int
+		lockedUntil sql.NullTime
+		createdAt   sql.NullTime
+	)
+	err := db.QueryRow(
+		`SELECT users.username, users.group_name, users.created_at,
+			user_status.active, user_status.blocked, user_status.locked_until
+		FROM users JOIN user_status ON users.id = user_status.user_id
+		WHERE users.username = ?`,
+		username,
+	).Scan(&u.Username, &u.Group, &createdAt, &active, &blocked, &lockedUntil)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	u.Active = active == 1
+	u.Blocked = blocked == 1
+	if lockedUntil.Valid && time.Now().Before(lockedUntil.Time) {
+		u.LockedUntil = lockedUntil.Time
+	}
+	if createdAt.Valid {
+		u.CreatedAt = createdAt.Time
+	}
+
+	e, err := GetUserExpiry(db, username)
+	if err != nil {
+		return nil, err
+	}
+	u.UserExpiry = *e
+	return &u, nil
 }
@@ -0,0 +1,129 @@
+package system
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestUserLockUnknownUser(t *testing.T) {
+	db := openTestDB(t)
+
+	if err := CheckUserLock(db, "nobody"); err != ErrUserNotFound {
+		t.Errorf("CheckUserLock: %v, want ErrUserNotFound", err)
+	}
+	if err := LockUser(db, testActor, "nobody", time.Now().Add(time.Hour)); err != ErrUserNotFound {
+		t.Errorf("LockUser: %v, want ErrUserNotFound", err)
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM audit_log WHERE action = ?`, AuditUserLock); n != 0 {
+		t.Errorf("%d lock audit records for an unknown user", n)
+	}
+}
+
+func TestUserLockExpires(t *testing.T) {
+	db := openTestDB(t)
+	must(t, AddUser(db, testActor, "alice", "secret-one"))
+
+	if err := CheckUserLock(db, "alice"); err != nil {
+		t.Fatalf("new user: %v", err)
+	}
+
+	must(t, LockUser(db, testActor, "alice", time.Now().Add(300*time.Millisecond)))
+	if err := CheckUserLock(db, "alice"); err != ErrUserLocked {
+		t.Errorf("locked user: %v, want ErrUserLocked", err)
+	}
+
+	time.Sleep(400 * time.Millisecond)
+	if err := CheckUserLock(db, "alice"); err != nil {
+		t.Errorf("after the lock ran out: %v", err)
+	}
+
+	// a lock in the past never applies
+	must(t, LockUser(db, testActor, "alice", time.Now().Add(-time.Minute)))
+	if err := CheckUserLock(db, "alice"); err != nil {
+		t.Errorf("lock in the past: %v", err)
+	}
+
+	// blocking outlasts any lock, and unlock clears both
+	must(t, LockUser(db, testActor, "alice", time.Now().Add(time.Hour)))
+	must(t, BlockUser(db, testActor, "alice"))
+	if err := CheckUserLock(db, "alice"); err != ErrUserBlocked {
+		t.Errorf("blocked user: %v, want ErrUserBlocked", err)
+	}
+	must(t, UnlockUser(db, testActor, "alice"))
+	if err := CheckUserLock(db, "alice"); err != nil {
+		t.Errorf("after unlock: %v", err)
+	}
+
+	if n := countRows(t, db, `SELECT COUNT(*) FROM audit_log WHERE action = ? AND target = 'alice'`, AuditUserLock); n != 3 {
+		t.Errorf("%d lock audit records, want 3", n)
+	}
+}
+
+func TestCreateUserIsAtomic(t *testing.T) {
+	db := openTestDB(t)
+
+	if err := CreateUser(db, testActor, "alice", "secret-one", "night shift", true); err != ErrInvalidGroup {
+		t.Fatalf("bad group: %v, want ErrInvalidGroup", err)
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM users`); n != 0 {
+		t.Error("a failed create left a user behind")
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM user_status`); n != 0 {
+		t.Error("a failed create left a status row behind")
+	}
+	if n := countRows(t, db, `SELECT COUNT(*) FROM audit_log`); n != 0 {
+		t.Errorf("a failed create wrote %d audit records", n)
+	}
+
+	must(t, CreateUser(db, testActor, "alice", "secret-one", " staff ", true))
+	info, err := GetUserInfo(db, "alice")
+	must(t, err)
+	if !info.Active || info.Group != "staff" {
+		t.Errorf("created %+v", info)
+	}
+	for _, action := range []string{AuditUserAdd, AuditUserGroup, AuditUserActivate} {
+		if n := countRows(t, db, `SELECT COUNT(*) FROM audit_log WHERE action = ? AND target = 'alice'`, action); n != 1 {
+			t.Errorf("%d %s audit records, want 1", n, action)
+		}
+	}
+
+	if err := CreateUser(db, testActor, "alice", "secret-two", "", false); err != ErrUserExists {
+		t.Errorf("duplicate: %v, want ErrUserExists", err)
+	}
+}
+
+func TestDeleteUserMatchesPolicyRemove(t *testing.T) {
+	dependents := func(t *testing.T, db *sql.DB) int {
+		t.Helper()
+		return countRows(t, db, `SELECT
+			(SELECT COUNT(*) FROM users) +
+			(SELECT COUNT(*) FROM user_status) +
+			(SELECT COUNT(*) FROM user_quotas) +
+			(SELECT COUNT(*) FROM rate_limits WHERE scope = 'user')`)
+	}
+	seed := func(t *testing.T) *sql.DB {
+		db := openTestDB(t)
+		must(t, AddUser(db, testActor, "alice", "secret-one"))
+		must(t, SetUserQuota(db, testActor, "alice", 1<<30, QuotaMonthly, 1))
+		must(t, SetRateLimit(db, testActor, RateUser, "alice", 1000, 1000))
+		return db
+	}
+
+	cli := seed(t)
+	must(t, DeleteUser(cli, testActor, "alice"))
+	if n := dependents(t, cli); n != 0 {
+		t.Errorf("DeleteUser left %d rows behind", n)
+	}
+
+	pol := seed(t)
+	_, err := ApplyPolicy(pol, testActor, &Policy{}, true)
+	must(t, err)
+	if n := dependents(t, pol); n != 0 {
+		t.Errorf("policy prune left %d rows behind", n)
+	}
+
+	if err := DeleteUser(cli, testActor, "alice"); err != ErrUserNotFound {
+		t.Errorf("second delete: %v, want ErrUserNotFound", err)
+	}
+}
@@ -54,64 +54,109 @@ func normalizeCIDR(input string) (string, error) {
 
 	_, _, err := net.ParseCIDR(input)
 	if err != nil {
-		return "", fmt.Errorf("invalid IP/CIDR: %s", input)
+		return "", fmt.Errorf("%w: %s", ErrInvalidCIDR, input)
 	}
 	return input, nil
 }
 
-// add if not exist , if exist grant access
-func AllowIP(db *sql.DB, input string) error {
-	cidr, err := normalizeCIDR(input)
+// whitelistState is a rule's state for the audit log: "enabled",
+// "disabled" or "" when there is no such rule.
+func whitelistState(q querier, cidr string) (string, error) {
+	var enabled int
+	err := q.QueryRow(`SELECT enabled FROM whitelist WHERE cidr = ?`, cidr).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
 	if err != nil {
-		return err
+		return "", err
+	}
+	if enabled == 1 {
+		return "enabled", nil
 	}
+	return "disabled", nil
+}
 
-	_, err = db.Exec(`
-		INSERT INTO whitelist (cidr, enabled)
-		VALUES (?, 1)
-		ON CONFLICT(cidr) DO UPDATE SET enabled = 1
-	`, cidr)
+// add if not exist , if exist grant access
+func AllowIP(db *sql.DB, actor Actor, input string) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		cidr, err := normalizeCIDR(input)
+		if err != nil {
+			return err
+		}
+		old, err := whitelistState(tx, cidr)
+		if err != nil {
+			return err
+		}
 
-	return err
+		_, err = tx.Exec(`
+			INSERT INTO whitelist (cidr, enabled)
+			VALUES (?, 1)
+			ON CONFLICT(cidr) DO UPDATE SET enabled = 1
+		`, cidr)
+		if err != nil {
+			return err
+		}
+
+		return recordAudit(tx, actor, AuditWhitelistAllow, cidr, old, "enabled")
+	})
 }
 
 // revoke access
-func BlockIP(db *sql.DB, input string) error {
-	cidr, err := normalizeCIDR(input)
-	if err != nil {
-		return err
-	}
+func BlockIP(db *sql.DB, actor Actor, input string) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		cidr, err := normalizeCIDR(input)
+		if err != nil {
+			return err
+		}
+		old, err := whitelistState(tx, cidr)
+		if err != nil {
+			return err
+		}
 
-	_, err = db.Exec(`
-		UPDATE whitelist SET enabled = 0 WHERE cidr = ?
-	`, cidr)
+		res, err := tx.Exec(`
+			UPDATE whitelist SET enabled = 0 WHERE cidr = ?
+		`, cidr)
+		if err != nil {
+			return err
+		}
 
-	return err
+		// blocking an IP that was never listed changes nothing
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+		return recordAudit(tx, actor, AuditWhitelistBlock, cidr, old, "disabled")
+	})
 }
 
 // hard remove
-func DeleteIP(db *sql.DB, input string) error {
-	cidr, err := normalizeCIDR(input)
-	if err != nil {
-		return err
-	}
+func DeleteIP(db *sql.DB, actor Actor, input string) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		cidr, err := normalizeCIDR(input)
+		if err != nil {
+			return err
+		}
+		old, err := whitelistState(tx, cidr)
+		if err != nil {
+			return err
+		}
 
-	res, err := db.Exec(`DELETE FROM whitelist WHERE cidr = ?`, cidr)
-	if err != nil {
-		return err
-	}
+		res, err := tx.Exec(`DELETE FROM whitelist WHERE cidr = ?`, cidr)
+		if err != nil {
+			return err
+		}
 
-	n, _ := res.RowsAffected()
-	if n == 0 {
-		return fmt.Errorf("ip not found: %s", cidr)
-	}
+		n, _ := res.RowsAffected()
+		if n == 0 {
+			return fmt.Errorf("ip %w: %s", ErrRuleNotFound, cidr)
+		}
 
-	return nil
+		return recordAudit(tx, actor, AuditWhitelistDelete, cidr, old, "")
+	})
 }
 
 type WhitelistEntry struct {
-	CIDR    string
-	Enabled bool
+	CIDR    string `json:"cidr"`
+	Enabled bool   `json:"enabled"`
 }
 
 func ListWhitelist(db *sql.DB) ([]WhitelistEntry, error) {
@@ -135,10 +180,10 @@ func ListWhitelist(db *sql.DB) ([]WhitelistEntry, error) {
 }
 
 type WhitelistStatus struct {
-	Version  int64
-	Enabled  int
-	Disabled int
-	Total    int
+	Version  int64 `json:"version"`
+	Enabled  int   `json:"enabled"`
+	Disabled int   `json:"disabled"`
+	Total    int   `json:"total"`
 }
 
 func GetWhitelistStatus(db *sql.DB) (*WhitelistStatus, error) {
@@ -165,11 +210,18 @@ func GetWhitelistStatus(db *sql.DB) (*WhitelistStatus, error) {
 	return &s, nil
 }
 
-func ClearWhitelist(db *sql.DB) error {
-	_, err := db.Exec(`
-		UPDATE whitelist
-		SET enabled = 0
-		WHERE cidr NOT IN ('127.0.0.1/32', '::1/128')
-	`)
-	return err
+func ClearWhitelist(db *sql.DB, actor Actor) error {
+	return inTx(db, func(tx *sql.Tx) error {
+		res, err := tx.Exec(`
+			UPDATE whitelist
+			SET enabled = 0
+			WHERE enabled = 1 AND cidr NOT IN ('127.0.0.1/32', '::1/128')
+		`)
+		if err != nil {
+			return err
+		}
+
+		n, _ := res.RowsAffected()
+		return recordAudit(tx, actor, AuditWhitelistClear, "*", "", fmt.Sprintf("disabled (%d changed)", n))
+	})
 }
@@ -0,0 +1,175 @@
+package web
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"proxychan/internal/system"
+)
+
+// totpIssuer is the account label shown in authenticator apps.
+const totpIssuer = "ProxyChan"
+
+// The account page lets every admin, whatever their role, manage their
+// own two-factor login. Other admins' 2FA can only be reset from the CLI.
+// Wrong codes count against the account in the login throttle, so a
+// hijacked session can't guess its way to disabling 2FA.
+
+// codeThrottleKey keeps per-account code failures apart from the
+// per-IP login failures in the same throttle.
+func codeThrottleKey(username string) string {
+	return "2fa:" + username
+}
+
+// codeLocked answers 429 if the account made too many wrong code
+// attempts.
+func codeLocked(w http.ResponseWriter, lt *loginThrottle, username string) bool {
+	left := lt.lockedFor(codeThrottleKey(username), time.Now())
+	if left <= 0 {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(left.Seconds())+1))
+	http.Error(w, "too many wrong codes, try again later", http.StatusTooManyRequests)
+	return true
+}
+
+// codeResult records a code attempt in the throttle.
+func codeResult(lt *loginThrottle, p ConnectionProvider, username string, err error) {
+	key := codeThrottleKey(username)
+	if err == nil {
+		lt.success(key)
+		return
+	}
+	if errors.Is(err, system.ErrInvalidTOTP) && lt.fail(key, time.Now()) {
+		p.Warnf("two-factor changes locked for admin %s after %d wrong codes", username, loginMaxFailures)
+	}
+}
+
+func accountHTMLHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+		html, err := staticFS.ReadFile("static/account.html")
+
+		if err != nil {
+			http.Error(w, "failed to load html", http.StatusInternalServerError)
+			return
+		}
+
+		w.Write(html)
+	}
+}
+
+func account2FAStatusHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		acct, _ := adminFrom(r)
+		left, err := system.RecoveryCodesLeft(db, acct.Username)
+		if err != nil {
+			http.Error(w, "failed to load 2fa status", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"username":            acct.Username,
+			"role":                acct.Role,
+			"enabled":             acct.TwoFactor,
+			"recovery_codes_left": left,
+		})
+	}
+}
+
+// begin2FAHandler returns a new secret and its otpauth:// URI. They are
+// not stored anywhere the page can read them back later.
+func begin2FAHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		acct, _ := adminFrom(r)
+		secret, uri, err := system.BeginAdminTOTP(db, acct.Username, totpIssuer)
+		if err != nil {
+			httpSystemError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"secret": secret,
+			"uri":    uri,
+		})
+	}
+}
+
+func confirm2FAHandler(db *sql.DB, lt *loginThrottle, p ConnectionProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		acct, _ := adminFrom(r)
+		if codeLocked(w, lt, acct.Username) {
+			return
+		}
+		codes, err := system.ConfirmAdminTOTP(db, actorFor(r), acct.Username, r.FormValue("code"))
+		codeResult(lt, p, acct.Username, err)
+		if err != nil {
+			httpSystemError(w, err)
+			return
+		}
+		p.Infof("admin %s enabled two-factor login", acct.Username)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(map[string][]string{
+			"recovery_codes": codes,
+		})
+	}
+}
+
+// disable2FAHandler turns 2FA off after checking a current code, so a
+// hijacked session alone can't remove it.
+func disable2FAHandler(db *sql.DB, lt *loginThrottle, p ConnectionProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		acct, _ := adminFrom(r)
+		if codeLocked(w, lt, acct.Username) {
+			return
+		}
+		_, err := system.VerifyAdminSecondFactor(db, acct.Username, r.FormValue("code"))
+		codeResult(lt, p, acct.Username, err)
+		if err != nil {
+			httpSystemError(w, err)
+			return
+		}
+		if err := system.ResetAdminTOTP(db, actorFor(r), acct.Username); err != nil {
+			httpSystemError(w, err)
+			return
+		}
+		p.Infof("admin %s disabled two-factor login", acct.Username)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
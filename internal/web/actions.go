@@ -0,0 +1,83 @@
+package web
+
+import (
+	"database/sql"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"proxychan/internal/system"
+)
+
+// Policy changes shared by the admin pages and the REST API. They make
+// the same internal/system calls as the CLI commands, including the
+// version bump the CLI does itself for the whitelist.
+
+// setWhitelistEntry is allow-ip (enabled) or block-ip (disabled).
+func setWhitelistEntry(db *sql.DB, actor system.Actor, cidr string, enabled bool) error {
+	var err error
+	if enabled {
+		err = system.AllowIP(db, actor, cidr)
+	} else {
+		err = system.BlockIP(db, actor, cidr)
+	}
+	if err != nil {
+		return err
+	}
+	return system.BumpWhitelistVersion(db)
+}
+
+// deleteWhitelistEntry is del-ip.
+func deleteWhitelistEntry(db *sql.DB, actor system.Actor, cidr string) error {
+	if err := system.DeleteIP(db, actor, cidr); err != nil {
+		return err
+	}
+	return system.BumpWhitelistVersion(db)
+}
+
+// setDenyRule is block-dest (enabled) or allow-dest (disabled).
+func setDenyRule(db *sql.DB, actor system.Actor, pattern string, enabled bool) error {
+	if enabled {
+		return system.DenyDestination(db, actor, pattern)
+	}
+	return system.AllowDestination(db, actor, pattern)
+}
+
+// ruleKey canonicalises a stored rule the way the server keys its hit
+// counters: networks as net.IPNet strings, single IPs as /32 or /128.
+func ruleKey(pattern string) string {
+	if _, n, err := net.ParseCIDR(pattern); err == nil {
+		return n.String()
+	}
+	if ip := net.ParseIP(pattern); ip != nil {
+		bits := 128
+		if ip.To4() != nil {
+			bits = 32
+		}
+		n := net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		return n.String()
+	}
+	return strings.ToLower(pattern)
+}
+
+// httpSystemError maps internal/system errors to plain-text responses
+// for the admin pages.
+func httpSystemError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, system.ErrUserNotFound),
+		errors.Is(err, system.ErrRuleNotFound),
+		errors.Is(err, system.ErrAdminNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, system.ErrUserExists),
+		errors.Is(err, system.ErrTOTPEnabled),
+		errors.Is(err, system.ErrTOTPNotPending):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, system.ErrInvalidCIDR),
+		errors.Is(err, system.ErrInvalidPattern),
+		errors.Is(err, system.ErrInvalidTOTP):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
@@ -2,40 +2,162 @@ package web
 
 import (
 	"context"
+	"crypto/tls"
 	"database/sql"
+	"net"
 	"net/http"
+	"os"
 	"proxychan/internal/models"
+	"proxychan/internal/system"
+	"time"
 )
 
 type ConnectionProvider interface {
 	SnapshotConnections() []models.ActiveConn
 	GroupConnectionsByIP([]models.ActiveConn) []models.ConnGroup
+	ConnLimits() models.ConnLimitStatus
+	KillConn(id uint64) bool
+	KillUser(username string) int
+	KillSource(ip string) int
+	RuleHits() models.RuleHits
+	MetricsHandler() http.Handler
+	SubscribeEvents(models.EventFilter) EventSubscription
+	Infof(format string, args ...any)
 	Warnf(format string, args ...any)
 }
 
-func RunAdminEndpoint(ctx context.Context, p ConnectionProvider, db *sql.DB) {
+// AdminOptions configures the admin endpoint. Zero session lifetimes
+// fall back to 30m idle / 12h absolute, and an empty Listen to
+// defaultAdminListen.
+//
+// TLS serves HTTPS with TLSCert/TLSKey, or with a self-signed
+// certificate kept in the data directory when they are empty. A
+// non-empty Allow limits which source IPs may connect; loopback is
+// always allowed so the local CLI keeps working.
+type AdminOptions struct {
+	SessionIdle time.Duration
+	SessionMax  time.Duration
+
+	Listen  string
+	TLS     bool
+	TLSCert string
+	TLSKey  string
+	Allow   []net.IPNet
+
+	// Control, if set, is the service's control channel, served under
+	// ControlPrefix to callers sending the internal secret. Linux leaves
+	// it nil and uses the control socket instead.
+	Control http.Handler
+}
+
+const defaultAdminListen = "127.0.0.1:6060"
+
+// Admin server timeouts. There is no write timeout: the event stream
+// stays open for as long as the page does.
+const (
+	adminReadHeaderTimeout = 10 * time.Second
+	adminIdleTimeout       = 2 * time.Minute
+)
+
+func RunAdminEndpoint(ctx context.Context, p ConnectionProvider, db *sql.DB, opts AdminOptions) {
+	sessions := newSessionStore(opts.SessionIdle, opts.SessionMax)
+	throttle := newLoginThrottle()
+	go sessionSweeper(ctx, p, sessions, throttle)
+
 	app := http.NewServeMux()
 
 	app.Handle("/static/", http.FileServer(http.FS(staticFS)))
 	app.HandleFunc("/login", adminLoginPage())
-	app.HandleFunc("/login/submit", adminLoginHandler(db))
+	app.HandleFunc("/login/submit", adminLoginHandler(db, sessions, throttle, p))
 	app.HandleFunc("/connections", connectionsHTMLHandler())
 	app.HandleFunc("/connections/by-ip", connectionsJSONHandler(p))
-	app.HandleFunc("/logout", adminLogoutHandler())
+	app.HandleFunc("/connections/limits", connectionLimitsJSONHandler(p))
+	app.HandleFunc("/connections/events", eventStreamHandler(p, db, sessions))
+	app.HandleFunc("/connections/kill", killConnHandler(p))
+	app.HandleFunc("/connections/kill-user", killUserHandler(p))
+	app.HandleFunc("/connections/kill-source", killSourceHandler(p))
+	app.Handle("/metrics", p.MetricsHandler())
+	app.HandleFunc("/bans", bansHTMLHandler())
+	app.HandleFunc("/bans/list", bansJSONHandler(db))
+	app.HandleFunc("/users", usersHTMLHandler())
+	app.HandleFunc("/users/list", usersJSONHandler(db))
+	app.HandleFunc("/users/add", addUserHandler(db))
+	app.HandleFunc("/users/activate", userActionHandler(db, system.ActivateUser))
+	app.HandleFunc("/users/deactivate", userActionHandler(db, system.DeactivateUser))
+	app.HandleFunc("/users/delete", userActionHandler(db, system.DeleteUser))
+	app.HandleFunc("/users/passwd", passwdUserHandler(db))
+	app.HandleFunc("/policies", policiesHTMLHandler())
+	app.HandleFunc("/policies/list", policiesJSONHandler(p, db))
+	app.HandleFunc("/policies/whitelist", whitelistActionHandler(db))
+	app.HandleFunc("/policies/denylist", denylistActionHandler(db))
+	app.HandleFunc("/audit", auditHTMLHandler())
+	app.HandleFunc("/audit/list", auditJSONHandler(db))
+	app.HandleFunc("/sessions", sessionsHTMLHandler())
+	app.HandleFunc("/sessions/list", sessionsJSONHandler(sessions))
+	app.HandleFunc("/sessions/revoke", revokeSessionHandler(sessions, p))
+	app.HandleFunc("/me", meHandler())
+	app.HandleFunc("/account", accountHTMLHandler())
+	app.HandleFunc("/account/2fa", account2FAStatusHandler(db))
+	app.HandleFunc("/account/2fa/begin", begin2FAHandler(db))
+	app.HandleFunc("/account/2fa/confirm", confirm2FAHandler(db, throttle, p))
+	app.HandleFunc("/account/2fa/disable", disable2FAHandler(db, throttle, p))
+	app.HandleFunc("/logout", adminLogoutHandler(sessions))
+	registerAPI(app, p, db)
 
-	handler := adminGate(db, app)
+	handler := adminSourceFilter(opts.Allow, p, adminGate(db, sessions, app, opts.Control))
+
+	if opts.Listen == "" {
+		opts.Listen = defaultAdminListen
+	}
 
 	srv := &http.Server{
-		Addr:    "127.0.0.1:6060",
-		Handler: handler,
+		Handler:           handler,
+		ReadHeaderTimeout: adminReadHeaderTimeout,
+		IdleTimeout:       adminIdleTimeout,
 	}
 
+	rt := system.AdminRuntime{PID: os.Getpid()}
+	if opts.TLS {
+		cert, fingerprint, err := loadAdminCert(opts)
+		if err != nil {
+			p.Warnf("admin endpoint disabled: %v", err)
+			return
+		}
+		srv.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+		rt.CertSHA256 = fingerprint
+	}
+
+	ln, err := net.Listen("tcp", opts.Listen)
+	if err != nil {
+		p.Warnf("admin endpoint error: %v", err)
+		return
+	}
+
+	rt.URL = adminClientURL(opts.Listen, ln.Addr(), opts.TLS)
+	if err := system.WriteAdminRuntime(rt); err != nil {
+		p.Warnf("failed to publish admin endpoint address: %v", err)
+	}
+	defer system.RemoveAdminRuntime(rt.PID)
+
+	if !opts.TLS && !isLoopbackListen(ln.Addr()) {
+		p.Warnf("admin endpoint on %s is plain HTTP; use --admin-tls to protect logins", ln.Addr())
+	}
+	p.Infof("admin endpoint on %s", rt.URL)
+
 	go func() {
 		<-ctx.Done()
 		_ = srv.Close()
 	}()
 
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	if opts.TLS {
+		err = srv.ServeTLS(ln, "", "")
+	} else {
+		err = srv.Serve(ln)
+	}
+	if err != nil && err != http.ErrServerClosed {
 		p.Warnf("admin endpoint error: %v", err)
 	}
 }
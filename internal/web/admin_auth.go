@@ -1,64 +1,153 @@
 package web
 
 import (
-	"crypto/rand"
+	"crypto/subtle"
 	"database/sql"
-	"encoding/hex"
+	"errors"
 	"net/http"
 	"proxychan/internal/system"
 	"strings"
-	"sync"
-	"time"
 )
 
-const adminCookieName = "proxychan_admin"
+const (
+	adminCookieName = "proxychan_admin"
 
-var (
-	adminTokens   = make(map[string]time.Time)
-	adminTokensMu sync.RWMutex
-)
+	// csrfCookieName is readable by the page scripts, which echo it in
+	// the csrfHeader of every state-changing request. The gate compares
+	// it to the token stored with the session, not to the cookie.
+	csrfCookieName = "proxychan_csrf"
+	csrfHeader     = "X-CSRF-Token"
+
+	// loginCSRFCookieName guards the login form itself, before there is
+	// a session (double-submit: cookie and hidden field must match).
+	loginCSRFCookieName = "proxychan_login_csrf"
 
-// issueAdminToken creates a new in-memory admin auth token
-func issueAdminToken() string {
-	b := make([]byte, 32)
-	_, _ = rand.Read(b)
-	token := hex.EncodeToString(b)
+	// backgroundHeader marks requests the pages make on their own
+	// (polls); event streams, which can't set headers, pass
+	// ?background=1 instead. Neither counts as session activity.
+	backgroundHeader = "X-ProxyChan-Background"
 
-	adminTokensMu.Lock()
-	adminTokens[token] = time.Now()
-	adminTokensMu.Unlock()
+	// ControlPrefix and InternalSecretHeader are the CLI's control
+	// channel on platforms without the control socket.
+	ControlPrefix        = "/control"
+	InternalSecretHeader = "X-ProxyChan-Internal"
+)
 
-	return token
+// adminSessionFor returns the live session of a request's admin cookie.
+func adminSessionFor(st *sessionStore, r *http.Request) (adminSession, bool) {
+	c, err := r.Cookie(adminCookieName)
+	if err != nil {
+		return adminSession{}, false
+	}
+	return st.lookup(c.Value, !isBackground(r))
 }
 
-// isAdminAuthenticated checks whether request has a valid admin cookie
-func isAdminAuthenticated(r *http.Request) bool {
+// stillAuthorized re-checks the session or API token behind a request
+// that stays open, such as an event stream: it fails once the session
+// ends or the account is deleted, or the token is revoked or expires.
+// API requests are checked by token only, so st may be nil for them.
+func stillAuthorized(db *sql.DB, st *sessionStore, r *http.Request) bool {
+	if tok, ok := r.Context().Value(apiTokenCtxKey{}).(*system.APIToken); ok {
+		active, err := system.APITokenActive(db, tok)
+		return err == nil && active
+	}
+	if st == nil {
+		return false
+	}
+
 	c, err := r.Cookie(adminCookieName)
 	if err != nil {
 		return false
 	}
+	sess, ok := st.lookup(c.Value, false)
+	if !ok {
+		return false
+	}
+	_, err = system.GetAdmin(db, sess.Username)
+	return err == nil
+}
+
+func hasBearer(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+func isBackground(r *http.Request) bool {
+	return r.Header.Get(backgroundHeader) != "" || r.URL.Query().Get("background") == "1"
+}
 
-	adminTokensMu.RLock()
-	_, ok := adminTokens[c.Value]
-	adminTokensMu.RUnlock()
+func tokensEqual(a, b string) bool {
+	return a != "" && subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
 
-	return ok
+// csrfValid checks the CSRF header of a state-changing browser request
+// against the session. Safe methods need no token.
+func csrfValid(r *http.Request, sess adminSession) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	got := r.Header.Get(csrfHeader)
+	if got == "" {
+		got = r.FormValue("csrf_token")
+	}
+	return tokensEqual(got, sess.csrf)
 }
 
-func adminGate(db *sql.DB, app http.Handler) http.Handler {
+func adminGate(db *sql.DB, st *sessionStore, app *http.ServeMux, control http.Handler) http.Handler {
+	if control != nil {
+		control = http.StripPrefix(ControlPrefix, control)
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// allow static assets unconditionally
 		if strings.HasPrefix(r.URL.Path, "/static/") {
 			app.ServeHTTP(w, r)
 			return
 		}
-		sec, err := system.InternalAdminSecret()
-		if err == nil && r.Header.Get("X-ProxyChan-Internal") == sec {
+		// the internal secret opens the control channel only, never the
+		// pages or the API
+		if strings.HasPrefix(r.URL.Path, ControlPrefix+"/") {
+			if control == nil {
+				http.NotFound(w, r)
+				return
+			}
+			sec, err := system.InternalAdminSecret()
+			if err != nil || !tokensEqual(r.Header.Get(InternalSecretHeader), sec) {
+				http.NotFound(w, r)
+				return
+			}
+			control.ServeHTTP(w, r)
+			return
+		}
+
+		// REST API: bearer tokens only, the browser cookie is not accepted.
+		// /metrics takes either, so Prometheus can scrape it with a token.
+		if strings.HasPrefix(r.URL.Path, apiPrefix+"/") || (r.URL.Path == "/metrics" && hasBearer(r)) {
+			if r.URL.Path == apiPrefix+"/openapi.json" {
+				app.ServeHTTP(w, r)
+				return
+			}
+			r, tok, ok := apiAuthenticated(db, w, r)
+			if !ok {
+				return
+			}
+			// no pattern means the mux answers with a redirect or 405
+			if _, pattern := app.Handler(r); pattern != "" {
+				need, known := apiRoles[pattern]
+				if !known {
+					writeAPIError(w, http.StatusNotFound, "NOT_FOUND", "no such endpoint")
+					return
+				}
+				if !tok.Role.Allows(need) {
+					writeAPIError(w, http.StatusForbidden, "FORBIDDEN", "requires "+string(need)+" role")
+					return
+				}
+			}
 			app.ServeHTTP(w, r)
 			return
 		}
 
-		ok, err := system.AdminPasswordConfigured(db)
+		ok, err := system.AdminAccountsConfigured(db)
 		if err != nil {
 			http.Error(w, "admin auth error", http.StatusInternalServerError)
 			return
@@ -71,18 +160,46 @@ func adminGate(db *sql.DB, app http.Handler) http.Handler {
 
 		// allow login endpoints without auth
 		if r.URL.Path == "/login" ||
-			r.URL.Path == "/login/submit" ||
-			r.URL.Path == "/logout" {
+			r.URL.Path == "/login/submit" {
 			app.ServeHTTP(w, r)
 			return
 		}
 
 		// browser auth path
-		if isAdminAuthenticated(r) {
-			app.ServeHTTP(w, r)
+		sess, ok := adminSessionFor(st, r)
+		if !ok {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		// the role is read on every request so role changes and deleted
+		// accounts take effect without waiting for the session to expire
+		acct, err := system.GetAdmin(db, sess.Username)
+		if errors.Is(err, system.ErrAdminNotFound) {
+			st.revokeUser(sess.Username)
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err != nil {
+			http.Error(w, "admin auth error", http.StatusInternalServerError)
+			return
+		}
+
+		if !csrfValid(r, sess) {
+			http.Error(w, "invalid csrf token", http.StatusForbidden)
+			return
+		}
+
+		need, known := routeRoles[r.URL.Path]
+		if !known {
+			http.NotFound(w, r)
+			return
+		}
+		if !acct.Role.Allows(need) {
+			http.Error(w, "forbidden: requires "+string(need)+" role", http.StatusForbidden)
 			return
 		}
 
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		app.ServeHTTP(w, withAdmin(r, acct))
 	})
 }
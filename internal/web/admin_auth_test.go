@@ -0,0 +1,311 @@
+package web
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"proxychan/internal/system"
+)
+
+const testActor = system.Actor("cli:test")
+
+// testProvider is a ConnectionProvider for handlers that only log.
+type testProvider struct{ ConnectionProvider }
+
+func (testProvider) Infof(string, ...any) {}
+func (testProvider) Warnf(string, ...any) {}
+
+type testAdmin struct {
+	db       *sql.DB
+	sessions *sessionStore
+	throttle *loginThrottle
+	handler  http.Handler
+}
+
+// newTestAdmin builds the admin gate over the real login and API
+// handlers, with every browser route answering 200.
+func newTestAdmin(t *testing.T) *testAdmin {
+	t.Helper()
+	db, err := system.OpenDB(filepath.Join(t.TempDir(), "proxychan.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, a := range []struct {
+		name string
+		role system.AdminRole
+	}{
+		{"root", system.RoleAdmin},
+		{"ops", system.RoleOperator},
+		{"watcher", system.RoleViewer},
+	} {
+		must(t, system.AddAdmin(db, testActor, a.name, "password-"+a.name, a.role))
+	}
+
+	ta := &testAdmin{
+		db:       db,
+		sessions: newSessionStore(time.Minute, time.Hour),
+		throttle: newLoginThrottle(),
+	}
+
+	app := http.NewServeMux()
+	for route := range routeRoles {
+		app.HandleFunc(route, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		})
+	}
+	app.HandleFunc("/login/submit", adminLoginHandler(db, ta.sessions, ta.throttle, testProvider{}))
+	registerAPI(app, testProvider{}, db)
+
+	ta.handler = adminGate(db, ta.sessions, app, nil)
+	return ta
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// login opens a session for an admin account and returns its cookie
+// token and CSRF token.
+func (ta *testAdmin) login(t *testing.T, username string) (token, csrf string) {
+	t.Helper()
+	acct, err := system.GetAdmin(ta.db, username)
+	must(t, err)
+	return ta.sessions.issue(httptest.NewRequest(http.MethodGet, "/", nil), acct)
+}
+
+func (ta *testAdmin) do(r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ta.handler.ServeHTTP(w, r)
+	return w
+}
+
+func browserRequest(method, path, token, csrf string) *http.Request {
+	r := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		r.AddCookie(&http.Cookie{Name: adminCookieName, Value: token})
+	}
+	if csrf != "" {
+		r.Header.Set(csrfHeader, csrf)
+	}
+	return r
+}
+
+func assertRedirectToLogin(t *testing.T, w *httptest.ResponseRecorder) {
+	t.Helper()
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/login" {
+		t.Errorf("got %d to %q, want a redirect to /login", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestGateCSRF(t *testing.T) {
+	ta := newTestAdmin(t)
+	token, csrf := ta.login(t, "root")
+	_, other := ta.login(t, "root")
+
+	for _, tc := range []struct {
+		name   string
+		method string
+		csrf   string
+		form   bool
+		want   int
+	}{
+		{"missing", http.MethodPost, "", false, http.StatusForbidden},
+		{"wrong", http.MethodPost, "not-the-token", false, http.StatusForbidden},
+		{"another session's", http.MethodPost, other, false, http.StatusForbidden},
+		{"right header", http.MethodPost, csrf, false, http.StatusOK},
+		{"right form field", http.MethodPost, csrf, true, http.StatusOK},
+		{"safe method needs none", http.MethodGet, "", false, http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := browserRequest(tc.method, "/users/delete", token, "")
+			if tc.form {
+				r = httptest.NewRequest(tc.method, "/users/delete",
+					strings.NewReader(url.Values{"csrf_token": {tc.csrf}}.Encode()))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				r.AddCookie(&http.Cookie{Name: adminCookieName, Value: token})
+			} else if tc.csrf != "" {
+				r.Header.Set(csrfHeader, tc.csrf)
+			}
+			if w := ta.do(r); w.Code != tc.want {
+				t.Errorf("got %d, want %d", w.Code, tc.want)
+			}
+		})
+	}
+
+	// the CSRF cookie alone is not a token; the gate compares with the
+	// session, not with whatever the browser sends back
+	r := browserRequest(http.MethodPost, "/users/delete", token, "forged")
+	r.AddCookie(&http.Cookie{Name: csrfCookieName, Value: "forged"})
+	if w := ta.do(r); w.Code != http.StatusForbidden {
+		t.Errorf("matching cookie and header: %d, want 403", w.Code)
+	}
+}
+
+func TestGateSessionExpiry(t *testing.T) {
+	ta := newTestAdmin(t)
+
+	t.Run("no session", func(t *testing.T) {
+		assertRedirectToLogin(t, ta.do(browserRequest(http.MethodGet, "/connections", "", "")))
+		assertRedirectToLogin(t, ta.do(browserRequest(http.MethodGet, "/connections", "unknown", "")))
+	})
+
+	for _, tc := range []struct {
+		name string
+		age  func(s *adminSession)
+	}{
+		{"idle", func(s *adminSession) { s.LastSeen = s.LastSeen.Add(-2 * time.Minute) }},
+		{"max age", func(s *adminSession) { s.Created = s.Created.Add(-2 * time.Hour) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			token, csrf := ta.login(t, "root")
+			ta.sessions.mu.Lock()
+			tc.age(ta.sessions.sessions[token])
+			ta.sessions.mu.Unlock()
+
+			assertRedirectToLogin(t, ta.do(browserRequest(http.MethodGet, "/connections", token, csrf)))
+			if _, ok := ta.sessions.lookup(token, false); ok {
+				t.Error("expired session is still stored")
+			}
+		})
+	}
+
+	t.Run("activity keeps it alive", func(t *testing.T) {
+		token, csrf := ta.login(t, "root")
+		ta.sessions.mu.Lock()
+		ta.sessions.sessions[token].LastSeen = time.Now().Add(-50 * time.Second)
+		ta.sessions.mu.Unlock()
+
+		if w := ta.do(browserRequest(http.MethodGet, "/connections", token, csrf)); w.Code != http.StatusOK {
+			t.Fatalf("got %d", w.Code)
+		}
+		sess, _ := ta.sessions.lookup(token, false)
+		if time.Since(sess.LastSeen) > time.Second {
+			t.Error("a page request did not count as activity")
+		}
+	})
+
+	t.Run("background polls are not activity", func(t *testing.T) {
+		token, csrf := ta.login(t, "root")
+		seen := time.Now().Add(-50 * time.Second)
+		ta.sessions.mu.Lock()
+		ta.sessions.sessions[token].LastSeen = seen
+		ta.sessions.mu.Unlock()
+
+		r := browserRequest(http.MethodGet, "/connections/by-ip", token, csrf)
+		r.Header.Set(backgroundHeader, "1")
+		if w := ta.do(r); w.Code != http.StatusOK {
+			t.Fatalf("got %d", w.Code)
+		}
+		sess, _ := ta.sessions.lookup(token, false)
+		if !sess.LastSeen.Equal(seen) {
+			t.Error("a background poll reset the idle timer")
+		}
+	})
+
+	t.Run("deleted account", func(t *testing.T) {
+		must(t, system.AddAdmin(ta.db, testActor, "temp", "password-temp", system.RoleAdmin))
+		token, csrf := ta.login(t, "temp")
+		_, _ = ta.login(t, "temp")
+		must(t, system.DeleteAdmin(ta.db, testActor, "temp"))
+
+		assertRedirectToLogin(t, ta.do(browserRequest(http.MethodGet, "/connections", token, csrf)))
+		for _, s := range ta.sessions.list() {
+			if s.Username == "temp" {
+				t.Error("sessions of a deleted account were kept")
+			}
+		}
+	})
+}
+
+func TestLoginThrottle(t *testing.T) {
+	lt := newLoginThrottle()
+	start := time.Now()
+
+	// failures spread wider than the window never add up
+	for i := 0; i < 3*loginMaxFailures; i++ {
+		if lt.fail("192.0.2.1", start.Add(time.Duration(i)*(loginWindow/2))) {
+			t.Fatalf("locked after failure %d spread over the window", i+1)
+		}
+	}
+
+	for i := 1; i <= loginMaxFailures; i++ {
+		locked := lt.fail("192.0.2.2", start)
+		if locked != (i == loginMaxFailures) {
+			t.Fatalf("failure %d: locked = %v", i, locked)
+		}
+	}
+	if left := lt.lockedFor("192.0.2.2", start); left != loginLockout {
+		t.Errorf("locked for %v, want %v", left, loginLockout)
+	}
+	if left := lt.lockedFor("192.0.2.3", start); left != 0 {
+		t.Errorf("another source is locked for %v", left)
+	}
+	if left := lt.lockedFor("192.0.2.2", start.Add(loginLockout)); left != 0 {
+		t.Errorf("still locked for %v after the lockout", left)
+	}
+
+	// a success forgets earlier failures
+	for i := 1; i < loginMaxFailures; i++ {
+		lt.fail("192.0.2.4", start)
+	}
+	lt.success("192.0.2.4")
+	if lt.fail("192.0.2.4", start) {
+		t.Error("failures before a success still counted")
+	}
+}
+
+func TestLoginHandler(t *testing.T) {
+	ta := newTestAdmin(t)
+
+	submit := func(user, password, cookie, field string) *httptest.ResponseRecorder {
+		form := url.Values{"username": {user}, "password": {password}, "csrf_token": {field}}
+		r := httptest.NewRequest(http.MethodPost, "/login/submit", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != "" {
+			r.AddCookie(&http.Cookie{Name: loginCSRFCookieName, Value: cookie})
+		}
+		return ta.do(r)
+	}
+
+	if w := submit("root", "password-root", "", "token"); w.Code != http.StatusForbidden {
+		t.Errorf("no login CSRF cookie: %d, want 403", w.Code)
+	}
+	if w := submit("root", "password-root", "token", "other"); w.Code != http.StatusForbidden {
+		t.Errorf("mismatched login CSRF: %d, want 403", w.Code)
+	}
+
+	w := submit("root", "password-root", "token", "token")
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("good login: %d, want 303", w.Code)
+	}
+	var token string
+	for _, c := range w.Result().Cookies() {
+		if c.Name == adminCookieName {
+			token = c.Value
+		}
+	}
+	if sess, ok := ta.sessions.lookup(token, false); !ok || sess.Username != "root" {
+		t.Error("login did not open a session")
+	}
+
+	for i := 1; i <= loginMaxFailures; i++ {
+		if w := submit("root", "wrong", "token", "token"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("failure %d: %d, want 401", i, w.Code)
+		}
+	}
+	w = submit("root", "password-root", "token", "token")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("locked source: %d, want 429 with Retry-After", w.Code)
+	}
+}
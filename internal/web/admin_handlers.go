@@ -1,9 +1,12 @@
 package web
 
 import (
+	"bytes"
 	"database/sql"
 	"net/http"
 	"proxychan/internal/system"
+	"strconv"
+	"time"
 )
 
 func adminLoginPage() http.HandlerFunc {
@@ -13,39 +16,112 @@ func adminLoginPage() http.HandlerFunc {
 			http.Error(w, "failed to load auth page", 500)
 			return
 		}
+
+		csrf := randomToken()
+		http.SetCookie(w, &http.Cookie{
+			Name:     loginCSRFCookieName,
+			Value:    csrf,
+			Path:     "/login",
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+			MaxAge:   0,
+		})
+		html = bytes.ReplaceAll(html, []byte("{{csrf_token}}"), []byte(csrf))
+
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
 		w.Write(html)
 	}
 }
 
-func adminLoginHandler(db *sql.DB) http.HandlerFunc {
+func adminLoginHandler(db *sql.DB, st *sessionStore, lt *loginThrottle, p ConnectionProvider) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ip := remoteIP(r)
+		now := time.Now()
+		if left := lt.lockedFor(ip, now); left > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(left.Seconds())+1))
+			http.Error(w, "too many failed logins, try again later", http.StatusTooManyRequests)
+			return
+		}
+
 		if err := r.ParseForm(); err != nil {
 			http.Error(w, "bad request", 400)
 			return
 		}
 
+		c, err := r.Cookie(loginCSRFCookieName)
+		if err != nil || !tokensEqual(r.FormValue("csrf_token"), c.Value) {
+			http.Error(w, "invalid csrf token, reload the login page", http.StatusForbidden)
+			return
+		}
+
+		user := r.FormValue("username")
 		pwd := r.FormValue("password")
-		if pwd == "" {
-			http.Error(w, "missing password", 400)
+		if user == "" || pwd == "" {
+			http.Error(w, "missing username or password", 400)
 			return
 		}
 
-		if err := system.VerifyAdminCredentials(db, pwd); err != nil {
-			http.Error(w, "invalid password", http.StatusUnauthorized)
+		// every failure gets the same answer and counts the same, so a
+		// missing or wrong code doesn't confirm the password was right
+		loginFailed := func() {
+			if lt.fail(ip, now) {
+				p.Warnf("admin login locked for %s after %d failed attempts", ip, loginMaxFailures)
+			}
+			http.Error(w, "invalid username, password or two-factor code", http.StatusUnauthorized)
+		}
+
+		acct, err := system.VerifyAdminCredentials(db, user, pwd)
+		if err != nil {
+			loginFailed()
 			return
 		}
+		if acct.TwoFactor {
+			recovery, err := system.VerifyAdminSecondFactor(db, acct.Username, r.FormValue("otp"))
+			if err != nil {
+				loginFailed()
+				return
+			}
+			if recovery {
+				left, _ := system.RecoveryCodesLeft(db, acct.Username)
+				p.Warnf("admin %s logged in with a recovery code (%d left)", acct.Username, left)
+			}
+		}
+		lt.success(ip)
+		p.Infof("admin %s (%s) logged in from %s", acct.Username, acct.Role, ip)
 
-		token := issueAdminToken()
+		token, csrf := st.issue(r, acct)
 
 		http.SetCookie(w, &http.Cookie{
 			Name:     adminCookieName,
 			Value:    token,
 			Path:     "/",
 			HttpOnly: true,
+			Secure:   r.TLS != nil,
 			SameSite: http.SameSiteStrictMode,
 			MaxAge:   0,
 		})
+		http.SetCookie(w, &http.Cookie{
+			Name:     csrfCookieName,
+			Value:    csrf,
+			Path:     "/",
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteStrictMode,
+			MaxAge:   0,
+		})
+		http.SetCookie(w, &http.Cookie{
+			Name:     loginCSRFCookieName,
+			Value:    "",
+			Path:     "/login",
+			MaxAge:   -1,
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
 
 		http.Redirect(w, r, "/connections", http.StatusSeeOther)
 	}
@@ -79,7 +155,7 @@ func adminNotConfiguredHandler() http.HandlerFunc {
 <body>
 	<div class="box">
 		<h2>Admin Interface Disabled</h2>
-		<p>Configure admin password to access page.</p>
+		<p>Create an admin account to access this page:<br><code>proxychan add-admin &lt;name&gt; admin</code></p>
 	</div>
 </body>
 </html>
@@ -87,13 +163,16 @@ func adminNotConfiguredHandler() http.HandlerFunc {
 	}
 }
 
-func adminLogoutHandler() http.HandlerFunc {
+func adminLogoutHandler(st *sessionStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// remove token from memory
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// remove session from memory
 		if c, err := r.Cookie(adminCookieName); err == nil {
-			adminTokensMu.Lock()
-			delete(adminTokens, c.Value)
-			adminTokensMu.Unlock()
+			st.revokeToken(c.Value)
 		}
 
 		// expire cookie in browser
@@ -105,6 +184,13 @@ func adminLogoutHandler() http.HandlerFunc {
 			HttpOnly: true,
 			SameSite: http.SameSiteStrictMode,
 		})
+		http.SetCookie(w, &http.Cookie{
+			Name:     csrfCookieName,
+			Value:    "",
+			Path:     "/",
+			MaxAge:   -1,
+			SameSite: http.SameSiteStrictMode,
+		})
 
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 	}
@@ -0,0 +1,123 @@
+package web
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"proxychan/internal/system"
+)
+
+// loadAdminCert loads the configured certificate, or the self-signed
+// one, and returns it with the SHA-256 of its leaf, which the CLI pins.
+func loadAdminCert(opts AdminOptions) (tls.Certificate, string, error) {
+	certFile, keyFile := opts.TLSCert, opts.TLSKey
+	if certFile == "" {
+		host, _, _ := net.SplitHostPort(opts.Listen)
+		var err error
+		certFile, keyFile, err = system.EnsureAdminCert(host)
+		if err != nil {
+			return tls.Certificate{}, "", fmt.Errorf("self-signed certificate: %w", err)
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return tls.Certificate{}, "", fmt.Errorf("admin tls certificate: %w", err)
+	}
+	sum := sha256.Sum256(cert.Certificate[0])
+	return cert, hex.EncodeToString(sum[:]), nil
+}
+
+// adminClientURL is the base URL local CLI commands use to reach a
+// listener. The port is the bound one (the configured port may be 0);
+// a wildcard host is reached through loopback.
+func adminClientURL(listen string, addr net.Addr, useTLS bool) string {
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return scheme + "://" + addr.String()
+	}
+	host, _, _ := net.SplitHostPort(listen)
+	switch ip := net.ParseIP(host); {
+	case host == "" || (ip != nil && ip.To4() != nil && ip.IsUnspecified()):
+		host = "127.0.0.1"
+	case ip != nil && ip.IsUnspecified():
+		host = "::1"
+	}
+	return scheme + "://" + net.JoinHostPort(host, strconv.Itoa(tcp.Port))
+}
+
+func isLoopbackListen(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	return ok && tcp.IP != nil && tcp.IP.IsLoopback()
+}
+
+// refusedLogEvery is how often a refused admin source is logged; a
+// scanner would otherwise write a line per request.
+const refusedLogEvery = time.Minute
+
+// refusedLog rate-limits the refusal log per source IP.
+type refusedLog struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+// due reports whether a refusal from ip should be logged now.
+func (l *refusedLog) due(ip string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.last[ip]) < refusedLogEvery {
+		return false
+	}
+	// keep the map bounded when many sources are refused
+	if len(l.last) >= 1024 {
+		for k, t := range l.last {
+			if now.Sub(t) >= refusedLogEvery {
+				delete(l.last, k)
+			}
+		}
+		if len(l.last) >= 1024 {
+			return false
+		}
+	}
+	l.last[ip] = now
+	return true
+}
+
+// adminSourceFilter refuses connections from source IPs outside allow.
+// An empty list allows everyone.
+func adminSourceFilter(allow []net.IPNet, p ConnectionProvider, next http.Handler) http.Handler {
+	if len(allow) == 0 {
+		return next
+	}
+	refused := &refusedLog{last: make(map[string]time.Time)}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := net.ParseIP(remoteIP(r))
+		if ip != nil && ip.IsLoopback() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, n := range allow {
+			if ip != nil && n.Contains(ip) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		if refused.due(remoteIP(r), time.Now()) {
+			p.Warnf("admin request from %s refused: not in --admin-allow (logged once a minute per source)", remoteIP(r))
+		}
+		http.Error(w, "forbidden", http.StatusForbidden)
+	})
+}
@@ -0,0 +1,121 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"proxychan/internal/system"
+)
+
+// routeRoles is the minimum admin role for each browser route. Routes
+// missing from the table are refused, so a new page has to be listed
+// here before anyone can reach it.
+var routeRoles = map[string]system.AdminRole{
+	"/me":                  system.RoleViewer,
+	"/logout":              system.RoleViewer,
+	"/account":             system.RoleViewer,
+	"/account/2fa":         system.RoleViewer,
+	"/account/2fa/begin":   system.RoleViewer,
+	"/account/2fa/confirm": system.RoleViewer,
+	"/account/2fa/disable": system.RoleViewer,
+	"/connections":         system.RoleViewer,
+	"/connections/by-ip":   system.RoleViewer,
+	"/connections/limits":  system.RoleViewer,
+	"/connections/events":  system.RoleViewer,
+	"/metrics":             system.RoleViewer,
+
+	"/connections/kill":        system.RoleOperator,
+	"/connections/kill-user":   system.RoleOperator,
+	"/connections/kill-source": system.RoleOperator,
+	"/users":                   system.RoleOperator,
+	"/users/list":              system.RoleOperator,
+	"/users/activate":          system.RoleOperator,
+	"/users/deactivate":        system.RoleOperator,
+	"/bans":                    system.RoleOperator,
+	"/bans/list":               system.RoleOperator,
+
+	"/users/add":          system.RoleAdmin,
+	"/users/delete":       system.RoleAdmin,
+	"/users/passwd":       system.RoleAdmin,
+	"/policies":           system.RoleAdmin,
+	"/policies/list":      system.RoleAdmin,
+	"/policies/whitelist": system.RoleAdmin,
+	"/policies/denylist":  system.RoleAdmin,
+	"/audit":              system.RoleAdmin,
+	"/audit/list":         system.RoleAdmin,
+	"/sessions":           system.RoleAdmin,
+	"/sessions/list":      system.RoleAdmin,
+	"/sessions/revoke":    system.RoleAdmin,
+}
+
+// apiRoles is the minimum role of an API token for each route pattern
+// registered in registerAPI, plus /metrics for scrapers. As with
+// routeRoles, a registered pattern missing here is refused.
+var apiRoles = map[string]system.AdminRole{
+	"GET " + apiPrefix + "/connections": system.RoleViewer,
+	"GET " + apiPrefix + "/events":      system.RoleViewer,
+	"GET " + apiPrefix + "/status":      system.RoleViewer,
+	apiPrefix + "/":                     system.RoleViewer, // JSON 404
+	"/metrics":                          system.RoleViewer,
+
+	"DELETE " + apiPrefix + "/connections/{id}": system.RoleOperator,
+	"GET " + apiPrefix + "/users":               system.RoleOperator,
+	"GET " + apiPrefix + "/users/{name}":        system.RoleOperator,
+
+	"POST " + apiPrefix + "/users":          system.RoleAdmin,
+	"PATCH " + apiPrefix + "/users/{name}":  system.RoleAdmin,
+	"DELETE " + apiPrefix + "/users/{name}": system.RoleAdmin,
+	"GET " + apiPrefix + "/whitelist":       system.RoleAdmin,
+	"POST " + apiPrefix + "/whitelist":      system.RoleAdmin,
+	"DELETE " + apiPrefix + "/whitelist":    system.RoleAdmin,
+	"GET " + apiPrefix + "/denylist":        system.RoleAdmin,
+	"POST " + apiPrefix + "/denylist":       system.RoleAdmin,
+	"DELETE " + apiPrefix + "/denylist":     system.RoleAdmin,
+}
+
+type adminCtxKey struct{}
+
+func withAdmin(r *http.Request, acct *system.AdminAccount) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), adminCtxKey{}, acct))
+}
+
+// adminFrom returns the account the gate authenticated, if any.
+func adminFrom(r *http.Request) (*system.AdminAccount, bool) {
+	acct, ok := r.Context().Value(adminCtxKey{}).(*system.AdminAccount)
+	return acct, ok
+}
+
+// actorFor names who is making a change, for the audit log: the admin
+// account of a browser session or the API token.
+func actorFor(r *http.Request) system.Actor {
+	if acct, ok := adminFrom(r); ok {
+		return system.WebActor(acct.Username)
+	}
+	if tok, ok := r.Context().Value(apiTokenCtxKey{}).(*system.APIToken); ok {
+		return system.APIActor(tok.Name)
+	}
+	return "web:unknown"
+}
+
+// meHandler tells the page scripts who is logged in, so they can hide
+// what the role can't use.
+func meHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		acct, ok := adminFrom(r)
+		if !ok {
+			http.Error(w, "not logged in", http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"username": acct.Username,
+			"role":     string(acct.Role),
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"proxychan/internal/system"
+)
+
+func TestGateRoles(t *testing.T) {
+	ta := newTestAdmin(t)
+
+	for _, tc := range []struct {
+		user   string
+		method string
+		path   string
+		want   int
+	}{
+		{"watcher", http.MethodGet, "/connections", http.StatusOK},
+		{"watcher", http.MethodPost, "/connections/kill", http.StatusForbidden},
+		{"watcher", http.MethodPost, "/users/delete", http.StatusForbidden},
+		{"ops", http.MethodPost, "/connections/kill", http.StatusOK},
+		{"ops", http.MethodPost, "/users/activate", http.StatusOK},
+		{"ops", http.MethodPost, "/users/delete", http.StatusForbidden},
+		{"ops", http.MethodGet, "/audit/list", http.StatusForbidden},
+		{"root", http.MethodPost, "/users/delete", http.StatusOK},
+		{"root", http.MethodGet, "/sessions/list", http.StatusOK},
+		{"root", http.MethodGet, "/not-listed", http.StatusNotFound},
+	} {
+		token, csrf := ta.login(t, tc.user)
+		w := ta.do(browserRequest(tc.method, tc.path, token, csrf))
+		if w.Code != tc.want {
+			t.Errorf("%s %s %s: %d, want %d", tc.user, tc.method, tc.path, w.Code, tc.want)
+		}
+	}
+}
+
+func TestGateAPIRoles(t *testing.T) {
+	ta := newTestAdmin(t)
+	tokens := map[system.AdminRole]string{}
+	for _, role := range []system.AdminRole{system.RoleViewer, system.RoleOperator, system.RoleAdmin} {
+		tok, err := system.CreateAPIToken(ta.db, testActor, "test-"+string(role), role, 0)
+		must(t, err)
+		tokens[role] = tok
+	}
+
+	api := func(method, path, bearer string) int {
+		r := httptest.NewRequest(method, path, nil)
+		if bearer != "" {
+			r.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		return ta.do(r).Code
+	}
+
+	for _, tc := range []struct {
+		role   system.AdminRole
+		method string
+		path   string
+		want   int
+	}{
+		{system.RoleViewer, http.MethodGet, apiPrefix + "/users", http.StatusForbidden},
+		{system.RoleViewer, http.MethodDelete, apiPrefix + "/users/alice", http.StatusForbidden},
+		{system.RoleOperator, http.MethodGet, apiPrefix + "/users", http.StatusOK},
+		{system.RoleOperator, http.MethodGet, apiPrefix + "/whitelist", http.StatusForbidden},
+		{system.RoleAdmin, http.MethodGet, apiPrefix + "/whitelist", http.StatusOK},
+		{system.RoleViewer, http.MethodGet, "/metrics", http.StatusOK},
+		{system.RoleViewer, http.MethodGet, apiPrefix + "/nothing-here", http.StatusNotFound},
+	} {
+		if got := api(tc.method, tc.path, tokens[tc.role]); got != tc.want {
+			t.Errorf("%s %s %s: %d, want %d", tc.role, tc.method, tc.path, got, tc.want)
+		}
+	}
+
+	if got := api(http.MethodGet, apiPrefix+"/users", ""); got != http.StatusUnauthorized {
+		t.Errorf("no token: %d, want 401", got)
+	}
+	if got := api(http.MethodGet, apiPrefix+"/users", "pct_wrong"); got != http.StatusUnauthorized {
+		t.Errorf("wrong token: %d, want 401", got)
+	}
+
+	// the browser session is not accepted on the API
+	token, csrf := ta.login(t, "root")
+	if w := ta.do(browserRequest(http.MethodGet, apiPrefix+"/users", token, csrf)); w.Code != http.StatusUnauthorized {
+		t.Errorf("session cookie on the API: %d, want 401", w.Code)
+	}
+}
+
+// TestAPIRolesMatchRoutes catches an apiRoles entry that drifted from
+// the pattern registerAPI uses, which would refuse the route outright.
+func TestAPIRolesMatchRoutes(t *testing.T) {
+	app := http.NewServeMux()
+	registerAPI(app, testProvider{}, nil)
+
+	for pattern, role := range apiRoles {
+		if role != system.RoleViewer && role != system.RoleOperator && role != system.RoleAdmin {
+			t.Errorf("%s: unknown role %q", pattern, role)
+		}
+		method, path, ok := strings.Cut(pattern, " ")
+		if !ok || strings.HasSuffix(path, "/") {
+			continue // /metrics and the catch-all are not API routes
+		}
+		path = strings.NewReplacer("{name}", "alice", "{id}", "1").Replace(path)
+		if _, got := app.Handler(httptest.NewRequest(method, path, nil)); got != pattern {
+			t.Errorf("%s %s is routed to %q", method, path, got)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"proxychan/internal/system"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Default admin session lifetimes, used when AdminOptions leaves them 0.
+const (
+	defaultSessionIdle = 30 * time.Minute
+	defaultSessionMax  = 12 * time.Hour
+)
+
+// Admin login throttling per source IP.
+const (
+	loginMaxFailures = 5
+	loginWindow      = 10 * time.Minute
+	loginLockout     = 15 * time.Minute
+)
+
+func randomToken() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// adminSession is a logged-in browser. The cookie token is only used as
+// the map key; ID identifies the session on the sessions page.
+type adminSession struct {
+	ID        string
+	Username  string
+	Created   time.Time
+	LastSeen  time.Time
+	RemoteIP  string
+	UserAgent string
+
+	csrf string
+}
+
+// sessionStore keeps admin sessions in memory. A session ends after
+// idle time without requests, or at max age regardless of use.
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*adminSession
+	idle     time.Duration
+	max      time.Duration
+}
+
+func newSessionStore(idle, max time.Duration) *sessionStore {
+	if idle <= 0 {
+		idle = defaultSessionIdle
+	}
+	if max <= 0 {
+		max = defaultSessionMax
+	}
+	return &sessionStore{
+		sessions: make(map[string]*adminSession),
+		idle:     idle,
+		max:      max,
+	}
+}
+
+func (st *sessionStore) expired(s *adminSession, now time.Time) bool {
+	return now.Sub(s.LastSeen) > st.idle || now.Sub(s.Created) > st.max
+}
+
+// issue creates a session for an admin account and returns its cookie
+// token and CSRF token.
+func (st *sessionStore) issue(r *http.Request, acct *system.AdminAccount) (token, csrf string) {
+	token, csrf = randomToken(), randomToken()
+	now := time.Now()
+
+	st.mu.Lock()
+	st.sessions[token] = &adminSession{
+		ID:        randomToken()[:16],
+		Username:  acct.Username,
+		Created:   now,
+		LastSeen:  now,
+		RemoteIP:  remoteIP(r),
+		UserAgent: r.UserAgent(),
+		csrf:      csrf,
+	}
+	st.mu.Unlock()
+
+	return token, csrf
+}
+
+// lookup returns a live session. touch marks it used; background
+// requests (page polls, event streams) leave the idle timer alone so an
+// open tab doesn't keep a session alive on its own.
+func (st *sessionStore) lookup(token string, touch bool) (adminSession, bool) {
+	now := time.Now()
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	s, ok := st.sessions[token]
+	if !ok {
+		return adminSession{}, false
+	}
+	if st.expired(s, now) {
+		delete(st.sessions, token)
+		return adminSession{}, false
+	}
+	if touch {
+		s.LastSeen = now
+	}
+	return *s, true
+}
+
+func (st *sessionStore) revokeToken(token string) {
+	st.mu.Lock()
+	delete(st.sessions, token)
+	st.mu.Unlock()
+}
+
+// revoke ends the session with the given display ID.
+func (st *sessionStore) revoke(id string) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for token, s := range st.sessions {
+		if s.ID == id {
+			delete(st.sessions, token)
+			return true
+		}
+	}
+	return false
+}
+
+// revokeUser ends every session of an admin account.
+func (st *sessionStore) revokeUser(username string) int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	n := 0
+	for token, s := range st.sessions {
+		if s.Username == username {
+			delete(st.sessions, token)
+			n++
+		}
+	}
+	return n
+}
+
+// list returns live sessions, most recently used first.
+func (st *sessionStore) list() []adminSession {
+	now := time.Now()
+
+	st.mu.Lock()
+	out := make([]adminSession, 0, len(st.sessions))
+	for _, s := range st.sessions {
+		if !st.expired(s, now) {
+			out = append(out, *s)
+		}
+	}
+	st.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].LastSeen.After(out[j].LastSeen) })
+	return out
+}
+
+func (st *sessionStore) sweep(now time.Time) int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	n := 0
+	for token, s := range st.sessions {
+		if st.expired(s, now) {
+			delete(st.sessions, token)
+			n++
+		}
+	}
+	return n
+}
+
+// loginThrottle locks out source IPs that fail the admin login too often.
+type loginThrottle struct {
+	mu     sync.Mutex
+	fails  map[string][]time.Time
+	locked map[string]time.Time
+}
+
+func newLoginThrottle() *loginThrottle {
+	return &loginThrottle{
+		fails:  make(map[string][]time.Time),
+		locked: make(map[string]time.Time),
+	}
+}
+
+// lockedFor returns how long ip is still locked out (0 if it isn't).
+func (t *loginThrottle) lockedFor(ip string, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	until, ok := t.locked[ip]
+	if !ok {
+		return 0
+	}
+	if !now.Before(until) {
+		delete(t.locked, ip)
+		return 0
+	}
+	return until.Sub(now)
+}
+
+// fail records a failed login and reports whether ip is now locked.
+func (t *loginThrottle) fail(ip string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cutoff := now.Add(-loginWindow)
+	kept := t.fails[ip][:0]
+	for _, f := range t.fails[ip] {
+		if f.After(cutoff) {
+			kept = append(kept, f)
+		}
+	}
+	kept = append(kept, now)
+
+	if len(kept) >= loginMaxFailures {
+		delete(t.fails, ip)
+		t.locked[ip] = now.Add(loginLockout)
+		return true
+	}
+	t.fails[ip] = kept
+	return false
+}
+
+func (t *loginThrottle) success(ip string) {
+	t.mu.Lock()
+	delete(t.fails, ip)
+	t.mu.Unlock()
+}
+
+func (t *loginThrottle) sweep(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cutoff := now.Add(-loginWindow)
+	for ip, fs := range t.fails {
+		if len(fs) == 0 || !fs[len(fs)-1].After(cutoff) {
+			delete(t.fails, ip)
+		}
+	}
+	for ip, until := range t.locked {
+		if !now.Before(until) {
+			delete(t.locked, ip)
+		}
+	}
+}
+
+// sessionSweeper drops expired sessions and stale login failures.
+func sessionSweeper(ctx context.Context, p ConnectionProvider, st *sessionStore, lt *loginThrottle) {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if n := st.sweep(now); n > 0 {
+				p.Infof("expired %d admin session(s)", n)
+			}
+			lt.sweep(now)
+		}
+	}
+}
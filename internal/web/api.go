@@ -0,0 +1,586 @@
+package web
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"proxychan/internal/models"
+	"proxychan/internal/system"
+)
+
+// The REST API lives under /api/v1 and wraps the same internal/system
+// functions as the CLI. It authenticates with API tokens only; the
+// browser cookie is never accepted here.
+
+const apiPrefix = "/api/v1"
+
+type apiErrorBody struct {
+	Error apiError `json:"error"`
+}
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if v != nil {
+		_ = json.NewEncoder(w).Encode(v)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code, msg string) {
+	writeJSON(w, status, apiErrorBody{Error: apiError{Code: code, Message: msg}})
+}
+
+// writeSystemError maps internal/system errors to HTTP status codes.
+// Anything unrecognised is an internal error and its text is not leaked.
+func writeSystemError(w http.ResponseWriter, code string, err error) {
+	switch {
+	case errors.Is(err, system.ErrUserNotFound),
+		errors.Is(err, system.ErrRuleNotFound):
+		writeAPIError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+	case errors.Is(err, system.ErrUserExists):
+		writeAPIError(w, http.StatusConflict, "ALREADY_EXISTS", err.Error())
+	case errors.Is(err, system.ErrInvalidCIDR),
+		errors.Is(err, system.ErrInvalidPattern),
+		errors.Is(err, system.ErrInvalidGroup):
+		writeAPIError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+	default:
+		writeAPIError(w, http.StatusInternalServerError, code, "internal error")
+	}
+}
+
+// decodeBody reads a JSON request body, rejecting unknown fields so
+// typos don't silently turn into no-ops.
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "INVALID_BODY", err.Error())
+		return false
+	}
+	return true
+}
+
+type apiTokenCtxKey struct{}
+
+// apiAuthenticated checks the Authorization: Bearer token of an API
+// request and returns the request carrying the token, whose name ends
+// up as the actor in the audit log.
+func apiAuthenticated(db *sql.DB, w http.ResponseWriter, r *http.Request) (*http.Request, *system.APIToken, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="proxychan"`)
+		writeAPIError(w, http.StatusUnauthorized, "UNAUTHENTICATED", "missing bearer token")
+		return r, nil, false
+	}
+
+	tok, err := system.VerifyAPIToken(db, strings.TrimSpace(token))
+	if err != nil {
+		if errors.Is(err, system.ErrTokenInvalid) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="proxychan", error="invalid_token"`)
+			writeAPIError(w, http.StatusUnauthorized, "UNAUTHENTICATED", err.Error())
+			return r, nil, false
+		}
+		writeAPIError(w, http.StatusInternalServerError, "TOKEN_CHECK_FAIL", "internal error")
+		return r, nil, false
+	}
+	return r.WithContext(context.WithValue(r.Context(), apiTokenCtxKey{}, tok)), tok, true
+}
+
+func registerAPI(app *http.ServeMux, p ConnectionProvider, db *sql.DB) {
+	app.HandleFunc("GET "+apiPrefix+"/openapi.json", apiSpecHandler())
+
+	app.HandleFunc("GET "+apiPrefix+"/users", apiListUsers(db))
+	app.HandleFunc("POST "+apiPrefix+"/users", apiCreateUser(db))
+	app.HandleFunc("GET "+apiPrefix+"/users/{name}", apiGetUser(db))
+	app.HandleFunc("PATCH "+apiPrefix+"/users/{name}", apiUpdateUser(db))
+	app.HandleFunc("DELETE "+apiPrefix+"/users/{name}", apiDeleteUser(db))
+
+	app.HandleFunc("GET "+apiPrefix+"/whitelist", apiListWhitelist(db))
+	app.HandleFunc("POST "+apiPrefix+"/whitelist", apiSetWhitelist(db))
+	app.HandleFunc("DELETE "+apiPrefix+"/whitelist", apiDeleteWhitelist(db))
+
+	app.HandleFunc("GET "+apiPrefix+"/denylist", apiListDenylist(db))
+	app.HandleFunc("POST "+apiPrefix+"/denylist", apiSetDenylist(db))
+	app.HandleFunc("DELETE "+apiPrefix+"/denylist", apiDeleteDenylist(db))
+
+	app.HandleFunc("GET "+apiPrefix+"/connections", apiListConnections(p))
+	app.HandleFunc("DELETE "+apiPrefix+"/connections/{id}", apiKillConnection(p))
+	app.HandleFunc("GET "+apiPrefix+"/events", apiEvents(p, db))
+
+	app.HandleFunc("GET "+apiPrefix+"/status", apiStatus(p, db))
+
+	// anything else under the prefix gets a JSON 404 instead of the
+	// admin HTML pages
+	app.HandleFunc(apiPrefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, "NOT_FOUND", "no such endpoint")
+	})
+}
+
+func apiSpecHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		spec, err := staticFS.ReadFile("static/openapi.json")
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "SPEC_LOAD_FAIL", "failed to load spec")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(spec)
+	}
+}
+
+// ---------- users ----------
+
+type userView struct {
+	Username          string     `json:"username"`
+	Group             string     `json:"group"`
+	Active            bool       `json:"active"`
+	Blocked           bool       `json:"blocked"`
+	LockedUntil       *time.Time `json:"locked_until"`
+	CreatedAt         *time.Time `json:"created_at"`
+	ExpiresAt         *time.Time `json:"expires_at"`
+	PasswordChangedAt *time.Time `json:"password_changed_at"`
+	PasswordExpiresAt *time.Time `json:"password_expires_at"`
+}
+
+// optTime renders zero times as JSON null.
+func optTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func newUserView(u *system.UserInfo) userView {
+	return userView{
+		Username:          u.Username,
+		Group:             u.Group,
+		Active:            u.Active,
+		Blocked:           u.Blocked,
+		LockedUntil:       optTime(u.LockedUntil),
+		CreatedAt:         optTime(u.CreatedAt),
+		ExpiresAt:         optTime(u.ExpiresAt),
+		PasswordChangedAt: optTime(u.PasswordChangedAt),
+		PasswordExpiresAt: optTime(u.PasswordExpiresAt),
+	}
+}
+
+func apiListUsers(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		names, err := system.ListUsers(db)
+		if err != nil {
+			writeSystemError(w, "USER_LIST_FAIL", err)
+			return
+		}
+
+		out := make([]userView, 0, len(names))
+		for _, n := range names {
+			u, err := system.GetUserInfo(db, n)
+			if err != nil {
+				writeSystemError(w, "USER_STATUS_FAIL", err)
+				return
+			}
+			out = append(out, newUserView(u))
+		}
+		writeJSON(w, http.StatusOK, out)
+	}
+}
+
+func apiGetUser(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, err := system.GetUserInfo(db, r.PathValue("name"))
+		if err != nil {
+			writeSystemError(w, "USER_STATUS_FAIL", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newUserView(u))
+	}
+}
+
+const groupNameRule = "group must be up to 255 characters without whitespace or ':'"
+
+type createUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Active   bool   `json:"active"`
+	Group    string `json:"group"`
+}
+
+func apiCreateUser(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req createUserRequest
+		if !decodeBody(w, r, &req) {
+			return
+		}
+
+		if !system.ValidUsername(req.Username) {
+			writeAPIError(w, http.StatusBadRequest, "INVALID_ARGUMENT",
+				"username must be 1-255 characters without whitespace or ':'")
+			return
+		}
+		if req.Password == "" {
+			writeAPIError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "password cannot be empty")
+			return
+		}
+		if !system.ValidGroupName(strings.TrimSpace(req.Group)) {
+			writeAPIError(w, http.StatusBadRequest, "INVALID_ARGUMENT", groupNameRule)
+			return
+		}
+
+		// new users start inactive, same as add-user
+		if err := system.CreateUser(db, actorFor(r), req.Username, req.Password, req.Group, req.Active); err != nil {
+			writeSystemError(w, "USER_ADD_FAIL", err)
+			return
+		}
+
+		u, err := system.GetUserInfo(db, req.Username)
+		if err != nil {
+			writeSystemError(w, "USER_STATUS_FAIL", err)
+			return
+		}
+		w.Header().Set("Location", apiPrefix+"/users/"+req.Username)
+		writeJSON(w, http.StatusCreated, newUserView(u))
+	}
+}
+
+// updateUserRequest only touches the fields that are present.
+// expires_at takes RFC3339, a duration like "30d", or "never".
+type updateUserRequest struct {
+	Active    *bool   `json:"active"`
+	Blocked   *bool   `json:"blocked"`
+	Group     *string `json:"group"`
+	Password  *string `json:"password"`
+	ExpiresAt *string `json:"expires_at"`
+}
+
+func apiUpdateUser(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+
+		var req updateUserRequest
+		if !decodeBody(w, r, &req) {
+			return
+		}
+
+		// validate everything before changing anything
+		var expiry time.Time
+		if req.ExpiresAt != nil {
+			at, err := parseExpiry(*req.ExpiresAt)
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+				return
+			}
+			expiry = at
+		}
+		if req.Password != nil && *req.Password == "" {
+			writeAPIError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "password cannot be empty")
+			return
+		}
+		if req.Group != nil && !system.ValidGroupName(strings.TrimSpace(*req.Group)) {
+			writeAPIError(w, http.StatusBadRequest, "INVALID_ARGUMENT", groupNameRule)
+			return
+		}
+		if _, err := system.GetUserInfo(db, name); err != nil {
+			writeSystemError(w, "USER_STATUS_FAIL", err)
+			return
+		}
+
+		actor := actorFor(r)
+		steps := []struct {
+			set  bool
+			code string
+			fn   func() error
+		}{
+			{req.Active != nil && *req.Active, "USER_ACTIVATE_FAIL", func() error { return system.ActivateUser(db, actor, name) }},
+			{req.Active != nil && !*req.Active, "USER_DEACTIVATE_FAIL", func() error { return system.DeactivateUser(db, actor, name) }},
+			{req.Blocked != nil && *req.Blocked, "USER_BLOCK_FAIL", func() error { return system.BlockUser(db, actor, name) }},
+			{req.Blocked != nil && !*req.Blocked, "USER_UNLOCK_FAIL", func() error { return system.UnlockUser(db, actor, name) }},
+			{req.Group != nil, "USER_GROUP_FAIL", func() error { return system.SetUserGroup(db, actor, name, *req.Group) }},
+			{req.Password != nil, "USER_PASSWD_FAIL", func() error { return system.ChangePassword(db, actor, name, *req.Password) }},
+			{req.ExpiresAt != nil, "USER_EXPIRY_FAIL", func() error { return system.SetUserExpiry(db, actor, name, expiry) }},
+		}
+		for _, s := range steps {
+			if !s.set {
+				continue
+			}
+			if err := s.fn(); err != nil {
+				writeSystemError(w, s.code, err)
+				return
+			}
+		}
+
+		u, err := system.GetUserInfo(db, name)
+		if err != nil {
+			writeSystemError(w, "USER_STATUS_FAIL", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newUserView(u))
+	}
+}
+
+// parseExpiry accepts RFC3339, a duration from now, or never/"".
+func parseExpiry(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "never" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := system.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return time.Time{}, errors.New("expires_at must be RFC3339, a positive duration (30d) or \"never\"")
+	}
+	return time.Now().Add(d), nil
+}
+
+func apiDeleteUser(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := system.DeleteUser(db, actorFor(r), r.PathValue("name")); err != nil {
+			writeSystemError(w, "USER_DELETE_FAIL", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ---------- whitelist ----------
+
+type whitelistView struct {
+	CIDR    string `json:"cidr"`
+	Enabled bool   `json:"enabled"`
+}
+
+type whitelistRequest struct {
+	CIDR    string `json:"cidr"`
+	Enabled *bool  `json:"enabled"`
+}
+
+func apiListWhitelist(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entries, err := system.ListWhitelist(db)
+		if err != nil {
+			writeSystemError(w, "WHITELIST_LIST_FAIL", err)
+			return
+		}
+
+		out := make([]whitelistView, 0, len(entries))
+		for _, e := range entries {
+			out = append(out, whitelistView{CIDR: e.CIDR, Enabled: e.Enabled})
+		}
+		writeJSON(w, http.StatusOK, out)
+	}
+}
+
+// apiSetWhitelist adds or re-enables an entry, or disables it with
+// "enabled": false (same as allow-ip / block-ip).
+func apiSetWhitelist(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req whitelistRequest
+		if !decodeBody(w, r, &req) {
+			return
+		}
+
+		if err := setWhitelistEntry(db, actorFor(r), req.CIDR, req.Enabled == nil || *req.Enabled); err != nil {
+			writeSystemError(w, "WHITELIST_UPDATE_FAIL", err)
+			return
+		}
+		apiListWhitelist(db)(w, r)
+	}
+}
+
+func apiDeleteWhitelist(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := deleteWhitelistEntry(db, actorFor(r), r.URL.Query().Get("cidr")); err != nil {
+			writeSystemError(w, "WHITELIST_DELETE_FAIL", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ---------- denylist ----------
+
+type denylistView struct {
+	Pattern string `json:"pattern"`
+	Type    string `json:"type"`
+	Enabled bool   `json:"enabled"`
+}
+
+type denylistRequest struct {
+	Pattern string `json:"pattern"`
+	Enabled *bool  `json:"enabled"`
+}
+
+func apiListDenylist(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rules, err := system.ListDenylist(db)
+		if err != nil {
+			writeSystemError(w, "DENYLIST_LIST_FAIL", err)
+			return
+		}
+
+		out := make([]denylistView, 0, len(rules))
+		for _, d := range rules {
+			out = append(out, denylistView{Pattern: d.Pattern, Type: string(d.Type), Enabled: d.Enabled})
+		}
+		writeJSON(w, http.StatusOK, out)
+	}
+}
+
+// apiSetDenylist blocks a destination, or re-allows it with
+// "enabled": false (same as block-dest / allow-dest).
+func apiSetDenylist(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req denylistRequest
+		if !decodeBody(w, r, &req) {
+			return
+		}
+
+		if err := setDenyRule(db, actorFor(r), req.Pattern, req.Enabled == nil || *req.Enabled); err != nil {
+			writeSystemError(w, "DENYLIST_UPDATE_FAIL", err)
+			return
+		}
+		apiListDenylist(db)(w, r)
+	}
+}
+
+func apiDeleteDenylist(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := system.DeleteDestination(db, actorFor(r), r.URL.Query().Get("pattern")); err != nil {
+			writeSystemError(w, "DENYLIST_DELETE_FAIL", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ---------- connections ----------
+
+func apiListConnections(p ConnectionProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conns := p.SnapshotConnections()
+		if conns == nil {
+			conns = []models.ActiveConn{}
+		}
+
+		q := r.URL.Query()
+		if user, src := q.Get("user"), q.Get("source"); user != "" || src != "" {
+			filtered := conns[:0]
+			for _, c := range conns {
+				if (user == "" || c.Username == user) && (src == "" || c.SourceIP == src) {
+					filtered = append(filtered, c)
+				}
+			}
+			conns = filtered
+		}
+		writeJSON(w, http.StatusOK, conns)
+	}
+}
+
+// apiEvents is the browser's event stream with API-style errors.
+func apiEvents(p ConnectionProvider, db *sql.DB) http.HandlerFunc {
+	stream := eventStreamHandler(p, db, nil)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := eventFilterFrom(r); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+			return
+		}
+		stream(w, r)
+	}
+}
+
+func apiKillConnection(p ConnectionProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "invalid connection id")
+			return
+		}
+
+		if !p.KillConn(id) {
+			writeAPIError(w, http.StatusNotFound, "NOT_FOUND", "connection not found")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ---------- status ----------
+
+type statusView struct {
+	Connections models.ConnLimitStatus `json:"connections"`
+	Users       int                    `json:"users"`
+	Whitelist   int                    `json:"whitelist_enabled"`
+	Denylist    int                    `json:"denylist_rules"`
+	Bans        int                    `json:"active_bans"`
+	Versions    map[string]int64       `json:"policy_versions"`
+}
+
+func apiStatus(p ConnectionProvider, db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		st := statusView{
+			Connections: p.ConnLimits(),
+			Versions:    make(map[string]int64),
+		}
+
+		users, err := system.ListUsers(db)
+		if err != nil {
+			writeSystemError(w, "USER_LIST_FAIL", err)
+			return
+		}
+		st.Users = len(users)
+
+		wl, err := system.GetWhitelistStatus(db)
+		if err != nil {
+			writeSystemError(w, "WHITELIST_STATUS_FAIL", err)
+			return
+		}
+		st.Whitelist = wl.Enabled
+
+		rules, err := system.ListDenylist(db)
+		if err != nil {
+			writeSystemError(w, "DENYLIST_LIST_FAIL", err)
+			return
+		}
+		st.Denylist = len(rules)
+
+		bans, err := system.ListBans(db)
+		if err != nil {
+			writeSystemError(w, "BAN_LIST_FAIL", err)
+			return
+		}
+		st.Bans = len(bans)
+
+		versions := []struct {
+			name string
+			get  func(*sql.DB) (int64, error)
+		}{
+			{"whitelist", system.GetWhitelistVersion},
+			{"denylist", system.GetDenylistVersion},
+			{"rate_limits", system.GetRateLimitsVersion},
+			{"bans", system.GetBansVersion},
+			{"users", system.GetUsersVersion},
+		}
+		for _, v := range versions {
+			n, err := v.get(db)
+			if err != nil {
+				writeSystemError(w, "VERSION_READ_FAIL", err)
+				return
+			}
+			st.Versions[v.name] = n
+		}
+
+		writeJSON(w, http.StatusOK, st)
+	}
+}
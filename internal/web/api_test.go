@@ -0,0 +1,74 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"proxychan/internal/system"
+)
+
+func (ta *testAdmin) api(t *testing.T, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	tok, err := system.CreateAPIToken(ta.db, testActor, "t-"+randomToken()[:8], system.RoleAdmin, 0)
+	must(t, err)
+
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+tok)
+	r.Header.Set("Content-Type", "application/json")
+	return ta.do(r)
+}
+
+func TestAPICreateUser(t *testing.T) {
+	ta := newTestAdmin(t)
+
+	for _, tc := range []struct {
+		name string
+		body string
+		want int
+	}{
+		{"group with a space", `{"username":"alice","password":"secret-one","group":"night shift","active":true}`, http.StatusBadRequest},
+		{"group with a colon", `{"username":"alice","password":"secret-one","group":"a:b"}`, http.StatusBadRequest},
+		{"bad username", `{"username":"al ice","password":"secret-one"}`, http.StatusBadRequest},
+		{"no password", `{"username":"alice"}`, http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := ta.api(t, http.MethodPost, apiPrefix+"/users", tc.body)
+			if w.Code != tc.want {
+				t.Fatalf("got %d, want %d: %s", w.Code, tc.want, w.Body)
+			}
+			if _, err := system.GetUserInfo(ta.db, "alice"); err != system.ErrUserNotFound {
+				t.Errorf("a refused create left the user behind (%v)", err)
+			}
+		})
+	}
+
+	// the same request with a valid group goes through on retry
+	w := ta.api(t, http.MethodPost, apiPrefix+"/users", `{"username":"alice","password":"secret-one","group":"staff","active":true}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: %d: %s", w.Code, w.Body)
+	}
+	var u userView
+	must(t, json.NewDecoder(w.Body).Decode(&u))
+	if u.Username != "alice" || u.Group != "staff" || !u.Active {
+		t.Errorf("created %+v", u)
+	}
+	if loc := w.Header().Get("Location"); loc != apiPrefix+"/users/alice" {
+		t.Errorf("Location %q", loc)
+	}
+
+	w = ta.api(t, http.MethodPost, apiPrefix+"/users", `{"username":"alice","password":"secret-two"}`)
+	if w.Code != http.StatusConflict {
+		t.Errorf("duplicate: %d, want 409", w.Code)
+	}
+
+	w = ta.api(t, http.MethodPatch, apiPrefix+"/users/alice", `{"active":false,"group":"two words"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("update with a bad group: %d, want 400", w.Code)
+	}
+	if info, err := system.GetUserInfo(ta.db, "alice"); err != nil || !info.Active || info.Group != "staff" {
+		t.Errorf("a refused update changed the user: %+v (%v)", info, err)
+	}
+}
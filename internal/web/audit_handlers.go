@@ -0,0 +1,104 @@
+package web
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"proxychan/internal/system"
+)
+
+func auditHTMLHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+		html, err := staticFS.ReadFile("static/audit.html")
+
+		if err != nil {
+			http.Error(w, "failed to load html", http.StatusInternalServerError)
+			return
+		}
+
+		w.Write(html)
+	}
+}
+
+type auditView struct {
+	ID       int64     `json:"id"`
+	At       time.Time `json:"at"`
+	Actor    string    `json:"actor"`
+	Action   string    `json:"action"`
+	Target   string    `json:"target"`
+	OldValue string    `json:"old_value"`
+	NewValue string    `json:"new_value"`
+}
+
+// auditJSONHandler serves the audit log with the audit-log filters as
+// query parameters: actor, action (prefix), target, since, until (RFC3339)
+// and limit (default 200).
+func auditJSONHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := r.URL.Query()
+		f := system.AuditFilter{
+			Actor:  q.Get("actor"),
+			Action: q.Get("action"),
+			Target: q.Get("target"),
+			Limit:  200,
+		}
+		for _, t := range []struct {
+			name string
+			dst  *time.Time
+		}{{"since", &f.Since}, {"until", &f.Until}} {
+			if v := q.Get(t.name); v != "" {
+				at, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					http.Error(w, t.name+" must be RFC3339", http.StatusBadRequest)
+					return
+				}
+				*t.dst = at
+			}
+		}
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			f.Limit = n
+		}
+
+		recs, err := system.QueryAudit(db, f)
+		if err != nil {
+			http.Error(w, "failed to load audit log", http.StatusInternalServerError)
+			return
+		}
+
+		out := make([]auditView, 0, len(recs))
+		for _, rec := range recs {
+			out = append(out, auditView{
+				ID:       rec.ID,
+				At:       rec.At,
+				Actor:    string(rec.Actor),
+				Action:   rec.Action,
+				Target:   rec.Target,
+				OldValue: rec.OldValue,
+				NewValue: rec.NewValue,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	}
+}
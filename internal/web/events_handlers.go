@@ -0,0 +1,134 @@
+package web
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"proxychan/internal/models"
+)
+
+// EventSubscription is a live feed of connection events. Events are
+// dropped rather than queued without bound when the reader falls behind;
+// Dropped reports how many since the last call.
+type EventSubscription interface {
+	Events() <-chan models.ConnEvent
+	Dropped() int64
+	Close()
+}
+
+const (
+	eventStatsInterval = 2 * time.Second
+	eventPingInterval  = 15 * time.Second
+)
+
+// eventFilterFrom reads the user, source and type (comma-separated)
+// query parameters.
+func eventFilterFrom(r *http.Request) (models.EventFilter, error) {
+	q := r.URL.Query()
+	f := models.EventFilter{User: q.Get("user"), Source: q.Get("source")}
+	for _, t := range strings.Split(q.Get("type"), ",") {
+		switch t = strings.TrimSpace(t); t {
+		case "":
+		case models.EventOpen, models.EventClose, models.EventDeny, models.EventAuthFail:
+			f.Types = append(f.Types, t)
+		default:
+			return f, fmt.Errorf("unknown event type %q", t)
+		}
+	}
+	return f, nil
+}
+
+// eventStreamHandler streams connection events as Server-Sent Events,
+// one "event:" per type. Every eventStatsInterval it also sends a
+// "stats" event with the counters of the matching live tunnels, and a
+// "resync" event when events were dropped, after which the client should
+// fetch a fresh snapshot. The session or token is checked again on each
+// stats tick and the stream ends once it is no longer valid.
+func eventStreamHandler(p ConnectionProvider, db *sql.DB, st *sessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		f, err := eventFilterFrom(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		sub := p.SubscribeEvents(f)
+		defer sub.Close()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		fmt.Fprint(w, "retry: 3000\n\n")
+		flusher.Flush()
+
+		stats := time.NewTicker(eventStatsInterval)
+		defer stats.Stop()
+		ping := time.NewTicker(eventPingInterval)
+		defer ping.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+
+			case ev := <-sub.Events():
+				writeSSE(w, ev.Type, ev)
+
+			case <-stats.C:
+				if !stillAuthorized(db, st, r) {
+					return
+				}
+				if n := sub.Dropped(); n > 0 {
+					writeSSE(w, "resync", map[string]int64{"dropped": n})
+				}
+				writeSSE(w, "stats", liveStats(p, f))
+
+			case <-ping.C:
+				fmt.Fprint(w, ": ping\n\n")
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func liveStats(p ConnectionProvider, f models.EventFilter) []models.ConnStats {
+	out := []models.ConnStats{}
+	for _, c := range p.SnapshotConnections() {
+		if !f.MatchConn(c) {
+			continue
+		}
+		out = append(out, models.ConnStats{
+			ID:              c.ID,
+			BytesUp:         c.BytesUp,
+			BytesDown:       c.BytesDown,
+			UpBps:           c.UpBps,
+			DownBps:         c.DownBps,
+			LastActivity:    c.LastActivity,
+			PolicyViolation: c.PolicyViolation,
+		})
+	}
+	return out
+}
+
+func writeSSE(w http.ResponseWriter, event string, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+}
@@ -1,8 +1,14 @@
 package web
 
 import (
+	"database/sql"
 	"encoding/json"
+	"net"
 	"net/http"
+	"strconv"
+	"time"
+
+	"proxychan/internal/system"
 )
 
 func connectionsHTMLHandler() http.HandlerFunc {
@@ -39,3 +45,135 @@ func connectionsJSONHandler(p ConnectionProvider) http.HandlerFunc {
 		_ = json.NewEncoder(w).Encode(groups)
 	}
 }
+
+func connectionLimitsJSONHandler(p ConnectionProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(p.ConnLimits())
+	}
+}
+
+type killResult struct {
+	Killed int `json:"killed"`
+}
+
+func killConnHandler(p ConnectionProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid connection id", http.StatusBadRequest)
+			return
+		}
+
+		if !p.KillConn(id) {
+			http.Error(w, "connection not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(killResult{Killed: 1})
+	}
+}
+
+func killUserHandler(p ConnectionProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		user := r.URL.Query().Get("user")
+		if user == "" {
+			http.Error(w, "missing user", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(killResult{Killed: p.KillUser(user)})
+	}
+}
+
+func killSourceHandler(p ConnectionProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ip := net.ParseIP(r.URL.Query().Get("ip"))
+		if ip == nil {
+			http.Error(w, "invalid ip", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(killResult{Killed: p.KillSource(ip.String())})
+	}
+}
+
+func bansHTMLHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+		html, err := staticFS.ReadFile("static/bans.html")
+
+		if err != nil {
+			http.Error(w, "failed to load html", http.StatusInternalServerError)
+			return
+		}
+
+		w.Write(html)
+	}
+}
+
+type banView struct {
+	IP        string    `json:"ip"`
+	Reason    string    `json:"reason"`
+	Hits      int       `json:"hits"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func bansJSONHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		bans, err := system.ListBans(db)
+		if err != nil {
+			http.Error(w, "failed to load bans", http.StatusInternalServerError)
+			return
+		}
+
+		out := make([]banView, 0, len(bans))
+		for _, b := range bans {
+			out = append(out, banView{
+				IP:        b.IP,
+				Reason:    b.Reason,
+				Hits:      b.Hits,
+				CreatedAt: b.CreatedAt,
+				ExpiresAt: b.ExpiresAt,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	}
+}
@@ -0,0 +1,153 @@
+package web
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"proxychan/internal/system"
+)
+
+func policiesHTMLHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+		html, err := staticFS.ReadFile("static/policies.html")
+
+		if err != nil {
+			http.Error(w, "failed to load html", http.StatusInternalServerError)
+			return
+		}
+
+		w.Write(html)
+	}
+}
+
+type whitelistHitView struct {
+	CIDR    string `json:"cidr"`
+	Enabled bool   `json:"enabled"`
+	Hits    uint64 `json:"hits"`
+}
+
+type denylistHitView struct {
+	Pattern string `json:"pattern"`
+	Type    string `json:"type"`
+	Enabled bool   `json:"enabled"`
+	Hits    uint64 `json:"hits"`
+}
+
+type policiesView struct {
+	Whitelist []whitelistHitView `json:"whitelist"`
+	Denylist  []denylistHitView  `json:"denylist"`
+}
+
+func policiesJSONHandler(p ConnectionProvider, db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		wl, err := system.ListWhitelist(db)
+		if err != nil {
+			http.Error(w, "failed to load whitelist", http.StatusInternalServerError)
+			return
+		}
+		dl, err := system.ListDenylist(db)
+		if err != nil {
+			http.Error(w, "failed to load denylist", http.StatusInternalServerError)
+			return
+		}
+
+		hits := p.RuleHits()
+		out := policiesView{
+			Whitelist: make([]whitelistHitView, 0, len(wl)),
+			Denylist:  make([]denylistHitView, 0, len(dl)),
+		}
+		for _, e := range wl {
+			out.Whitelist = append(out.Whitelist, whitelistHitView{
+				CIDR:    e.CIDR,
+				Enabled: e.Enabled,
+				Hits:    hits.Whitelist[ruleKey(e.CIDR)],
+			})
+		}
+		for _, d := range dl {
+			out.Denylist = append(out.Denylist, denylistHitView{
+				Pattern: d.Pattern,
+				Type:    string(d.Type),
+				Enabled: d.Enabled,
+				Hits:    hits.Denylist[ruleKey(d.Pattern)],
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	}
+}
+
+// whitelistActionHandler: action=allow|block|delete, cidr=...
+func whitelistActionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		cidr := r.FormValue("cidr")
+
+		var err error
+		switch r.FormValue("action") {
+		case "allow":
+			err = setWhitelistEntry(db, actorFor(r), cidr, true)
+		case "block":
+			err = setWhitelistEntry(db, actorFor(r), cidr, false)
+		case "delete":
+			err = deleteWhitelistEntry(db, actorFor(r), cidr)
+		default:
+			http.Error(w, "action must be allow, block or delete", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			httpSystemError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// denylistActionHandler: action=block|allow|delete, pattern=...
+func denylistActionHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		pattern := r.FormValue("pattern")
+
+		var err error
+		switch r.FormValue("action") {
+		case "block":
+			err = setDenyRule(db, actorFor(r), pattern, true)
+		case "allow":
+			err = setDenyRule(db, actorFor(r), pattern, false)
+		case "delete":
+			err = system.DeleteDestination(db, actorFor(r), pattern)
+		default:
+			http.Error(w, "action must be block, allow or delete", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			httpSystemError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,92 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+func sessionsHTMLHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+		html, err := staticFS.ReadFile("static/sessions.html")
+
+		if err != nil {
+			http.Error(w, "failed to load html", http.StatusInternalServerError)
+			return
+		}
+
+		w.Write(html)
+	}
+}
+
+type sessionView struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	Created   time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	IdleEnds  time.Time `json:"idle_expires_at"`
+	Ends      time.Time `json:"expires_at"`
+	RemoteIP  string    `json:"remote_ip"`
+	UserAgent string    `json:"user_agent"`
+	Current   bool      `json:"current"`
+}
+
+func sessionsJSONHandler(st *sessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		cur, _ := adminSessionFor(st, r)
+
+		sessions := st.list()
+		out := make([]sessionView, 0, len(sessions))
+		for _, s := range sessions {
+			out = append(out, sessionView{
+				ID:        s.ID,
+				Username:  s.Username,
+				Created:   s.Created,
+				LastSeen:  s.LastSeen,
+				IdleEnds:  s.LastSeen.Add(st.idle),
+				Ends:      s.Created.Add(st.max),
+				RemoteIP:  s.RemoteIP,
+				UserAgent: s.UserAgent,
+				Current:   s.ID == cur.ID,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	}
+}
+
+func revokeSessionHandler(st *sessionStore, p ConnectionProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		id := r.FormValue("id")
+		if id == "" {
+			http.Error(w, "missing session id", http.StatusBadRequest)
+			return
+		}
+
+		if !st.revoke(id) {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		p.Infof("admin session %s revoked from %s", id, remoteIP(r))
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
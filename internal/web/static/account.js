@@ -0,0 +1,68 @@
+const el = (id) => document.getElementById(id);
+
+async function fetchStatus() {
+	try {
+		const res = await fetch('/account/2fa');
+		if (!res.ok) return;
+
+		const s = await res.json();
+		el('status').textContent =
+			`${s.username} ROLE=${s.role} 2FA=${s.enabled ? 'on' : 'off'}` +
+			(s.enabled ? ` RECOVERY CODES LEFT=${s.recovery_codes_left}` : '');
+
+		el('begin').hidden = s.enabled;
+		el('disable').hidden = !s.enabled;
+		if (s.enabled) el('enroll').hidden = true;
+	} catch (_) {
+		// silent
+	}
+}
+
+el('begin').addEventListener('submit', async (e) => {
+	e.preventDefault();
+
+	const { data, err } = await adminPostJSON('/account/2fa/begin');
+	if (err) {
+		alert(err);
+		return;
+	}
+	el('uri').textContent = data.uri;
+	el('secret').textContent = data.secret;
+	el('enroll').hidden = false;
+	el('recovery').hidden = true;
+});
+
+el('confirm').addEventListener('submit', async (e) => {
+	e.preventDefault();
+
+	const form = e.target;
+	const { data, err } = await adminPostJSON('/account/2fa/confirm', { code: form.code.value });
+	if (err) {
+		alert(err);
+		return;
+	}
+	form.reset();
+	el('uri').textContent = '';
+	el('secret').textContent = '';
+	el('codes').textContent = data.recovery_codes.join('\n');
+	el('recovery').hidden = false;
+	fetchStatus();
+});
+
+el('disable').addEventListener('submit', async (e) => {
+	e.preventDefault();
+
+	const form = e.target;
+	if (!confirm('Disable two-factor login for this account?')) return;
+
+	const err = await adminPost('/account/2fa/disable', { code: form.code.value });
+	if (err) {
+		alert(err);
+		return;
+	}
+	form.reset();
+	el('recovery').hidden = true;
+	fetchStatus();
+});
+
+fetchStatus();
@@ -0,0 +1,98 @@
+// Shared helpers for the admin pages.
+
+// The session's CSRF token is kept in a readable cookie and echoed in a
+// header on every state-changing request.
+function csrfToken() {
+	const m = document.cookie.match(/(?:^|;\s*)proxychan_csrf=([^;]*)/);
+	return m ? decodeURIComponent(m[1]) : '';
+}
+
+// pollFetch is fetch for requests the page makes on its own; they don't
+// keep the session from going idle.
+function pollFetch(url) {
+	return fetch(url, { headers: { 'X-ProxyChan-Background': '1' } });
+}
+
+// adminPost sends form-encoded params and returns '' on success or the
+// server's error text.
+async function adminPost(url, params = {}) {
+	try {
+		const res = await fetch(url, {
+			method: 'POST',
+			headers: {
+				'Content-Type': 'application/x-www-form-urlencoded',
+				'X-CSRF-Token': csrfToken(),
+			},
+			body: new URLSearchParams(params),
+		});
+		if (res.ok) return '';
+		return (await res.text()).trim() || `request failed (${res.status})`;
+	} catch (e) {
+		return String(e);
+	}
+}
+
+// adminPostJSON is adminPost for endpoints that answer with JSON. It
+// returns { data } on success or { err } with the server's error text.
+async function adminPostJSON(url, params = {}) {
+	try {
+		const res = await fetch(url, {
+			method: 'POST',
+			headers: {
+				'Content-Type': 'application/x-www-form-urlencoded',
+				'X-CSRF-Token': csrfToken(),
+			},
+			body: new URLSearchParams(params),
+		});
+		if (res.ok) return { data: await res.json() };
+		return { err: (await res.text()).trim() || `request failed (${res.status})` };
+	} catch (e) {
+		return { err: String(e) };
+	}
+}
+
+// actionButton runs fn after an optional confirmation and reports errors.
+function actionButton(label, question, fn) {
+	const btn = document.createElement('button');
+	btn.className = 'kill-btn';
+	btn.textContent = label;
+
+	btn.addEventListener('click', async (e) => {
+		// keep a surrounding <details> panel from toggling
+		e.preventDefault();
+		e.stopPropagation();
+
+		if (question && !confirm(question)) return;
+
+		const err = await fn();
+		if (err) alert(err);
+	});
+
+	return btn;
+}
+
+// Logout is a POST with the CSRF token, so another site can't end the
+// session with a plain link.
+for (const a of document.querySelectorAll('.logout-btn')) {
+	a.addEventListener('click', async (e) => {
+		e.preventDefault();
+		await adminPost('/logout');
+		location.href = '/login';
+	});
+}
+
+// The server enforces roles; this only hides what the logged-in role
+// can't use. Elements carry data-min-role="operator" or "admin" and the
+// body gets data-role once /me answers.
+async function loadRole() {
+	try {
+		const res = await fetch('/me');
+		if (!res.ok) return;
+		const me = await res.json();
+		document.body.dataset.role = me.role;
+	} catch (_) {
+		// silent
+	}
+}
+
+loadRole();
@@ -0,0 +1,56 @@
+let lastRecords = [];
+let searchValue = '';
+
+document.getElementById('search').addEventListener('input', (e) => {
+	searchValue = e.target.value.toLowerCase();
+	render();
+});
+
+async function fetchAudit() {
+	try {
+		const res = await pollFetch('/audit/list?limit=500');
+		if (!res.ok) return;
+
+		lastRecords = await res.json();
+		render();
+	} catch (_) {
+		// silent
+	}
+}
+
+function render() {
+	const container = document.getElementById('content');
+	container.innerHTML = '';
+
+	const matched = lastRecords.filter(r =>
+		r.actor.toLowerCase().includes(searchValue) ||
+		r.action.toLowerCase().includes(searchValue) ||
+		r.target.toLowerCase().includes(searchValue)
+	);
+
+	if (matched.length === 0) {
+		const div = document.createElement('div');
+		div.className = 'conn';
+		div.textContent = 'no audit records';
+		container.appendChild(div);
+		return;
+	}
+
+	for (const r of matched) {
+		const div = document.createElement('div');
+		div.className = 'conn';
+
+		let text =
+			`${new Date(r.at).toLocaleString()} ${r.actor} ${r.action} ${r.target}`;
+		if (r.old_value || r.new_value) {
+			text += ` [${r.old_value || '-'} -> ${r.new_value || '-'}]`;
+		}
+		div.textContent = text;
+
+		container.appendChild(div);
+	}
+}
+
+// polling
+fetchAudit();
+setInterval(fetchAudit, 10000);
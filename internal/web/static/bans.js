@@ -0,0 +1,61 @@
+let lastBans = [];
+let searchValue = '';
+
+document.getElementById('search').addEventListener('input', (e) => {
+	searchValue = e.target.value.toLowerCase();
+	render();
+});
+
+async function fetchBans() {
+	try {
+		const res = await pollFetch('/bans/list');
+		if (!res.ok) return;
+
+		lastBans = await res.json();
+		render();
+	} catch (_) {
+		// silent
+	}
+}
+
+function render() {
+	const container = document.getElementById('content');
+	container.innerHTML = '';
+
+	const matched = lastBans.filter(b =>
+		b.ip.toLowerCase().includes(searchValue) ||
+		b.reason.toLowerCase().includes(searchValue)
+	);
+
+	if (matched.length === 0) {
+		const div = document.createElement('div');
+		div.className = 'conn';
+		div.textContent = 'no active bans';
+		container.appendChild(div);
+		return;
+	}
+
+	for (const b of matched) {
+		const details = document.createElement('details');
+		details.open = true;
+
+		const summary = document.createElement('summary');
+		const leftSec = Math.max(0, Math.floor(
+			(new Date(b.expires_at) - Date.now()) / 1000
+		));
+		summary.textContent = `${b.ip} (expires in ${leftSec}s)`;
+		details.appendChild(summary);
+
+		const div = document.createElement('div');
+		div.className = 'conn';
+		div.textContent =
+			`REASON=${b.reason} HITS=${b.hits} SINCE=${new Date(b.created_at).toLocaleString()}`;
+		details.appendChild(div);
+
+		container.appendChild(details);
+	}
+}
+
+// polling
+fetchBans();
+setInterval(fetchBans, 5000);
@@ -1,80 +1,296 @@
+// The page loads a snapshot of the live tunnels, then follows the
+// event stream: open/close events add and remove single rows, "stats"
+// events refresh the counters in place, and deny/auth_fail/close events
+// go to the recent events list. Events that arrive while the snapshot is
+// loading are queued and applied after it.
+
 const panelState = new Map();
-let lastGroups = [];
+const conns = new Map();  // id -> connection
+const rows = new Map();   // id -> row element
+const groups = new Map(); // source ip -> { details, label }
 let searchValue = '';
+let pending = null;
+
+// ?user= and ?source= on the page narrow the stream too
+const pageQuery = new URLSearchParams(location.search);
+const streamQuery = new URLSearchParams({ background: '1' });
+for (const k of ['user', 'source']) {
+	if (pageQuery.get(k)) streamQuery.set(k, pageQuery.get(k));
+}
+
+const maxEventLog = 50;
 
 document.getElementById('search').addEventListener('input', (e) => {
 	searchValue = e.target.value.toLowerCase();
-	render();
+	for (const ip of groups.keys()) updateGroup(ip);
 });
 
-async function fetchConnections() {
+function connect() {
+	const es = new EventSource('/connections/events?' + streamQuery);
+
+	// "open" is both the EventSource connection event (no data) and our
+	// tunnel-opened event; every (re)connect starts from a fresh snapshot
+	es.addEventListener('open', (e) => {
+		if (e.data === undefined) {
+			loadSnapshot();
+			return;
+		}
+		queueOrApply(JSON.parse(e.data));
+	});
+	for (const type of ['close', 'deny', 'auth_fail']) {
+		es.addEventListener(type, (e) => queueOrApply(JSON.parse(e.data)));
+	}
+	es.addEventListener('stats', (e) => {
+		if (pending === null) applyStats(JSON.parse(e.data));
+	});
+	es.addEventListener('resync', () => loadSnapshot());
+}
+
+async function loadSnapshot() {
+	pending = [];
 	try {
-		const res = await fetch('/connections/by-ip');
+		const res = await pollFetch('/connections/by-ip');
 		if (!res.ok) return;
 
-		lastGroups = await res.json();
-		render();
+		const snapshot = await res.json();
+		clearAll();
+		// rows and groups are inserted on top, so add oldest first
+		for (const g of snapshot.slice().reverse()) {
+			for (const c of g.conns.slice().reverse()) {
+				if (matchesStream(c)) addConn(c);
+			}
+		}
+		for (const ip of groups.keys()) updateGroup(ip);
 	} catch (_) {
-		// silent
+		// silent; the stream reconnects and retries
+	} finally {
+		const queued = pending || [];
+		pending = null;
+		for (const ev of queued) applyEvent(ev);
 	}
 }
 
-function render() {
+function matchesStream(c) {
+	const user = streamQuery.get('user');
+	const source = streamQuery.get('source');
+	return (!user || c.username === user) && (!source || c.source_ip === source);
+}
+
+function queueOrApply(ev) {
+	if (pending !== null) {
+		pending.push(ev);
+		return;
+	}
+	applyEvent(ev);
+}
+
+function applyEvent(ev) {
+	switch (ev.type) {
+	case 'open':
+		if (!conns.has(ev.id)) {
+			addConn({
+				id: ev.id,
+				username: ev.username,
+				source_ip: ev.source_ip,
+				destination: ev.destination,
+				route: ev.route,
+				started_at: ev.at,
+				last_activity: ev.at,
+				bytes_up: 0,
+				bytes_down: 0,
+				up_bps: 0,
+				down_bps: 0,
+				dial_latency_ms: 0,
+			});
+			updateGroup(ev.source_ip);
+		}
+		break;
+	case 'close':
+		removeConn(ev.id);
+		logEvent(ev);
+		break;
+	default:
+		logEvent(ev);
+	}
+}
+
+function applyStats(list) {
+	for (const s of list) {
+		const c = conns.get(s.id);
+		if (!c) continue;
+		Object.assign(c, s);
+		if (!s.policy_violation) delete c.policy_violation;
+		updateRow(c);
+	}
+	for (const ip of groups.keys()) updateGroup(ip);
+}
+
+function clearAll() {
+	document.getElementById('content').innerHTML = '';
+	conns.clear();
+	rows.clear();
+	groups.clear();
+}
+
+function addConn(c) {
+	conns.set(c.id, c);
+
+	let g = groups.get(c.source_ip);
+	if (!g) g = addGroup(c.source_ip);
+
+	const div = document.createElement('div');
+	div.className = 'conn';
+	div.dataset.id = c.id;
+	rows.set(c.id, div);
+
+	// newest first, as in the snapshot
+	g.details.insertBefore(div, g.details.querySelector('.conn'));
+	updateRow(c);
+}
+
+function removeConn(id) {
+	const c = conns.get(id);
+	if (!c) return;
+
+	conns.delete(id);
+	rows.get(id)?.remove();
+	rows.delete(id);
+
+	const g = groups.get(c.source_ip);
+	if (g && !g.details.querySelector('.conn')) {
+		g.details.remove();
+		groups.delete(c.source_ip);
+		return;
+	}
+	updateGroup(c.source_ip);
+}
+
+function addGroup(ip) {
+	const details = document.createElement('details');
+	details.dataset.sourceIp = ip;
+	details.open = panelState.get(ip) ?? false;
+	details.addEventListener('toggle', () => {
+		panelState.set(ip, details.open);
+	});
+
+	const summary = document.createElement('summary');
+	const label = document.createElement('span');
+	summary.appendChild(label);
+	summary.appendChild(killButton(
+		'Kill all',
+		`Kill all connections from ${ip}?`,
+		`/connections/kill-source?ip=${encodeURIComponent(ip)}`
+	));
+	details.appendChild(summary);
+
+	// most recently active source first
 	const container = document.getElementById('content');
-	container.innerHTML = '';
+	container.insertBefore(details, container.firstChild);
+
+	const g = { details, label };
+	groups.set(ip, g);
+	return g;
+}
+
+function matchesSearch(c) {
+	return (
+		c.source_ip.toLowerCase().includes(searchValue) ||
+		(c.username || '').toLowerCase().includes(searchValue) ||
+		c.destination.toLowerCase().includes(searchValue)
+	);
+}
 
-	if (lastGroups.length === 0) return;
+// updateGroup applies the search to a source's rows and refreshes its
+// summary line.
+function updateGroup(ip) {
+	const g = groups.get(ip);
+	if (!g) return;
 
-	for (const g of lastGroups) {
-		// filter group + connections
-		const matchedConns = g.conns.filter(c => {
-			const user = (c.username || '').toLowerCase();
-			const dst = c.destination.toLowerCase();
+	let n = 0, up = 0, down = 0;
+	for (const div of g.details.querySelectorAll('.conn')) {
+		const c = conns.get(Number(div.dataset.id));
+		const match = c && matchesSearch(c);
+		div.hidden = !match;
+		if (!match) continue;
+		n++;
+		up += c.up_bps;
+		down += c.down_bps;
+	}
+
+	g.details.hidden = n === 0;
+	g.label.textContent =
+		`${ip} (${n} connections, ` +
+		`↑ ${formatBytes(up)}/s ↓ ${formatBytes(down)}/s) `;
+}
 
-			return (
-				g.source_ip.toLowerCase().includes(searchValue) ||
-				user.includes(searchValue) ||
-				dst.includes(searchValue)
-			);
-		});
+function updateRow(c) {
+	const div = rows.get(c.id);
+	if (!div) return;
 
-		if (matchedConns.length === 0) continue;
+	const ageSec = Math.max(0, Math.floor(
+		(Date.now() - new Date(c.started_at)) / 1000
+	));
+	const idleSec = Math.max(0, Math.floor(
+		(Date.now() - new Date(c.last_activity)) / 1000
+	));
+	const user = c.username || '-';
 
-		const details = document.createElement('details');
-		details.dataset.sourceIp = g.source_ip;
-		details.open = panelState.get(g.source_ip) ?? false;
+	div.textContent =
+		`ID=${c.id} USER=${user} DST=${c.destination} AGE=${ageSec}s IDLE=${idleSec}s ` +
+		`UP=${formatBytes(c.bytes_up)} (${formatBytes(c.up_bps)}/s) ` +
+		`DOWN=${formatBytes(c.bytes_down)} (${formatBytes(c.down_bps)}/s) ` +
+		`DIAL=${Math.round(c.dial_latency_ms)}ms ROUTE=${c.route} `;
 
-		details.addEventListener('toggle', () => {
-			panelState.set(g.source_ip, details.open);
-		});
+	div.classList.toggle('flagged', !!c.policy_violation);
+	if (c.policy_violation) {
+		div.textContent += `POLICY VIOLATION: ${c.policy_violation} `;
+	}
 
-		const summary = document.createElement('summary');
-		summary.textContent = `${g.source_ip} (${matchedConns.length} connections)`;
-		details.appendChild(summary);
+	div.appendChild(killButton(
+		'Kill',
+		`Kill connection ${c.id} to ${c.destination}?`,
+		`/connections/kill?id=${c.id}`
+	));
+}
 
-		for (const c of matchedConns) {
-			const div = document.createElement('div');
-			div.className = 'conn';
+function logEvent(ev) {
+	const list = document.getElementById('eventLog');
 
-			const ageSec = Math.floor(
-				(Date.now() - new Date(c.started_at)) / 1000
-			);
+	const li = document.createElement('li');
+	li.className = `event ${ev.type}`;
+	const at = new Date(ev.at).toLocaleTimeString();
+	const user = ev.username || '-';
+	let text = `${at} ${ev.type.toUpperCase()} USER=${user} SRC=${ev.source_ip}`;
+	if (ev.destination) text += ` DST=${ev.destination}`;
+	if (ev.type === 'close') {
+		text += ` UP=${formatBytes(ev.bytes_up || 0)} DOWN=${formatBytes(ev.bytes_down || 0)}`;
+	}
+	if (ev.reason) text += ` (${ev.reason})`;
+	li.textContent = text;
 
-			const user = c.username || '-';
+	list.insertBefore(li, list.firstChild);
+	while (list.children.length > maxEventLog) list.lastChild.remove();
+}
 
-			div.textContent =
-				`ID=${c.id} USER=${user} DST=${c.destination} AGE=${ageSec}s`;
+function killButton(label, question, url) {
+	// the close event removes the row
+	return actionButton(label, question, () => adminPost(url));
+}
 
-			details.appendChild(div);
-		}
+// binary units, matching the CLI
+function formatBytes(n) {
+	const unit = 1024;
+	if (n < unit) return `${n}B`;
 
-		container.appendChild(details);
+	let div = unit, exp = 0;
+	for (let v = Math.floor(n / unit); v >= unit; v = Math.floor(v / unit)) {
+		div *= unit;
+		exp++;
 	}
+	return `${(n / div).toFixed(1)}${'KMGTPE'[exp]}B`;
 }
 
-// polling
-fetchConnections();
-setInterval(fetchConnections, 2000);
+connect();
 
 // controls
 document.getElementById('openAll').addEventListener('click', () => {
@@ -0,0 +1,111 @@
+let lastPolicies = { whitelist: [], denylist: [] };
+let searchValue = '';
+
+document.getElementById('search').addEventListener('input', (e) => {
+	searchValue = e.target.value.toLowerCase();
+	render();
+});
+
+function submitRule(formId, url, field, action) {
+	document.getElementById(formId).addEventListener('submit', async (e) => {
+		e.preventDefault();
+		const form = e.target;
+
+		const err = await adminPost(url, { action, [field]: form[field].value });
+		if (err) {
+			alert(err);
+			return;
+		}
+
+		form.reset();
+		fetchPolicies();
+	});
+}
+
+submitRule('addWhitelist', '/policies/whitelist', 'cidr', 'allow');
+submitRule('addDenylist', '/policies/denylist', 'pattern', 'block');
+
+async function fetchPolicies() {
+	try {
+		const res = await pollFetch('/policies/list');
+		if (!res.ok) return;
+
+		lastPolicies = await res.json();
+		render();
+	} catch (_) {
+		// silent
+	}
+}
+
+function ruleAction(label, question, url, params) {
+	return actionButton(label, question, async () => {
+		const err = await adminPost(url, params);
+		fetchPolicies();
+		return err;
+	});
+}
+
+function renderList(id, rules, keyField, describe, buttons) {
+	const container = document.getElementById(id);
+	container.innerHTML = '';
+
+	const matched = rules.filter(r => r[keyField].toLowerCase().includes(searchValue));
+	if (matched.length === 0) {
+		const div = document.createElement('div');
+		div.className = 'conn';
+		div.textContent = 'no rules';
+		container.appendChild(div);
+		return;
+	}
+
+	for (const r of matched) {
+		const div = document.createElement('div');
+		div.className = 'conn';
+		if (!r.enabled) div.classList.add('disabled');
+		div.textContent = `${describe(r)} HITS=${r.hits} `;
+		for (const b of buttons(r)) div.appendChild(b);
+		container.appendChild(div);
+	}
+}
+
+function render() {
+	renderList(
+		'whitelist',
+		lastPolicies.whitelist,
+		'cidr',
+		r => `${r.cidr} (${r.enabled ? 'allowed' : 'disabled'})`,
+		r => {
+			const p = { cidr: r.cidr };
+			return [
+				r.enabled
+					? ruleAction('Disable', `Disable ${r.cidr}? Open tunnels from it will be re-checked.`,
+						'/policies/whitelist', { ...p, action: 'block' })
+					: ruleAction('Enable', null, '/policies/whitelist', { ...p, action: 'allow' }),
+				ruleAction('Delete', `Remove ${r.cidr} from the whitelist?`,
+					'/policies/whitelist', { ...p, action: 'delete' }),
+			];
+		}
+	);
+
+	renderList(
+		'denylist',
+		lastPolicies.denylist,
+		'pattern',
+		r => `${r.pattern} TYPE=${r.type} (${r.enabled ? 'blocked' : 'allowed'})`,
+		r => {
+			const p = { pattern: r.pattern };
+			return [
+				r.enabled
+					? ruleAction('Allow', null, '/policies/denylist', { ...p, action: 'allow' })
+					: ruleAction('Block', `Block ${r.pattern} again? Open tunnels to it will be re-checked.`,
+						'/policies/denylist', { ...p, action: 'block' }),
+				ruleAction('Delete', `Remove rule ${r.pattern}?`,
+					'/policies/denylist', { ...p, action: 'delete' }),
+			];
+		}
+	);
+}
+
+// polling
+fetchPolicies();
+setInterval(fetchPolicies, 5000);
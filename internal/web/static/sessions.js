@@ -0,0 +1,64 @@
+let lastSessions = [];
+let searchValue = '';
+
+document.getElementById('search').addEventListener('input', (e) => {
+	searchValue = e.target.value.toLowerCase();
+	render();
+});
+
+async function fetchSessions() {
+	try {
+		const res = await pollFetch('/sessions/list');
+		if (!res.ok) return;
+
+		lastSessions = await res.json();
+		render();
+	} catch (_) {
+		// silent
+	}
+}
+
+function render() {
+	const container = document.getElementById('content');
+	container.innerHTML = '';
+
+	const matched = lastSessions.filter(s =>
+		s.username.toLowerCase().includes(searchValue) ||
+		s.remote_ip.toLowerCase().includes(searchValue) ||
+		s.user_agent.toLowerCase().includes(searchValue)
+	);
+
+	for (const s of matched) {
+		const div = document.createElement('div');
+		div.className = 'conn';
+
+		const ends = Math.min(new Date(s.idle_expires_at), new Date(s.expires_at));
+		const leftMin = Math.max(0, Math.floor((ends - Date.now()) / 60000));
+
+		div.textContent =
+			`${s.current ? '(this session) ' : ''}${s.username} IP=${s.remote_ip} ` +
+			`SINCE=${new Date(s.created_at).toLocaleString()} ` +
+			`LAST=${new Date(s.last_seen).toLocaleString()} ` +
+			`EXPIRES IN ${leftMin}m AGENT=${s.user_agent || '-'} `;
+
+		div.appendChild(actionButton(
+			'Revoke',
+			s.current ? 'Revoke this session? You will be logged out.' : `Revoke session from ${s.remote_ip}?`,
+			async () => {
+				const err = await adminPost('/sessions/revoke', { id: s.id });
+				if (!err && s.current) {
+					location.href = '/login';
+					return '';
+				}
+				fetchSessions();
+				return err;
+			}
+		));
+
+		container.appendChild(div);
+	}
+}
+
+// polling
+fetchSessions();
+setInterval(fetchSessions, 5000);
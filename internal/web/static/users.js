@@ -0,0 +1,121 @@
+let lastUsers = [];
+let searchValue = '';
+
+document.getElementById('search').addEventListener('input', (e) => {
+	searchValue = e.target.value.toLowerCase();
+	render();
+});
+
+document.getElementById('addUser').addEventListener('submit', async (e) => {
+	e.preventDefault();
+	const form = e.target;
+
+	const err = await adminPost('/users/add', {
+		username: form.username.value,
+		password: form.password.value,
+		active: form.active.checked ? '1' : '',
+	});
+	if (err) {
+		alert(err);
+		return;
+	}
+
+	form.reset();
+	fetchUsers();
+});
+
+async function fetchUsers() {
+	try {
+		const res = await pollFetch('/users/list');
+		if (!res.ok) return;
+
+		lastUsers = await res.json();
+		render();
+	} catch (_) {
+		// silent
+	}
+}
+
+function userStatus(u) {
+	const parts = [u.active ? 'active' : 'inactive'];
+	if (u.blocked) parts.push('blocked');
+	if (u.locked_until) parts.push(`locked until ${new Date(u.locked_until).toLocaleString()}`);
+
+	const now = Date.now();
+	if (u.expires_at) {
+		const at = new Date(u.expires_at);
+		parts.push(at <= now ? 'expired' : `expires ${at.toLocaleString()}`);
+	}
+	if (u.password_expires_at && new Date(u.password_expires_at) <= now) {
+		parts.push('password expired');
+	}
+	return parts.join(', ');
+}
+
+// each action re-fetches so the list reflects what SQLite holds
+function userAction(label, question, url, params) {
+	return actionButton(label, question, async () => {
+		const err = await adminPost(url, params);
+		fetchUsers();
+		return err;
+	});
+}
+
+function render() {
+	const container = document.getElementById('content');
+	container.innerHTML = '';
+
+	const matched = lastUsers.filter(u =>
+		u.username.toLowerCase().includes(searchValue) ||
+		u.group.toLowerCase().includes(searchValue)
+	);
+
+	if (matched.length === 0) {
+		const div = document.createElement('div');
+		div.className = 'conn';
+		div.textContent = 'no users defined';
+		container.appendChild(div);
+		return;
+	}
+
+	for (const u of matched) {
+		const div = document.createElement('div');
+		div.className = 'conn';
+		if (!u.active || u.blocked) div.classList.add('flagged');
+
+		div.textContent =
+			`${u.username} GROUP=${u.group || '-'} (${userStatus(u)}) `;
+
+		const user = { user: u.username };
+		if (u.active) {
+			div.appendChild(userAction('Deactivate', null, '/users/deactivate', user));
+		} else {
+			div.appendChild(userAction('Activate', null, '/users/activate', user));
+		}
+
+		const reset = actionButton('Reset password', null, async () => {
+			const password = prompt(`New password for ${u.username}`);
+			if (!password) return '';
+			const err = await adminPost('/users/passwd', { user: u.username, password });
+			fetchUsers();
+			return err;
+		});
+		reset.dataset.minRole = 'admin';
+		div.appendChild(reset);
+
+		const del = userAction(
+			'Delete',
+			`Delete user ${u.username}? Open tunnels will be re-checked.`,
+			'/users/delete',
+			user
+		);
+		del.dataset.minRole = 'admin';
+		div.appendChild(del);
+
+		container.appendChild(div);
+	}
+}
+
+// polling
+fetchUsers();
+setInterval(fetchUsers, 5000);
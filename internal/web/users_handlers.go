@@ -0,0 +1,139 @@
+package web
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"proxychan/internal/system"
+)
+
+func usersHTMLHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+		html, err := staticFS.ReadFile("static/users.html")
+
+		if err != nil {
+			http.Error(w, "failed to load html", http.StatusInternalServerError)
+			return
+		}
+
+		w.Write(html)
+	}
+}
+
+func usersJSONHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		names, err := system.ListUsers(db)
+		if err != nil {
+			http.Error(w, "failed to load users", http.StatusInternalServerError)
+			return
+		}
+
+		out := make([]userView, 0, len(names))
+		for _, n := range names {
+			u, err := system.GetUserInfo(db, n)
+			if err != nil {
+				http.Error(w, "failed to load users", http.StatusInternalServerError)
+				return
+			}
+			out = append(out, newUserView(u))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	}
+}
+
+// addUserHandler is add-user; the account starts inactive unless
+// "active" is set, as with the CLI.
+func addUserHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		username := r.FormValue("username")
+		password := r.FormValue("password")
+		if !system.ValidUsername(username) {
+			http.Error(w, "username must be 1-255 characters without whitespace or ':'", http.StatusBadRequest)
+			return
+		}
+		if password == "" {
+			http.Error(w, "password cannot be empty", http.StatusBadRequest)
+			return
+		}
+
+		if err := system.AddUser(db, actorFor(r), username, password); err != nil {
+			httpSystemError(w, err)
+			return
+		}
+		if r.FormValue("active") == "1" {
+			if err := system.ActivateUser(db, actorFor(r), username); err != nil {
+				httpSystemError(w, err)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// userActionHandler runs a single-user command (activate, deactivate,
+// delete) for ?user=.
+func userActionHandler(db *sql.DB, action func(*sql.DB, system.Actor, string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		user := r.FormValue("user")
+		if user == "" {
+			http.Error(w, "missing user", http.StatusBadRequest)
+			return
+		}
+		if err := action(db, actorFor(r), user); err != nil {
+			httpSystemError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// passwdUserHandler is passwd-user.
+func passwdUserHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		user := r.FormValue("user")
+		password := r.FormValue("password")
+		if user == "" || password == "" {
+			http.Error(w, "missing user or password", http.StatusBadRequest)
+			return
+		}
+
+		if err := system.ChangePassword(db, actorFor(r), user, password); err != nil {
+			httpSystemError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}